@@ -4,6 +4,10 @@
 SET search_path TO public;
 
 -- Borramos tablas en orden inverso de dependencias
+DROP TABLE IF EXISTS routing_decision CASCADE;
+DROP TABLE IF EXISTS plan_asignacion CASCADE;
+DROP TABLE IF EXISTS batch_distribuidor CASCADE;
+DROP TABLE IF EXISTS regla_ruteo CASCADE;
 DROP TABLE IF EXISTS orden_vaciado CASCADE;
 DROP TABLE IF EXISTS salida_caja CASCADE;
 DROP TABLE IF EXISTS salida_sku CASCADE;
@@ -66,6 +70,11 @@ CREATE TABLE caja (
     dark                INTEGER      NOT NULL DEFAULT 0,
     color               VARCHAR(50)  NOT NULL,
     correlativo_pallet  VARCHAR(50),
+    cognex_id           INT,                  -- Cámara que leyó la caja
+    simbologia          VARCHAR(20),
+    grado_lectura       CHAR(1),              -- Grado ISO 15415 informado por la cámara (A, B, C, D, F)
+    puntaje_lectura     NUMERIC(3, 2),        -- A=4 ... F=0
+    tiempo_decodificacion_ms INT,
     CONSTRAINT fk_caja_pallet FOREIGN KEY (correlativo_pallet)
         REFERENCES pallet (correlativo) ON DELETE CASCADE,
     CONSTRAINT fk_caja_sku FOREIGN KEY (calibre, variedad, embalaje, dark)
@@ -76,6 +85,7 @@ CREATE INDEX idx_caja_variedad ON caja (variedad);
 CREATE INDEX idx_caja_calibre ON caja (calibre);
 CREATE INDEX idx_caja_embalaje ON caja (embalaje);
 CREATE INDEX idx_caja_correlativo_pallet ON caja (correlativo_pallet);
+CREATE INDEX idx_caja_cognex_fecha ON caja (cognex_id, fecha_embalaje) WHERE grado_lectura IS NOT NULL;
 
 -- =======================
 -- Sorter
@@ -157,6 +167,13 @@ CREATE TABLE salida_caja (
     llena           BOOLEAN NOT NULL DEFAULT FALSE,
     fecha_salida     TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     id_fabricacion   INT,
+    id_salida_original INT,                  -- Salida prevista para la caja (solo si hubo desborde)
+    id_salida_destino  INT,                  -- Salida donde terminó la caja (solo si hubo desborde)
+    salto              SMALLINT NOT NULL DEFAULT 0, -- Posición en la cadena de desborde (0 = salida prevista)
+    tracking_plc       INT,                  -- Número de seguimiento asignado por el PLC al desviar la caja (uint16)
+    estado_desvio      VARCHAR(20),          -- Confirmación física: confirmado, mal_desviado, perdido, no_comandado (NULL = sin confirmar)
+    lane_confirmada    SMALLINT,             -- Salida física donde el PLC confirmó la caja
+    fecha_confirmacion TIMESTAMPTZ,
     CONSTRAINT pk_salida_caja PRIMARY KEY (correlativo_caja, id_salida),
     CONSTRAINT fk_salida_caja_caja FOREIGN KEY (correlativo_caja)
         REFERENCES caja (correlativo) ON DELETE CASCADE,
@@ -168,6 +185,8 @@ CREATE TABLE salida_caja (
 CREATE INDEX idx_salida_caja_salida ON salida_caja (id_salida);
 CREATE INDEX idx_salida_caja_fabricacion ON salida_caja (id_fabricacion);
 CREATE INDEX idx_salida_caja_fecha ON salida_caja (fecha_salida);
+CREATE INDEX idx_salida_caja_tracking_plc ON salida_caja (tracking_plc, fecha_salida DESC) WHERE tracking_plc IS NOT NULL;
+CREATE INDEX idx_salida_caja_estado_desvio ON salida_caja (estado_desvio, fecha_salida DESC) WHERE estado_desvio IN ('mal_desviado', 'perdido');
 
 -- =======================
 -- Orden de Vaciado
@@ -187,6 +206,88 @@ CREATE INDEX idx_orden_vaciado_mesa ON orden_vaciado (idmesa);
 CREATE INDEX idx_orden_vaciado_fabricacion ON orden_vaciado (id_fabricacion_activa);
 CREATE INDEX idx_orden_vaciado_fecha ON orden_vaciado (fecha_envio);
 
+-- =======================
+-- Reglas de ruteo por atributos
+-- =======================
+CREATE TABLE regla_ruteo (
+    id                  INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sorter_id           INT NOT NULL,
+    salida_id           INT NOT NULL,
+    prioridad           INT NOT NULL DEFAULT 0,
+    variedades          TEXT[] NOT NULL DEFAULT '{}',  -- vacío = cualquiera
+    calibres            TEXT[] NOT NULL DEFAULT '{}',
+    embalajes           TEXT[] NOT NULL DEFAULT '{}',
+    dark                INTEGER,                       -- NULL = cualquiera
+    activa              BOOLEAN NOT NULL DEFAULT TRUE,
+    descripcion         VARCHAR(255),
+    fecha_creacion      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    fecha_actualizacion TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_regla_ruteo_sorter FOREIGN KEY (sorter_id)
+        REFERENCES sorter (id) ON DELETE CASCADE,
+    CONSTRAINT fk_regla_ruteo_salida FOREIGN KEY (salida_id)
+        REFERENCES salida (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_regla_ruteo_sorter ON regla_ruteo (sorter_id, prioridad DESC);
+
+-- =======================
+-- Estado del balance por batch (round-robin por SKU)
+-- =======================
+CREATE TABLE batch_distribuidor (
+    sorter_id           INT NOT NULL,
+    sku                 VARCHAR(255) NOT NULL,
+    salidas             INT[] NOT NULL DEFAULT '{}',
+    current_index       INT NOT NULL DEFAULT 0,
+    current_count       INT NOT NULL DEFAULT 0,
+    fecha_actualizacion TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pk_batch_distribuidor PRIMARY KEY (sorter_id, sku),
+    CONSTRAINT fk_batch_distribuidor_sorter FOREIGN KEY (sorter_id)
+        REFERENCES sorter (id) ON DELETE CASCADE
+);
+
+-- =======================
+-- Planes de asignación programados (cambios de turno / campaña)
+-- =======================
+CREATE TABLE plan_asignacion (
+    id                  INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sorter_id           INT NOT NULL,
+    nombre              VARCHAR(100) NOT NULL,
+    descripcion         VARCHAR(255),
+    ejecutar_en         TIMESTAMPTZ,                   -- Ejecución única en fecha/hora
+    turno               VARCHAR(50),                   -- Ejecución al inicio de cada turno (config.yaml: shifts)
+    items               JSONB NOT NULL DEFAULT '[]',   -- [{salida_id, sku_ids, limpiar}]
+    activo              BOOLEAN NOT NULL DEFAULT TRUE,
+    ultima_ejecucion    TIMESTAMPTZ,
+    ultimo_resultado    TEXT,
+    fecha_creacion      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    fecha_actualizacion TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_plan_asignacion_disparador CHECK ((ejecutar_en IS NULL) <> (turno IS NULL)),
+    CONSTRAINT fk_plan_asignacion_sorter FOREIGN KEY (sorter_id)
+        REFERENCES sorter (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_plan_asignacion_sorter ON plan_asignacion (sorter_id, activo);
+
+-- =======================
+-- Auditoría de decisiones de ruteo (una fila por caja)
+-- =======================
+CREATE TABLE routing_decision (
+    id                  BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sorter_id           INT NOT NULL,
+    correlativo         VARCHAR(50),
+    sku                 VARCHAR(255),
+    exitosa             BOOLEAN NOT NULL,            -- Lectura exitosa (false = NO_READ / formato / BD)
+    razon               VARCHAR(50) NOT NULL,        -- sku_asignado, regla, sin_asignacion, salidas_no_disponibles, no_read...
+    estrategia          VARCHAR(50),
+    candidatas          JSONB NOT NULL DEFAULT '[]', -- [{salida_id, estado, bloqueo, disponible}]
+    batch_index         INT,
+    reglas              INT[] NOT NULL DEFAULT '{}',
+    salida_id           INT,                         -- Salida decidida (NULL = ninguna)
+    salida_final_id     INT,                         -- Salida confirmada por el PLC (tras reintentos)
+    plc_intentos        JSONB NOT NULL DEFAULT '[]', -- [{salida_id, latencia_ms, error}]
+    plc_error           TEXT,
+    fecha               TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_routing_decision_correlativo ON routing_decision (correlativo);
+CREATE INDEX idx_routing_decision_sorter_fecha ON routing_decision (sorter_id, fecha DESC);
 
 COMMENT ON TABLE sku IS 'Catálogo de productos SKU con calibre, variedad y embalaje';
 COMMENT ON TABLE pallet IS 'Registro de pallets con su correlativo y fecha de creación';
@@ -198,6 +299,10 @@ COMMENT ON TABLE orden_fabricacion IS 'Órdenes de fabricación con detalles de
 COMMENT ON TABLE salida_caja IS 'Registro de cajas procesadas por cada salida';
 COMMENT ON TABLE codigoenvase IS 'Catálogo de códigos de envases disponibles';
 COMMENT ON TABLE orden_vaciado IS 'Órdenes de vaciado de mesas';
+COMMENT ON TABLE regla_ruteo IS 'Reglas de ruteo por atributos de SKU (variedad/calibre/embalaje/dark) con prioridad';
+COMMENT ON TABLE batch_distribuidor IS 'Estado persistido del balance round-robin por SKU (índice y conteo del batch en curso)';
+COMMENT ON TABLE plan_asignacion IS 'Planes de asignación SKU→salida programados por fecha o inicio de turno';
+COMMENT ON TABLE routing_decision IS 'Auditoría por caja de la decisión de ruteo: candidatas, razón, balance y envío al PLC';
 
 -- Crear una secuencia para el correlativo
 CREATE SEQUENCE IF NOT EXISTS caja_correlativo_seq
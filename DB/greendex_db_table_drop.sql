@@ -1,3 +1,7 @@
+DROP TABLE IF EXISTS routing_decision;
+DROP TABLE IF EXISTS plan_asignacion;
+DROP TABLE IF EXISTS batch_distribuidor;
+DROP TABLE IF EXISTS regla_ruteo;
 DROP TABLE IF EXISTS orden_vaciado;
 DROP TABLE IF EXISTS salida_caja;
 DROP TABLE IF EXISTS orden_fabricacion;
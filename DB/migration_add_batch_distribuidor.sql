@@ -0,0 +1,21 @@
+-- ============================================================================
+-- Migración: Agregar tabla 'batch_distribuidor'
+-- Fecha: 2026-10-16
+-- Descripción: Persiste el estado del balance round-robin por SKU para retomarlo tras un reinicio
+-- ============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS batch_distribuidor (
+    sorter_id           INT NOT NULL,
+    sku                 VARCHAR(255) NOT NULL,
+    salidas             INT[] NOT NULL DEFAULT '{}',
+    current_index       INT NOT NULL DEFAULT 0,
+    current_count       INT NOT NULL DEFAULT 0,
+    fecha_actualizacion TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pk_batch_distribuidor PRIMARY KEY (sorter_id, sku),
+    CONSTRAINT fk_batch_distribuidor_sorter FOREIGN KEY (sorter_id)
+        REFERENCES sorter (id) ON DELETE CASCADE
+);
+
+COMMIT;
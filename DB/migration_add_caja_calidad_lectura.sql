@@ -0,0 +1,18 @@
+-- ============================================================================
+-- Migración: Agregar columnas de calidad de lectura a tabla 'caja'
+-- Fecha: 2026-10-16
+-- Descripción: Cámara que leyó la caja, simbología, grado ISO 15415 y tiempo de decodificación
+--              informados por la cámara (read_trailer en cognex_devices)
+-- ============================================================================
+
+BEGIN;
+
+ALTER TABLE caja ADD COLUMN IF NOT EXISTS cognex_id INT;
+ALTER TABLE caja ADD COLUMN IF NOT EXISTS simbologia VARCHAR(20);
+ALTER TABLE caja ADD COLUMN IF NOT EXISTS grado_lectura CHAR(1);           -- A, B, C, D o F
+ALTER TABLE caja ADD COLUMN IF NOT EXISTS puntaje_lectura NUMERIC(3, 2);   -- A=4 ... F=0
+ALTER TABLE caja ADD COLUMN IF NOT EXISTS tiempo_decodificacion_ms INT;
+
+CREATE INDEX IF NOT EXISTS idx_caja_cognex_fecha ON caja (cognex_id, fecha_embalaje) WHERE grado_lectura IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- ============================================================================
+-- Migración: Agregar tabla 'plan_asignacion'
+-- Fecha: 2026-10-16
+-- Descripción: Planes de asignación SKU→salida que se aplican automáticamente en una fecha o al inicio de un turno
+-- ============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS plan_asignacion (
+    id                  INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sorter_id           INT NOT NULL,
+    nombre              VARCHAR(100) NOT NULL,
+    descripcion         VARCHAR(255),
+    ejecutar_en         TIMESTAMPTZ,                   -- Ejecución única en fecha/hora
+    turno               VARCHAR(50),                   -- Ejecución al inicio de cada turno (config.yaml: shifts)
+    items               JSONB NOT NULL DEFAULT '[]',   -- [{salida_id, sku_ids, limpiar}]
+    activo              BOOLEAN NOT NULL DEFAULT TRUE,
+    ultima_ejecucion    TIMESTAMPTZ,
+    ultimo_resultado    TEXT,
+    fecha_creacion      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    fecha_actualizacion TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_plan_asignacion_disparador CHECK ((ejecutar_en IS NULL) <> (turno IS NULL)),
+    CONSTRAINT fk_plan_asignacion_sorter FOREIGN KEY (sorter_id)
+        REFERENCES sorter (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_plan_asignacion_sorter ON plan_asignacion (sorter_id, activo);
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- ============================================================================
+-- Migración: Agregar tabla 'regla_ruteo'
+-- Fecha: 2026-10-16
+-- Descripción: Reglas de ruteo por atributos del SKU con comodines y prioridad,
+--              evaluadas cuando el SKU no tiene asignación explícita en salida_sku
+-- ============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS regla_ruteo (
+    id                  INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sorter_id           INT NOT NULL,
+    salida_id           INT NOT NULL,
+    prioridad           INT NOT NULL DEFAULT 0,
+    variedades          TEXT[] NOT NULL DEFAULT '{}',  -- vacío = cualquiera
+    calibres            TEXT[] NOT NULL DEFAULT '{}',
+    embalajes           TEXT[] NOT NULL DEFAULT '{}',
+    dark                INTEGER,                       -- NULL = cualquiera
+    activa              BOOLEAN NOT NULL DEFAULT TRUE,
+    descripcion         VARCHAR(255),
+    fecha_creacion      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    fecha_actualizacion TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_regla_ruteo_sorter FOREIGN KEY (sorter_id)
+        REFERENCES sorter (id) ON DELETE CASCADE,
+    CONSTRAINT fk_regla_ruteo_salida FOREIGN KEY (salida_id)
+        REFERENCES salida (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_regla_ruteo_sorter ON regla_ruteo (sorter_id, prioridad DESC);
+
+COMMENT ON TABLE regla_ruteo IS 'Reglas de ruteo por atributos de SKU (variedad/calibre/embalaje/dark) con prioridad';
+
+COMMIT;
@@ -0,0 +1,29 @@
+-- ============================================================================
+-- Migración: Agregar tabla 'routing_decision'
+-- Fecha: 2026-10-16
+-- Descripción: Registro de auditoría de la decisión de ruteo de cada caja (candidatas, razón, reintentos PLC)
+-- ============================================================================
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS routing_decision (
+    id                  BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sorter_id           INT NOT NULL,
+    correlativo         VARCHAR(50),
+    sku                 VARCHAR(255),
+    exitosa             BOOLEAN NOT NULL,            -- Lectura exitosa (false = NO_READ / formato / BD)
+    razon               VARCHAR(50) NOT NULL,        -- sku_asignado, regla, sin_asignacion, salidas_no_disponibles, no_read...
+    estrategia          VARCHAR(50),
+    candidatas          JSONB NOT NULL DEFAULT '[]', -- [{salida_id, estado, bloqueo, disponible}]
+    batch_index         INT,
+    reglas              INT[] NOT NULL DEFAULT '{}',
+    salida_id           INT,                         -- Salida decidida (NULL = ninguna)
+    salida_final_id     INT,                         -- Salida confirmada por el PLC (tras reintentos)
+    plc_intentos        JSONB NOT NULL DEFAULT '[]', -- [{salida_id, latencia_ms, error}]
+    plc_error           TEXT,
+    fecha               TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_routing_decision_correlativo ON routing_decision (correlativo);
+CREATE INDEX IF NOT EXISTS idx_routing_decision_sorter_fecha ON routing_decision (sorter_id, fecha DESC);
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- ============================================================================
+-- Migración: Agregar confirmación física del desvío a tabla 'salida_caja'
+-- Fecha: 2026-10-16
+-- Descripción: Resultado de relacionar la confirmación del PLC (por tracking) con la caja asignada:
+--              confirmado, mal_desviado (confirmada en otra salida) o perdido (sin confirmación)
+-- ============================================================================
+
+BEGIN;
+
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS estado_desvio VARCHAR(20);
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS lane_confirmada SMALLINT;
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS fecha_confirmacion TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_salida_caja_estado_desvio ON salida_caja (estado_desvio, fecha_salida DESC)
+    WHERE estado_desvio IN ('mal_desviado', 'perdido');
+
+COMMIT;
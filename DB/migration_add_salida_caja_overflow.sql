@@ -0,0 +1,13 @@
+-- ============================================================================
+-- Migración: Agregar columnas de desborde a tabla 'salida_caja'
+-- Fecha: 2026-10-16
+-- Descripción: Registra cada salto de la cadena de desborde (overflow) con la salida prevista y la real
+-- ============================================================================
+
+BEGIN;
+
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS id_salida_original INT;
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS id_salida_destino INT;
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS salto SMALLINT NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- ============================================================================
+-- Migración: Agregar número de seguimiento del PLC a tabla 'salida_caja'
+-- Fecha: 2026-10-16
+-- Descripción: Guarda el tracking (uint16) que retorna el método del sorter al asignar la salida,
+--              para relacionar lo que informa el PLC con la etiqueta leída
+-- ============================================================================
+
+BEGIN;
+
+ALTER TABLE salida_caja ADD COLUMN IF NOT EXISTS tracking_plc INT;
+CREATE INDEX IF NOT EXISTS idx_salida_caja_tracking_plc ON salida_caja (tracking_plc, fecha_salida DESC)
+    WHERE tracking_plc IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"API-GREENEX/internal/config"
+	"API-GREENEX/internal/models"
+)
+
+// Reproduce tráfico Cognex grabado contra una instancia de la API (modo server de las cámaras).
+// Acepta grabaciones JSON lines de record_path y logs de journald con líneas "📦 Mensaje recibido de ...".
+//
+// Uso:
+//
+//	go run ./cmd/cognex-replay -config config/config.yaml logs/cognex-1.jsonl
+//	go run ./cmd/cognex-replay -target localhost:9050 -speed 2 docs/Tren-cajas.txt
+//	go run ./cmd/cognex-replay -map 192.168.121.50=localhost:9050,2=localhost:9051 captura.txt
+
+const (
+	marcaMensaje = "📦 Mensaje recibido de "
+	formatoLogTs = "2006-01-02T15:04:05.000000" // Formato de logTs en listeners
+	formatoLog   = "2006/01/02 15:04:05"        // Prefijo estándar de log
+)
+
+var reLogTs = regexp.MustCompile(`\[(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6})\]`)
+
+// destino es una conexión TCP hacia un puerto de la instancia
+type destino struct {
+	addr    string
+	conn    net.Conn
+	tramas  int
+	acks    int64
+	nacks   int64
+	errores int
+}
+
+func main() {
+	configPath := flag.String("config", "", "config.yaml para resolver cognex_id → puerto de la instancia")
+	host := flag.String("host", "127.0.0.1", "Host de la instancia (con -config)")
+	target := flag.String("target", "", "Destino por defecto (host:puerto) para tramas sin mapeo")
+	mapping := flag.String("map", "", "Mapeo explícito cognex_id|ip_camara=host:puerto, separado por comas")
+	speed := flag.Float64("speed", 1, "Factor de velocidad (2 = doble de rápido, 0 = sin esperas)")
+	delimiter := flag.String("delimiter", "crlf", "Fin de trama al enviar: crlf | cr | lf | etx")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Uso: cognex-replay [opciones] archivo...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	fin, err := terminador(*delimiter)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	rutas, err := cargarMapeo(*mapping, *configPath, *host)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	var registros []models.CognexTrafficRecord
+	for _, archivo := range flag.Args() {
+		leidos, err := leerArchivo(archivo)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		log.Printf("📄 %s: %d trama(s)", archivo, len(leidos))
+		registros = append(registros, leidos...)
+	}
+	if len(registros) == 0 {
+		log.Fatalf("❌ No se encontraron tramas en los archivos")
+	}
+	sort.SliceStable(registros, func(i, j int) bool {
+		return registros[i].Timestamp.Before(registros[j].Timestamp)
+	})
+
+	// Resolver destinos antes de empezar para no fallar a mitad de la reproducción
+	destinos := make(map[string]*destino)
+	asignados := make([]*destino, len(registros))
+	for i, reg := range registros {
+		addr := resolverDestino(reg, rutas, *target)
+		if addr == "" {
+			log.Fatalf("❌ Sin destino para la trama de cognex_id=%d remote=%s (use -target, -map o -config)", reg.CognexID, reg.Remote)
+		}
+		if destinos[addr] == nil {
+			destinos[addr] = &destino{addr: addr}
+		}
+		asignados[i] = destinos[addr]
+	}
+
+	duracion := registros[len(registros)-1].Timestamp.Sub(registros[0].Timestamp)
+	log.Printf("▶️  Reproduciendo %d trama(s) en %d destino(s) | duración original %v | velocidad x%g",
+		len(registros), len(destinos), duracion.Round(time.Millisecond), *speed)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	inicio := time.Now()
+	t0 := registros[0].Timestamp
+	for i, reg := range registros {
+		if *speed > 0 {
+			objetivo := inicio.Add(time.Duration(float64(reg.Timestamp.Sub(t0)) / *speed))
+			select {
+			case <-sigChan:
+				log.Println("🛑 Reproducción interrumpida")
+				resumen(destinos)
+				return
+			case <-time.After(time.Until(objetivo)):
+			}
+		}
+
+		d := asignados[i]
+		if err := d.enviar(reg.Frame + fin); err != nil {
+			d.errores++
+			log.Printf("❌ #%d → %s: %v", i+1, d.addr, err)
+			continue
+		}
+		log.Printf("📤 #%-4d → %s | cognex_id=%d | %q", i+1, d.addr, reg.CognexID, reg.Frame)
+	}
+
+	// Esperar los últimos ACK
+	time.Sleep(500 * time.Millisecond)
+	resumen(destinos)
+}
+
+// terminador traduce el nombre del delimitador a los bytes que se agregan a cada trama
+func terminador(nombre string) (string, error) {
+	switch strings.ToLower(nombre) {
+	case "crlf", "":
+		return "\r\n", nil
+	case "cr":
+		return "\r", nil
+	case "lf":
+		return "\n", nil
+	case "etx":
+		return "\x03", nil
+	default:
+		return "", fmt.Errorf("delimitador no soportado: %s", nombre)
+	}
+}
+
+// cargarMapeo combina los puertos de config.yaml (cognex_id → host:port) con el mapeo explícito
+func cargarMapeo(mapping, configPath, host string) (map[string]string, error) {
+	rutas := make(map[string]string)
+
+	if configPath != "" {
+		cfg, err := config.LoadConfig(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("error al cargar config: %w", err)
+		}
+		for _, dev := range cfg.CognexDevices {
+			rutas[strconv.Itoa(dev.ID)] = net.JoinHostPort(host, strconv.Itoa(dev.Port))
+		}
+	}
+
+	for _, par := range strings.Split(mapping, ",") {
+		par = strings.TrimSpace(par)
+		if par == "" {
+			continue
+		}
+		clave, addr, ok := strings.Cut(par, "=")
+		if !ok || clave == "" || addr == "" {
+			return nil, fmt.Errorf("mapeo inválido '%s' (esperado clave=host:puerto)", par)
+		}
+		rutas[clave] = addr
+	}
+	return rutas, nil
+}
+
+// resolverDestino busca el destino por cognex_id, luego por IP de la cámara y por último el default
+func resolverDestino(reg models.CognexTrafficRecord, rutas map[string]string, target string) string {
+	if reg.CognexID > 0 {
+		if addr, ok := rutas[strconv.Itoa(reg.CognexID)]; ok {
+			return addr
+		}
+	}
+	if ip, _, err := net.SplitHostPort(reg.Remote); err == nil {
+		if addr, ok := rutas[ip]; ok {
+			return addr
+		}
+	}
+	return target
+}
+
+// leerArchivo lee una grabación JSON lines o un log de la API
+func leerArchivo(archivo string) ([]models.CognexTrafficRecord, error) {
+	f, err := os.Open(archivo)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir %s: %w", archivo, err)
+	}
+	defer f.Close()
+
+	var registros []models.CognexTrafficRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	linea := 0
+	for scanner.Scan() {
+		linea++
+		texto := scanner.Text()
+
+		if strings.HasPrefix(texto, "{") {
+			var reg models.CognexTrafficRecord
+			if err := json.Unmarshal([]byte(texto), &reg); err != nil {
+				return nil, fmt.Errorf("%s:%d: registro inválido: %w", archivo, linea, err)
+			}
+			registros = append(registros, reg)
+			continue
+		}
+
+		if reg, ok := parsearLineaLog(texto); ok {
+			registros = append(registros, reg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error al leer %s: %w", archivo, err)
+	}
+	return registros, nil
+}
+
+// parsearLineaLog extrae la trama de una línea "📦 Mensaje recibido de <ip:puerto>: <trama>".
+// El timestamp se toma de logTs (microsegundos), del prefijo de journald o del prefijo de log.
+func parsearLineaLog(texto string) (models.CognexTrafficRecord, bool) {
+	idx := strings.Index(texto, marcaMensaje)
+	if idx < 0 {
+		return models.CognexTrafficRecord{}, false
+	}
+	remote, frame, ok := strings.Cut(texto[idx+len(marcaMensaje):], ": ")
+	if !ok {
+		return models.CognexTrafficRecord{}, false
+	}
+
+	reg := models.CognexTrafficRecord{Remote: remote, Frame: frame}
+	prefijo := texto[:idx]
+
+	if m := reLogTs.FindStringSubmatch(prefijo); m != nil {
+		if ts, err := time.ParseInLocation(formatoLogTs, m[1], time.Local); err == nil {
+			reg.Timestamp = ts
+			return reg, true
+		}
+	}
+	if campo, _, _ := strings.Cut(prefijo, " "); campo != "" {
+		if ts, err := time.Parse(time.RFC3339Nano, campo); err == nil {
+			reg.Timestamp = ts
+			return reg, true
+		}
+	}
+	if len(prefijo) >= len(formatoLog) {
+		if ts, err := time.ParseInLocation(formatoLog, prefijo[:len(formatoLog)], time.Local); err == nil {
+			reg.Timestamp = ts
+			return reg, true
+		}
+	}
+	return models.CognexTrafficRecord{}, false
+}
+
+// enviar escribe la trama, conectando (o reconectando una vez) si hace falta
+func (d *destino) enviar(trama string) error {
+	for intento := 0; intento < 2; intento++ {
+		if d.conn == nil {
+			conn, err := net.DialTimeout("tcp", d.addr, 3*time.Second)
+			if err != nil {
+				return fmt.Errorf("error al conectar: %w", err)
+			}
+			d.conn = conn
+			go d.leerRespuestas(conn)
+			log.Printf("✅ Conectado a %s", d.addr)
+		}
+
+		if _, err := d.conn.Write([]byte(trama)); err != nil {
+			d.conn.Close()
+			d.conn = nil
+			continue
+		}
+		d.tramas++
+		return nil
+	}
+	return fmt.Errorf("error al enviar a %s", d.addr)
+}
+
+// leerRespuestas cuenta los ACK/NACK de la instancia para el resumen final
+func (d *destino) leerRespuestas(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "ACK":
+			atomic.AddInt64(&d.acks, 1)
+		case "NACK":
+			atomic.AddInt64(&d.nacks, 1)
+		}
+	}
+}
+
+// resumen imprime lo enviado por destino y cierra las conexiones
+func resumen(destinos map[string]*destino) {
+	log.Println("")
+	log.Println("📊 Resumen:")
+	for _, d := range destinos {
+		log.Printf("   %s → %d enviadas | ACK: %d | NACK: %d | errores: %d",
+			d.addr, d.tramas, atomic.LoadInt64(&d.acks), atomic.LoadInt64(&d.nacks), d.errores)
+		if d.conn != nil {
+			d.conn.Close()
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"API-GREENEX/internal/config"
 	"API-GREENEX/internal/db"
 	"API-GREENEX/internal/flow"
+	"API-GREENEX/internal/journal"
 	"API-GREENEX/internal/listeners"
 	"API-GREENEX/internal/models"
 	"API-GREENEX/internal/monitoring"
@@ -65,6 +66,11 @@ func main() {
 	}
 	log.Printf("✅ Configuración cargada desde: %s", configPath)
 
+	shiftStarts, err := cfg.GetShiftStarts()
+	if err != nil {
+		log.Fatalf("❌ Configuración de turnos inválida: %v", err)
+	}
+
 	// Inicializar la conexión a PostgreSQL usando config YAML
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
@@ -86,6 +92,30 @@ func main() {
 	defer dbManager.Close()
 	log.Println("✅ Base de datos PostgreSQL inicializada correctamente")
 
+	// Registro local de cajas para seguir desviando si PostgreSQL se cae
+	var boxJournal *journal.BoxJournal
+	var journalReconciler *journal.Reconciler
+	if journalCfg := cfg.Database.Postgres.Journal; journalCfg != nil {
+		reconcileInterval, err := journalCfg.GetReconcileIntervalDuration()
+		if err != nil {
+			log.Fatalf("❌ database.postgres.journal.reconcile_interval inválido: %v", err)
+		}
+		boxJournal, err = journal.Open(journalCfg.Path)
+		if err != nil {
+			log.Fatalf("❌ Error al abrir registro de cajas: %v", err)
+		}
+		defer boxJournal.Close()
+
+		// Precargar nombres de variedad: sin BD el SKU se construye con los nombres en memoria
+		if _, err := dbManager.GetAllVariedades(ctx); err != nil {
+			log.Printf("⚠️  No se pudieron precargar variedades para el registro de cajas: %v", err)
+		}
+
+		journalReconciler = journal.NewReconciler(boxJournal, dbManager, reconcileInterval)
+		go journalReconciler.Run(context.Background())
+		log.Printf("✅ Registro de cajas sin BD: %s (reconciliación cada %s)", journalCfg.Path, reconcileInterval)
+	}
+
 	// Inicializar FX6Manager para lecturas DataMatrix
 	log.Println("")
 	log.Println("📊 Inicializando conexión a SQL Server FX6...")
@@ -127,6 +157,9 @@ func main() {
 
 	httpService := listeners.NewHTTPFrontend(httpAddr)
 	httpService.SetPostgresManager(dbManager)
+	if journalReconciler != nil {
+		httpService.SetBoxJournal(journalReconciler)
+	}
 
 	// Vincular SKUManager si está disponible para endpoints de streaming
 	if skuManager != nil {
@@ -146,6 +179,30 @@ func main() {
 	log.Println("")
 	log.Printf("📷 Configurando %d dispositivo(s) Cognex...", len(cfg.CognexDevices))
 	var cognexListeners []*listeners.CognexListener
+	recorders := make(map[string]*listeners.TrafficRecorder) // Grabaciones de tráfico por archivo (compartidas entre cámaras)
+	recorderFor := func(cognexCfg config.CognexDevice) *listeners.TrafficRecorder {
+		if cognexCfg.RecordPath == "" {
+			return nil
+		}
+		recorder, ok := recorders[cognexCfg.RecordPath]
+		if !ok {
+			var err error
+			recorder, err = listeners.NewTrafficRecorder(cognexCfg.RecordPath, cognexCfg.RecordMaxSizeMB, cognexCfg.RecordMaxFiles)
+			if err != nil {
+				log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+			}
+			recorders[cognexCfg.RecordPath] = recorder
+		}
+		return recorder
+	}
+	commandClientFor := func(cognexCfg config.CognexDevice) *listeners.CognexCommandClient {
+		ctrl := cognexCfg.Control
+		host := ctrl.Host
+		if host == "" {
+			host = cognexCfg.Host
+		}
+		return listeners.NewCognexCommandClient(host, ctrl.Port, ctrl.User, ctrl.Password, time.Duration(ctrl.TimeoutMs)*time.Millisecond)
+	}
 
 	for _, cognexCfg := range cfg.CognexDevices {
 		log.Println("  ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -161,6 +218,56 @@ func main() {
 			cognexCfg.ScanMethod,
 			dbManager,
 		)
+		if err := cognexListener.SetPayloadTemplate(cognexCfg.GetPayloadTemplate()); err != nil {
+			log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+		}
+		if err := cognexListener.SetFraming(cognexCfg.FrameDelimiter, cognexCfg.MaxFrameLength, time.Duration(cognexCfg.PartialTimeoutMs)*time.Millisecond, cognexCfg.FlushOnTimeout); err != nil {
+			log.Fatalf("❌ Cognex #%d: Configuración de tramas inválida: %v", cognexCfg.ID, err)
+		}
+		if err := cognexListener.SetMode(cognexCfg.Mode, time.Duration(cognexCfg.ReconnectMinMs)*time.Millisecond, time.Duration(cognexCfg.ReconnectMaxMs)*time.Millisecond); err != nil {
+			log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+		}
+		if cognexListener.IsClientMode() {
+			log.Printf("     Modo: cliente (conecta a %s:%d)", cognexCfg.Host, cognexCfg.Port)
+		}
+		if err := cognexListener.SetQueue(cognexCfg.QueueDepth, cognexCfg.QueuePolicy); err != nil {
+			log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+		}
+		if err := cognexListener.SetConnectionPolicy(cognexCfg.AllowedSources, cognexCfg.MaxConnections, cognexCfg.ReplaceOnReconnect); err != nil {
+			log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+		}
+		if len(cognexCfg.AllowedSources) > 0 || cognexCfg.MaxConnections > 0 {
+			log.Printf("     Conexiones: orígenes %v | máximo %d | reemplazo al reconectar: %t",
+				cognexCfg.AllowedSources, cognexCfg.MaxConnections, cognexCfg.ReplaceOnReconnect)
+		}
+		if ctrl := cognexCfg.Control; ctrl != nil {
+			commands := commandClientFor(cognexCfg)
+			cognexListener.SetCommandClient(commands, ctrl.OfflineOnPause)
+			log.Printf("     Control Native Mode: %s (offline en pausa: %t)", commands.Address(), ctrl.OfflineOnPause)
+		}
+		if boxJournal != nil {
+			cognexListener.SetJournal(boxJournal)
+		}
+		if cognexCfg.ReadTrailer != nil {
+			if err := cognexListener.SetReadTrailer(*cognexCfg.ReadTrailer); err != nil {
+				log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+			}
+			log.Printf("     Datos de lectura: %v (prefijo AIM: %t, grado mínimo: %s)",
+				cognexCfg.ReadTrailer.Fields, cognexCfg.ReadTrailer.SymbologyPrefix, cognexCfg.ReadTrailer.MinGrade)
+		}
+		if cognexCfg.DuplicateWindowMs > 0 {
+			window := time.Duration(cognexCfg.DuplicateWindowMs) * time.Millisecond
+			pitch := time.Duration(cognexCfg.BoxPitchMs) * time.Millisecond
+			if err := cognexListener.SetDuplicateSuppression(window, pitch, cognexCfg.DuplicateUsePLC); err != nil {
+				log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+			}
+			log.Printf("     Duplicados: ventana %d ms (confirmar con PLC: %t)", cognexCfg.DuplicateWindowMs, cognexCfg.DuplicateUsePLC)
+		}
+		if recorder := recorderFor(cognexCfg); recorder != nil {
+			cognexListener.SetRecorder(recorder)
+			log.Printf("     Grabación de tráfico: %s", recorder.Path())
+		}
+		httpService.RegisterCognex(cognexListener)
 
 		cognexListeners = append(cognexListeners, cognexListener)
 		log.Printf("     [OK] CognexListener created (will be started by sorter)")
@@ -195,6 +302,16 @@ func main() {
 		log.Printf("🔀 Inicializando %d Sorter(s)...", len(cfg.Sorters))
 		log.Println("")
 
+		// Cámaras secundarias de lectores multi-cámara (cognex_ids[1:]): solo entregan por su principal
+		camarasSecundarias := make(map[int]bool)
+		for _, sorterCfg := range cfg.Sorters {
+			if len(sorterCfg.CognexIDs) > 1 {
+				for _, cognexID := range sorterCfg.CognexIDs[1:] {
+					camarasSecundarias[cognexID] = true
+				}
+			}
+		}
+
 		for _, sorterCfg := range cfg.Sorters {
 			log.Println("  ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 			log.Printf("  📦 Sorter #%d: %s", sorterCfg.ID, sorterCfg.Name)
@@ -209,13 +326,43 @@ func main() {
 
 			// Buscar el CognexListener correspondiente para QR/SKU (asumiendo 1 Cognex principal por sorter)
 			var cognexListener *listeners.CognexListener
-			if sorterCfg.ID > 0 && sorterCfg.ID <= len(cognexListeners) {
+			if len(sorterCfg.CognexIDs) > 0 {
+				// Varias cámaras QR como un solo lector: la primera lectura exitosa de cada caja gana
+				camaras := make([]*listeners.CognexListener, 0, len(sorterCfg.CognexIDs))
+				for _, cognexID := range sorterCfg.CognexIDs {
+					var camara *listeners.CognexListener
+					for _, cl := range cognexListeners {
+						if cl.GetID() == cognexID {
+							camara = cl
+							break
+						}
+					}
+					if camara == nil {
+						log.Fatalf("❌ Sorter #%d: cognex_ids incluye la cámara #%d, que no está en cognex_devices", sorterCfg.ID, cognexID)
+					}
+					camaras = append(camaras, camara)
+				}
+				cognexListener = camaras[0]
+				if len(camaras) > 1 {
+					if err := cognexListener.FuseWith(time.Duration(sorterCfg.FusionWindowMs)*time.Millisecond, camaras[1:]...); err != nil {
+						log.Fatalf("❌ Sorter #%d: Lector QR multi-cámara inválido: %v", sorterCfg.ID, err)
+					}
+					log.Printf("     📷 Lector QR con %d cámaras %v (ventana de fusión: %d ms)",
+						len(camaras), sorterCfg.CognexIDs, cognexListener.GetStats().Fusion.VentanaMs)
+				}
+			} else if sorterCfg.ID > 0 && sorterCfg.ID <= len(cognexListeners) && !camarasSecundarias[cognexListeners[sorterCfg.ID-1].GetID()] {
 				cognexListener = cognexListeners[sorterCfg.ID-1]
 			}
 
-			if cognexListener == nil && len(cognexListeners) > 0 {
-				log.Printf("     ⚠️  Usando primer Cognex disponible para Sorter #%d", sorterCfg.ID)
-				cognexListener = cognexListeners[0]
+			if cognexListener == nil {
+				// Una cámara secundaria de otro lector multi-cámara no puede ser el lector de este sorter
+				for _, cl := range cognexListeners {
+					if !camarasSecundarias[cl.GetID()] {
+						log.Printf("     ⚠️  Usando primer Cognex disponible para Sorter #%d", sorterCfg.ID)
+						cognexListener = cl
+						break
+					}
+				}
 			}
 
 			// Crear mapa de cámaras DataMatrix para este sorter (basado en cognex_id en salidas)
@@ -235,7 +382,45 @@ func main() {
 									cognexCfg.ScanMethod,
 									dbManager,
 								)
+								if err := dmListener.SetFraming(cognexCfg.FrameDelimiter, cognexCfg.MaxFrameLength, time.Duration(cognexCfg.PartialTimeoutMs)*time.Millisecond, cognexCfg.FlushOnTimeout); err != nil {
+									log.Fatalf("❌ Cognex #%d: Configuración de tramas inválida: %v", cognexCfg.ID, err)
+								}
+								if err := dmListener.SetMode(cognexCfg.Mode, time.Duration(cognexCfg.ReconnectMinMs)*time.Millisecond, time.Duration(cognexCfg.ReconnectMaxMs)*time.Millisecond); err != nil {
+									log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+								}
+								if recorder := recorderFor(cognexCfg); recorder != nil {
+									dmListener.SetRecorder(recorder)
+								}
+								if err := dmListener.SetQueue(cognexCfg.QueueDepth, cognexCfg.QueuePolicy); err != nil {
+									log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+								}
+								if err := dmListener.SetConnectionPolicy(cognexCfg.AllowedSources, cognexCfg.MaxConnections, cognexCfg.ReplaceOnReconnect); err != nil {
+									log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+								}
+								if cognexCfg.ReadTrailer != nil {
+									if err := dmListener.SetReadTrailer(*cognexCfg.ReadTrailer); err != nil {
+										log.Fatalf("❌ Cognex #%d: %v", cognexCfg.ID, err)
+									}
+								}
+								if ctrl := cognexCfg.Control; ctrl != nil {
+									dmListener.SetCommandClient(commandClientFor(cognexCfg), ctrl.OfflineOnPause)
+								}
+								if dmListener.IsClientMode() {
+									// La conexión la mantiene el servicio: informar su estado al monitor
+									dmDevice := &models.DeviceStatus{
+										ID:         sorterCfg.ID*100 + 10 + cognexCfg.ID, // ID único: sorterID * 100 + 10 + cognexID para DataMatrix
+										DeviceName: cognexCfg.Name,
+										DeviceType: models.DeviceTypeCognex,
+										IP:         cognexCfg.Host,
+										Port:       cognexCfg.Port,
+										SectionID:  sorterCfg.ID,
+										Reported:   true,
+									}
+									deviceMonitor.RegisterDevice(dmDevice)
+									dmListener.SetConnectionReporter(deviceMonitor, dmDevice.ID)
+								}
 								cognexDevices[cognexCfg.ID] = dmListener
+								httpService.RegisterCognex(dmListener)
 								log.Printf("     📷 Cámara DataMatrix Cognex #%d → Salida #%d (%s:%d)",
 									cognexCfg.ID, salidaCfg.ID, cognexCfg.Host, cognexCfg.Port)
 							}
@@ -363,6 +548,46 @@ func main() {
 			}
 
 			s := sorter.GetNewSorter(sorterCfg.ID, sorterCfg.Name, sorterCfg.PLC.InputNodeID, sorterCfg.PLC.OutputNodeID, sorterCfg.PaletAutomatico.Host, sorterCfg.PaletAutomatico.Port, salidas, cognexListener, cognexDevices, httpService.GetWebSocketHub(), dbManager, plcManager, fxSyncManager)
+			if boxJournal != nil {
+				s.SetBoxJournal(boxJournal)
+			}
+
+			// Configurar estrategia de ruteo (default: batch_round_robin)
+			if err := s.ConfigureRouting(sorterCfg.Routing.Strategy, sorterCfg.Routing.SKUStrategies, sorterCfg.GetWeights()); err != nil {
+				log.Fatalf("❌ Sorter #%d: Configuración de ruteo inválida: %v", sorterCfg.ID, err)
+			}
+			overflowChains, err := sorterCfg.GetOverflowChains()
+			if err != nil {
+				log.Fatalf("❌ Sorter #%d: Configuración de desborde inválida: %v", sorterCfg.ID, err)
+			}
+			s.ConfigureOverflow(overflowChains)
+			for _, salidaCfg := range sorterCfg.Salidas {
+				if salidaCfg.MaxRate > 0 {
+					s.ConfigureRateLimit(salidaCfg.ID, salidaCfg.MaxRate, salidaCfg.Burst)
+				}
+			}
+			if sorterCfg.PLC.BoxCounterNodeID != "" {
+				s.ConfigureBoxTracking(sorterCfg.PLC.BoxCounterNodeID)
+			} else if cognexListener != nil && cognexListener.UsesPLCTracking() {
+				log.Fatalf("❌ Sorter #%d: duplicate_use_plc requiere plc.box_counter_node_id (sin contador se descartarían cajas del mismo SKU)", sorterCfg.ID)
+			}
+			if sorterCfg.DivertConfirmEnabled() {
+				salidaNodes := make(map[int]string)
+				for _, salidaCfg := range sorterCfg.Salidas {
+					if salidaCfg.PLC.DivertConfirmNodeID != "" {
+						salidaNodes[salidaCfg.ID] = salidaCfg.PLC.DivertConfirmNodeID
+					}
+				}
+				if err := s.ConfigureDivertConfirmation(sorterCfg.PLC.DivertConfirmFIFONodeID, salidaNodes, sorterCfg.PLC.GetDivertConfirmTimeout()); err != nil {
+					log.Fatalf("❌ Sorter #%d: Configuración de confirmación de desvíos inválida: %v", sorterCfg.ID, err)
+				}
+			}
+			capacityCfg := sorterCfg.Routing.Capacity
+			s.ConfigureCapacity(capacityCfg.Enabled, capacityCfg.GetPollInterval(), capacityCfg.GetStaleAfter(), capacityCfg.HoldBackRemaining)
+			if err := s.ReloadRoutingRules(ctx); err != nil {
+				log.Printf("     ⚠️  Error al cargar reglas de ruteo desde BD: %v", err)
+			}
+			s.SetShifts(shiftStarts)
 
 			// Configurar WebSocketHub para todas las salidas (necesario para el channel)
 			log.Printf("     🔧 Configurando WebSocket Hub para salidas...")
@@ -439,19 +664,35 @@ func main() {
 				}
 			}
 
-			// Registrar Cognex del sorter
+			// Registrar Cognex del sorter (todas las cámaras si el lector QR es multi-cámara)
 			if cognexListener != nil {
-				cognexCfg := cfg.CognexDevices[sorterCfg.ID-1] // Asumiendo relación 1:1
-				cognexDevice := &models.DeviceStatus{
-					ID:             sorterCfg.ID*100 + 2, // ID único: sorterID * 100 + 2 para Cognex
-					DeviceName:     cognexCfg.Name,
-					DeviceType:     models.DeviceTypeCognex,
-					IP:             cognexCfg.Host,
-					Port:           cognexCfg.Port,
-					SectionID:      sorterCfg.ID,
-					IsDisconnected: false,
+				for i, camara := range cognexListener.FusedCameras() {
+					var cognexCfg config.CognexDevice
+					for _, dev := range cfg.CognexDevices {
+						if dev.ID == camara.GetID() {
+							cognexCfg = dev
+							break
+						}
+					}
+					deviceID := sorterCfg.ID*100 + 2 // ID único: sorterID * 100 + 2 para Cognex
+					if i > 0 {
+						deviceID = sorterCfg.ID*100 + 20 + camara.GetID() // sorterID * 100 + 20 + cognexID para cámaras secundarias
+					}
+					cognexDevice := &models.DeviceStatus{
+						ID:             deviceID,
+						DeviceName:     cognexCfg.Name,
+						DeviceType:     models.DeviceTypeCognex,
+						IP:             cognexCfg.Host,
+						Port:           cognexCfg.Port,
+						SectionID:      sorterCfg.ID,
+						IsDisconnected: false,
+						Reported:       camara.IsClientMode(),
+					}
+					deviceMonitor.RegisterDevice(cognexDevice)
+					if cognexDevice.Reported {
+						camara.SetConnectionReporter(deviceMonitor, cognexDevice.ID)
+					}
 				}
-				deviceMonitor.RegisterDevice(cognexDevice)
 			}
 		}
 
@@ -565,6 +806,9 @@ func main() {
 		for _, cl := range cognexListeners {
 			cl.Stop()
 		}
+		for _, recorder := range recorders {
+			recorder.Close()
+		}
 		for _, s := range sorters {
 			s.Stop()
 		}
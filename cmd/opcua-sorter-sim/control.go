@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// controlAPI expone el estado de los PLC simulados y la inyección de fallas
+type controlAPI struct {
+	plcs map[int]*simPLC
+}
+
+// setupRoutes registra los endpoints de control
+func (a *controlAPI) setupRoutes(router *gin.Engine) {
+	api := router.Group("/api")
+	{
+		api.GET("/state", a.getAllState)
+		api.GET("/sorters/:sorter_id", a.getState)
+		api.POST("/sorters/:sorter_id/salidas/:physical_id/estado", a.setEstado)
+		api.POST("/sorters/:sorter_id/salidas/:physical_id/bloqueo", a.setBloqueo)
+		api.POST("/sorters/:sorter_id/latency", a.setLatency)
+		api.POST("/sorters/:sorter_id/session-errors", a.injectSessionErrors)
+		api.POST("/sorters/:sorter_id/session-drop", a.dropSessions)
+		api.POST("/sorters/:sorter_id/divert-faults", a.injectDivertFaults)
+	}
+}
+
+// plcFor obtiene el PLC simulado del sorter de la ruta
+func (a *controlAPI) plcFor(c *gin.Context) (*simPLC, bool) {
+	sorterID, err := strconv.Atoi(c.Param("sorter_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sorter_id inválido"})
+		return nil, false
+	}
+	plc, ok := a.plcs[sorterID]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sorter no simulado", "sorter_id": sorterID})
+		return nil, false
+	}
+	return plc, true
+}
+
+// physicalIDFor obtiene el número físico de salida de la ruta
+func physicalIDFor(c *gin.Context) (int, bool) {
+	physicalID, err := strconv.Atoi(c.Param("physical_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "physical_id inválido"})
+		return 0, false
+	}
+	return physicalID, true
+}
+
+func (a *controlAPI) getAllState(c *gin.Context) {
+	states := make([]simState, 0, len(a.plcs))
+	for _, id := range sortedIDs(a.plcs) {
+		states = append(states, a.plcs[id].State())
+	}
+	c.JSON(http.StatusOK, gin.H{"sorters": states})
+}
+
+func (a *controlAPI) getState(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, plc.State())
+}
+
+// setEstado body: {"estado": 2}  (0 = apagado, 1 = andando, 2 = falla)
+func (a *controlAPI) setEstado(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	physicalID, ok := physicalIDFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Estado *int16 `json:"estado"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Estado == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Se espera {\"estado\": 0|1|2}"})
+		return
+	}
+	if err := plc.SetEstado(physicalID, *req.Estado); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plc.State())
+}
+
+// setBloqueo body: {"bloqueo": true}
+func (a *controlAPI) setBloqueo(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	physicalID, ok := physicalIDFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Bloqueo *bool `json:"bloqueo"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Bloqueo == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Se espera {\"bloqueo\": true|false}"})
+		return
+	}
+	if err := plc.SetBloqueo(physicalID, *req.Bloqueo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plc.State())
+}
+
+// setLatency body: {"latency_ms": 200, "jitter_ms": 50}
+func (a *controlAPI) setLatency(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		LatencyMs int `json:"latency_ms"`
+		JitterMs  int `json:"jitter_ms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.LatencyMs < 0 || req.JitterMs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Se espera {\"latency_ms\": N, \"jitter_ms\": N} con N >= 0"})
+		return
+	}
+	plc.SetLatency(time.Duration(req.LatencyMs)*time.Millisecond, time.Duration(req.JitterMs)*time.Millisecond)
+	c.JSON(http.StatusOK, plc.State())
+}
+
+// injectSessionErrors body: {"count": 3}
+func (a *controlAPI) injectSessionErrors(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Count int `json:"count"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Count < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Se espera {\"count\": N} con N >= 0"})
+		return
+	}
+	plc.InjectSessionErrors(req.Count)
+	c.JSON(http.StatusOK, plc.State())
+}
+
+// dropSessions body opcional: {"downtime_ms": 3000}
+func (a *controlAPI) dropSessions(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	req := struct {
+		DowntimeMs int `json:"downtime_ms"`
+	}{DowntimeMs: 2000}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || req.DowntimeMs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Se espera {\"downtime_ms\": N} con N >= 0"})
+			return
+		}
+	}
+	if err := plc.DropSessions(time.Duration(req.DowntimeMs) * time.Millisecond); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plc.State())
+}
+
+// injectDivertFaults body: {"mal_desviadas": 1, "perdidas": 2}
+func (a *controlAPI) injectDivertFaults(c *gin.Context) {
+	plc, ok := a.plcFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		MalDesviadas int `json:"mal_desviadas"`
+		Perdidas     int `json:"perdidas"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.MalDesviadas < 0 || req.Perdidas < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Se espera {\"mal_desviadas\": N, \"perdidas\": N} con N >= 0"})
+		return
+	}
+	plc.InjectDivertFaults(req.MalDesviadas, req.Perdidas)
+	c.JSON(http.StatusOK, plc.State())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"API-GREENEX/internal/config"
+)
+
+// Simula el PLC OPC UA de los sorters de config.yaml para correr la API completa en un laptop.
+// Cada sorter escucha en el puerto de su plc_endpoint; apuntar plc_endpoint a localhost en la
+// configuración de la API (ej: opc.tcp://localhost:4840). La API de control HTTP permite poner
+// salidas en falla o bloqueadas e inyectar latencia, errores y caídas de sesión.
+//
+// Uso:
+//
+//	go run ./cmd/opcua-sorter-sim -config config/config.yaml
+//	go run ./cmd/opcua-sorter-sim -sorter 1 -travel 3s -http :9200
+//	curl -X POST localhost:9200/api/sorters/1/salidas/3/estado -d '{"estado": 2}'
+
+func main() {
+	configPath := flag.String("config", "config/config.yaml", "Archivo de configuración con los sorters a simular")
+	sorterID := flag.Int("sorter", 0, "Simular solo este sorter (0 = todos los que tengan plc_endpoint)")
+	host := flag.String("host", "localhost", "Host donde escuchan los servidores OPC UA")
+	httpAddr := flag.String("http", ":9200", "Dirección de la API de control")
+	travel := flag.Duration("travel", 2*time.Second, "Tiempo desde la asignación hasta la confirmación del desvío")
+	triggerBusy := flag.Duration("trigger-busy", 50*time.Millisecond, "Tiempo que el trigger queda ocupado después de cada asignación")
+	trackingStart := flag.Uint("tracking-start", 1, "Primer número de seguimiento retornado por el método")
+	flag.Parse()
+
+	if *trackingStart > 0xFFFF {
+		log.Fatalf("❌ -tracking-start debe estar entre 0 y 65535")
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("❌ Error cargando configuración: %v", err)
+	}
+
+	opts := simOptions{
+		Host:          *host,
+		Travel:        *travel,
+		TriggerBusy:   *triggerBusy,
+		TrackingStart: uint16(*trackingStart),
+	}
+
+	plcs := make(map[int]*simPLC)
+	puertos := make(map[int]int)
+	for _, sorterCfg := range cfg.Sorters {
+		if *sorterID != 0 && sorterCfg.ID != *sorterID {
+			continue
+		}
+		if sorterCfg.PLCEndpoint == "" {
+			log.Printf("⚠️  Sorter #%d sin plc_endpoint, no se simula", sorterCfg.ID)
+			continue
+		}
+		plc, err := newSimPLC(sorterCfg, opts)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if otro, usado := puertos[plc.port]; usado {
+			log.Fatalf("❌ Sorters #%d y #%d usan el puerto %d: usar puertos distintos en plc_endpoint o -sorter",
+				otro, sorterCfg.ID, plc.port)
+		}
+		puertos[plc.port] = sorterCfg.ID
+		plcs[sorterCfg.ID] = plc
+	}
+	if len(plcs) == 0 {
+		log.Fatalf("❌ No hay sorters para simular en %s", *configPath)
+	}
+
+	for _, id := range sortedIDs(plcs) {
+		if err := plcs[id].Start(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	api := &controlAPI{plcs: plcs}
+	api.setupRoutes(router)
+
+	go func() {
+		log.Printf("🌐 API de control en http://%s/api/state", *httpAddr)
+		if err := router.Run(*httpAddr); err != nil {
+			log.Fatalf("❌ Error en la API de control: %v", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	log.Println("🛑 Deteniendo PLC simulados...")
+	for _, plc := range plcs {
+		plc.Stop()
+	}
+}
+
+// sortedIDs retorna los IDs de sorter en orden
+func sortedIDs(plcs map[int]*simPLC) []int {
+	ids := make([]int, 0, len(plcs))
+	for id := range plcs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/server/attrs"
+	"github.com/gopcua/opcua/ua"
+	"github.com/gopcua/opcua/uasc"
+
+	"API-GREENEX/internal/config"
+)
+
+// Estados de una salida en el PLC (mismos valores que lee el sorter)
+const (
+	estadoApagado int16 = 0
+	estadoAndando int16 = 1
+	estadoFalla   int16 = 2
+)
+
+// simOptions son los tiempos del proceso físico simulado
+type simOptions struct {
+	Host          string        // Host donde escucha el servidor OPC UA
+	Travel        time.Duration // Tiempo desde la asignación hasta la confirmación del desvío
+	TriggerBusy   time.Duration // Tiempo que el trigger queda en true después de cada asignación
+	TrackingStart uint16        // Primer número de seguimiento
+}
+
+// simNode es una variable del espacio de direcciones simulado
+type simNode struct {
+	id     *ua.NodeID
+	nombre string
+	valor  interface{}
+}
+
+// salidaSim es una salida física del sorter simulado
+type salidaSim struct {
+	ID         int    `json:"id"`
+	PhysicalID int    `json:"physical_id"`
+	Nombre     string `json:"nombre"`
+	Tipo       string `json:"tipo"`
+	Cajas      int64  `json:"cajas"` // Cajas confirmadas en esta salida
+
+	estadoNode  string
+	bloqueoNode string
+	confirmNode string
+}
+
+// simPLC simula el PLC de un sorter: método de asignación de salida, nodos de estado/bloqueo,
+// trigger, contador de cajas y confirmación física de desvíos
+type simPLC struct {
+	sorterID int
+	nombre   string
+	port     int
+	plc      config.SorterPLCConfig
+	opts     simOptions
+
+	objectID string
+	methodID string
+
+	mu           sync.Mutex
+	nodos        map[string]*simNode
+	salidas      []*salidaSim
+	porLane      map[int16]*salidaSim
+	tracking     uint16
+	llamadas     int64
+	asignaciones int64
+	latencia     time.Duration
+	jitter       time.Duration
+	fallasSesion int  // Próximas llamadas al método que responden BadSessionIDInvalid
+	malDesvios   int  // Próximas cajas confirmadas en otra salida
+	perdidas     int  // Próximas cajas sin confirmación
+	caido        bool // Caída de sesiones en curso
+	caidas       int
+
+	srv    *server.Server
+	proxy  *sessionProxy
+	cancel context.CancelFunc
+}
+
+// simSalidaState es el estado de una salida para la API de control
+type simSalidaState struct {
+	salidaSim
+	Estado         interface{} `json:"estado"`
+	Bloqueo        interface{} `json:"bloqueo,omitempty"`
+	UltimoTracking interface{} `json:"ultimo_tracking,omitempty"`
+}
+
+// simState es el estado de un sorter simulado para la API de control
+type simState struct {
+	SorterID       int              `json:"sorter_id"`
+	Nombre         string           `json:"nombre"`
+	Endpoint       string           `json:"endpoint"`
+	Caido          bool             `json:"caido"`
+	Caidas         int              `json:"caidas"`
+	Conexiones     int              `json:"conexiones"`           // Conexiones OPC UA abiertas
+	ConexionesAcep int64            `json:"conexiones_aceptadas"` // Conexiones aceptadas desde el inicio
+	Tracking       uint16           `json:"tracking"`
+	Llamadas       int64            `json:"llamadas"`
+	Asignaciones   int64            `json:"asignaciones"`
+	LatenciaMs     int64            `json:"latencia_ms"`
+	JitterMs       int64            `json:"jitter_ms"`
+	FallasSesion   int              `json:"fallas_sesion_pendientes"`
+	MalDesvios     int              `json:"mal_desvios_pendientes"`
+	Perdidas       int              `json:"perdidas_pendientes"`
+	Trigger        interface{}      `json:"trigger,omitempty"`
+	ContadorCajas  interface{}      `json:"contador_cajas,omitempty"`
+	UltimoDesviado interface{}      `json:"ultimo_desviado,omitempty"`
+	Salidas        []simSalidaState `json:"salidas"`
+}
+
+// newSimPLC arma el PLC simulado de un sorter a partir de su configuración
+func newSimPLC(sorterCfg config.Sorter, opts simOptions) (*simPLC, error) {
+	u, err := url.Parse(sorterCfg.PLCEndpoint)
+	if err != nil || u.Port() == "" {
+		return nil, fmt.Errorf("sorter %d: plc_endpoint inválido %q (se espera opc.tcp://host:puerto)", sorterCfg.ID, sorterCfg.PLCEndpoint)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return nil, fmt.Errorf("sorter %d: puerto inválido en plc_endpoint %q", sorterCfg.ID, sorterCfg.PLCEndpoint)
+	}
+	if sorterCfg.PLC.ObjectID == "" || sorterCfg.PLC.MethodID == "" {
+		return nil, fmt.Errorf("sorter %d: plc.object_id y plc.method_id son obligatorios", sorterCfg.ID)
+	}
+
+	p := &simPLC{
+		sorterID: sorterCfg.ID,
+		nombre:   sorterCfg.Name,
+		port:     port,
+		plc:      sorterCfg.PLC,
+		opts:     opts,
+		nodos:    make(map[string]*simNode),
+		porLane:  make(map[int16]*salidaSim),
+		tracking: opts.TrackingStart - 1,
+	}
+
+	if p.objectID, err = normalizarNodo(sorterCfg.PLC.ObjectID); err != nil {
+		return nil, fmt.Errorf("sorter %d: object_id: %w", sorterCfg.ID, err)
+	}
+	if p.methodID, err = normalizarNodo(sorterCfg.PLC.MethodID); err != nil {
+		return nil, fmt.Errorf("sorter %d: method_id: %w", sorterCfg.ID, err)
+	}
+
+	variables := []struct {
+		nodeID string
+		nombre string
+		valor  interface{}
+	}{
+		{sorterCfg.PLC.TriggerNodeID, "Trigger", false},
+		{sorterCfg.PLC.BoxCounterNodeID, "ContadorCajas", uint32(0)},
+		{sorterCfg.PLC.DivertConfirmFIFONodeID, "UltimoDesviado", []uint16{0, 0}},
+		{sorterCfg.PLC.InputNodeID, "Input", int16(0)},
+		{sorterCfg.PLC.OutputNodeID, "Output", int16(0)},
+	}
+	for _, v := range variables {
+		if err := p.agregarNodo(v.nodeID, v.nombre, v.valor); err != nil {
+			return nil, fmt.Errorf("sorter %d: %w", sorterCfg.ID, err)
+		}
+	}
+
+	for _, salidaCfg := range sorterCfg.Salidas {
+		salida := &salidaSim{
+			ID:         salidaCfg.ID,
+			PhysicalID: salidaCfg.PhysicalID,
+			Nombre:     salidaCfg.Nombre,
+			Tipo:       salidaCfg.Tipo,
+		}
+		prefijo := fmt.Sprintf("Salida%d.", salidaCfg.PhysicalID)
+		if salida.estadoNode, err = p.agregarNodoSalida(salidaCfg.PLC.EstadoNodeID, prefijo+"Estado", estadoAndando); err != nil {
+			return nil, fmt.Errorf("sorter %d: %w", sorterCfg.ID, err)
+		}
+		if salida.bloqueoNode, err = p.agregarNodoSalida(salidaCfg.PLC.BloqueoNodeID, prefijo+"Bloqueo", false); err != nil {
+			return nil, fmt.Errorf("sorter %d: %w", sorterCfg.ID, err)
+		}
+		if salida.confirmNode, err = p.agregarNodoSalida(salidaCfg.PLC.DivertConfirmNodeID, prefijo+"UltimoTracking", uint16(0)); err != nil {
+			return nil, fmt.Errorf("sorter %d: %w", sorterCfg.ID, err)
+		}
+		p.salidas = append(p.salidas, salida)
+		p.porLane[int16(salidaCfg.PhysicalID)] = salida
+	}
+
+	return p, nil
+}
+
+// normalizarNodo valida un NodeID de la configuración y lo retorna en formato canónico
+func normalizarNodo(nodeID string) (string, error) {
+	parsed, err := ua.ParseNodeID(nodeID)
+	if err != nil {
+		return "", fmt.Errorf("NodeID inválido %q: %w", nodeID, err)
+	}
+	return parsed.String(), nil
+}
+
+// agregarNodo registra una variable del espacio de direcciones ("" = no configurada)
+func (p *simPLC) agregarNodo(nodeID, nombre string, valor interface{}) error {
+	if nodeID == "" {
+		return nil
+	}
+	parsed, err := ua.ParseNodeID(nodeID)
+	if err != nil {
+		return fmt.Errorf("%s: NodeID inválido %q: %w", nombre, nodeID, err)
+	}
+	key := parsed.String()
+	if existente, ok := p.nodos[key]; ok {
+		return fmt.Errorf("%s: el NodeID %s ya está usado por %s", nombre, nodeID, existente.nombre)
+	}
+	if key == p.objectID || key == p.methodID {
+		return fmt.Errorf("%s: el NodeID %s ya está usado por el objeto o el método del sorter", nombre, nodeID)
+	}
+	p.nodos[key] = &simNode{id: parsed, nombre: nombre, valor: valor}
+	return nil
+}
+
+// agregarNodoSalida registra una variable de salida y retorna su clave ("" = no configurada)
+func (p *simPLC) agregarNodoSalida(nodeID, nombre string, valor interface{}) (string, error) {
+	if nodeID == "" {
+		return "", nil
+	}
+	if err := p.agregarNodo(nodeID, nombre, valor); err != nil {
+		return "", err
+	}
+	key, _ := normalizarNodo(nodeID)
+	return key, nil
+}
+
+// endpoint retorna la URL donde escucha el servidor OPC UA simulado
+func (p *simPLC) endpoint() string {
+	return fmt.Sprintf("opc.tcp://%s:%d", p.opts.Host, p.port)
+}
+
+// Start levanta el servidor OPC UA interno con el espacio de direcciones del sorter y el proxy
+// en el puerto de plc_endpoint
+func (p *simPLC) Start() error {
+	interno, err := puertoLibre("127.0.0.1")
+	if err != nil {
+		return fmt.Errorf("sorter %d: %w", p.sorterID, err)
+	}
+
+	srv := server.New(
+		server.EndPoint("127.0.0.1", interno),
+		server.EnableSecurity("None", ua.MessageSecurityModeNone),
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+		server.ServerName(fmt.Sprintf("Sorter %d simulado", p.sorterID)),
+		server.ManufacturerName("Greenex"),
+		server.ProductName("opcua-sorter-sim"),
+	)
+
+	p.construirEspacio(srv)
+
+	// Deben registrarse antes de Start: Start solo agrega los handlers que falten
+	srv.RegisterHandler(id.CallRequest_Encoding_DefaultBinary, p.handleCall)
+	srv.RegisterHandler(id.WriteRequest_Encoding_DefaultBinary, p.handleWrite)
+	srv.RegisterHandler(id.DeleteSubscriptionsRequest_Encoding_DefaultBinary, deleteSubscriptions(srv))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := srv.Start(ctx); err != nil {
+		cancel()
+		return fmt.Errorf("sorter %d: no se pudo iniciar el servidor OPC UA interno: %w", p.sorterID, err)
+	}
+
+	proxy, err := newSessionProxy(fmt.Sprintf("%s:%d", p.opts.Host, p.port), fmt.Sprintf("127.0.0.1:%d", interno))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("sorter %d: no se pudo escuchar en %s: %w", p.sorterID, p.endpoint(), err)
+	}
+
+	p.mu.Lock()
+	p.srv = srv
+	p.proxy = proxy
+	p.cancel = cancel
+	p.mu.Unlock()
+
+	log.Printf("✅ [Sorter %d] PLC simulado escuchando en %s (%d nodos, %d salidas)",
+		p.sorterID, p.endpoint(), len(p.nodos), len(p.salidas))
+	return nil
+}
+
+// Stop corta las sesiones y detiene el servidor OPC UA
+func (p *simPLC) Stop() {
+	p.mu.Lock()
+	srv, proxy, cancel := p.srv, p.proxy, p.cancel
+	p.srv, p.proxy, p.cancel = nil, nil, nil
+	p.mu.Unlock()
+
+	if srv == nil {
+		return
+	}
+	proxy.Close()
+	cancel()
+}
+
+// DropSessions corta todas las conexiones OPC UA y rechaza las nuevas durante downtime.
+// El proceso del sorter sigue corriendo: las confirmaciones de desvío continúan.
+func (p *simPLC) DropSessions(downtime time.Duration) error {
+	p.mu.Lock()
+	proxy := p.proxy
+	if proxy == nil || p.caido {
+		p.mu.Unlock()
+		return fmt.Errorf("el PLC simulado del sorter %d ya está caído", p.sorterID)
+	}
+	p.caido = true
+	p.caidas++
+	p.mu.Unlock()
+
+	cortadas := proxy.Drop(true)
+	log.Printf("🔌 [Sorter %d] %d conexión(es) OPC UA cortadas, sin servicio por %v", p.sorterID, cortadas, downtime)
+
+	time.AfterFunc(downtime, func() {
+		proxy.Resume()
+		p.mu.Lock()
+		p.caido = false
+		p.mu.Unlock()
+		log.Printf("🔌 [Sorter %d] PLC simulado acepta conexiones nuevamente", p.sorterID)
+	})
+	return nil
+}
+
+// construirEspacio crea los namespaces hasta el mayor índice configurado y agrega los nodos
+func (p *simPLC) construirEspacio(srv *server.Server) {
+	maxNS := uint16(1)
+	ids := []*ua.NodeID{ua.MustParseNodeID(p.objectID), ua.MustParseNodeID(p.methodID)}
+	for _, n := range p.nodos {
+		ids = append(ids, n.id)
+	}
+	for _, nid := range ids {
+		if nid.Namespace() > maxNS {
+			maxNS = nid.Namespace()
+		}
+	}
+
+	// El índice de cada namespace es su posición: se crean los intermedios vacíos
+	namespaces := map[uint16]*server.NodeNameSpace{}
+	for i := uint16(1); i <= maxNS; i++ {
+		namespaces[i] = server.NewNodeNameSpace(srv, fmt.Sprintf("urn:greenex:sorter-sim:%d:ns%d", p.sorterID, i))
+	}
+	root, _ := srv.Namespace(0)
+	rootObjects := root.Objects()
+
+	objetoID := ua.MustParseNodeID(p.objectID)
+	nsObjeto := namespaces[objetoID.Namespace()]
+	// server.NewFolderNode de gopcua v0.8.0 entra en pánico (Description con NodeClass): se arma a mano
+	nombreObjeto := fmt.Sprintf("Sorter%d", p.sorterID)
+	objeto := server.NewNode(
+		objetoID,
+		map[ua.AttributeID]*ua.DataValue{
+			ua.AttributeIDNodeClass:     server.DataValueFromValue(uint32(ua.NodeClassObject)),
+			ua.AttributeIDBrowseName:    server.DataValueFromValue(attrs.BrowseName(nombreObjeto)),
+			ua.AttributeIDDisplayName:   server.DataValueFromValue(attrs.DisplayName(nombreObjeto, nombreObjeto)),
+			ua.AttributeIDEventNotifier: server.DataValueFromValue(int16(0)),
+		},
+		nil,
+		nil,
+	)
+	nsObjeto.AddNode(objeto)
+	nsObjeto.Objects().AddRef(objeto, id.HasComponent, true)
+	rootObjects.AddRef(nsObjeto.Objects(), id.HasComponent, true)
+
+	metodoID := ua.MustParseNodeID(p.methodID)
+	metodo := server.NewNode(
+		metodoID,
+		map[ua.AttributeID]*ua.DataValue{
+			ua.AttributeIDNodeClass:   server.DataValueFromValue(uint32(ua.NodeClassMethod)),
+			ua.AttributeIDBrowseName:  server.DataValueFromValue(attrs.BrowseName("AssignLaneToBox")),
+			ua.AttributeIDDisplayName: server.DataValueFromValue(attrs.DisplayName("AssignLaneToBox", "AssignLaneToBox")),
+			ua.AttributeIDExecutable:  server.DataValueFromValue(true),
+		},
+		nil,
+		nil,
+	)
+	namespaces[metodoID.Namespace()].AddNode(metodo)
+	objeto.AddRef(metodo, id.HasComponent, true)
+
+	keys := make([]string, 0, len(p.nodos))
+	for key := range p.nodos {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		key := key
+		n := p.nodos[key]
+		variable := server.NewVariableNode(n.id, n.nombre, func() *ua.DataValue {
+			return server.DataValueFromValue(p.get(key))
+		})
+		namespaces[n.id.Namespace()].AddNode(variable)
+		objeto.AddRef(variable, id.HasComponent, true)
+	}
+}
+
+// get retorna el valor actual de un nodo
+func (p *simPLC) get(key string) interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.getLocked(key)
+}
+
+func (p *simPLC) getLocked(key string) interface{} {
+	if n, ok := p.nodos[key]; ok {
+		return n.valor
+	}
+	return nil
+}
+
+// setLocked cambia el valor de un nodo; retorna false si el nodo no está configurado
+func (p *simPLC) setLocked(key string, valor interface{}) bool {
+	n, ok := p.nodos[key]
+	if !ok {
+		return false
+	}
+	n.valor = valor
+	return true
+}
+
+// notify avisa a las suscripciones de los nodos cambiados (sin tomar p.mu: el servidor lee los valores)
+func (p *simPLC) notify(keys ...string) {
+	p.mu.Lock()
+	srv := p.srv
+	p.mu.Unlock()
+	if srv == nil {
+		return
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		srv.ChangeNotification(ua.MustParseNodeID(key))
+	}
+}
+
+// handleCall atiende CallRequest: solo existe el método de asignación de salida del sorter
+func (p *simPLC) handleCall(sc *uasc.SecureChannel, r ua.Request, reqID uint32) (ua.Response, error) {
+	req, ok := r.(*ua.CallRequest)
+	if !ok {
+		return nil, ua.StatusBadRequestTypeInvalid
+	}
+
+	p.mu.Lock()
+	p.llamadas++
+	demora := p.latencia
+	if p.jitter > 0 {
+		demora += time.Duration(rand.Int63n(int64(p.jitter)))
+	}
+	fallaSesion := p.fallasSesion > 0
+	if fallaSesion {
+		p.fallasSesion--
+	}
+	p.mu.Unlock()
+
+	if demora > 0 {
+		time.Sleep(demora)
+	}
+	if fallaSesion {
+		log.Printf("💥 [Sorter %d] Llamada al método rechazada con BadSessionIDInvalid (falla inyectada)", p.sorterID)
+		return nil, ua.StatusBadSessionIDInvalid
+	}
+
+	results := make([]*ua.CallMethodResult, len(req.MethodsToCall))
+	for i, metodo := range req.MethodsToCall {
+		results[i] = p.callMethod(metodo)
+	}
+
+	return &ua.CallResponse{
+		ResponseHeader:  responseHeader(req.RequestHeader.RequestHandle, ua.StatusOK),
+		Results:         results,
+		DiagnosticInfos: []*ua.DiagnosticInfo{},
+	}, nil
+}
+
+// callMethod asigna la salida pedida a una caja nueva y retorna su número de seguimiento.
+// Lane 0 sin salida configurada es el warm-up del cliente: responde sin crear una caja.
+func (p *simPLC) callMethod(req *ua.CallMethodRequest) *ua.CallMethodResult {
+	if req.ObjectID.String() != p.objectID || req.MethodID.String() != p.methodID {
+		return &ua.CallMethodResult{StatusCode: ua.StatusBadMethodInvalid}
+	}
+	if len(req.InputArguments) == 0 {
+		return &ua.CallMethodResult{StatusCode: ua.StatusBadArgumentsMissing}
+	}
+	lane, ok := req.InputArguments[0].Value().(int16)
+	if !ok {
+		return &ua.CallMethodResult{
+			StatusCode:           ua.StatusBadInvalidArgument,
+			InputArgumentResults: []ua.StatusCode{ua.StatusBadTypeMismatch},
+		}
+	}
+
+	p.mu.Lock()
+	salida, existe := p.porLane[lane]
+	if !existe && lane != 0 {
+		p.mu.Unlock()
+		log.Printf("⚠️  [Sorter %d] Lane %d no existe en el sorter simulado", p.sorterID, lane)
+		return &ua.CallMethodResult{
+			StatusCode:           ua.StatusBadInvalidArgument,
+			InputArgumentResults: []ua.StatusCode{ua.StatusBadOutOfRange},
+		}
+	}
+	if !existe {
+		tracking := p.tracking
+		p.mu.Unlock()
+		return metodoOK(tracking)
+	}
+
+	p.tracking++
+	if p.tracking == 0 {
+		p.tracking = 1
+	}
+	tracking := p.tracking
+	p.asignaciones++
+
+	triggerKey := p.clave(p.plc.TriggerNodeID)
+	contadorKey := p.clave(p.plc.BoxCounterNodeID)
+	p.setLocked(triggerKey, true)
+	if contador, ok := p.getLocked(contadorKey).(uint32); ok {
+		p.setLocked(contadorKey, contador+1)
+	}
+
+	destino := salida
+	perdida := false
+	switch {
+	case p.perdidas > 0:
+		p.perdidas--
+		perdida = true
+	case p.malDesvios > 0:
+		if otra := p.otraSalida(salida); otra != nil {
+			p.malDesvios--
+			destino = otra
+		}
+	}
+	p.mu.Unlock()
+
+	p.notify(triggerKey, contadorKey)
+
+	if p.opts.TriggerBusy > 0 {
+		time.AfterFunc(p.opts.TriggerBusy, func() {
+			p.mu.Lock()
+			p.setLocked(triggerKey, false)
+			p.mu.Unlock()
+			p.notify(triggerKey)
+		})
+	} else {
+		p.mu.Lock()
+		p.setLocked(triggerKey, false)
+		p.mu.Unlock()
+	}
+
+	switch {
+	case perdida:
+		log.Printf("📦 [Sorter %d] Caja %d → lane %d (se perderá: sin confirmación)", p.sorterID, tracking, lane)
+	case destino != salida:
+		log.Printf("📦 [Sorter %d] Caja %d → lane %d (se desviará a lane %d)", p.sorterID, tracking, lane, destino.PhysicalID)
+		time.AfterFunc(p.opts.Travel, func() { p.confirmarDesvio(tracking, destino) })
+	default:
+		log.Printf("📦 [Sorter %d] Caja %d → lane %d", p.sorterID, tracking, lane)
+		time.AfterFunc(p.opts.Travel, func() { p.confirmarDesvio(tracking, destino) })
+	}
+
+	return metodoOK(tracking)
+}
+
+// metodoOK arma la respuesta del método con el número de seguimiento en Output[0]
+func metodoOK(tracking uint16) *ua.CallMethodResult {
+	return &ua.CallMethodResult{
+		StatusCode:           ua.StatusOK,
+		InputArgumentResults: []ua.StatusCode{ua.StatusOK},
+		OutputArguments:      []*ua.Variant{ua.MustVariant(tracking)},
+	}
+}
+
+// otraSalida retorna una salida distinta a la asignada para simular un mal desvío
+func (p *simPLC) otraSalida(asignada *salidaSim) *salidaSim {
+	for _, s := range p.salidas {
+		if s != asignada {
+			return s
+		}
+	}
+	return nil
+}
+
+// confirmarDesvio publica la caja en el nodo FIFO y en el nodo de confirmación de la salida
+func (p *simPLC) confirmarDesvio(tracking uint16, salida *salidaSim) {
+	fifoKey := p.clave(p.plc.DivertConfirmFIFONodeID)
+
+	p.mu.Lock()
+	salida.Cajas++
+	p.setLocked(fifoKey, []uint16{tracking, uint16(salida.PhysicalID)})
+	p.setLocked(salida.confirmNode, tracking)
+	p.mu.Unlock()
+
+	p.notify(fifoKey, salida.confirmNode)
+}
+
+// clave retorna la clave canónica de un NodeID de la configuración ("" = no configurado)
+func (p *simPLC) clave(nodeID string) string {
+	if nodeID == "" {
+		return ""
+	}
+	key, err := normalizarNodo(nodeID)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// handleWrite atiende WriteRequest sobre las variables simuladas (ej: bloqueo desde la API)
+func (p *simPLC) handleWrite(sc *uasc.SecureChannel, r ua.Request, reqID uint32) (ua.Response, error) {
+	req, ok := r.(*ua.WriteRequest)
+	if !ok {
+		return nil, ua.StatusBadRequestTypeInvalid
+	}
+
+	status := make([]ua.StatusCode, len(req.NodesToWrite))
+	var cambiados []string
+	p.mu.Lock()
+	for i, w := range req.NodesToWrite {
+		key := w.NodeID.String()
+		switch {
+		case w.AttributeID != ua.AttributeIDValue:
+			status[i] = ua.StatusBadNotWritable
+		case w.Value == nil || w.Value.Value == nil:
+			status[i] = ua.StatusBadTypeMismatch
+		case !p.setLocked(key, w.Value.Value.Value()):
+			status[i] = ua.StatusBadNodeIDUnknown
+		default:
+			status[i] = ua.StatusOK
+			cambiados = append(cambiados, key)
+			log.Printf("✏️  [Sorter %d] Escritura %s = %v", p.sorterID, p.nodos[key].nombre, p.nodos[key].valor)
+		}
+	}
+	p.mu.Unlock()
+
+	p.notify(cambiados...)
+
+	return &ua.WriteResponse{
+		ResponseHeader:  responseHeader(req.RequestHeader.RequestHandle, ua.StatusOK),
+		Results:         status,
+		DiagnosticInfos: []*ua.DiagnosticInfo{},
+	}, nil
+}
+
+// deleteSubscriptions protege DeleteSubscriptions de gopcua v0.8.0, que entra en pánico si la
+// sesión de la solicitud ya no existe (cliente que se despide después de una caída de sesión)
+func deleteSubscriptions(srv *server.Server) server.Handler {
+	return func(sc *uasc.SecureChannel, r ua.Request, reqID uint32) (ua.Response, error) {
+		req, ok := r.(*ua.DeleteSubscriptionsRequest)
+		if !ok {
+			return nil, ua.StatusBadRequestTypeInvalid
+		}
+		if srv.Session(req.Header()) == nil {
+			return nil, ua.StatusBadSessionIDInvalid
+		}
+		return srv.SubscriptionService.DeleteSubscriptions(sc, r, reqID)
+	}
+}
+
+// responseHeader arma la cabecera de respuesta igual que los servicios del servidor
+func responseHeader(requestHandle uint32, status ua.StatusCode) *ua.ResponseHeader {
+	return &ua.ResponseHeader{
+		Timestamp:          time.Now(),
+		RequestHandle:      requestHandle,
+		ServiceResult:      status,
+		ServiceDiagnostics: &ua.DiagnosticInfo{},
+		StringTable:        []string{},
+		AdditionalHeader:   ua.NewExtensionObject(nil),
+	}
+}
+
+// salidaPorPhysicalID busca una salida por su número físico
+func (p *simPLC) salidaPorPhysicalID(physicalID int) (*salidaSim, bool) {
+	salida, ok := p.porLane[int16(physicalID)]
+	return salida, ok
+}
+
+// SetEstado cambia el estado de una salida (0 = apagado, 1 = andando, 2 = falla)
+func (p *simPLC) SetEstado(physicalID int, estado int16) error {
+	salida, ok := p.salidaPorPhysicalID(physicalID)
+	if !ok {
+		return fmt.Errorf("salida física %d no existe en el sorter %d", physicalID, p.sorterID)
+	}
+	if estado < estadoApagado || estado > estadoFalla {
+		return fmt.Errorf("estado %d inválido (0 = apagado, 1 = andando, 2 = falla)", estado)
+	}
+
+	p.mu.Lock()
+	ok = p.setLocked(salida.estadoNode, estado)
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("la salida física %d no tiene estado_node_id", physicalID)
+	}
+
+	log.Printf("🔧 [Sorter %d] Salida %d: estado=%d", p.sorterID, physicalID, estado)
+	p.notify(salida.estadoNode)
+	return nil
+}
+
+// SetBloqueo bloquea o desbloquea una salida
+func (p *simPLC) SetBloqueo(physicalID int, bloqueo bool) error {
+	salida, ok := p.salidaPorPhysicalID(physicalID)
+	if !ok {
+		return fmt.Errorf("salida física %d no existe en el sorter %d", physicalID, p.sorterID)
+	}
+
+	p.mu.Lock()
+	ok = p.setLocked(salida.bloqueoNode, bloqueo)
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("la salida física %d no tiene bloqueo_node_id", physicalID)
+	}
+
+	log.Printf("🔧 [Sorter %d] Salida %d: bloqueo=%v", p.sorterID, physicalID, bloqueo)
+	p.notify(salida.bloqueoNode)
+	return nil
+}
+
+// SetLatency fija la demora de cada llamada al método (latencia + aleatorio en [0, jitter))
+func (p *simPLC) SetLatency(latencia, jitter time.Duration) {
+	p.mu.Lock()
+	p.latencia = latencia
+	p.jitter = jitter
+	p.mu.Unlock()
+	log.Printf("🐢 [Sorter %d] Latencia del método: %v (+ hasta %v)", p.sorterID, latencia, jitter)
+}
+
+// InjectSessionErrors hace que las próximas n llamadas al método respondan BadSessionIDInvalid
+func (p *simPLC) InjectSessionErrors(n int) {
+	p.mu.Lock()
+	p.fallasSesion = n
+	p.mu.Unlock()
+	log.Printf("💥 [Sorter %d] Próximas %d llamadas al método fallarán con error de sesión", p.sorterID, n)
+}
+
+// InjectDivertFaults hace que las próximas cajas se desvíen a otra salida o no se confirmen
+func (p *simPLC) InjectDivertFaults(malDesvios, perdidas int) {
+	p.mu.Lock()
+	p.malDesvios = malDesvios
+	p.perdidas = perdidas
+	p.mu.Unlock()
+	log.Printf("💥 [Sorter %d] Próximas cajas: %d mal desviadas, %d perdidas", p.sorterID, malDesvios, perdidas)
+}
+
+// State retorna el estado actual del sorter simulado
+func (p *simPLC) State() simState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := simState{
+		SorterID:       p.sorterID,
+		Nombre:         p.nombre,
+		Endpoint:       p.endpoint(),
+		Caido:          p.caido,
+		Caidas:         p.caidas,
+		Tracking:       p.tracking,
+		Llamadas:       p.llamadas,
+		Asignaciones:   p.asignaciones,
+		LatenciaMs:     p.latencia.Milliseconds(),
+		JitterMs:       p.jitter.Milliseconds(),
+		FallasSesion:   p.fallasSesion,
+		MalDesvios:     p.malDesvios,
+		Perdidas:       p.perdidas,
+		Trigger:        p.getLocked(p.clave(p.plc.TriggerNodeID)),
+		ContadorCajas:  p.getLocked(p.clave(p.plc.BoxCounterNodeID)),
+		UltimoDesviado: p.getLocked(p.clave(p.plc.DivertConfirmFIFONodeID)),
+		Salidas:        make([]simSalidaState, 0, len(p.salidas)),
+	}
+	if p.proxy != nil {
+		state.Conexiones, state.ConexionesAcep = p.proxy.Stats()
+	}
+	for _, s := range p.salidas {
+		state.Salidas = append(state.Salidas, simSalidaState{
+			salidaSim:      *s,
+			Estado:         p.getLocked(s.estadoNode),
+			Bloqueo:        p.getLocked(s.bloqueoNode),
+			UltimoTracking: p.getLocked(s.confirmNode),
+		})
+	}
+	return state
+}
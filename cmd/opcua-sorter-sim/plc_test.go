@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+
+	"API-GREENEX/internal/config"
+)
+
+// sorterSim arma la configuración de un sorter con dos salidas en el puerto indicado
+func sorterSim(port int) config.Sorter {
+	salida := func(id, physicalID int) config.Salida {
+		return config.Salida{ID: id, PhysicalID: physicalID, Nombre: fmt.Sprintf("S%d", physicalID), PLC: config.SalidaPLCConfig{
+			EstadoNodeID:        fmt.Sprintf("ns=4;s=Salida%d.Estado", physicalID),
+			BloqueoNodeID:       fmt.Sprintf("ns=4;s=Salida%d.Bloqueo", physicalID),
+			DivertConfirmNodeID: fmt.Sprintf("ns=4;s=Salida%d.Tracking", physicalID),
+		}}
+	}
+	return config.Sorter{
+		ID:          1,
+		Name:        "Sorter de prueba",
+		PLCEndpoint: fmt.Sprintf("opc.tcp://127.0.0.1:%d", port),
+		PLC: config.SorterPLCConfig{
+			ObjectID:                "ns=4;i=1",
+			MethodID:                "ns=4;i=2",
+			TriggerNodeID:           "ns=4;s=Trigger",
+			BoxCounterNodeID:        "ns=4;s=ContadorCajas",
+			DivertConfirmFIFONodeID: "ns=4;s=FIFO_Desvio",
+		},
+		Salidas: []config.Salida{salida(10, 1), salida(11, 2)},
+	}
+}
+
+// llamada arma la llamada al método de asignación con el argumento indicado
+func llamada(p *simPLC, args ...*ua.Variant) *ua.CallMethodRequest {
+	return &ua.CallMethodRequest{
+		ObjectID:       ua.MustParseNodeID(p.objectID),
+		MethodID:       ua.MustParseNodeID(p.methodID),
+		InputArguments: args,
+	}
+}
+
+// esperarEstado espera a que el estado del PLC simulado cumpla la condición
+func esperarEstado(t *testing.T, p *simPLC, cond func(simState) bool) simState {
+	t.Helper()
+	limite := time.Now().Add(2 * time.Second)
+	for {
+		state := p.State()
+		if cond(state) {
+			return state
+		}
+		if time.Now().After(limite) {
+			t.Fatalf("timeout esperando estado, último: %+v", state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewSimPLCInvalido(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		modificar func(s *config.Sorter)
+	}{
+		{"endpoint sin puerto", func(s *config.Sorter) { s.PLCEndpoint = "opc.tcp://127.0.0.1" }},
+		{"sin método", func(s *config.Sorter) { s.PLC.MethodID = "" }},
+		{"NodeID inválido", func(s *config.Sorter) { s.PLC.TriggerNodeID = "ns=x;s=Trigger" }},
+		{"NodeID repetido", func(s *config.Sorter) { s.PLC.BoxCounterNodeID = s.PLC.TriggerNodeID }},
+		{"nodo sobre el método", func(s *config.Sorter) { s.Salidas[0].PLC.EstadoNodeID = s.PLC.MethodID }},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			cfg := sorterSim(4840)
+			caso.modificar(&cfg)
+			if _, err := newSimPLC(cfg, simOptions{}); err == nil {
+				t.Error("configuración aceptada")
+			}
+		})
+	}
+}
+
+func TestSimPLCCallMethod(t *testing.T) {
+	p, err := newSimPLC(sorterSim(4840), simOptions{TrackingStart: 100})
+	if err != nil {
+		t.Fatalf("newSimPLC: %v", err)
+	}
+
+	invalidas := []struct {
+		nombre string
+		req    *ua.CallMethodRequest
+		status ua.StatusCode
+	}{
+		{"otro método", &ua.CallMethodRequest{ObjectID: ua.MustParseNodeID(p.objectID), MethodID: ua.NewNumericNodeID(4, 9)}, ua.StatusBadMethodInvalid},
+		{"sin argumentos", llamada(p), ua.StatusBadArgumentsMissing},
+		{"tipo de lane incorrecto", llamada(p, ua.MustVariant(int32(1))), ua.StatusBadInvalidArgument},
+		{"lane inexistente", llamada(p, ua.MustVariant(int16(7))), ua.StatusBadInvalidArgument},
+	}
+	for _, caso := range invalidas {
+		if result := p.callMethod(caso.req); result.StatusCode != caso.status {
+			t.Errorf("%s: status %v, esperado %v", caso.nombre, result.StatusCode, caso.status)
+		}
+	}
+
+	// Lane 0 es el warm-up del cliente: no crea una caja
+	if result := p.callMethod(llamada(p, ua.MustVariant(int16(0)))); result.StatusCode != ua.StatusOK || p.State().Asignaciones != 0 {
+		t.Fatalf("warm-up: status %v, %d asignaciones", result.StatusCode, p.State().Asignaciones)
+	}
+
+	// Caja normal, mal desviada y perdida
+	trackings := make([]uint16, 0, 2)
+	for i := 0; i < 2; i++ {
+		result := p.callMethod(llamada(p, ua.MustVariant(int16(1))))
+		if result.StatusCode != ua.StatusOK || len(result.OutputArguments) != 1 {
+			t.Fatalf("caja %d: status %v, salidas %v", i, result.StatusCode, result.OutputArguments)
+		}
+		trackings = append(trackings, result.OutputArguments[0].Value().(uint16))
+		p.InjectDivertFaults(1, 0)
+	}
+	p.InjectDivertFaults(0, 1)
+	p.callMethod(llamada(p, ua.MustVariant(int16(2))))
+
+	if !reflect.DeepEqual(trackings, []uint16{100, 101}) {
+		t.Errorf("trackings = %v, esperado [100 101]", trackings)
+	}
+	esperarEstado(t, p, func(s simState) bool { return s.Salidas[0].Cajas+s.Salidas[1].Cajas == 2 })
+	time.Sleep(20 * time.Millisecond) // la caja perdida no debe confirmarse
+	state := p.State()
+	if state.Asignaciones != 3 || state.ContadorCajas != uint32(3) || state.Trigger != false {
+		t.Errorf("asignaciones %d, contador %v, trigger %v; esperado 3, 3, false", state.Asignaciones, state.ContadorCajas, state.Trigger)
+	}
+	// La primera caja salió por la lane 1 y la segunda (mal desviada) por la 2; la tercera se perdió
+	if state.Salidas[0].Cajas != 1 || state.Salidas[1].Cajas != 1 || state.Salidas[0].UltimoTracking != trackings[0] || state.Salidas[1].UltimoTracking != trackings[1] {
+		t.Errorf("salidas = %+v", state.Salidas)
+	}
+	if state.MalDesvios != 0 || state.Perdidas != 0 {
+		t.Errorf("fallas pendientes: %d mal desviadas, %d perdidas", state.MalDesvios, state.Perdidas)
+	}
+}
+
+func TestSimPLCSetEstadoYBloqueo(t *testing.T) {
+	p, err := newSimPLC(sorterSim(4840), simOptions{})
+	if err != nil {
+		t.Fatalf("newSimPLC: %v", err)
+	}
+
+	if err := p.SetEstado(2, estadoFalla); err != nil {
+		t.Fatalf("SetEstado: %v", err)
+	}
+	if err := p.SetBloqueo(1, true); err != nil {
+		t.Fatalf("SetBloqueo: %v", err)
+	}
+	state := p.State()
+	if state.Salidas[1].Estado != estadoFalla || state.Salidas[0].Bloqueo != true || state.Salidas[0].Estado != estadoAndando {
+		t.Errorf("salidas = %+v", state.Salidas)
+	}
+
+	if err := p.SetEstado(3, estadoFalla); err == nil {
+		t.Error("salida inexistente aceptada")
+	}
+	if err := p.SetEstado(1, 5); err == nil {
+		t.Error("estado fuera de rango aceptado")
+	}
+}
+
+// TestSimPLCOPCUA verifica el simulador con un cliente OPC UA real: asignación, lectura de nodos
+// y caída de sesiones a través del proxy
+func TestSimPLCOPCUA(t *testing.T) {
+	if testing.Short() {
+		t.Skip("levanta un servidor OPC UA")
+	}
+	port, err := puertoLibre("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newSimPLC(sorterSim(port), simOptions{Host: "127.0.0.1", TrackingStart: 1})
+	if err != nil {
+		t.Fatalf("newSimPLC: %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(p.Stop)
+
+	conectar := func() *opcua.Client {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client, err := opcua.NewClient(p.endpoint(), opcua.SecurityMode(ua.MessageSecurityModeNone), opcua.AutoReconnect(false))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		return client
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := conectar()
+
+	result, err := client.Call(ctx, llamada(p, ua.MustVariant(int16(2))))
+	if err != nil || result.StatusCode != ua.StatusOK {
+		t.Fatalf("Call: %v (status %v)", err, result)
+	}
+	if tracking := result.OutputArguments[0].Value(); tracking != uint16(1) {
+		t.Errorf("tracking = %v, esperado 1", tracking)
+	}
+
+	if err := p.SetEstado(1, estadoFalla); err != nil {
+		t.Fatalf("SetEstado: %v", err)
+	}
+	resp, err := client.Read(ctx, &ua.ReadRequest{NodesToRead: []*ua.ReadValueID{
+		{NodeID: ua.MustParseNodeID("ns=4;s=Salida1.Estado"), AttributeID: ua.AttributeIDValue},
+		{NodeID: ua.MustParseNodeID("ns=4;s=ContadorCajas"), AttributeID: ua.AttributeIDValue},
+	}})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if estado, contador := resp.Results[0].Value.Value(), resp.Results[1].Value.Value(); estado != estadoFalla || contador != uint32(1) {
+		t.Errorf("estado %v, contador %v; esperado %d y 1", estado, contador, estadoFalla)
+	}
+
+	// Caída de sesiones: la conexión se corta y las nuevas se rechazan hasta que termina la caída
+	if err := p.DropSessions(300 * time.Millisecond); err != nil {
+		t.Fatalf("DropSessions: %v", err)
+	}
+	if err := p.DropSessions(time.Second); err == nil {
+		t.Error("segunda caída aceptada durante la primera")
+	}
+	if _, err := client.Call(ctx, llamada(p, ua.MustVariant(int16(1)))); err == nil {
+		t.Error("llamada exitosa con la sesión cortada")
+	}
+	client.Close(ctx)
+
+	esperarEstado(t, p, func(s simState) bool { return !s.Caido })
+	client = conectar()
+	defer client.Close(ctx)
+	if result, err := client.Call(ctx, llamada(p, ua.MustVariant(int16(1)))); err != nil || result.StatusCode != ua.StatusOK {
+		t.Fatalf("Call tras la caída: %v (status %v)", err, result)
+	}
+	if state := p.State(); state.Caidas != 1 || state.ConexionesAcep < 2 {
+		t.Errorf("caídas %d, conexiones aceptadas %d", state.Caidas, state.ConexionesAcep)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// sessionProxy reenvía las conexiones TCP del puerto de plc_endpoint al servidor OPC UA interno.
+// El servidor de gopcua no cierra los sockets de sus canales seguros, así que las caídas de
+// sesión se simulan cortando las conexiones aquí.
+type sessionProxy struct {
+	listener net.Listener
+	backend  string
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	rechazar  bool // Caída en curso: las conexiones nuevas se cierran al aceptarlas
+	aceptadas int64
+}
+
+// newSessionProxy escucha en addr y reenvía cada conexión a backend
+func newSessionProxy(addr, backend string) (*sessionProxy, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	px := &sessionProxy{
+		listener: listener,
+		backend:  backend,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go px.serve()
+	return px, nil
+}
+
+// serve acepta conexiones hasta que se cierra el listener
+func (px *sessionProxy) serve() {
+	for {
+		conn, err := px.listener.Accept()
+		if err != nil {
+			return
+		}
+		go px.handle(conn)
+	}
+}
+
+// handle copia los datos en ambos sentidos entre el cliente y el servidor interno
+func (px *sessionProxy) handle(client net.Conn) {
+	px.mu.Lock()
+	if px.rechazar {
+		px.mu.Unlock()
+		client.Close()
+		return
+	}
+	px.mu.Unlock()
+
+	backend, err := net.Dial("tcp", px.backend)
+	if err != nil {
+		log.Printf("⚠️  No se pudo conectar al servidor OPC UA interno %s: %v", px.backend, err)
+		client.Close()
+		return
+	}
+
+	px.mu.Lock()
+	px.conns[client] = struct{}{}
+	px.conns[backend] = struct{}{}
+	px.aceptadas++
+	px.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copiar := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		// Un lado cerrado corta la conexión completa
+		dst.Close()
+		src.Close()
+	}
+	go copiar(backend, client)
+	go copiar(client, backend)
+	wg.Wait()
+
+	px.mu.Lock()
+	delete(px.conns, client)
+	delete(px.conns, backend)
+	px.mu.Unlock()
+}
+
+// Drop corta todas las conexiones abiertas; con rechazar=true las nuevas se cierran hasta Resume
+func (px *sessionProxy) Drop(rechazar bool) int {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	px.rechazar = rechazar
+	cortadas := len(px.conns) / 2
+	for conn := range px.conns {
+		conn.Close()
+	}
+	return cortadas
+}
+
+// Resume vuelve a aceptar conexiones después de una caída
+func (px *sessionProxy) Resume() {
+	px.mu.Lock()
+	px.rechazar = false
+	px.mu.Unlock()
+}
+
+// Stats retorna las conexiones abiertas y las aceptadas desde el inicio
+func (px *sessionProxy) Stats() (abiertas int, aceptadas int64) {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	return len(px.conns) / 2, px.aceptadas
+}
+
+// Close deja de escuchar y corta las conexiones abiertas
+func (px *sessionProxy) Close() {
+	px.listener.Close()
+	px.Drop(true)
+}
+
+// puertoLibre retorna un puerto TCP libre en host para el servidor OPC UA interno
+func puertoLibre(host string) (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, fmt.Errorf("no se pudo reservar un puerto interno: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -30,9 +30,11 @@ log.Println("══════════════════════
 log.Println("TEST: Asignar caja a salida 5")
 log.Println("═══════════════════════════════════════")
 
-err = manager.AssignLaneToBox(context.Background(), 1, 5)
+asignacion, err := manager.AssignLaneToBox(context.Background(), 1, 5, time.Time{})
 if err != nil {
 log.Printf("❌ Error final: %v\n", err)
+} else if asignacion.Tracking != nil {
+log.Printf("📦 Tracking PLC: %d\n", *asignacion.Tracking)
 }
 
 time.Sleep(1 * time.Second)
@@ -33,10 +33,9 @@ func NewClient(config PLCConfig) *Client {
 func (c *Client) Connect(ctx context.Context) error {
 	t0 := time.Now()
 
-	opts := []opcua.Option{
-		opcua.SecurityMode(ua.MessageSecurityModeNone),
-		opcua.SecurityPolicy(ua.SecurityPolicyURINone),
-		opcua.AutoReconnect(true),
+	opts, err := c.clientOptions(ctx)
+	if err != nil {
+		return err
 	}
 
 	t1 := time.Now()
@@ -48,7 +47,7 @@ func (c *Client) Connect(ctx context.Context) error {
 
 	t2 := time.Now()
 	if err := client.Connect(ctx); err != nil {
-		return fmt.Errorf("error al conectar a %s: %w", c.endpoint, err)
+		return fmt.Errorf("error al conectar a %s: %w", c.endpoint, c.describeConnectError(err))
 	}
 	log.Printf("⏱️  [Connect] ⚡ client.Connect(): %dms", time.Since(t2).Milliseconds())
 
@@ -229,10 +228,9 @@ func (c *Client) reconnect(ctx context.Context) error {
 
 	// Crear nueva conexión
 	t2 := time.Now()
-	opts := []opcua.Option{
-		opcua.SecurityMode(ua.MessageSecurityModeNone),
-		opcua.SecurityPolicy(ua.SecurityPolicyURINone),
-		opcua.AutoReconnect(true),
+	opts, err := c.clientOptions(ctx)
+	if err != nil {
+		return err
 	}
 
 	client, err := opcua.NewClient(c.endpoint, opts...)
@@ -243,7 +241,7 @@ func (c *Client) reconnect(ctx context.Context) error {
 
 	t3 := time.Now()
 	if err := client.Connect(ctx); err != nil {
-		return fmt.Errorf("error al conectar: %w", err)
+		return fmt.Errorf("error al conectar: %w", c.describeConnectError(err))
 	}
 	log.Printf("⏱️  [Reconnect] ⚡ client.Connect(): %dms", time.Since(t3).Milliseconds())
 
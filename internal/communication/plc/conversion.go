@@ -2,6 +2,7 @@ package plc
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 )
 
@@ -292,3 +293,37 @@ func ConvertValue(value interface{}, dataType string) (interface{}, error) {
 		return value, nil
 	}
 }
+
+// ToUint16 convierte un valor entero de OPC UA a uint16 (falso si no es entero o no cabe en 16 bits)
+func ToUint16(value interface{}) (uint16, bool) {
+	var v int64
+	switch x := value.(type) {
+	case uint16:
+		return x, true
+	case uint8:
+		v = int64(x)
+	case uint32:
+		v = int64(x)
+	case uint64:
+		if x > math.MaxUint16 {
+			return 0, false
+		}
+		v = int64(x)
+	case int8:
+		v = int64(x)
+	case int16:
+		v = int64(x)
+	case int32:
+		v = int64(x)
+	case int64:
+		v = x
+	case int:
+		v = int64(x)
+	default:
+		return 0, false
+	}
+	if v < 0 || v > math.MaxUint16 {
+		return 0, false
+	}
+	return uint16(v), true
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"API-GREENEX/internal/config"
+	"API-GREENEX/internal/models"
 
 	"github.com/gopcua/opcua/ua"
 )
@@ -23,6 +24,9 @@ type Manager struct {
 	config       *config.Config
 	clients      map[string]*Client
 	clientsMutex sync.RWMutex
+
+	queues      map[int]*commandQueue // Cola serializada de comandos por sorter
+	queuesMutex sync.Mutex
 }
 
 // NewManager crea un nuevo gestor de clientes OPC UA
@@ -30,16 +34,49 @@ func NewManager(cfg *config.Config) *Manager {
 	return &Manager{
 		clients: make(map[string]*Client),
 		config:  cfg,
+		queues:  make(map[int]*commandQueue),
+	}
+}
+
+// queueFor retorna la cola de comandos de un sorter, creándola en el primer uso
+func (m *Manager) queueFor(sorterID int) *commandQueue {
+	m.queuesMutex.Lock()
+	defer m.queuesMutex.Unlock()
+	q, ok := m.queues[sorterID]
+	if !ok {
+		q = newCommandQueue(sorterID)
+		m.queues[sorterID] = q
 	}
+	return q
+}
+
+// enqueue envía un comando por la cola del sorter: las llamadas a métodos y escrituras llegan al PLC
+// de a una, primero las de mayor prioridad. Con deadline, el comando se descarta si no alcanza a salir.
+func (m *Manager) enqueue(ctx context.Context, sorterID int, prioridad CommandPriority, deadline time.Time, nombre string, run func(ctx context.Context) error) error {
+	return m.queueFor(sorterID).Submit(ctx, prioridad, deadline, nombre, run)
+}
+
+// GetQueueStats retorna la profundidad y las latencias de la cola de comandos de un sorter
+func (m *Manager) GetQueueStats(sorterID int) models.PLCQueueStats {
+	return m.queueFor(sorterID).Stats()
 }
 
 // ConnectAll establece conexiones con todos los PLCs configurados
 func (m *Manager) ConnectAll(ctx context.Context) error {
-	endpoints := make(map[string]bool)
+	// Un cliente por endpoint: los sorters que lo comparten deben usar la misma seguridad
+	endpoints := make(map[string]PLCConfig)
 	for _, sorter := range m.config.Sorters {
-		if sorter.PLCEndpoint != "" {
-			endpoints[sorter.PLCEndpoint] = true
+		if sorter.PLCEndpoint == "" {
+			continue
 		}
+		plcCfg, err := PLCConfigFromSorter(sorter)
+		if err != nil {
+			return fmt.Errorf("sorter %d: configuración opcua inválida: %w", sorter.ID, err)
+		}
+		if previo, ok := endpoints[sorter.PLCEndpoint]; ok && !previo.sameSession(plcCfg) {
+			return fmt.Errorf("sorter %d: el endpoint %s ya está configurado con otra seguridad por otro sorter", sorter.ID, sorter.PLCEndpoint)
+		}
+		endpoints[sorter.PLCEndpoint] = plcCfg
 	}
 
 	if len(endpoints) == 0 {
@@ -51,11 +88,12 @@ func (m *Manager) ConnectAll(ctx context.Context) error {
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(endpoints))
 
-	for endpoint := range endpoints {
+	for endpoint, plcCfg := range endpoints {
 		wg.Add(1)
-		go func(ep string) {
+		go func(ep string, plcCfg PLCConfig) {
 			defer wg.Done()
-			client := NewClient(PLCConfig{Endpoint: ep})
+			log.Printf("🔐 %s: seguridad %s", ep, plcCfg.describe())
+			client := NewClient(plcCfg)
 			if err := client.Connect(ctx); err != nil {
 				errChan <- fmt.Errorf("error conectando a %s: %w", ep, err)
 				return
@@ -64,7 +102,7 @@ func (m *Manager) ConnectAll(ctx context.Context) error {
 			m.clients[ep] = client
 			m.clientsMutex.Unlock()
 			log.Printf("✅ Conexión establecida con %s", ep)
-		}(endpoint)
+		}(endpoint, plcCfg)
 	}
 
 	wg.Wait()
@@ -83,8 +121,15 @@ func (m *Manager) ConnectAll(ctx context.Context) error {
 	return nil
 }
 
-// CloseAll cierra todas las conexiones
+// CloseAll detiene las colas de comandos y cierra todas las conexiones
 func (m *Manager) CloseAll(ctx context.Context) {
+	m.queuesMutex.Lock()
+	for _, q := range m.queues {
+		q.Close()
+	}
+	m.queues = make(map[int]*commandQueue)
+	m.queuesMutex.Unlock()
+
 	m.clientsMutex.Lock()
 	defer m.clientsMutex.Unlock()
 	for endpoint, client := range m.clients {
@@ -134,7 +179,9 @@ func (m *Manager) WriteNode(ctx context.Context, sorterID int, nodeID string, va
 	if err != nil {
 		return err
 	}
-	return client.WriteNode(ctx, nodeID, value)
+	return m.enqueue(ctx, sorterID, PriorityHousekeeping, time.Time{}, "write "+nodeID, func(ctx context.Context) error {
+		return client.WriteNode(ctx, nodeID, value)
+	})
 }
 
 // WriteNodeTyped escribe en un nodo con conversión de tipo explícita (como dantrack)
@@ -143,7 +190,9 @@ func (m *Manager) WriteNodeTyped(ctx context.Context, sorterID int, nodeID strin
 	if err != nil {
 		return err
 	}
-	return client.WriteNodeTyped(ctx, nodeID, value, dataType)
+	return m.enqueue(ctx, sorterID, PriorityHousekeeping, time.Time{}, "write "+nodeID, func(ctx context.Context) error {
+		return client.WriteNodeTyped(ctx, nodeID, value, dataType)
+	})
 }
 
 // AppendToArrayNode agrega un elemento a un array de ExtensionObject en un nodo de un sorter
@@ -159,7 +208,9 @@ func (m *Manager) AppendToArrayNode(ctx context.Context, sorterID int, nodeID st
 		return fmt.Errorf("el elemento debe ser un *ua.ExtensionObject")
 	}
 
-	return client.AppendToArrayNode(ctx, nodeID, extObj)
+	return m.enqueue(ctx, sorterID, PriorityHousekeeping, time.Time{}, "append "+nodeID, func(ctx context.Context) error {
+		return client.AppendToArrayNode(ctx, nodeID, extObj)
+	})
 }
 
 // AppendToUInt32Array agrega un elemento a un array de uint32 en un nodo de un sorter
@@ -169,7 +220,9 @@ func (m *Manager) AppendToUInt32Array(ctx context.Context, sorterID int, nodeID
 		return err
 	}
 
-	return client.AppendToUInt32Array(ctx, nodeID, newValue)
+	return m.enqueue(ctx, sorterID, PriorityHousekeeping, time.Time{}, "append "+nodeID, func(ctx context.Context) error {
+		return client.AppendToUInt32Array(ctx, nodeID, newValue)
+	})
 }
 
 // BrowseNode explora los nodos hijos de un nodo específico de un sorter
@@ -182,8 +235,19 @@ func (m *Manager) BrowseNode(ctx context.Context, sorterID int, nodeID string) (
 	return client.BrowseNode(ctx, nodeID)
 }
 
-// CallMethod invoca un método OPC UA en un sorter específico
+// CallMethod invoca un método OPC UA en un sorter específico (por la cola, como mantenimiento)
 func (m *Manager) CallMethod(ctx context.Context, sorterID int, objectID string, methodID string, inputArgs []*ua.Variant) ([]interface{}, error) {
+	var outputValues []interface{}
+	err := m.enqueue(ctx, sorterID, PriorityHousekeeping, time.Time{}, "call "+methodID, func(ctx context.Context) error {
+		var err error
+		outputValues, err = m.callMethod(ctx, sorterID, objectID, methodID, inputArgs)
+		return err
+	})
+	return outputValues, err
+}
+
+// callMethod invoca el método directamente; solo para comandos que ya tienen el turno de la cola
+func (m *Manager) callMethod(ctx context.Context, sorterID int, objectID string, methodID string, inputArgs []*ua.Variant) ([]interface{}, error) {
 	client, _, err := m.getClientForSorter(sorterID)
 	if err != nil {
 		return nil, err
@@ -345,9 +409,43 @@ func (m *Manager) MonitorMultipleNodes(ctx context.Context, sorterID int, nodeID
 	return client.MonitorMultipleNodes(ctx, nodeIDs, interval)
 }
 
-// AssignLaneToBox replica el comportamiento del código Rust:
-// Intenta llamar al método del PLC para asignar una caja a una salida
-func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber int16) error {
+// AssignLaneToBox asigna una caja a una salida con prioridad de desvío en la cola del sorter.
+// leida es el momento de la lectura de la caja: con plc.box_travel_time configurado, la asignación se
+// descarta (ErrCommandExpired) si no alcanza a salir antes de que la caja llegue a las salidas.
+// Retorna el número de seguimiento que el PLC asigna a la caja (Output[0] del método).
+func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber int16, leida time.Time) (LaneAssignment, error) {
+	sorterConfig := m.sorterConfig(sorterID)
+	if sorterConfig == nil {
+		return LaneAssignment{}, fmt.Errorf("sorter ID %d no encontrado", sorterID)
+	}
+
+	var deadline time.Time
+	if travel := sorterConfig.PLC.GetBoxTravelTime(); travel > 0 && !leida.IsZero() {
+		deadline = leida.Add(travel)
+	}
+
+	var asignacion LaneAssignment
+	err := m.enqueue(ctx, sorterID, PriorityDivert, deadline, fmt.Sprintf("AssignLaneToBox lane %d", laneNumber), func(ctx context.Context) error {
+		var err error
+		asignacion, err = m.assignLaneToBox(ctx, sorterID, laneNumber)
+		return err
+	})
+	return asignacion, err
+}
+
+// sorterConfig busca la configuración de un sorter (nil si no existe)
+func (m *Manager) sorterConfig(sorterID int) *config.Sorter {
+	for i := range m.config.Sorters {
+		if m.config.Sorters[i].ID == sorterID {
+			return &m.config.Sorters[i]
+		}
+	}
+	return nil
+}
+
+// assignLaneToBox replica el comportamiento del código Rust:
+// Intenta llamar al método del PLC para asignar una caja a una salida.
+func (m *Manager) assignLaneToBox(ctx context.Context, sorterID int, laneNumber int16) (LaneAssignment, error) {
 	// Buscar configuración del sorter
 	var sorterConfig *config.Sorter
 	for _, sorter := range m.config.Sorters {
@@ -358,7 +456,7 @@ func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber
 	}
 
 	if sorterConfig == nil {
-		return fmt.Errorf("sorter ID %d no encontrado", sorterID)
+		return LaneAssignment{}, fmt.Errorf("sorter ID %d no encontrado", sorterID)
 	}
 
 	// Buscar el NodeID del ESTADO de la salida (el método espera un NodeID, NO un número)
@@ -371,7 +469,7 @@ func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber
 	}
 
 	if estadoNodeID == "" {
-		return fmt.Errorf("no se encontró nodo ESTADO para lane %d en sorter %d", laneNumber, sorterID)
+		return LaneAssignment{}, fmt.Errorf("no se encontró nodo ESTADO para lane %d en sorter %d", laneNumber, sorterID)
 	}
 
 	// Intentar llamar al método con el NÚMERO de salida como int16
@@ -385,7 +483,7 @@ func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber
 
 			warmUpVariant := ua.MustVariant(int16(0))
 			warmUpInputArgs := []*ua.Variant{warmUpVariant}
-			_, err := m.CallMethod(ctx, sorterID, sorterConfig.PLC.ObjectID, sorterConfig.PLC.MethodID, warmUpInputArgs)
+			_, err := m.callMethod(ctx, sorterID, sorterConfig.PLC.ObjectID, sorterConfig.PLC.MethodID, warmUpInputArgs)
 			if err != nil {
 				logTs("⚠️  [Sorter %d] Error en warm up del método PLC: %v", sorterID, err)
 			} else {
@@ -451,17 +549,20 @@ func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber
 				time.Sleep(25 * time.Millisecond) // Política del PLC: 25ms entre reintentos
 			}
 
-			outputValues, lastErr = m.CallMethod(ctx, sorterID, sorterConfig.PLC.ObjectID, sorterConfig.PLC.MethodID, inputArgs)
+			outputValues, lastErr = m.callMethod(ctx, sorterID, sorterConfig.PLC.ObjectID, sorterConfig.PLC.MethodID, inputArgs)
 
 			// ✅ ÉXITO: Sin error
 			if lastErr == nil {
-				// Validar que hay output (algunos PLCs retornan valores de confirmación)
-				if len(outputValues) > 0 {
+				// El PLC retorna en Output[0] el número de seguimiento de la caja
+				assignment := LaneAssignment{Lane: laneNumber, Tracking: trackingFromOutput(outputValues), Output: outputValues}
+				if assignment.Tracking != nil {
+					logTs("✅ [Sorter %d] Método ejecutado - Lane %d asignado. Tracking PLC: %d", sorterID, laneNumber, *assignment.Tracking)
+				} else if len(outputValues) > 0 {
 					logTs("✅ [Sorter %d] Método ejecutado - Lane %d asignado. Output: %v", sorterID, laneNumber, outputValues)
 				} else {
 					logTs("✅ [Sorter %d] Método ejecutado - Lane %d asignado (sin output)", sorterID, laneNumber)
 				}
-				return nil
+				return assignment, nil
 			}
 
 			// ⚠️ ERROR DE SESIÓN: Reintentar en cualquier intento
@@ -477,11 +578,24 @@ func (m *Manager) AssignLaneToBox(ctx context.Context, sorterID int, laneNumber
 
 		// Si llegamos aquí, todos los intentos fallaron - ignorar envío según política del PLC
 		logTs("❌ [Sorter %d] Lane %d NO asignado después de %d intentos - IGNORADO", sorterID, laneNumber, maxRetries)
-		return fmt.Errorf("error llamando método PLC para lane %d en sorter %d (intentos: %d): %w", laneNumber, sorterID, maxRetries, lastErr)
+		return LaneAssignment{}, fmt.Errorf("error llamando método PLC para lane %d en sorter %d (intentos: %d): %w", laneNumber, sorterID, maxRetries, lastErr)
 	}
 
 	// Si no hay ObjectID o MethodID configurado, retornar error
-	return fmt.Errorf("no hay método PLC configurado para sorter %d", sorterID)
+	return LaneAssignment{}, fmt.Errorf("no hay método PLC configurado para sorter %d", sorterID)
+}
+
+// trackingFromOutput extrae el número de seguimiento de la caja del primer valor de salida del método.
+// El PLC lo declara uint16; se aceptan otros enteros no negativos que quepan en 16 bits.
+func trackingFromOutput(outputValues []interface{}) *uint16 {
+	if len(outputValues) == 0 {
+		return nil
+	}
+	tracking, ok := ToUint16(outputValues[0])
+	if !ok {
+		return nil
+	}
+	return &tracking
 }
 
 // WaitForSorterReady espera hasta que el trigger del sorter esté en false (disponible)
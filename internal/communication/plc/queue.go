@@ -0,0 +1,359 @@
+package plc
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"API-GREENEX/internal/models"
+)
+
+// CommandPriority es la prioridad de un comando en la cola del PLC (mayor valor = se envía antes)
+type CommandPriority int
+
+const (
+	PriorityHousekeeping CommandPriority = iota // Bloqueos y escrituras de mantenimiento
+	PriorityDivert                              // Asignación de salida a una caja en tránsito
+)
+
+// String implementa fmt.Stringer
+func (p CommandPriority) String() string {
+	switch p {
+	case PriorityDivert:
+		return "desvio"
+	case PriorityHousekeeping:
+		return "mantenimiento"
+	}
+	return fmt.Sprintf("prioridad_%d", int(p))
+}
+
+// priorities son las prioridades de la cola, de mayor a menor
+var priorities = []CommandPriority{PriorityDivert, PriorityHousekeeping}
+
+// ErrCommandExpired indica que un comando venció su plazo esperando turno y no se envió al PLC
+var ErrCommandExpired = errors.New("comando descartado: venció su plazo antes de llegar al PLC")
+
+// ErrQueueClosed indica que la cola del sorter se cerró (Manager.CloseAll) y el comando no se envió al PLC
+var ErrQueueClosed = errors.New("comando descartado: cola de comandos del PLC cerrada")
+
+// latencySamples es la cantidad de muestras recientes por prioridad usadas para los percentiles
+const latencySamples = 1000
+
+// plcCommand es una llamada o escritura pendiente en la cola de un sorter
+type plcCommand struct {
+	nombre    string
+	prioridad CommandPriority
+	seq       uint64    // Orden de llegada: FIFO dentro de la misma prioridad
+	deadline  time.Time // Vacío = sin plazo
+	ctx       context.Context
+	run       func(ctx context.Context) error
+	encolado  time.Time
+	index     int // Posición en el heap (-1 = ya salió de la cola)
+	done      chan error
+}
+
+// commandHeap ordena los comandos por prioridad y luego por orden de llegada
+type commandHeap []*plcCommand
+
+func (h commandHeap) Len() int { return len(h) }
+func (h commandHeap) Less(i, j int) bool {
+	if h[i].prioridad != h[j].prioridad {
+		return h[i].prioridad > h[j].prioridad
+	}
+	return h[i].seq < h[j].seq
+}
+func (h commandHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *commandHeap) Push(x interface{}) {
+	cmd := x.(*plcCommand)
+	cmd.index = len(*h)
+	*h = append(*h, cmd)
+}
+func (h *commandHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	cmd := old[n-1]
+	old[n-1] = nil
+	cmd.index = -1
+	*h = old[:n-1]
+	return cmd
+}
+
+// latencyWindow guarda las últimas latencias en un buffer circular
+type latencyWindow struct {
+	muestras []float64
+	next     int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	ms := float64(d.Microseconds()) / 1000
+	if len(w.muestras) < latencySamples {
+		w.muestras = append(w.muestras, ms)
+		return
+	}
+	w.muestras[w.next] = ms
+	w.next = (w.next + 1) % latencySamples
+}
+
+// percentiles calcula p50/p90/p99/max por rango más cercano
+func (w *latencyWindow) percentiles() models.PLCLatencyPercentiles {
+	n := len(w.muestras)
+	if n == 0 {
+		return models.PLCLatencyPercentiles{}
+	}
+	ordenadas := append([]float64(nil), w.muestras...)
+	sort.Float64s(ordenadas)
+	rango := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(n))) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= n {
+			i = n - 1
+		}
+		return ordenadas[i]
+	}
+	return models.PLCLatencyPercentiles{
+		Muestras: n,
+		P50:      rango(0.50),
+		P90:      rango(0.90),
+		P99:      rango(0.99),
+		Max:      ordenadas[n-1],
+	}
+}
+
+// priorityStats son los contadores de una prioridad
+type priorityStats struct {
+	encolados, ejecutados, fallidos, vencidos, cancelados int64
+	espera, ejecucion                                     latencyWindow
+}
+
+// commandQueue serializa los comandos a un PLC: un solo comando en vuelo a la vez,
+// primero los de mayor prioridad y, dentro de una prioridad, en orden de llegada
+type commandQueue struct {
+	sorterID int
+
+	mu             sync.Mutex
+	cond           *sync.Cond
+	pendientes     commandHeap
+	seq            uint64
+	enCurso        string
+	profundidadMax int
+	stats          map[CommandPriority]*priorityStats
+	cerrada        bool
+	terminado      chan struct{} // Se cierra cuando el worker termina
+}
+
+// newCommandQueue crea la cola de un sorter e inicia su worker
+func newCommandQueue(sorterID int) *commandQueue {
+	q := &commandQueue{
+		sorterID:  sorterID,
+		stats:     make(map[CommandPriority]*priorityStats),
+		terminado: make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for _, p := range priorities {
+		q.stats[p] = &priorityStats{}
+	}
+	go q.worker()
+	return q
+}
+
+// statsFor retorna los contadores de una prioridad (q.mu tomado)
+func (q *commandQueue) statsFor(p CommandPriority) *priorityStats {
+	st, ok := q.stats[p]
+	if !ok {
+		st = &priorityStats{}
+		q.stats[p] = st
+	}
+	return st
+}
+
+// Submit encola un comando y espera su resultado. Si vence deadline o se cancela ctx mientras
+// espera turno, el comando se retira de la cola sin enviarse (ErrCommandExpired / ctx.Err()).
+// Un comando que ya está en vuelo se espera hasta que termine.
+func (q *commandQueue) Submit(ctx context.Context, prioridad CommandPriority, deadline time.Time, nombre string, run func(ctx context.Context) error) error {
+	cmd := &plcCommand{
+		nombre:    nombre,
+		prioridad: prioridad,
+		deadline:  deadline,
+		ctx:       ctx,
+		run:       run,
+		encolado:  time.Now(),
+		done:      make(chan error, 1),
+	}
+
+	q.mu.Lock()
+	if q.cerrada {
+		q.mu.Unlock()
+		return fmt.Errorf("%w (%s)", ErrQueueClosed, nombre)
+	}
+	q.seq++
+	cmd.seq = q.seq
+	heap.Push(&q.pendientes, cmd)
+	q.statsFor(prioridad).encolados++
+	if len(q.pendientes) > q.profundidadMax {
+		q.profundidadMax = len(q.pendientes)
+	}
+	q.mu.Unlock()
+	q.cond.Signal()
+
+	var vence <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		vence = timer.C
+	}
+
+	select {
+	case err := <-cmd.done:
+		return err
+	case <-vence:
+		if q.retirar(cmd, true) {
+			return fmt.Errorf("%w (%s, %v en cola)", ErrCommandExpired, nombre, time.Since(cmd.encolado).Round(time.Millisecond))
+		}
+	case <-ctx.Done():
+		if q.retirar(cmd, false) {
+			return ctx.Err()
+		}
+	}
+	// Ya estaba en vuelo: esperar su resultado real
+	return <-cmd.done
+}
+
+// retirar saca un comando que todavía espera turno; retorna false si ya salió de la cola
+func (q *commandQueue) retirar(cmd *plcCommand, vencido bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if cmd.index < 0 {
+		return false
+	}
+	heap.Remove(&q.pendientes, cmd.index)
+	st := q.statsFor(cmd.prioridad)
+	if vencido {
+		st.vencidos++
+	} else {
+		st.cancelados++
+	}
+	return true
+}
+
+// Close detiene el worker: los comandos que esperan turno fallan con ErrQueueClosed y el
+// comando en vuelo (si lo hay) termina normalmente. No espera al worker (ver terminado).
+func (q *commandQueue) Close() {
+	q.mu.Lock()
+	if q.cerrada {
+		q.mu.Unlock()
+		return
+	}
+	q.cerrada = true
+	pendientes := q.pendientes
+	q.pendientes = nil
+	for _, cmd := range pendientes {
+		cmd.index = -1
+		q.statsFor(cmd.prioridad).cancelados++
+	}
+	q.mu.Unlock()
+	q.cond.Broadcast()
+
+	for _, cmd := range pendientes {
+		cmd.done <- fmt.Errorf("%w (%s)", ErrQueueClosed, cmd.nombre)
+	}
+}
+
+// worker envía los comandos de a uno hasta que se cierra la cola
+func (q *commandQueue) worker() {
+	defer close(q.terminado)
+	for {
+		q.mu.Lock()
+		for len(q.pendientes) == 0 && !q.cerrada {
+			q.cond.Wait()
+		}
+		if q.cerrada {
+			q.mu.Unlock()
+			return
+		}
+		cmd := heap.Pop(&q.pendientes).(*plcCommand)
+		st := q.statsFor(cmd.prioridad)
+
+		if !cmd.deadline.IsZero() && !time.Now().Before(cmd.deadline) {
+			st.vencidos++
+			q.mu.Unlock()
+			cmd.done <- fmt.Errorf("%w (%s, %v en cola)", ErrCommandExpired, cmd.nombre, time.Since(cmd.encolado).Round(time.Millisecond))
+			continue
+		}
+		if err := cmd.ctx.Err(); err != nil {
+			st.cancelados++
+			q.mu.Unlock()
+			cmd.done <- err
+			continue
+		}
+
+		st.espera.add(time.Since(cmd.encolado))
+		q.enCurso = cmd.nombre
+		q.mu.Unlock()
+
+		// Un comando con plazo no puede retener el PLC más allá de ese plazo
+		ctx, cancel := cmd.ctx, context.CancelFunc(func() {})
+		if !cmd.deadline.IsZero() {
+			ctx, cancel = context.WithDeadline(cmd.ctx, cmd.deadline)
+		}
+		inicio := time.Now()
+		err := cmd.run(ctx)
+		cancel()
+
+		q.mu.Lock()
+		q.enCurso = ""
+		st.ejecucion.add(time.Since(inicio))
+		if err != nil {
+			st.fallidos++
+		} else {
+			st.ejecutados++
+		}
+		q.mu.Unlock()
+
+		cmd.done <- err
+	}
+}
+
+// Stats retorna la profundidad, contadores y percentiles de latencia de la cola
+func (q *commandQueue) Stats() models.PLCQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	profundidad := make(map[CommandPriority]int)
+	for _, cmd := range q.pendientes {
+		profundidad[cmd.prioridad]++
+	}
+
+	stats := models.PLCQueueStats{
+		SorterID:       q.sorterID,
+		Profundidad:    len(q.pendientes),
+		ProfundidadMax: q.profundidadMax,
+		EnCurso:        q.enCurso,
+		Prioridades:    make([]models.PLCCommandStats, 0, len(priorities)),
+	}
+	for _, p := range priorities {
+		st := q.statsFor(p)
+		stats.Prioridades = append(stats.Prioridades, models.PLCCommandStats{
+			Prioridad:   p.String(),
+			Profundidad: profundidad[p],
+			Encolados:   st.encolados,
+			Ejecutados:  st.ejecutados,
+			Fallidos:    st.fallidos,
+			Vencidos:    st.vencidos,
+			Cancelados:  st.cancelados,
+			EsperaMs:    st.espera.percentiles(),
+			EjecucionMs: st.ejecucion.percentiles(),
+		})
+	}
+	return stats
+}
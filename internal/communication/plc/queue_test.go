@@ -0,0 +1,207 @@
+package plc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"API-GREENEX/internal/config"
+)
+
+// bloquearCola deja un comando en vuelo hasta que se cierre el canal retornado
+func bloquearCola(t *testing.T, q *commandQueue) (liberar func(), terminado <-chan error) {
+	t.Helper()
+	enVuelo := make(chan struct{})
+	soltar := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Submit(context.Background(), PriorityHousekeeping, time.Time{}, "bloqueo", func(ctx context.Context) error {
+			close(enVuelo)
+			<-soltar
+			return nil
+		})
+	}()
+	<-enVuelo
+	return func() { close(soltar) }, done
+}
+
+// esperarProfundidad espera a que la cola tenga n comandos pendientes
+func esperarProfundidad(t *testing.T, q *commandQueue, n int) {
+	t.Helper()
+	limite := time.Now().Add(2 * time.Second)
+	for q.Stats().Profundidad != n {
+		if time.Now().After(limite) {
+			t.Fatalf("profundidad = %d, se esperaba %d", q.Stats().Profundidad, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCommandQueueOrdenPorPrioridad(t *testing.T) {
+	q := newCommandQueue(1)
+	liberar, bloqueo := bloquearCola(t, q)
+
+	var mu sync.Mutex
+	var orden []string
+	registrar := func(nombre string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			orden = append(orden, nombre)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	encolar := func(p CommandPriority, nombre string, pendientes int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.Submit(context.Background(), p, time.Time{}, nombre, registrar(nombre)); err != nil {
+				t.Errorf("%s: %v", nombre, err)
+			}
+		}()
+		esperarProfundidad(t, q, pendientes)
+	}
+	encolar(PriorityHousekeeping, "mant1", 1)
+	encolar(PriorityDivert, "desvio1", 2)
+	encolar(PriorityHousekeeping, "mant2", 3)
+	encolar(PriorityDivert, "desvio2", 4)
+
+	liberar()
+	wg.Wait()
+	if err := <-bloqueo; err != nil {
+		t.Fatalf("bloqueo: %v", err)
+	}
+
+	esperado := []string{"desvio1", "desvio2", "mant1", "mant2"}
+	if len(orden) != len(esperado) {
+		t.Fatalf("orden = %v, se esperaba %v", orden, esperado)
+	}
+	for i := range esperado {
+		if orden[i] != esperado[i] {
+			t.Fatalf("orden = %v, se esperaba %v", orden, esperado)
+		}
+	}
+}
+
+func TestCommandQueueDescartaComandoVencido(t *testing.T) {
+	q := newCommandQueue(1)
+	liberar, _ := bloquearCola(t, q)
+	defer liberar()
+
+	enviado := false
+	err := q.Submit(context.Background(), PriorityDivert, time.Now().Add(20*time.Millisecond), "asignar", func(ctx context.Context) error {
+		enviado = true
+		return nil
+	})
+	if !errors.Is(err, ErrCommandExpired) {
+		t.Fatalf("err = %v, se esperaba ErrCommandExpired", err)
+	}
+	if enviado {
+		t.Fatal("un comando vencido no debe enviarse al PLC")
+	}
+
+	stats := q.Stats()
+	if stats.Profundidad != 0 {
+		t.Fatalf("profundidad = %d, el comando vencido debe salir de la cola", stats.Profundidad)
+	}
+	if desvio := stats.Prioridades[0]; desvio.Prioridad != "desvio" || desvio.Vencidos != 1 || desvio.Ejecutados != 0 {
+		t.Fatalf("stats desvio = %+v", desvio)
+	}
+}
+
+func TestCommandQueueStats(t *testing.T) {
+	q := newCommandQueue(7)
+	fallo := errors.New("BadSessionIDInvalid")
+	for i := 0; i < 3; i++ {
+		if err := q.Submit(context.Background(), PriorityHousekeeping, time.Time{}, "escribir", func(ctx context.Context) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Submit(context.Background(), PriorityHousekeeping, time.Time{}, "escribir", func(ctx context.Context) error { return fallo }); !errors.Is(err, fallo) {
+		t.Fatalf("err = %v, se esperaba el error del PLC", err)
+	}
+
+	stats := q.Stats()
+	if stats.SorterID != 7 || len(stats.Prioridades) != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	mant := stats.Prioridades[1]
+	if mant.Prioridad != "mantenimiento" || mant.Encolados != 4 || mant.Ejecutados != 3 || mant.Fallidos != 1 {
+		t.Fatalf("stats mantenimiento = %+v", mant)
+	}
+	if mant.EsperaMs.Muestras != 4 || mant.EjecucionMs.Muestras != 4 {
+		t.Fatalf("muestras espera=%d ejecucion=%d, se esperaban 4", mant.EsperaMs.Muestras, mant.EjecucionMs.Muestras)
+	}
+}
+
+func TestLatencyWindowPercentiles(t *testing.T) {
+	var w latencyWindow
+	for i := 1; i <= 100; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	p := w.percentiles()
+	if p.Muestras != 100 || p.P50 != 50 || p.P90 != 90 || p.P99 != 99 || p.Max != 100 {
+		t.Fatalf("percentiles = %+v", p)
+	}
+
+	// El buffer conserva solo las últimas latencySamples muestras
+	for i := 0; i < latencySamples; i++ {
+		w.add(5 * time.Millisecond)
+	}
+	if p := w.percentiles(); p.Muestras != latencySamples || p.Max != 5 {
+		t.Fatalf("percentiles tras llenar el buffer = %+v", p)
+	}
+}
+
+func TestCommandQueueClose(t *testing.T) {
+	q := newCommandQueue(1)
+	liberar, bloqueo := bloquearCola(t, q)
+
+	pendiente := make(chan error, 1)
+	go func() {
+		pendiente <- q.Submit(context.Background(), PriorityDivert, time.Time{}, "asignar", func(ctx context.Context) error {
+			t.Error("un comando pendiente no debe enviarse tras cerrar la cola")
+			return nil
+		})
+	}()
+	esperarProfundidad(t, q, 1)
+
+	q.Close()
+	if err := <-pendiente; !errors.Is(err, ErrQueueClosed) {
+		t.Fatalf("pendiente: err = %v, se esperaba ErrQueueClosed", err)
+	}
+
+	// El comando en vuelo termina normalmente y luego el worker se detiene
+	liberar()
+	if err := <-bloqueo; err != nil {
+		t.Fatalf("en vuelo: %v", err)
+	}
+	select {
+	case <-q.terminado:
+	case <-time.After(2 * time.Second):
+		t.Fatal("el worker no terminó al cerrar la cola")
+	}
+
+	if err := q.Submit(context.Background(), PriorityHousekeeping, time.Time{}, "escribir", func(ctx context.Context) error { return nil }); !errors.Is(err, ErrQueueClosed) {
+		t.Fatalf("Submit tras Close: err = %v, se esperaba ErrQueueClosed", err)
+	}
+}
+
+func TestManagerCloseAllStopsQueues(t *testing.T) {
+	m := NewManager(&config.Config{})
+	q := m.queueFor(1)
+
+	m.CloseAll(context.Background())
+	select {
+	case <-q.terminado:
+	case <-time.After(2 * time.Second):
+		t.Fatal("CloseAll no detuvo el worker de la cola")
+	}
+	if m.queueFor(1) == q {
+		t.Error("tras CloseAll el sorter debe recibir una cola nueva")
+	}
+}
@@ -0,0 +1,351 @@
+package plc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"API-GREENEX/internal/config"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// Rutas por defecto del certificado del cliente cuando la política exige uno y no se configuró
+const (
+	defaultCertificatePath = "certs/opcua_client_cert.pem"
+	defaultPrivateKeyPath  = "certs/opcua_client_key.pem"
+)
+
+// Vigencia del certificado autofirmado generado en el primer inicio
+const clientCertificateValidity = 10 * 365 * 24 * time.Hour
+
+// PLCConfigFromSorter arma la configuración de conexión de un sorter (plc_endpoint + opcua)
+func PLCConfigFromSorter(sorter config.Sorter) (PLCConfig, error) {
+	cfg := PLCConfig{Endpoint: sorter.PLCEndpoint, SecurityPolicy: ua.SecurityPolicyURINone, SecurityMode: ua.MessageSecurityModeNone}
+	opc := sorter.OPCUA
+	if opc == nil {
+		return cfg, nil
+	}
+
+	policy, err := parseSecurityPolicy(opc.SecurityPolicy)
+	if err != nil {
+		return cfg, err
+	}
+	mode, err := parseSecurityMode(opc.SecurityMode)
+	if err != nil {
+		return cfg, err
+	}
+	if policy == ua.SecurityPolicyURINone && mode != ua.MessageSecurityModeNone {
+		return cfg, fmt.Errorf("security_mode %s requiere una security_policy distinta de None", mode)
+	}
+	if policy != ua.SecurityPolicyURINone && mode == ua.MessageSecurityModeNone {
+		return cfg, fmt.Errorf("security_policy %s requiere security_mode Sign o SignAndEncrypt", opc.SecurityPolicy)
+	}
+	if opc.Username == "" && opc.Password != "" {
+		return cfg, fmt.Errorf("password configurado sin username")
+	}
+
+	connectTimeout, err := opc.GetConnectionTimeoutDuration()
+	if err != nil {
+		return cfg, fmt.Errorf("connection_timeout inválido: %w", err)
+	}
+	sessionTimeout, err := opc.GetSessionTimeoutDuration()
+	if err != nil {
+		return cfg, fmt.Errorf("session_timeout inválido: %w", err)
+	}
+
+	cfg.SecurityPolicy = policy
+	cfg.SecurityMode = mode
+	cfg.Username = opc.Username
+	cfg.Password = opc.Password
+	cfg.CertificatePath = opc.CertificatePath
+	cfg.PrivateKeyPath = opc.PrivateKeyPath
+	cfg.ApplicationURI = opc.ApplicationURI
+	cfg.ConnectionTimeout = connectTimeout
+	cfg.SessionTimeout = sessionTimeout
+
+	if cfg.secured() {
+		if cfg.CertificatePath == "" {
+			cfg.CertificatePath = defaultCertificatePath
+		}
+		if cfg.PrivateKeyPath == "" {
+			cfg.PrivateKeyPath = defaultPrivateKeyPath
+		}
+	}
+	return cfg, nil
+}
+
+// secured indica si el canal usa firma/cifrado (y por lo tanto certificado de cliente)
+func (c PLCConfig) secured() bool {
+	return c.SecurityMode != ua.MessageSecurityModeNone
+}
+
+// sameSession indica si dos sorters pueden compartir la sesión con el mismo endpoint
+func (c PLCConfig) sameSession(o PLCConfig) bool {
+	return c == o
+}
+
+// describe resume la seguridad configurada para los logs
+func (c PLCConfig) describe() string {
+	auth := "anónimo"
+	if c.Username != "" {
+		auth = "usuario " + c.Username
+	}
+	return fmt.Sprintf("%s/%s, %s", policyName(c.SecurityPolicy), modeName(c.SecurityMode), auth)
+}
+
+// parseSecurityPolicy acepta el nombre corto (Basic256Sha256, Aes128_Sha256_RsaOaep) o la URI completa
+func parseSecurityPolicy(policy string) (string, error) {
+	if policy == "" || strings.EqualFold(policy, "none") {
+		return ua.SecurityPolicyURINone, nil
+	}
+	nombre := strings.ReplaceAll(strings.TrimPrefix(policy, ua.SecurityPolicyURIPrefix), "_", "")
+	for corto, uri := range ua.SecurityPolicyURIs {
+		if strings.EqualFold(corto, nombre) {
+			return uri, nil
+		}
+	}
+	return "", fmt.Errorf("security_policy '%s' no soportada (None, Basic256Sha256, Aes128_Sha256_RsaOaep, Aes256_Sha256_RsaPss, Basic256, Basic128Rsa15)", policy)
+}
+
+// parseSecurityMode acepta None, Sign o SignAndEncrypt (sin distinguir mayúsculas, con o sin "_")
+func parseSecurityMode(mode string) (ua.MessageSecurityMode, error) {
+	switch strings.ToLower(strings.NewReplacer("_", "", "&", "and", " ", "").Replace(mode)) {
+	case "", "none":
+		return ua.MessageSecurityModeNone, nil
+	case "sign":
+		return ua.MessageSecurityModeSign, nil
+	case "signandencrypt":
+		return ua.MessageSecurityModeSignAndEncrypt, nil
+	}
+	return ua.MessageSecurityModeInvalid, fmt.Errorf("security_mode '%s' no soportado (None, Sign, SignAndEncrypt)", mode)
+}
+
+// clientOptions arma las opciones de gopcua según la seguridad configurada.
+// Con seguridad consulta los endpoints del servidor para tomar su certificado y la política del token de usuario.
+func (c *Client) clientOptions(ctx context.Context) ([]opcua.Option, error) {
+	cfg := c.config
+	opts := []opcua.Option{opcua.AutoReconnect(true)}
+	if cfg.ConnectionTimeout > 0 {
+		opts = append(opts, opcua.DialTimeout(cfg.ConnectionTimeout))
+	}
+	if cfg.SessionTimeout > 0 {
+		opts = append(opts, opcua.SessionTimeout(cfg.SessionTimeout))
+	}
+
+	if !cfg.secured() && cfg.Username == "" {
+		return append(opts,
+			opcua.SecurityMode(ua.MessageSecurityModeNone),
+			opcua.SecurityPolicy(ua.SecurityPolicyURINone),
+		), nil
+	}
+
+	endpoints, err := opcua.GetEndpoints(ctx, c.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar endpoints de %s: %w", c.endpoint, err)
+	}
+	ep, authType, err := c.selectEndpoint(endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.secured() {
+		if err := ensureClientCertificate(cfg.CertificatePath, cfg.PrivateKeyPath, cfg.ApplicationURI); err != nil {
+			return nil, err
+		}
+		opts = append(opts, opcua.CertificateFile(cfg.CertificatePath), opcua.PrivateKeyFile(cfg.PrivateKeyPath))
+	}
+
+	opts = append(opts, opcua.SecurityFromEndpoint(ep, authType))
+	if cfg.Username != "" {
+		opts = append(opts, opcua.AuthUsername(cfg.Username, cfg.Password))
+	} else {
+		opts = append(opts, opcua.AuthAnonymous())
+	}
+	return opts, nil
+}
+
+// selectEndpoint elige el endpoint del servidor con la política y modo configurados
+// y verifica que acepte el tipo de autenticación (usuario o anónima)
+func (c *Client) selectEndpoint(endpoints []*ua.EndpointDescription) (*ua.EndpointDescription, ua.UserTokenType, error) {
+	cfg := c.config
+	ep, err := opcua.SelectEndpoint(endpoints, cfg.SecurityPolicy, cfg.SecurityMode)
+	if err != nil {
+		return nil, 0, fmt.Errorf("el servidor %s no ofrece %s/%s (disponibles: %s)",
+			c.endpoint, policyName(cfg.SecurityPolicy), modeName(cfg.SecurityMode), describeEndpoints(endpoints))
+	}
+
+	authType := ua.UserTokenTypeAnonymous
+	if cfg.Username != "" {
+		authType = ua.UserTokenTypeUserName
+	}
+	if !endpointAccepts(ep, authType) {
+		return nil, 0, fmt.Errorf("el endpoint %s/%s de %s no acepta autenticación %s",
+			policyName(ep.SecurityPolicyURI), modeName(ep.SecurityMode), c.endpoint, strings.TrimPrefix(authType.String(), "UserTokenType"))
+	}
+	return ep, authType, nil
+}
+
+// endpointAccepts indica si el endpoint ofrece el tipo de token de usuario
+func endpointAccepts(ep *ua.EndpointDescription, authType ua.UserTokenType) bool {
+	for _, t := range ep.UserIdentityTokens {
+		if t.TokenType == authType {
+			return true
+		}
+	}
+	return false
+}
+
+// describeEndpoints lista política/modo de los endpoints del servidor
+func describeEndpoints(endpoints []*ua.EndpointDescription) string {
+	descripciones := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		descripciones = append(descripciones, policyName(ep.SecurityPolicyURI)+"/"+modeName(ep.SecurityMode))
+	}
+	return strings.Join(descripciones, ", ")
+}
+
+// policyName retorna el nombre corto de una política (ej: "Basic256Sha256")
+func policyName(uri string) string {
+	return strings.TrimPrefix(uri, ua.SecurityPolicyURIPrefix)
+}
+
+// modeName retorna el nombre corto de un modo de seguridad (ej: "SignAndEncrypt")
+func modeName(mode ua.MessageSecurityMode) string {
+	return strings.TrimPrefix(mode.String(), "MessageSecurityMode")
+}
+
+// describeConnectError agrega a los rechazos de seguridad del servidor qué revisar en el PLC o la config
+func (c *Client) describeConnectError(err error) error {
+	cfg := c.config
+	switch {
+	case errors.Is(err, ua.StatusBadCertificateUntrusted), errors.Is(err, ua.StatusBadSecurityChecksFailed):
+		return fmt.Errorf("el PLC %s rechazó el certificado del cliente (%s): agregue %s a los certificados confiables del servidor OPC UA: %w",
+			c.endpoint, certificateThumbprint(cfg.CertificatePath), cfg.CertificatePath, err)
+	case errors.Is(err, ua.StatusBadCertificateInvalid), errors.Is(err, ua.StatusBadCertificateTimeInvalid),
+		errors.Is(err, ua.StatusBadCertificateURIInvalid), errors.Is(err, ua.StatusBadCertificateHostNameInvalid),
+		errors.Is(err, ua.StatusBadCertificateUseNotAllowed):
+		return fmt.Errorf("el PLC %s considera inválido el certificado %s (vigencia, URI de aplicación o uso): %w",
+			c.endpoint, cfg.CertificatePath, err)
+	case errors.Is(err, ua.StatusBadIdentityTokenRejected), errors.Is(err, ua.StatusBadIdentityTokenInvalid),
+		errors.Is(err, ua.StatusBadUserAccessDenied):
+		return fmt.Errorf("el PLC %s rechazó el usuario '%s' (revise username/password): %w", c.endpoint, cfg.Username, err)
+	case errors.Is(err, ua.StatusBadSecurityPolicyRejected):
+		return fmt.Errorf("el PLC %s rechazó la política %s: %w", c.endpoint, policyName(cfg.SecurityPolicy), err)
+	}
+	return err
+}
+
+// ensureClientCertificate verifica el par certificado/clave del cliente y lo genera autofirmado si no existe
+func ensureClientCertificate(certPath, keyPath, appURI string) error {
+	_, errCert := os.Stat(certPath)
+	_, errKey := os.Stat(keyPath)
+	switch {
+	case errCert == nil && errKey == nil:
+		return nil
+	case errCert == nil || errKey == nil:
+		return fmt.Errorf("existe solo uno de certificate_path (%s) y private_key_path (%s): elimine el otro para regenerar el par", certPath, keyPath)
+	case !os.IsNotExist(errCert):
+		return fmt.Errorf("error al leer certificado %s: %w", certPath, errCert)
+	case !strings.HasSuffix(certPath, ".pem") || !strings.HasSuffix(keyPath, ".pem"):
+		return fmt.Errorf("el certificado autofirmado se genera en PEM: certificate_path y private_key_path deben terminar en .pem")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	if appURI == "" {
+		appURI = fmt.Sprintf("urn:%s:danich:api-greenex", hostname)
+	}
+
+	certPEM, keyPEM, err := generateClientCertificate(appURI, hostname)
+	if err != nil {
+		return fmt.Errorf("error al generar certificado OPC UA: %w", err)
+	}
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("error al crear directorio %s: %w", dir, err)
+		}
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("error al guardar clave privada %s: %w", keyPath, err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return fmt.Errorf("error al guardar certificado %s: %w", certPath, err)
+	}
+
+	log.Printf("🔐 Certificado OPC UA autofirmado generado: %s (%s, %s)", certPath, appURI, certificateThumbprint(certPath))
+	log.Printf("   ↳ Debe agregarse a los certificados confiables del PLC antes de conectar con seguridad")
+	return nil
+}
+
+// generateClientCertificate crea un certificado de aplicación OPC UA autofirmado (RSA 2048, PEM)
+func generateClientCertificate(appURI, hostname string) (certPEM, keyPEM []byte, err error) {
+	uri, err := url.Parse(appURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("application_uri inválida: %w", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "API-GREENEX OPC UA Client",
+			Organization: []string{"Danich"},
+		},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(clientCertificateValidity),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+		DNSNames:              []string{hostname},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM, nil
+}
+
+// certificateThumbprint retorna la huella SHA-1 del certificado (la que muestran los PLC al confiarlo)
+func certificateThumbprint(certPath string) string {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return "huella no disponible"
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	sum := sha1.Sum(data)
+	return "SHA1 " + strings.ToUpper(hex.EncodeToString(sum[:]))
+}
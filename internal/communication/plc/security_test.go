@@ -0,0 +1,200 @@
+package plc
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"API-GREENEX/internal/config"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestParseSecurityPolicy(t *testing.T) {
+	casos := []struct {
+		entrada string
+		uri     string
+		valida  bool
+	}{
+		{"", ua.SecurityPolicyURINone, true},
+		{"NONE", ua.SecurityPolicyURINone, true},
+		{"Basic256Sha256", ua.SecurityPolicyURIBasic256Sha256, true},
+		{"basic256sha256", ua.SecurityPolicyURIBasic256Sha256, true},
+		{"Aes128_Sha256_RsaOaep", ua.SecurityPolicyURIAes128Sha256RsaOaep, true},
+		{ua.SecurityPolicyURIAes256Sha256RsaPss, ua.SecurityPolicyURIAes256Sha256RsaPss, true},
+		{"Basic512", "", false},
+	}
+	for _, caso := range casos {
+		uri, err := parseSecurityPolicy(caso.entrada)
+		if (err == nil) != caso.valida || uri != caso.uri {
+			t.Errorf("parseSecurityPolicy(%q) = (%s, %v), esperado %s válida=%v", caso.entrada, uri, err, caso.uri, caso.valida)
+		}
+	}
+}
+
+func TestParseSecurityMode(t *testing.T) {
+	casos := []struct {
+		entrada string
+		modo    ua.MessageSecurityMode
+		valido  bool
+	}{
+		{"", ua.MessageSecurityModeNone, true},
+		{"None", ua.MessageSecurityModeNone, true},
+		{"sign", ua.MessageSecurityModeSign, true},
+		{"SignAndEncrypt", ua.MessageSecurityModeSignAndEncrypt, true},
+		{"sign_and_encrypt", ua.MessageSecurityModeSignAndEncrypt, true},
+		{"Sign & Encrypt", ua.MessageSecurityModeSignAndEncrypt, true},
+		{"encrypt", ua.MessageSecurityModeInvalid, false},
+	}
+	for _, caso := range casos {
+		modo, err := parseSecurityMode(caso.entrada)
+		if (err == nil) != caso.valido || modo != caso.modo {
+			t.Errorf("parseSecurityMode(%q) = (%s, %v), esperado %s válido=%v", caso.entrada, modo, err, caso.modo, caso.valido)
+		}
+	}
+}
+
+func TestPLCConfigFromSorter(t *testing.T) {
+	casos := []struct {
+		nombre string
+		opcua  *config.OPCUAConfig
+		valida bool
+		cert   string // certificado esperado ("" = sin certificado)
+	}{
+		{"sin bloque opcua", nil, true, ""},
+		{"usuario sin seguridad", &config.OPCUAConfig{Username: "sorter", Password: "x"}, true, ""},
+		{"firma con certificado por defecto", &config.OPCUAConfig{SecurityPolicy: "Basic256Sha256", SecurityMode: "Sign"}, true, defaultCertificatePath},
+		{"certificado configurado", &config.OPCUAConfig{SecurityPolicy: "Basic256Sha256", SecurityMode: "SignAndEncrypt",
+			CertificatePath: "pki/cert.pem", PrivateKeyPath: "pki/key.pem"}, true, "pki/cert.pem"},
+		{"política sin modo", &config.OPCUAConfig{SecurityPolicy: "Basic256Sha256"}, false, ""},
+		{"modo sin política", &config.OPCUAConfig{SecurityMode: "Sign"}, false, ""},
+		{"password sin usuario", &config.OPCUAConfig{Password: "x"}, false, ""},
+		{"política desconocida", &config.OPCUAConfig{SecurityPolicy: "Basic512", SecurityMode: "Sign"}, false, ""},
+		{"timeout inválido", &config.OPCUAConfig{ConnectionTimeout: "5"}, false, ""},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			cfg, err := PLCConfigFromSorter(config.Sorter{PLCEndpoint: "opc.tcp://10.0.0.1:4840", OPCUA: caso.opcua})
+			if (err == nil) != caso.valida {
+				t.Fatalf("PLCConfigFromSorter = %v, esperado válida=%v", err, caso.valida)
+			}
+			if caso.valida && (cfg.CertificatePath != caso.cert || cfg.secured() != (caso.cert != "")) {
+				t.Errorf("certificado %q (seguro=%v), esperado %q", cfg.CertificatePath, cfg.secured(), caso.cert)
+			}
+		})
+	}
+}
+
+func TestSelectEndpoint(t *testing.T) {
+	anonimo := &ua.UserTokenPolicy{TokenType: ua.UserTokenTypeAnonymous}
+	usuario := &ua.UserTokenPolicy{TokenType: ua.UserTokenTypeUserName}
+	endpoints := func() []*ua.EndpointDescription {
+		return []*ua.EndpointDescription{
+			{SecurityPolicyURI: ua.SecurityPolicyURINone, SecurityMode: ua.MessageSecurityModeNone,
+				SecurityLevel: 0, UserIdentityTokens: []*ua.UserTokenPolicy{anonimo}},
+			{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSign,
+				SecurityLevel: 1, UserIdentityTokens: []*ua.UserTokenPolicy{usuario}},
+			{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt,
+				SecurityLevel: 2, UserIdentityTokens: []*ua.UserTokenPolicy{anonimo, usuario}},
+		}
+	}
+
+	casos := []struct {
+		nombre   string
+		policy   string
+		mode     ua.MessageSecurityMode
+		username string
+		auth     ua.UserTokenType
+		error    string // fragmento del error esperado ("" = sin error)
+	}{
+		{"sin seguridad anónimo", ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, "", ua.UserTokenTypeAnonymous, ""},
+		{"firma con usuario", ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSign, "sorter", ua.UserTokenTypeUserName, ""},
+		{"cifrado anónimo", ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSignAndEncrypt, "", ua.UserTokenTypeAnonymous, ""},
+		{"cifrado con usuario", ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSignAndEncrypt, "sorter", ua.UserTokenTypeUserName, ""},
+		{"usuario sin seguridad no ofrecido", ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, "sorter", 0, "no acepta autenticación UserName"},
+		{"firma anónima no ofrecida", ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSign, "", 0, "no acepta autenticación Anonymous"},
+		{"política no ofrecida", ua.SecurityPolicyURIAes128Sha256RsaOaep, ua.MessageSecurityModeSignAndEncrypt, "", 0, "disponibles: Basic256Sha256/SignAndEncrypt"},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			c := &Client{endpoint: "opc.tcp://10.0.0.1:4840", config: PLCConfig{
+				SecurityPolicy: caso.policy, SecurityMode: caso.mode, Username: caso.username,
+			}}
+			ep, auth, err := c.selectEndpoint(endpoints())
+			if caso.error != "" {
+				if err == nil || !strings.Contains(err.Error(), caso.error) {
+					t.Fatalf("error = %v, esperado %q", err, caso.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectEndpoint: %v", err)
+			}
+			if ep.SecurityPolicyURI != caso.policy || ep.SecurityMode != caso.mode || auth != caso.auth {
+				t.Errorf("endpoint %s/%s (%s), esperado %s/%s (%s)",
+					policyName(ep.SecurityPolicyURI), modeName(ep.SecurityMode), auth, policyName(caso.policy), modeName(caso.mode), caso.auth)
+			}
+		})
+	}
+}
+
+func TestEnsureClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "certs", "cliente.pem")
+	keyPath := filepath.Join(dir, "certs", "clave.pem")
+
+	if err := ensureClientCertificate(certPath, keyPath, "urn:test:api-greenex"); err != nil {
+		t.Fatalf("ensureClientCertificate: %v", err)
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("certificado no generado: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("certificado sin bloque PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("certificado inválido: %v", err)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "urn:test:api-greenex" || cert.NotAfter.Before(time.Now().AddDate(9, 0, 0)) {
+		t.Errorf("certificado con URIs %v y vigencia hasta %v", cert.URIs, cert.NotAfter)
+	}
+	if info, err := os.Stat(keyPath); err != nil {
+		t.Errorf("clave privada no generada: %v", err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("clave privada con permisos %v, esperado 0600", info.Mode().Perm())
+	}
+	if huella := certificateThumbprint(certPath); !strings.HasPrefix(huella, "SHA1 ") || len(huella) != 45 {
+		t.Errorf("huella = %q", huella)
+	}
+
+	// Un par existente se reutiliza sin regenerarlo
+	if err := ensureClientCertificate(certPath, keyPath, "urn:otra"); err != nil {
+		t.Fatalf("ensureClientCertificate con par existente: %v", err)
+	}
+	if actual, _ := os.ReadFile(certPath); !bytes.Equal(actual, certPEM) {
+		t.Error("certificado existente regenerado")
+	}
+
+	// Solo uno de los dos archivos: no se pisa el existente
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureClientCertificate(certPath, keyPath, ""); err == nil {
+		t.Error("par incompleto aceptado")
+	}
+
+	// El par autofirmado solo se genera en PEM
+	if err := ensureClientCertificate(filepath.Join(dir, "cliente.der"), filepath.Join(dir, "clave.der"), ""); err == nil {
+		t.Error("generación en DER aceptada")
+	}
+}
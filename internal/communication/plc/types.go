@@ -1,6 +1,8 @@
 package plc
 
 import (
+	"time"
+
 	"github.com/gopcua/opcua/ua"
 )
 
@@ -33,9 +35,28 @@ type SorterNodes struct {
 	Salidas    []SalidaNodes // Lista de nodos de cada salida
 }
 
+// LaneAssignment es el resultado de asignar una salida a una caja con el método del PLC.
+type LaneAssignment struct {
+	Lane     int16         // Salida física enviada (0 = descarte)
+	Tracking *uint16       // Número de seguimiento de la caja en el PLC (nil si el método no lo retornó)
+	Output   []interface{} // Valores de salida crudos del método
+}
+
 // PLCConfig contiene la configuración necesaria para conectarse a un PLC.
 type PLCConfig struct {
 	Endpoint string
+
+	// Seguridad (vacíos = None/None, sesión anónima)
+	SecurityPolicy  string // URI completa de la política (ej: ua.SecurityPolicyURIBasic256Sha256)
+	SecurityMode    ua.MessageSecurityMode
+	Username        string
+	Password        string
+	CertificatePath string
+	PrivateKeyPath  string
+	ApplicationURI  string
+
+	ConnectionTimeout time.Duration // 0 = default de gopcua
+	SessionTimeout    time.Duration // 0 = default de gopcua
 }
 
 // BrowseResult representa un nodo descubierto durante la exploración.
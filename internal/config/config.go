@@ -12,6 +12,7 @@ type Config struct {
 	Database      DatabaseConfig   `yaml:"database"`
 	HTTP          HTTPConfig       `yaml:"http"`
 	Statistics    StatisticsConfig `yaml:"statistics"`
+	Shifts        []Shift          `yaml:"shifts"`
 	CognexDevices []CognexDevice   `yaml:"cognex_devices"`
 	Sorters       []Sorter         `yaml:"sorters"`
 }
@@ -39,6 +40,40 @@ func (s *StatisticsConfig) GetFlowWindowDuration() time.Duration {
 	return duration
 }
 
+// Shift define el inicio de un turno de planta (usado por los planes de asignación programados)
+type Shift struct {
+	Name  string `yaml:"name"`  // Nombre del turno (ej: "noche")
+	Start string `yaml:"start"` // Hora de inicio local "HH:MM" (ej: "22:00")
+}
+
+// GetStartOffset retorna la hora de inicio del turno como duración desde medianoche
+func (s Shift) GetStartOffset() (time.Duration, error) {
+	inicio, err := time.Parse("15:04", s.Start)
+	if err != nil {
+		return 0, fmt.Errorf("hora de inicio inválida para turno '%s' (%q): se espera HH:MM", s.Name, s.Start)
+	}
+	return time.Duration(inicio.Hour())*time.Hour + time.Duration(inicio.Minute())*time.Minute, nil
+}
+
+// GetShiftStarts retorna el inicio de cada turno indexado por nombre
+func (c *Config) GetShiftStarts() (map[string]time.Duration, error) {
+	turnos := make(map[string]time.Duration, len(c.Shifts))
+	for _, shift := range c.Shifts {
+		if shift.Name == "" {
+			return nil, fmt.Errorf("turno sin nombre (start=%q)", shift.Start)
+		}
+		if _, exists := turnos[shift.Name]; exists {
+			return nil, fmt.Errorf("turno '%s' duplicado", shift.Name)
+		}
+		offset, err := shift.GetStartOffset()
+		if err != nil {
+			return nil, err
+		}
+		turnos[shift.Name] = offset
+	}
+	return turnos, nil
+}
+
 type DatabaseConfig struct {
 	Postgres  PostgresConfig  `yaml:"postgres"`
 	SQLServer SQLServerConfig `yaml:"sqlserver"`
@@ -50,6 +85,15 @@ type PostgresConfig struct {
 	MaxConns            int    `yaml:"max_conns"`
 	ConnectTimeout      string `yaml:"connect_timeout"`
 	HealthcheckInterval string `yaml:"healthcheck_interval"`
+
+	// Registro local de cajas cuando PostgreSQL no está disponible (nil = deshabilitado)
+	Journal *BoxJournalConfig `yaml:"journal,omitempty"`
+}
+
+// BoxJournalConfig configura el registro local (JSON por línea) de cajas con correlativo provisional
+type BoxJournalConfig struct {
+	Path              string `yaml:"path"`               // Archivo del registro (ej: "data/cajas_pendientes.jsonl")
+	ReconcileInterval string `yaml:"reconcile_interval"` // Cada cuánto se reintenta escribir en la BD (default "15s")
 }
 
 type SQLServerConfig struct {
@@ -78,14 +122,16 @@ func (s *SQLServerConfig) GetSKUSyncInterval() time.Duration {
 	return duration
 }
 
+// OPCUAConfig configura la seguridad y la sesión OPC UA con el PLC de un sorter
 type OPCUAConfig struct {
 	Endpoint             string `yaml:"endpoint"`
-	Username             string `yaml:"username"`
+	Username             string `yaml:"username"` // Vacío = sesión anónima
 	Password             string `yaml:"password"`
-	SecurityPolicy       string `yaml:"security_policy"`
-	SecurityMode         string `yaml:"security_mode"`
-	CertificatePath      string `yaml:"certificate_path"`
-	PrivateKeyPath       string `yaml:"private_key_path"`
+	SecurityPolicy       string `yaml:"security_policy"`  // None (default), Basic256Sha256, Aes128_Sha256_RsaOaep, Aes256_Sha256_RsaPss...
+	SecurityMode         string `yaml:"security_mode"`    // None (default), Sign, SignAndEncrypt
+	CertificatePath      string `yaml:"certificate_path"` // Certificado del cliente (PEM o DER); se genera autofirmado si no existe
+	PrivateKeyPath       string `yaml:"private_key_path"` // Clave privada RSA del cliente (PEM o DER)
+	ApplicationURI       string `yaml:"application_uri"`  // URI de aplicación del certificado generado (default "urn:<host>:danich:api-greenex")
 	ConnectionTimeout    string `yaml:"connection_timeout"`
 	SessionTimeout       string `yaml:"session_timeout"`
 	SubscriptionInterval string `yaml:"subscription_interval"`
@@ -102,23 +148,213 @@ type HTTPConfig struct {
 type CognexDevice struct {
 	ID            int    `yaml:"id"`
 	Name          string `yaml:"name"`
-	Host          string `yaml:"host"`            // Host remoto informativo (de dónde viene)
-	Port          int    `yaml:"port"`            // Puerto en el que escuchará (siempre 0.0.0.0)
+	Host          string `yaml:"host"`            // Host de la cámara (informativo en modo server, destino en modo client)
+	Port          int    `yaml:"port"`            // Puerto donde escucha la API (server) o de la cámara (client)
 	ScanMethod    string `yaml:"scan_method"`     // Método de escaneo por defecto: "QR" o "DATAMATRIX"
 	Ubicacion     string `yaml:"ubicacion"`       // Ubicación física del dispositivo
 	IntervalMs    int    `yaml:"interval_ms"`     // Intervalo entre lecturas (milisegundos) para simulador
 	NoReadPercent int    `yaml:"no_read_percent"` // Porcentaje de lecturas NO_READ para simulador
+
+	DuplicateWindowMs int  `yaml:"duplicate_window_ms"` // Suprimir lecturas del mismo código dentro de N ms (0 = deshabilitado)
+	DuplicateUsePLC   bool `yaml:"duplicate_use_plc"`   // Confirmar duplicados con el contador de cajas del PLC (plc.box_counter_node_id)
+	BoxPitchMs        int  `yaml:"box_pitch_ms"`        // Separación mínima entre cajas consecutivas frente a la cámara (default 500)
+
+	FrameDelimiter   string `yaml:"frame_delimiter"`    // Fin de trama: "crlf" (default), "cr", "lf" o "etx"
+	MaxFrameLength   int    `yaml:"max_frame_length"`   // Longitud máxima de una trama en bytes (default 1024)
+	PartialTimeoutMs int    `yaml:"partial_timeout_ms"` // Espera máxima del resto de una trama incompleta (default 200)
+	FlushOnTimeout   bool   `yaml:"flush_on_timeout"`   // Procesar la trama incompleta al vencer partial_timeout_ms (cámaras sin delimitador); false = descartarla
+
+	Payload *PayloadTemplate `yaml:"payload"` // Formato del QR (nil = ESPECIE;CALIBRE;DARK;EMBALAJE;VARIEDAD)
+
+	Mode           string `yaml:"mode"`             // "server" (default, escucha en 0.0.0.0:port) o "client" (se conecta a host:port)
+	ReconnectMinMs int    `yaml:"reconnect_min_ms"` // Modo client: espera inicial antes de reconectar (default 1000)
+	ReconnectMaxMs int    `yaml:"reconnect_max_ms"` // Modo client: espera máxima del backoff exponencial (default 30000)
+
+	RecordPath      string `yaml:"record_path"`        // Grabar las tramas crudas en este archivo (vacío = sin grabación)
+	RecordMaxSizeMB int    `yaml:"record_max_size_mb"` // Tamaño máximo antes de rotar (default 50)
+	RecordMaxFiles  int    `yaml:"record_max_files"`   // Archivos rotados que se conservan (default 5)
+
+	QueueDepth  int    `yaml:"queue_depth"`  // Eventos pendientes máximos hacia el sorter (default 100)
+	QueuePolicy string `yaml:"queue_policy"` // Cola llena: "block" (default), "drop_oldest" o "divert_to_reject"
+
+	AllowedSources     []string `yaml:"allowed_sources"`      // IPs o redes CIDR que pueden conectarse al puerto (vacío = cualquiera)
+	MaxConnections     int      `yaml:"max_connections"`      // Conexiones simultáneas máximas en el puerto (0 = sin límite)
+	ReplaceOnReconnect bool     `yaml:"replace_on_reconnect"` // Una reconexión del mismo origen (o sobre el límite) cierra la conexión más antigua
+
+	Control *CognexControl `yaml:"control"` // Canal de control Native Mode (nil = solo recepción)
+
+	ReadTrailer *ReadTrailer `yaml:"read_trailer"` // Datos de decodificación al final de la lectura (nil = no se agregan)
+}
+
+// Campos reconocidos al final de una lectura (formato de salida de la cámara)
+const (
+	TrailerSymbology = "symbology" // Simbología: identificador AIM (]Q1, ]d2) o nombre (QR, DATAMATRIX)
+	TrailerDecodeMs  = "decode_ms" // Tiempo de decodificación en milisegundos
+	TrailerGrade     = "grade"     // Grado de calidad ISO 15415: letra A-F o número 0-4
+)
+
+// ReadTrailer describe los datos que la cámara agrega a cada lectura después del código
+type ReadTrailer struct {
+	Delimiter       string   `yaml:"delimiter"`        // Separador entre el código y cada dato agregado (default "|")
+	Fields          []string `yaml:"fields"`           // Datos agregados al final, en orden: symbology, decode_ms, grade
+	SymbologyPrefix bool     `yaml:"symbology_prefix"` // El código empieza con el identificador AIM de simbología (]Q1, ]d2)
+	Symbologies     []string `yaml:"symbologies"`      // Simbologías aceptadas (vacío = cualquiera), ej: [QR]
+	MinGrade        string   `yaml:"min_grade"`        // Grado promedio reciente bajo el cual la cámara se marca degradada (ej: "C")
+}
+
+// CognexControl configura el canal de comandos Native Mode (telnet) de una cámara In-Sight
+type CognexControl struct {
+	Host           string `yaml:"host"`             // Host de la cámara (default: host del dispositivo)
+	Port           int    `yaml:"port"`             // Puerto telnet de la cámara (default 23)
+	User           string `yaml:"user"`             // Usuario (default "admin")
+	Password       string `yaml:"password"`         // Contraseña (vacía por defecto en In-Sight)
+	TimeoutMs      int    `yaml:"timeout_ms"`       // Timeout de conexión y respuesta (default 2000)
+	OfflineOnPause bool   `yaml:"offline_on_pause"` // Poner la cámara offline mientras su sorter está en pausa
+}
+
+// Campos reconocidos en una plantilla de QR
+const (
+	PayloadEspecie  = "especie"
+	PayloadCalibre  = "calibre"
+	PayloadDark     = "dark"
+	PayloadEmbalaje = "embalaje"
+	PayloadVariedad = "variedad"
+	PayloadMarca    = "marca"
+)
+
+// PayloadTemplate describe el formato del QR de la etiqueta leída por una cámara
+type PayloadTemplate struct {
+	Delimiter   string                        `yaml:"delimiter"`    // Separador de campos (default ";"), ignorado si hay regex
+	Fields      map[string]int                `yaml:"fields"`       // Campo → posición (desde 0)
+	Regex       string                        `yaml:"regex"`        // Alternativa a fields: grupos con nombre, ej: (?P<calibre>[^;]+)
+	Required    []string                      `yaml:"required"`     // Campos obligatorios (default: especie, calibre, embalaje, variedad)
+	DarkDefault int                           `yaml:"dark_default"` // Valor de dark si el campo no viene o no es 0/1
+	Normalize   map[string]FieldNormalization `yaml:"normalize"`    // Normalización por campo
+}
+
+// FieldNormalization normaliza el valor de un campo del QR (siempre se quitan espacios en los extremos)
+type FieldNormalization struct {
+	Case string            `yaml:"case"` // "upper", "lower" o "" (sin cambio)
+	Trim string            `yaml:"trim"` // Caracteres adicionales a quitar en los extremos (ej: "0")
+	Map  map[string]string `yaml:"map"`  // Reemplazo de valores exactos tras normalizar (ej: "S": "1")
+}
+
+// DefaultPayloadTemplate retorna el formato histórico ESPECIE;CALIBRE;DARK;EMBALAJE;VARIEDAD
+func DefaultPayloadTemplate() PayloadTemplate {
+	return PayloadTemplate{
+		Delimiter: ";",
+		Fields: map[string]int{
+			PayloadEspecie:  0,
+			PayloadCalibre:  1,
+			PayloadDark:     2,
+			PayloadEmbalaje: 3,
+			PayloadVariedad: 4,
+		},
+		Required: []string{PayloadEspecie, PayloadCalibre, PayloadEmbalaje, PayloadVariedad},
+	}
+}
+
+// GetPayloadTemplate retorna la plantilla de QR del dispositivo (o la histórica si no está configurada)
+func (d *CognexDevice) GetPayloadTemplate() PayloadTemplate {
+	if d.Payload == nil {
+		return DefaultPayloadTemplate()
+	}
+	tpl := *d.Payload
+	if tpl.Delimiter == "" {
+		tpl.Delimiter = ";"
+	}
+	if tpl.Required == nil {
+		tpl.Required = []string{PayloadEspecie, PayloadCalibre, PayloadEmbalaje, PayloadVariedad}
+	}
+	return tpl
 }
 
 type Sorter struct {
 	ID              int                   `yaml:"id"`
 	Name            string                `yaml:"name"`
-	CognexID        int                   `yaml:"cognex_id"`    // ID de la cámara Cognex QR/SKU principal del sorter
-	PLCEndpoint     string                `yaml:"plc_endpoint"` // Endpoint OPC UA (ej: "opc.tcp://192.168.120.100:4840")
+	CognexID        int                   `yaml:"cognex_id"`        // ID de la cámara Cognex QR/SKU principal del sorter
+	CognexIDs       []int                 `yaml:"cognex_ids"`       // Cámaras QR que forman un solo lector (ej: superior y lateral); la primera es la principal
+	FusionWindowMs  int                   `yaml:"fusion_window_ms"` // Ventana de fusión entre las lecturas de las cámaras del lector (default 150)
+	PLCEndpoint     string                `yaml:"plc_endpoint"`     // Endpoint OPC UA (ej: "opc.tcp://192.168.120.100:4840")
+	OPCUA           *OPCUAConfig          `yaml:"opcua,omitempty"`  // Seguridad y autenticación OPC UA (nil = sin seguridad, anónimo)
 	PLC             SorterPLCConfig       `yaml:"plc"`
 	PaletAutomatico PaletAutomaticoConfig `yaml:"palet_automatico"`
 	Salidas         []Salida              `yaml:"salidas"`
 	DefaultSalida   int                   `yaml:"default_salida"`
+	Routing         RoutingConfig         `yaml:"routing"`
+}
+
+type RoutingConfig struct {
+	Strategy      string            `yaml:"strategy"`       // "batch_round_robin" (default), "weighted", "least_recently_used", "least_filled"
+	SKUStrategies map[string]string `yaml:"sku_strategies"` // Estrategia específica por SKU (key=SKU, ej: "XL-LAPINS-CEMDCRAM44-0")
+	Capacity      CapacityConfig    `yaml:"capacity"`
+}
+
+type CapacityConfig struct {
+	Enabled           bool   `yaml:"enabled"`             // Consultar llenado de mesas y retener salidas con pallet por completarse
+	PollInterval      string `yaml:"poll_interval"`       // Intervalo de consulta a Serfruit (ej: "2s")
+	StaleAfter        string `yaml:"stale_after"`         // Antigüedad máxima del dato de llenado (ej: "10s")
+	HoldBackRemaining int    `yaml:"hold_back_remaining"` // Retener la salida cuando falten <= N cajas para completar el pallet (0 = solo pallet lleno)
+}
+
+// GetPollInterval retorna el intervalo de consulta de llenado de mesas
+func (c *CapacityConfig) GetPollInterval() time.Duration {
+	duration, err := time.ParseDuration(c.PollInterval)
+	if err != nil || duration <= 0 {
+		return 2 * time.Second // default
+	}
+	return duration
+}
+
+// GetStaleAfter retorna la antigüedad máxima aceptada para un dato de llenado
+func (c *CapacityConfig) GetStaleAfter() time.Duration {
+	duration, err := time.ParseDuration(c.StaleAfter)
+	if err != nil || duration <= 0 {
+		return 10 * time.Second // default
+	}
+	return duration
+}
+
+// GetWeights retorna el peso configurado de cada salida del sorter (key=salidaID)
+func (s *Sorter) GetWeights() map[int]int {
+	weights := make(map[int]int, len(s.Salidas))
+	for _, salida := range s.Salidas {
+		if salida.Weight > 0 {
+			weights[salida.ID] = salida.Weight
+		}
+	}
+	return weights
+}
+
+// GetOverflowChains retorna las cadenas de desborde configuradas (key=salidaID).
+// Valida que cada salida de la cadena exista en el sorter, no se repita y no sea la propia salida.
+func (s *Sorter) GetOverflowChains() (map[int][]int, error) {
+	ids := make(map[int]bool, len(s.Salidas))
+	for _, salida := range s.Salidas {
+		ids[salida.ID] = true
+	}
+
+	chains := make(map[int][]int)
+	for _, salida := range s.Salidas {
+		if len(salida.Overflow) == 0 {
+			continue
+		}
+		vistas := make(map[int]bool, len(salida.Overflow))
+		for _, destino := range salida.Overflow {
+			if destino == salida.ID {
+				return nil, fmt.Errorf("salida %d: no puede desbordar hacia sí misma", salida.ID)
+			}
+			if !ids[destino] {
+				return nil, fmt.Errorf("salida %d: salida de desborde %d no existe en el sorter #%d", salida.ID, destino, s.ID)
+			}
+			if vistas[destino] {
+				return nil, fmt.Errorf("salida %d: salida de desborde %d repetida", salida.ID, destino)
+			}
+			vistas[destino] = true
+		}
+		chains[salida.ID] = salida.Overflow
+	}
+	return chains, nil
 }
 
 type PaletAutomaticoConfig struct {
@@ -132,6 +368,46 @@ type SorterPLCConfig struct {
 	ObjectID      string `yaml:"object_id"`
 	MethodID      string `yaml:"method_id"`
 	TriggerNodeID string `yaml:"trigger_node_id"` // Nodo para verificar si el sorter está ocupado
+
+	BoxCounterNodeID string `yaml:"box_counter_node_id"` // Nodo contador de cajas que ingresan al sorter (opcional, para confirmar duplicados)
+
+	// Confirmación física de desvíos (opcional): FIFO del sorter y/o nodos por salida (divert_confirm_node_id)
+	DivertConfirmFIFONodeID string `yaml:"divert_confirm_fifo_node_id"` // Última caja desviada: [tracking, lane] (UInt16[2]) o UInt32 tracking<<16|lane
+	DivertConfirmTimeout    string `yaml:"divert_confirm_timeout"`      // Tiempo máximo entre la asignación y la confirmación (default 10s)
+
+	BoxTravelTime string `yaml:"box_travel_time"` // Tiempo de la caja desde la lectura QR hasta la primera salida (vacío = sin plazo)
+}
+
+// GetBoxTravelTime retorna el plazo para asignar la salida de una caja desde su lectura (0 = sin plazo).
+// Una asignación que no alcanza a salir hacia el PLC dentro del plazo se descarta: la caja ya pasó.
+func (p *SorterPLCConfig) GetBoxTravelTime() time.Duration {
+	duration, err := time.ParseDuration(p.BoxTravelTime)
+	if err != nil || duration <= 0 {
+		return 0
+	}
+	return duration
+}
+
+// GetDivertConfirmTimeout retorna el tiempo máximo para confirmar físicamente un desvío
+func (p *SorterPLCConfig) GetDivertConfirmTimeout() time.Duration {
+	duration, err := time.ParseDuration(p.DivertConfirmTimeout)
+	if err != nil || duration <= 0 {
+		return 10 * time.Second // default
+	}
+	return duration
+}
+
+// DivertConfirmEnabled indica si el sorter tiene algún nodo de confirmación de desvíos configurado
+func (s *Sorter) DivertConfirmEnabled() bool {
+	if s.PLC.DivertConfirmFIFONodeID != "" {
+		return true
+	}
+	for _, salida := range s.Salidas {
+		if salida.PLC.DivertConfirmNodeID != "" {
+			return true
+		}
+	}
+	return false
 }
 
 type Salida struct {
@@ -142,12 +418,18 @@ type Salida struct {
 	MesaID     int             `yaml:"mesa_id"`     // ID de la mesa de paletizado (solo para salidas automáticas)
 	CognexID   int             `yaml:"cognex_id"`   // ID de la cámara Cognex DataMatrix asignada a esta salida
 	BatchSize  int             `yaml:"batch_size"`  // Tamaño del lote para balance round-robin
+	Weight     int             `yaml:"weight"`      // Peso relativo para la estrategia "weighted" (default 1)
+	Overflow   []int           `yaml:"overflow"`    // Salidas de desborde en orden, antes de caer a REJECT (ej: [6, 2])
+	MaxRate    int             `yaml:"max_rate"`    // Ritmo máximo en cajas/minuto (0 = sin límite)
+	Burst      int             `yaml:"burst"`       // Cajas que puede recibir seguidas por sobre el ritmo (default 1)
 	PLC        SalidaPLCConfig `yaml:"plc"`
 }
 
 type SalidaPLCConfig struct {
 	EstadoNodeID  string `yaml:"estado_node_id"`  // Nodo OPC UA para leer/escribir estado numérico
 	BloqueoNodeID string `yaml:"bloqueo_node_id"` // Nodo OPC UA para leer/escribir bloqueo (opcional, "" = no tiene)
+
+	DivertConfirmNodeID string `yaml:"divert_confirm_node_id"` // Tracking de la última caja desviada en esta salida (opcional)
 }
 
 // LoadConfig carga la configuración desde el archivo YAML
@@ -174,11 +456,24 @@ func (p PostgresConfig) GetHealthcheckIntervalDuration() (time.Duration, error)
 	return time.ParseDuration(p.HealthcheckInterval)
 }
 
+func (j BoxJournalConfig) GetReconcileIntervalDuration() (time.Duration, error) {
+	if j.ReconcileInterval == "" {
+		return 15 * time.Second, nil
+	}
+	return time.ParseDuration(j.ReconcileInterval)
+}
+
 func (o OPCUAConfig) GetConnectionTimeoutDuration() (time.Duration, error) {
+	if o.ConnectionTimeout == "" {
+		return 0, nil
+	}
 	return time.ParseDuration(o.ConnectionTimeout)
 }
 
 func (o OPCUAConfig) GetSessionTimeoutDuration() (time.Duration, error) {
+	if o.SessionTimeout == "" {
+		return 0, nil
+	}
 	return time.ParseDuration(o.SessionTimeout)
 }
 
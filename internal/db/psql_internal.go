@@ -3,9 +3,11 @@ package db
 import (
 	"API-GREENEX/internal/models"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -200,7 +202,8 @@ func isNullOrEmpty(calibre, variedad, embalaje string) bool {
 	return false
 }
 
-func (m *PostgresManager) InsertNewBox(ctx context.Context, especie, variedad, calibre, embalaje string, dark int, linea string) (string, error) {
+// InsertNewBox inserta una caja leída por la cámara cognexID con la calidad de la lectura (calidad nil = no informada)
+func (m *PostgresManager) InsertNewBox(ctx context.Context, especie, variedad, calibre, embalaje string, dark int, linea string, cognexID int, calidad *models.ReadQuality) (string, error) {
 	// NO crear un nuevo manager cada vez, usar el singleton existente
 	if m == nil || m.pool == nil {
 		return "", fmt.Errorf("gestor de base de datos no inicializado")
@@ -237,7 +240,27 @@ func (m *PostgresManager) InsertNewBox(ctx context.Context, especie, variedad, c
 	// Paso 2: Insertar la caja
 	var correlativo string // ⚠️ CAMBIO: ahora es string, no int
 
-	err = m.pool.QueryRow(ctx, INSERT_CAJA_SIN_CORRELATIVO_INTERNAL_DB, especie, variedad, calibre, embalaje, dark, linea).Scan(&correlativo)
+	var cognex *int
+	if cognexID > 0 {
+		cognex = &cognexID
+	}
+	var simbologia, grado *string
+	var puntaje *float64
+	var decodeMs *int
+	if calidad != nil {
+		if calidad.Simbologia != "" {
+			simbologia = &calidad.Simbologia
+		}
+		if calidad.Grado != "" {
+			grado, puntaje = &calidad.Grado, &calidad.Puntaje
+		}
+		if calidad.DecodeMs >= 0 {
+			decodeMs = &calidad.DecodeMs
+		}
+	}
+
+	err = m.pool.QueryRow(ctx, INSERT_CAJA_SIN_CORRELATIVO_INTERNAL_DB, especie, variedad, calibre, embalaje, dark, linea,
+		cognex, simbologia, grado, puntaje, decodeMs).Scan(&correlativo)
 	if err != nil {
 		return "", fmt.Errorf("error al insertar caja: %w", err)
 	}
@@ -524,6 +547,107 @@ func (m *PostgresManager) InsertSalidaCaja(ctx context.Context, correlativo stri
 	return nil
 }
 
+// InsertSalidaCajaOverflow registra un salto de la cadena de desborde de una caja
+// Parámetros:
+//   - salidaID / salidaRelativa: salida del salto (la prevista, una intermedia o la final)
+//   - llena: true si la salida del salto no estaba disponible
+//   - salidaOriginalID: salida prevista para la caja
+//   - salidaDestinoID: salida donde terminó la caja
+//   - salto: posición en la cadena (0 = salida prevista)
+func (m *PostgresManager) InsertSalidaCajaOverflow(ctx context.Context, correlativo string, salidaID, salidaRelativa int, llena bool, salidaOriginalID, salidaDestinoID, salto int) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+	if correlativo == "" {
+		return fmt.Errorf("correlativo vacío")
+	}
+	if salidaID <= 0 {
+		return fmt.Errorf("salidaID inválido: %d", salidaID)
+	}
+
+	_, err := m.pool.Exec(ctx, INSERT_SALIDA_CAJA_OVERFLOW_INTERNAL_DB,
+		correlativo, salidaID, salidaRelativa, llena, salidaOriginalID, salidaDestinoID, salto)
+	if err != nil {
+		return fmt.Errorf("error al insertar salto de desborde en salida_caja: %w", err)
+	}
+
+	log.Printf("✅ [DB] Caja %s: salto %d de desborde en salida %d (prevista %d → destino %d)",
+		correlativo, salto, salidaID, salidaOriginalID, salidaDestinoID)
+	return nil
+}
+
+// SetCajaFechaEmbalaje corrige la fecha de embalaje de una caja insertada después de su lectura
+// (cajas registradas en el registro local mientras PostgreSQL no estaba disponible)
+func (m *PostgresManager) SetCajaFechaEmbalaje(ctx context.Context, correlativo string, fecha time.Time) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	if _, err := m.pool.Exec(ctx, UPDATE_CAJA_FECHA_EMBALAJE_INTERNAL_DB, correlativo, fecha); err != nil {
+		return fmt.Errorf("error al actualizar fecha de embalaje de caja %s: %w", correlativo, err)
+	}
+	return nil
+}
+
+// SetSalidaCajaFecha corrige la fecha de salida de un registro de salida_caja insertado después del desvío
+func (m *PostgresManager) SetSalidaCajaFecha(ctx context.Context, correlativo string, salidaID int, fecha time.Time) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	if _, err := m.pool.Exec(ctx, UPDATE_SALIDA_CAJA_FECHA_INTERNAL_DB, correlativo, salidaID, fecha); err != nil {
+		return fmt.Errorf("error al actualizar fecha de salida de caja %s: %w", correlativo, err)
+	}
+	return nil
+}
+
+// SetSalidaCajaTracking guarda el número de seguimiento que el PLC asignó a la caja en su salida
+func (m *PostgresManager) SetSalidaCajaTracking(ctx context.Context, correlativo string, salidaID int, tracking uint16) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	if _, err := m.pool.Exec(ctx, UPDATE_SALIDA_CAJA_TRACKING_INTERNAL_DB, correlativo, salidaID, int32(tracking)); err != nil {
+		return fmt.Errorf("error al guardar tracking PLC de caja %s: %w", correlativo, err)
+	}
+	return nil
+}
+
+// SetSalidaCajaDesvio guarda el resultado de la confirmación física del desvío de una caja
+// (laneReal = salida física confirmada por el PLC, nil si la caja no se confirmó)
+func (m *PostgresManager) SetSalidaCajaDesvio(ctx context.Context, correlativo string, salidaID int, estado string, laneReal *int16) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	commandTag, err := m.pool.Exec(ctx, UPDATE_SALIDA_CAJA_DESVIO_INTERNAL_DB, correlativo, salidaID, estado, laneReal)
+	if err != nil {
+		return fmt.Errorf("error al registrar desvío %s de caja %s: %w", estado, correlativo, err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("caja %s sin registro en salida %d, desvío %s no registrado", correlativo, salidaID, estado)
+	}
+	return nil
+}
+
+// GetCorrelativoByTracking retorna el correlativo de la caja más reciente con ese número de seguimiento
+// del PLC en el sorter (cadena vacía si no hay ninguna)
+func (m *PostgresManager) GetCorrelativoByTracking(ctx context.Context, sorterID int, tracking uint16) (string, error) {
+	if m == nil || m.pool == nil {
+		return "", fmt.Errorf("manager no inicializado")
+	}
+
+	var correlativo string
+	err := m.pool.QueryRow(ctx, SELECT_CORRELATIVO_BY_TRACKING_INTERNAL_DB, sorterID, int32(tracking)).Scan(&correlativo)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error al buscar caja con tracking PLC %d: %w", tracking, err)
+	}
+	return correlativo, nil
+}
+
 // GetHistorialDesvios obtiene las últimas 100 lecturas/desvíos de un sorter
 func (m *PostgresManager) GetHistorialDesvios(ctx context.Context, sorterID int) ([]map[string]interface{}, error) {
 	if m == nil || m.pool == nil {
@@ -657,9 +781,22 @@ func (m *PostgresManager) GetNombreVariedad(ctx context.Context, codigoVariedad
 		return "", fmt.Errorf("error al obtener nombre variedad: %w", err)
 	}
 
+	m.variedades.Store(strings.TrimSpace(codigoVariedad), nombre)
 	return nombre, nil
 }
 
+// CachedNombreVariedad retorna el nombre de variedad ya leído de la BD sin consultarla
+// (el código si nunca se leyó). Se usa para construir el SKU cuando PostgreSQL no está disponible.
+func (m *PostgresManager) CachedNombreVariedad(codigoVariedad string) string {
+	codigo := strings.TrimSpace(codigoVariedad)
+	if m != nil {
+		if nombre, ok := m.variedades.Load(codigo); ok {
+			return nombre.(string)
+		}
+	}
+	return codigo
+}
+
 // GetCodigoVariedad obtiene el código de variedad dado su nombre
 // Retorna el código o un string vacío si no existe
 func (m *PostgresManager) GetCodigoVariedad(ctx context.Context, nombreVariedad string) (string, error) {
@@ -698,6 +835,7 @@ func (m *PostgresManager) GetAllVariedades(ctx context.Context) (map[string]stri
 			return nil, fmt.Errorf("error al leer variedad: %w", err)
 		}
 		variedades[codigo] = nombre
+		m.variedades.Store(codigo, nombre)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -706,3 +844,519 @@ func (m *PostgresManager) GetAllVariedades(ctx context.Context) (map[string]stri
 
 	return variedades, nil
 }
+
+// scanRoutingRule convierte una fila de regla_ruteo en models.RoutingRule
+func scanRoutingRule(row pgx.Row) (models.RoutingRule, error) {
+	var rule models.RoutingRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.SorterID,
+		&rule.SalidaID,
+		&rule.Prioridad,
+		&rule.Variedades,
+		&rule.Calibres,
+		&rule.Embalajes,
+		&rule.Dark,
+		&rule.Activa,
+		&rule.Descripcion,
+	)
+	return rule, err
+}
+
+// GetRoutingRules obtiene las reglas de ruteo de un sorter ordenadas por prioridad (mayor primero)
+func (m *PostgresManager) GetRoutingRules(ctx context.Context, sorterID int) ([]models.RoutingRule, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+
+	rows, err := m.pool.Query(ctx, SELECT_REGLAS_RUTEO_BY_SORTER_INTERNAL_DB, sorterID)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar reglas de ruteo: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]models.RoutingRule, 0)
+	for rows.Next() {
+		rule, err := scanRoutingRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error al escanear regla de ruteo: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error al iterar reglas de ruteo: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetRoutingRule obtiene una regla de ruteo por ID
+func (m *PostgresManager) GetRoutingRule(ctx context.Context, id int) (*models.RoutingRule, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+
+	rule, err := scanRoutingRule(m.pool.QueryRow(ctx, SELECT_REGLA_RUTEO_BY_ID_INTERNAL_DB, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error al consultar regla de ruteo %d: %w", id, err)
+	}
+	return &rule, nil
+}
+
+// InsertRoutingRule crea una regla de ruteo y retorna su ID
+func (m *PostgresManager) InsertRoutingRule(ctx context.Context, rule models.RoutingRule) (int, error) {
+	if m == nil || m.pool == nil {
+		return 0, fmt.Errorf("manager no inicializado")
+	}
+
+	var id int
+	err := m.pool.QueryRow(ctx, INSERT_REGLA_RUTEO_INTERNAL_DB,
+		rule.SorterID, rule.SalidaID, rule.Prioridad,
+		nonNilStrings(rule.Variedades), nonNilStrings(rule.Calibres), nonNilStrings(rule.Embalajes),
+		rule.Dark, rule.Activa, rule.Descripcion,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error al insertar regla de ruteo: %w", err)
+	}
+
+	log.Printf("✅ [DB] Regla de ruteo #%d creada (sorter %d → salida %d)", id, rule.SorterID, rule.SalidaID)
+	return id, nil
+}
+
+// UpdateRoutingRule actualiza una regla de ruteo existente
+func (m *PostgresManager) UpdateRoutingRule(ctx context.Context, rule models.RoutingRule) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	commandTag, err := m.pool.Exec(ctx, UPDATE_REGLA_RUTEO_INTERNAL_DB,
+		rule.ID, rule.SorterID, rule.SalidaID, rule.Prioridad,
+		nonNilStrings(rule.Variedades), nonNilStrings(rule.Calibres), nonNilStrings(rule.Embalajes),
+		rule.Dark, rule.Activa, rule.Descripcion,
+	)
+	if err != nil {
+		return fmt.Errorf("error al actualizar regla de ruteo: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("regla de ruteo %d no encontrada", rule.ID)
+	}
+	return nil
+}
+
+// DeleteRoutingRule elimina una regla de ruteo
+func (m *PostgresManager) DeleteRoutingRule(ctx context.Context, id int) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	commandTag, err := m.pool.Exec(ctx, DELETE_REGLA_RUTEO_INTERNAL_DB, id)
+	if err != nil {
+		return fmt.Errorf("error al eliminar regla de ruteo: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("regla de ruteo %d no encontrada", id)
+	}
+	return nil
+}
+
+// nonNilStrings evita insertar NULL en columnas TEXT[] NOT NULL
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// LoadBatchStates carga el estado persistido del balance por batch de un sorter
+func (m *PostgresManager) LoadBatchStates(ctx context.Context, sorterID int) ([]models.BatchState, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+
+	rows, err := m.pool.Query(ctx, SELECT_BATCH_DISTRIBUIDOR_BY_SORTER_INTERNAL_DB, sorterID)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar estado de balance: %w", err)
+	}
+	defer rows.Close()
+
+	states := make([]models.BatchState, 0)
+	for rows.Next() {
+		var state models.BatchState
+		if err := rows.Scan(&state.SorterID, &state.SKU, &state.Salidas, &state.CurrentIndex, &state.CurrentCount, &state.FechaActualizacion); err != nil {
+			return nil, fmt.Errorf("error al escanear estado de balance: %w", err)
+		}
+		states = append(states, state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error al iterar estado de balance: %w", err)
+	}
+
+	return states, nil
+}
+
+// SaveBatchStates guarda (upsert) y elimina estados de balance de un sorter en una sola transacción
+func (m *PostgresManager) SaveBatchStates(ctx context.Context, sorterID int, states []models.BatchState, deletedSKUs []string) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, sku := range deletedSKUs {
+		if _, err := tx.Exec(ctx, DELETE_BATCH_DISTRIBUIDOR_INTERNAL_DB, sorterID, sku); err != nil {
+			return fmt.Errorf("error al eliminar estado de balance de SKU '%s': %w", sku, err)
+		}
+	}
+
+	for _, state := range states {
+		salidas := state.Salidas
+		if salidas == nil {
+			salidas = []int{}
+		}
+		if _, err := tx.Exec(ctx, UPSERT_BATCH_DISTRIBUIDOR_INTERNAL_DB, sorterID, state.SKU, salidas, state.CurrentIndex, state.CurrentCount); err != nil {
+			return fmt.Errorf("error al guardar estado de balance de SKU '%s': %w", state.SKU, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error al confirmar transacción: %w", err)
+	}
+	return nil
+}
+
+// DeleteAllBatchStates elimina todo el estado de balance persistido de un sorter
+func (m *PostgresManager) DeleteAllBatchStates(ctx context.Context, sorterID int) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	if _, err := m.pool.Exec(ctx, DELETE_ALL_BATCH_DISTRIBUIDOR_INTERNAL_DB, sorterID); err != nil {
+		return fmt.Errorf("error al eliminar estado de balance: %w", err)
+	}
+	return nil
+}
+
+// scanAssignmentPlan convierte una fila de plan_asignacion en models.AssignmentPlan
+func scanAssignmentPlan(row pgx.Row) (models.AssignmentPlan, error) {
+	var plan models.AssignmentPlan
+	var items []byte
+	err := row.Scan(
+		&plan.ID,
+		&plan.SorterID,
+		&plan.Nombre,
+		&plan.Descripcion,
+		&plan.EjecutarEn,
+		&plan.Turno,
+		&items,
+		&plan.Activo,
+		&plan.UltimaEjecucion,
+		&plan.UltimoResultado,
+		&plan.FechaCreacion,
+	)
+	if err != nil {
+		return plan, err
+	}
+	if err := json.Unmarshal(items, &plan.Items); err != nil {
+		return plan, fmt.Errorf("items inválidos en plan %d: %w", plan.ID, err)
+	}
+	return plan, nil
+}
+
+// queryAssignmentPlans ejecuta una consulta de planes de asignación y escanea todas las filas
+func (m *PostgresManager) queryAssignmentPlans(ctx context.Context, query string, args ...interface{}) ([]models.AssignmentPlan, error) {
+	rows, err := m.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar planes de asignación: %w", err)
+	}
+	defer rows.Close()
+
+	plans := make([]models.AssignmentPlan, 0)
+	for rows.Next() {
+		plan, err := scanAssignmentPlan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error al escanear plan de asignación: %w", err)
+		}
+		plans = append(plans, plan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error al iterar planes de asignación: %w", err)
+	}
+
+	return plans, nil
+}
+
+// GetAssignmentPlans obtiene todos los planes de asignación de un sorter
+func (m *PostgresManager) GetAssignmentPlans(ctx context.Context, sorterID int) ([]models.AssignmentPlan, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+	return m.queryAssignmentPlans(ctx, SELECT_PLANES_ASIGNACION_BY_SORTER_INTERNAL_DB, sorterID)
+}
+
+// GetActiveAssignmentPlans obtiene los planes de asignación activos de un sorter
+func (m *PostgresManager) GetActiveAssignmentPlans(ctx context.Context, sorterID int) ([]models.AssignmentPlan, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+	return m.queryAssignmentPlans(ctx, SELECT_PLANES_ASIGNACION_ACTIVOS_BY_SORTER_INTERNAL_DB, sorterID)
+}
+
+// GetAssignmentPlan obtiene un plan de asignación por ID (nil si no existe)
+func (m *PostgresManager) GetAssignmentPlan(ctx context.Context, id int) (*models.AssignmentPlan, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+
+	plan, err := scanAssignmentPlan(m.pool.QueryRow(ctx, SELECT_PLAN_ASIGNACION_BY_ID_INTERNAL_DB, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error al consultar plan de asignación %d: %w", id, err)
+	}
+	return &plan, nil
+}
+
+// InsertAssignmentPlan crea un plan de asignación y retorna su ID
+func (m *PostgresManager) InsertAssignmentPlan(ctx context.Context, plan models.AssignmentPlan) (int, error) {
+	if m == nil || m.pool == nil {
+		return 0, fmt.Errorf("manager no inicializado")
+	}
+
+	items, err := json.Marshal(plan.Items)
+	if err != nil {
+		return 0, fmt.Errorf("error al serializar items del plan: %w", err)
+	}
+
+	var id int
+	err = m.pool.QueryRow(ctx, INSERT_PLAN_ASIGNACION_INTERNAL_DB,
+		plan.SorterID, plan.Nombre, plan.Descripcion, plan.EjecutarEn, plan.Turno, items, plan.Activo,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error al insertar plan de asignación: %w", err)
+	}
+
+	log.Printf("✅ [DB] Plan de asignación #%d '%s' creado (sorter %d)", id, plan.Nombre, plan.SorterID)
+	return id, nil
+}
+
+// UpdateAssignmentPlan actualiza un plan de asignación existente
+func (m *PostgresManager) UpdateAssignmentPlan(ctx context.Context, plan models.AssignmentPlan) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	items, err := json.Marshal(plan.Items)
+	if err != nil {
+		return fmt.Errorf("error al serializar items del plan: %w", err)
+	}
+
+	commandTag, err := m.pool.Exec(ctx, UPDATE_PLAN_ASIGNACION_INTERNAL_DB,
+		plan.ID, plan.SorterID, plan.Nombre, plan.Descripcion, plan.EjecutarEn, plan.Turno, items, plan.Activo,
+	)
+	if err != nil {
+		return fmt.Errorf("error al actualizar plan de asignación: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("plan de asignación %d no encontrado", plan.ID)
+	}
+	return nil
+}
+
+// MarkAssignmentPlanApplied registra la ejecución de un plan (desactiva los de ejecución única)
+func (m *PostgresManager) MarkAssignmentPlanApplied(ctx context.Context, id int, aplicadoEn time.Time, resultado string) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	if _, err := m.pool.Exec(ctx, UPDATE_PLAN_ASIGNACION_EJECUTADO_INTERNAL_DB, id, aplicadoEn, resultado); err != nil {
+		return fmt.Errorf("error al registrar ejecución del plan %d: %w", id, err)
+	}
+	return nil
+}
+
+// DeleteAssignmentPlan elimina un plan de asignación
+func (m *PostgresManager) DeleteAssignmentPlan(ctx context.Context, id int) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	commandTag, err := m.pool.Exec(ctx, DELETE_PLAN_ASIGNACION_INTERNAL_DB, id)
+	if err != nil {
+		return fmt.Errorf("error al eliminar plan de asignación: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("plan de asignación %d no encontrado", id)
+	}
+	return nil
+}
+
+// InsertRoutingDecision guarda el registro de auditoría de la decisión de ruteo de una caja
+func (m *PostgresManager) InsertRoutingDecision(ctx context.Context, decision *models.RoutingDecision) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
+
+	candidatas, err := json.Marshal(nonNilCandidates(decision.Candidatas))
+	if err != nil {
+		return fmt.Errorf("error al serializar candidatas: %w", err)
+	}
+	intentos, err := json.Marshal(nonNilAttempts(decision.PLCIntentos))
+	if err != nil {
+		return fmt.Errorf("error al serializar intentos PLC: %w", err)
+	}
+	reglas := decision.Reglas
+	if reglas == nil {
+		reglas = []int{}
+	}
+
+	_, err = m.pool.Exec(ctx, INSERT_ROUTING_DECISION_INTERNAL_DB,
+		decision.SorterID, decision.Correlativo, decision.SKU, decision.Exitosa, decision.Razon, decision.Estrategia,
+		candidatas, decision.BatchIndex, reglas, decision.SalidaID, decision.SalidaFinalID,
+		intentos, decision.PLCError, decision.Fecha,
+	)
+	if err != nil {
+		return fmt.Errorf("error al insertar decisión de ruteo: %w", err)
+	}
+	return nil
+}
+
+// UpdateRoutingDecisionCorrelativo reemplaza el correlativo provisional de las decisiones de ruteo
+// por el asignado al reconciliar la caja en la BD
+func (m *PostgresManager) UpdateRoutingDecisionCorrelativo(ctx context.Context, anterior, nuevo string) (int64, error) {
+	if m == nil || m.pool == nil {
+		return 0, fmt.Errorf("manager no inicializado")
+	}
+
+	commandTag, err := m.pool.Exec(ctx, UPDATE_ROUTING_DECISION_CORRELATIVO_INTERNAL_DB, anterior, nuevo)
+	if err != nil {
+		return 0, fmt.Errorf("error al actualizar correlativo de decisiones de ruteo: %w", err)
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// GetRoutingDecisionsByCorrelativo obtiene las decisiones de ruteo registradas para una caja
+func (m *PostgresManager) GetRoutingDecisionsByCorrelativo(ctx context.Context, correlativo string) ([]models.RoutingDecision, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+	return m.queryRoutingDecisions(ctx, SELECT_ROUTING_DECISIONS_BY_CORRELATIVO_INTERNAL_DB, correlativo)
+}
+
+// GetRoutingDecisions obtiene las decisiones de ruteo de un sorter en un rango de tiempo [desde, hasta),
+// opcionalmente filtradas por razón
+func (m *PostgresManager) GetRoutingDecisions(ctx context.Context, sorterID int, desde, hasta time.Time, razon string, limit int) ([]models.RoutingDecision, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+	return m.queryRoutingDecisions(ctx, SELECT_ROUTING_DECISIONS_BY_RANGE_INTERNAL_DB, sorterID, desde, hasta, razon, limit)
+}
+
+// queryRoutingDecisions ejecuta una consulta de routing_decision y escanea todas las filas
+func (m *PostgresManager) queryRoutingDecisions(ctx context.Context, query string, args ...interface{}) ([]models.RoutingDecision, error) {
+	rows, err := m.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar decisiones de ruteo: %w", err)
+	}
+	defer rows.Close()
+
+	decisions := make([]models.RoutingDecision, 0)
+	for rows.Next() {
+		var d models.RoutingDecision
+		var candidatas, intentos []byte
+		err := rows.Scan(
+			&d.ID,
+			&d.SorterID,
+			&d.Correlativo,
+			&d.SKU,
+			&d.Exitosa,
+			&d.Razon,
+			&d.Estrategia,
+			&candidatas,
+			&d.BatchIndex,
+			&d.Reglas,
+			&d.SalidaID,
+			&d.SalidaFinalID,
+			&intentos,
+			&d.PLCError,
+			&d.Fecha,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error al escanear decisión de ruteo: %w", err)
+		}
+		if err := json.Unmarshal(candidatas, &d.Candidatas); err != nil {
+			return nil, fmt.Errorf("candidatas inválidas en decisión %d: %w", d.ID, err)
+		}
+		if err := json.Unmarshal(intentos, &d.PLCIntentos); err != nil {
+			return nil, fmt.Errorf("intentos PLC inválidos en decisión %d: %w", d.ID, err)
+		}
+		for _, intento := range d.PLCIntentos {
+			if intento.Error == "" && intento.Tracking != nil {
+				d.TrackingPLC = intento.Tracking
+			}
+		}
+		decisions = append(decisions, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error al iterar decisiones de ruteo: %w", err)
+	}
+
+	return decisions, nil
+}
+
+// nonNilCandidates evita serializar null en la columna JSONB candidatas
+func nonNilCandidates(values []models.RoutingCandidate) []models.RoutingCandidate {
+	if values == nil {
+		return []models.RoutingCandidate{}
+	}
+	return values
+}
+
+// nonNilAttempts evita serializar null en la columna JSONB plc_intentos
+func nonNilAttempts(values []models.PLCAttempt) []models.PLCAttempt {
+	if values == nil {
+		return []models.PLCAttempt{}
+	}
+	return values
+}
+
+// GetReadQualityHistory retorna la calidad de lectura de las cajas de una cámara agrupada por hora o día
+func (m *PostgresManager) GetReadQualityHistory(ctx context.Context, cognexID int, desde, hasta time.Time, intervalo string) ([]models.ReadQualityBucket, error) {
+	if m == nil || m.pool == nil {
+		return nil, fmt.Errorf("manager no inicializado")
+	}
+
+	rows, err := m.pool.Query(ctx, SELECT_READ_QUALITY_HISTORY_INTERNAL_DB, cognexID, desde, hasta, intervalo)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar calidad de lectura: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make([]models.ReadQualityBucket, 0)
+	for rows.Next() {
+		var b models.ReadQualityBucket
+		var a, bb, c, d, f int64
+		if err := rows.Scan(&b.Desde, &b.Cajas, &a, &bb, &c, &d, &f, &b.PuntajePromedio, &b.DecodePromedioMs); err != nil {
+			return nil, fmt.Errorf("error al escanear calidad de lectura: %w", err)
+		}
+		b.PorGrado = map[string]int64{"A": a, "B": bb, "C": c, "D": d, "F": f}
+		buckets = append(buckets, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error al iterar calidad de lectura: %w", err)
+	}
+
+	return buckets, nil
+}
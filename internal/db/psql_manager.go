@@ -17,8 +17,9 @@ import (
 )
 
 type PostgresManager struct {
-	pool      *pgxpool.Pool
-	closeOnce sync.Once
+	pool       *pgxpool.Pool
+	closeOnce  sync.Once
+	variedades sync.Map // Código → nombre de variedad leídos de la BD (para construir SKUs sin conexión)
 }
 
 func (m *PostgresManager) InsertSKUsBatch(ctx context.Context, skuList []struct {
@@ -183,6 +184,9 @@ func (m *PostgresManager) RunQuery(ctx context.Context, query string, args ...an
 }
 
 func (m *PostgresManager) Ping(ctx context.Context) error {
+	if m == nil || m.pool == nil {
+		return fmt.Errorf("manager no inicializado")
+	}
 	return m.pool.Ping(ctx)
 }
 
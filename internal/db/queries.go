@@ -143,7 +143,12 @@ const INSERT_CAJA_SIN_CORRELATIVO_INTERNAL_DB = `
 		dark,
 		linea,
 		color,
-		correlativo_pallet
+		correlativo_pallet,
+		cognex_id,
+		simbologia,
+		grado_lectura,
+		puntaje_lectura,
+		tiempo_decodificacion_ms
 	) VALUES (
 		CURRENT_TIMESTAMP,
 		$1,
@@ -153,10 +158,36 @@ const INSERT_CAJA_SIN_CORRELATIVO_INTERNAL_DB = `
 		$5,
 		$6,
 		'Rojo',
-		NULL
+		NULL,
+		$7,
+		$8,
+		$9,
+		$10,
+		$11
 	) RETURNING correlativo;
 `
 
+// Calidad de lectura de las cajas de una cámara agrupada por intervalo ($4 = 'hour' o 'day')
+const SELECT_READ_QUALITY_HISTORY_INTERNAL_DB = `
+	SELECT
+		date_trunc($4, fecha_embalaje) AS desde,
+		COUNT(*) AS cajas,
+		COUNT(*) FILTER (WHERE grado_lectura = 'A') AS grado_a,
+		COUNT(*) FILTER (WHERE grado_lectura = 'B') AS grado_b,
+		COUNT(*) FILTER (WHERE grado_lectura = 'C') AS grado_c,
+		COUNT(*) FILTER (WHERE grado_lectura = 'D') AS grado_d,
+		COUNT(*) FILTER (WHERE grado_lectura = 'F') AS grado_f,
+		COALESCE(AVG(puntaje_lectura), 0)::float8 AS puntaje_promedio,
+		COALESCE(AVG(tiempo_decodificacion_ms), 0)::float8 AS decode_promedio_ms
+	FROM caja
+	WHERE cognex_id = $1
+	  AND fecha_embalaje >= $2
+	  AND fecha_embalaje < $3
+	  AND grado_lectura IS NOT NULL
+	GROUP BY 1
+	ORDER BY 1;
+`
+
 const INSERT_SALIDA_CAJA_INTERNAL_DB = `
 	INSERT INTO salida_caja (
 		correlativo_caja,
@@ -289,6 +320,71 @@ const CHECK_SALIDA_SKU_EXISTS_INTERNAL_DB = `
 	)
 `
 
+// Registro de un salto de la cadena de desborde: id_salida es la salida del salto,
+// id_salida_original la prevista y id_salida_destino donde terminó la caja
+const INSERT_SALIDA_CAJA_OVERFLOW_INTERNAL_DB = `
+	INSERT INTO salida_caja (
+		correlativo_caja,
+		id_salida,
+		salida_enviada,
+		llena,
+		fecha_salida,
+		id_fabricacion,
+		id_salida_original,
+		id_salida_destino,
+		salto
+	) VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		CURRENT_TIMESTAMP,
+		NULL,
+		$5,
+		$6,
+		$7
+	)
+	ON CONFLICT (correlativo_caja, id_salida) DO UPDATE
+	SET
+		salida_enviada = EXCLUDED.salida_enviada,
+		llena = EXCLUDED.llena,
+		fecha_salida = EXCLUDED.fecha_salida,
+		id_salida_original = EXCLUDED.id_salida_original,
+		id_salida_destino = EXCLUDED.id_salida_destino,
+		salto = EXCLUDED.salto;
+`
+
+// Fechas originales de cajas y salidas reconciliadas desde el registro local
+const UPDATE_CAJA_FECHA_EMBALAJE_INTERNAL_DB = `
+	UPDATE caja SET fecha_embalaje = $2 WHERE correlativo = $1
+`
+
+const UPDATE_SALIDA_CAJA_FECHA_INTERNAL_DB = `
+	UPDATE salida_caja SET fecha_salida = $3 WHERE correlativo_caja = $1 AND id_salida = $2
+`
+
+// Número de seguimiento que el PLC asignó a la caja al desviarla (Output[0] del método del sorter)
+const UPDATE_SALIDA_CAJA_TRACKING_INTERNAL_DB = `
+	UPDATE salida_caja SET tracking_plc = $3 WHERE correlativo_caja = $1 AND id_salida = $2
+`
+
+// Resultado de la confirmación física del desvío (confirmado, mal_desviado, perdido)
+const UPDATE_SALIDA_CAJA_DESVIO_INTERNAL_DB = `
+	UPDATE salida_caja
+	SET estado_desvio = $3, lane_confirmada = $4, fecha_confirmacion = CURRENT_TIMESTAMP
+	WHERE correlativo_caja = $1 AND id_salida = $2
+`
+
+// Caja más reciente con un número de seguimiento en un sorter (el contador del PLC se reinicia en 65535)
+const SELECT_CORRELATIVO_BY_TRACKING_INTERNAL_DB = `
+	SELECT sc.correlativo_caja
+	FROM salida_caja sc
+	INNER JOIN salida s ON sc.id_salida = s.id
+	WHERE s.sorter = $1 AND sc.tracking_plc = $2
+	ORDER BY sc.fecha_salida DESC
+	LIMIT 1
+`
+
 const SELECT_HISTORIAL_DESVIOS_INTERNAL_DB = `
 	SELECT 
 		sc.correlativo_caja AS box_id,
@@ -329,3 +425,170 @@ const SELECT_CODIGO_VARIEDAD_BY_NOMBRE = `
 const SELECT_ALL_VARIEDADES = `
 	SELECT codigo_variedad, nombre_variedad FROM variedad ORDER BY nombre_variedad
 `
+
+// =======================
+// Queries para reglas de ruteo por atributos (tabla regla_ruteo)
+// =======================
+
+const SELECT_REGLAS_RUTEO_BY_SORTER_INTERNAL_DB = `
+	SELECT id, sorter_id, salida_id, prioridad, variedades, calibres, embalajes, dark, activa, COALESCE(descripcion, '')
+	FROM regla_ruteo
+	WHERE sorter_id = $1
+	ORDER BY prioridad DESC, id
+`
+
+const SELECT_REGLA_RUTEO_BY_ID_INTERNAL_DB = `
+	SELECT id, sorter_id, salida_id, prioridad, variedades, calibres, embalajes, dark, activa, COALESCE(descripcion, '')
+	FROM regla_ruteo
+	WHERE id = $1
+`
+
+const INSERT_REGLA_RUTEO_INTERNAL_DB = `
+	INSERT INTO regla_ruteo (sorter_id, salida_id, prioridad, variedades, calibres, embalajes, dark, activa, descripcion)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+`
+
+const UPDATE_REGLA_RUTEO_INTERNAL_DB = `
+	UPDATE regla_ruteo
+	SET sorter_id = $2,
+		salida_id = $3,
+		prioridad = $4,
+		variedades = $5,
+		calibres = $6,
+		embalajes = $7,
+		dark = $8,
+		activa = $9,
+		descripcion = $10,
+		fecha_actualizacion = CURRENT_TIMESTAMP
+	WHERE id = $1
+`
+
+const DELETE_REGLA_RUTEO_INTERNAL_DB = `
+	DELETE FROM regla_ruteo WHERE id = $1
+`
+
+// =======================
+// Queries para estado del balance por batch (tabla batch_distribuidor)
+// =======================
+
+const SELECT_BATCH_DISTRIBUIDOR_BY_SORTER_INTERNAL_DB = `
+	SELECT sorter_id, sku, salidas, current_index, current_count, fecha_actualizacion
+	FROM batch_distribuidor
+	WHERE sorter_id = $1
+`
+
+const UPSERT_BATCH_DISTRIBUIDOR_INTERNAL_DB = `
+	INSERT INTO batch_distribuidor (sorter_id, sku, salidas, current_index, current_count, fecha_actualizacion)
+	VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+	ON CONFLICT (sorter_id, sku) DO UPDATE
+	SET
+		salidas = EXCLUDED.salidas,
+		current_index = EXCLUDED.current_index,
+		current_count = EXCLUDED.current_count,
+		fecha_actualizacion = EXCLUDED.fecha_actualizacion
+`
+
+const DELETE_BATCH_DISTRIBUIDOR_INTERNAL_DB = `
+	DELETE FROM batch_distribuidor WHERE sorter_id = $1 AND sku = $2
+`
+
+const DELETE_ALL_BATCH_DISTRIBUIDOR_INTERNAL_DB = `
+	DELETE FROM batch_distribuidor WHERE sorter_id = $1
+`
+
+// =======================
+// Queries para planes de asignación programados (tabla plan_asignacion)
+// =======================
+
+const SELECT_PLANES_ASIGNACION_BY_SORTER_INTERNAL_DB = `
+	SELECT id, sorter_id, nombre, COALESCE(descripcion, ''), ejecutar_en, COALESCE(turno, ''), items,
+		activo, ultima_ejecucion, COALESCE(ultimo_resultado, ''), fecha_creacion
+	FROM plan_asignacion
+	WHERE sorter_id = $1
+	ORDER BY id
+`
+
+const SELECT_PLANES_ASIGNACION_ACTIVOS_BY_SORTER_INTERNAL_DB = `
+	SELECT id, sorter_id, nombre, COALESCE(descripcion, ''), ejecutar_en, COALESCE(turno, ''), items,
+		activo, ultima_ejecucion, COALESCE(ultimo_resultado, ''), fecha_creacion
+	FROM plan_asignacion
+	WHERE sorter_id = $1 AND activo = TRUE
+	ORDER BY id
+`
+
+const SELECT_PLAN_ASIGNACION_BY_ID_INTERNAL_DB = `
+	SELECT id, sorter_id, nombre, COALESCE(descripcion, ''), ejecutar_en, COALESCE(turno, ''), items,
+		activo, ultima_ejecucion, COALESCE(ultimo_resultado, ''), fecha_creacion
+	FROM plan_asignacion
+	WHERE id = $1
+`
+
+const INSERT_PLAN_ASIGNACION_INTERNAL_DB = `
+	INSERT INTO plan_asignacion (sorter_id, nombre, descripcion, ejecutar_en, turno, items, activo)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+	RETURNING id
+`
+
+const UPDATE_PLAN_ASIGNACION_INTERNAL_DB = `
+	UPDATE plan_asignacion
+	SET sorter_id = $2,
+		nombre = $3,
+		descripcion = $4,
+		ejecutar_en = $5,
+		turno = NULLIF($6, ''),
+		items = $7,
+		activo = $8,
+		fecha_actualizacion = CURRENT_TIMESTAMP
+	WHERE id = $1
+`
+
+// Los planes de ejecución única se desactivan al aplicarse; los de turno siguen activos
+const UPDATE_PLAN_ASIGNACION_EJECUTADO_INTERNAL_DB = `
+	UPDATE plan_asignacion
+	SET ultima_ejecucion = $2,
+		ultimo_resultado = $3,
+		activo = CASE WHEN turno IS NULL THEN FALSE ELSE activo END,
+		fecha_actualizacion = CURRENT_TIMESTAMP
+	WHERE id = $1
+`
+
+const DELETE_PLAN_ASIGNACION_INTERNAL_DB = `
+	DELETE FROM plan_asignacion WHERE id = $1
+`
+
+// =======================
+// Queries para auditoría de decisiones de ruteo (tabla routing_decision)
+// =======================
+
+const INSERT_ROUTING_DECISION_INTERNAL_DB = `
+	INSERT INTO routing_decision (sorter_id, correlativo, sku, exitosa, razon, estrategia, candidatas,
+		batch_index, reglas, salida_id, salida_final_id, plc_intentos, plc_error, fecha)
+	VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7, $8, $9, NULLIF($10, 0), NULLIF($11, 0), $12, NULLIF($13, ''), $14)
+`
+
+const UPDATE_ROUTING_DECISION_CORRELATIVO_INTERNAL_DB = `
+	UPDATE routing_decision SET correlativo = $2 WHERE correlativo = $1
+`
+
+const SELECT_ROUTING_DECISIONS_BY_CORRELATIVO_INTERNAL_DB = `
+	SELECT id, sorter_id, COALESCE(correlativo, ''), COALESCE(sku, ''), exitosa, razon, COALESCE(estrategia, ''),
+		candidatas, batch_index, reglas, COALESCE(salida_id, 0), COALESCE(salida_final_id, 0),
+		plc_intentos, COALESCE(plc_error, ''), fecha
+	FROM routing_decision
+	WHERE correlativo = $1
+	ORDER BY fecha DESC
+`
+
+const SELECT_ROUTING_DECISIONS_BY_RANGE_INTERNAL_DB = `
+	SELECT id, sorter_id, COALESCE(correlativo, ''), COALESCE(sku, ''), exitosa, razon, COALESCE(estrategia, ''),
+		candidatas, batch_index, reglas, COALESCE(salida_id, 0), COALESCE(salida_final_id, 0),
+		plc_intentos, COALESCE(plc_error, ''), fecha
+	FROM routing_decision
+	WHERE sorter_id = $1
+		AND fecha >= $2
+		AND fecha < $3
+		AND ($4 = '' OR razon = $4)
+	ORDER BY fecha DESC
+	LIMIT $5
+`
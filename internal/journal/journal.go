@@ -0,0 +1,378 @@
+package journal
+
+import (
+	"API-GREENEX/internal/models"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProvisionalPrefix antecede a los correlativos generados localmente mientras PostgreSQL no está disponible
+const ProvisionalPrefix = "PROV-"
+
+// Tipos de entrada del registro
+const (
+	EntryCaja         = "caja"         // Caja registrada sin BD (correlativo provisional)
+	EntrySalidaCaja   = "salida_caja"  // Salida de una caja que no se pudo registrar en BD
+	EntryReconciliada = "reconciliada" // Caja o salida ya escrita en BD por el reconciliador
+	EntryCuarentena   = "cuarentena"   // Caja o salida que la BD rechaza: se deja de reintentar (queda en el archivo)
+)
+
+// BoxRecord son los datos de una caja pendiente de insertar en la tabla caja
+type BoxRecord struct {
+	CognexID int                 `json:"cognex_id"`
+	Especie  string              `json:"especie"`
+	Variedad string              `json:"variedad"`
+	Calibre  string              `json:"calibre"`
+	Embalaje string              `json:"embalaje"`
+	Dark     int                 `json:"dark"`
+	Linea    string              `json:"linea"`
+	Calidad  *models.ReadQuality `json:"calidad,omitempty"`
+}
+
+// SalidaRecord es un registro pendiente de salida_caja (Desborde = salto de una cadena de desborde)
+type SalidaRecord struct {
+	SalidaID         int     `json:"salida_id"`
+	SealerPhysicalID int     `json:"sealer_physical_id"`
+	Llena            bool    `json:"llena"`
+	Desborde         bool    `json:"desborde,omitempty"`
+	SalidaOriginalID int     `json:"salida_original_id,omitempty"`
+	SalidaDestinoID  int     `json:"salida_destino_id,omitempty"`
+	Salto            int     `json:"salto,omitempty"`
+	TrackingPLC      *uint16 `json:"tracking_plc,omitempty"`  // Número de seguimiento asignado por el PLC (solo la salida final)
+	EstadoDesvio     string  `json:"estado_desvio,omitempty"` // Estado del desvío al registrar (no_comandado = sin señal al PLC)
+}
+
+// Entry es una línea del registro (JSON por línea, solo se agregan entradas)
+type Entry struct {
+	ID              int64         `json:"id"`
+	Tipo            string        `json:"tipo"`
+	Correlativo     string        `json:"correlativo"`
+	Fecha           time.Time     `json:"fecha"`
+	Caja            *BoxRecord    `json:"caja,omitempty"`
+	Salida          *SalidaRecord `json:"salida,omitempty"`
+	EntradaID       int64         `json:"entrada_id,omitempty"`       // Reconciliada: entrada escrita en BD
+	CorrelativoReal string        `json:"correlativo_real,omitempty"` // Reconciliada: correlativo asignado por la BD
+	Motivo          string        `json:"motivo,omitempty"`           // Cuarentena: error de la BD al escribir la entrada
+}
+
+// BoxJournal es el registro local de cajas y salidas que no se pudieron escribir en PostgreSQL.
+// Cada entrada se agrega al archivo y se sincroniza a disco antes de confirmarla; al reiniciar
+// se recuperan las entradas aún no reconciliadas.
+type BoxJournal struct {
+	path string
+
+	mu                   sync.Mutex
+	file                 *os.File
+	nextID               int64
+	pendientes           []Entry           // Entradas sin reconciliar, en orden de llegada
+	cuarentena           []Entry           // Entradas rechazadas por la BD que ya no se reintentan
+	cajasEnCuarentena    map[string]bool   // Correlativos provisionales de cajas en cuarentena
+	reales               map[string]string // Correlativo provisional → real (ya reconciliados)
+	reconciliadas        int64
+	ultimoError          string
+	ultimaReconciliacion time.Time
+}
+
+// Open abre (o crea) el registro y carga las entradas pendientes
+func Open(path string) (*BoxJournal, error) {
+	if path == "" {
+		return nil, fmt.Errorf("ruta del registro de cajas vacía")
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("error al crear directorio del registro: %w", err)
+		}
+	}
+
+	j := &BoxJournal{path: path, nextID: 1, reales: make(map[string]string), cajasEnCuarentena: make(map[string]bool)}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir registro de cajas: %w", err)
+	}
+	j.file = file
+
+	if len(j.pendientes) > 0 {
+		log.Printf("📒 Registro de cajas %s: %d entrada(s) pendiente(s) de reconciliar", path, len(j.pendientes))
+	}
+	if len(j.cuarentena) > 0 {
+		log.Printf("⚠️  Registro de cajas %s: %d entrada(s) en cuarentena (revisar manualmente)", path, len(j.cuarentena))
+	}
+	return j, nil
+}
+
+// load relee el archivo y deja en memoria solo las entradas sin reconciliar
+func (j *BoxJournal) load() error {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error al leer registro de cajas: %w", err)
+	}
+	defer file.Close()
+
+	var entradas []Entry
+	hechas := make(map[int64]bool)
+	motivos := make(map[int64]string) // Entradas en cuarentena → motivo
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	linea := 0
+	for scanner.Scan() {
+		linea++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// Una línea cortada por un apagado en medio de la escritura no invalida el resto
+			log.Printf("⚠️  Registro de cajas %s: línea %d inválida, se ignora: %v", j.path, linea, err)
+			continue
+		}
+		if e.ID >= j.nextID {
+			j.nextID = e.ID + 1
+		}
+		if e.Tipo == EntryReconciliada {
+			hechas[e.EntradaID] = true
+			if e.CorrelativoReal != "" {
+				j.reales[e.Correlativo] = e.CorrelativoReal
+			}
+			continue
+		}
+		if e.Tipo == EntryCuarentena {
+			motivos[e.EntradaID] = e.Motivo
+			continue
+		}
+		entradas = append(entradas, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error al leer registro de cajas: %w", err)
+	}
+
+	for _, e := range entradas {
+		if hechas[e.ID] {
+			continue
+		}
+		if motivo, ok := motivos[e.ID]; ok {
+			e.Motivo = motivo
+			j.cuarentena = append(j.cuarentena, e)
+			if e.Tipo == EntryCaja {
+				j.cajasEnCuarentena[e.Correlativo] = true
+			}
+			continue
+		}
+		j.pendientes = append(j.pendientes, e)
+	}
+	return nil
+}
+
+// RecordBox registra una caja sin BD y retorna su correlativo provisional
+func (j *BoxJournal) RecordBox(caja BoxRecord) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	correlativo := fmt.Sprintf("%s%d-%d", ProvisionalPrefix, time.Now().UnixMilli(), j.nextID)
+	e := Entry{Tipo: EntryCaja, Correlativo: correlativo, Caja: &caja}
+	if err := j.appendLocked(&e); err != nil {
+		return "", err
+	}
+	j.pendientes = append(j.pendientes, e)
+	log.Printf("📒 Caja registrada sin BD con correlativo provisional %s", correlativo)
+	return correlativo, nil
+}
+
+// RecordSalida registra la salida de una caja que no se pudo escribir en salida_caja
+func (j *BoxJournal) RecordSalida(correlativo string, salida SalidaRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// La caja pudo reconciliarse mientras seguía en la línea
+	if real, ok := j.reales[correlativo]; ok {
+		correlativo = real
+	}
+	e := Entry{Tipo: EntrySalidaCaja, Correlativo: correlativo, Salida: &salida}
+	if err := j.appendLocked(&e); err != nil {
+		return err
+	}
+	j.pendientes = append(j.pendientes, e)
+	return nil
+}
+
+// Pending retorna una copia de las entradas pendientes, en orden de llegada
+func (j *BoxJournal) Pending() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Entry(nil), j.pendientes...)
+}
+
+// RealCorrelativo retorna el correlativo asignado por la BD a un correlativo provisional ya reconciliado
+func (j *BoxJournal) RealCorrelativo(provisional string) (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	real, ok := j.reales[provisional]
+	return real, ok
+}
+
+// MarkReconciled registra que la entrada ya está en la BD (correlativoReal solo para cajas).
+// Cuando no quedan pendientes el archivo se vacía.
+func (j *BoxJournal) MarkReconciled(entrada Entry, correlativoReal string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e := Entry{Tipo: EntryReconciliada, Correlativo: entrada.Correlativo, EntradaID: entrada.ID, CorrelativoReal: correlativoReal}
+	if err := j.appendLocked(&e); err != nil {
+		return err
+	}
+	if correlativoReal != "" {
+		j.reales[entrada.Correlativo] = correlativoReal
+	}
+	for i, p := range j.pendientes {
+		if p.ID == entrada.ID {
+			j.pendientes = append(j.pendientes[:i], j.pendientes[i+1:]...)
+			break
+		}
+	}
+	j.reconciliadas++
+
+	if len(j.pendientes) == 0 && len(j.cuarentena) == 0 {
+		return j.truncateLocked()
+	}
+	return nil
+}
+
+// Quarantine saca de los pendientes una entrada que la BD rechaza (ej: violación de restricción),
+// para que no impida reconciliar las siguientes. La entrada queda en el archivo para revisarla a mano;
+// el archivo ya no se vacía mientras haya entradas en cuarentena.
+func (j *BoxJournal) Quarantine(entrada Entry, motivo string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e := Entry{Tipo: EntryCuarentena, Correlativo: entrada.Correlativo, EntradaID: entrada.ID, Motivo: motivo}
+	if err := j.appendLocked(&e); err != nil {
+		return err
+	}
+	for i, p := range j.pendientes {
+		if p.ID == entrada.ID {
+			j.pendientes = append(j.pendientes[:i], j.pendientes[i+1:]...)
+			break
+		}
+	}
+	entrada.Motivo = motivo
+	j.cuarentena = append(j.cuarentena, entrada)
+	if entrada.Tipo == EntryCaja {
+		j.cajasEnCuarentena[entrada.Correlativo] = true
+	}
+	log.Printf("⚠️  Registro de cajas: entrada %d (%s %s) en cuarentena: %s", entrada.ID, entrada.Tipo, entrada.Correlativo, motivo)
+	return nil
+}
+
+// InQuarantine indica si la caja con ese correlativo provisional está en cuarentena
+func (j *BoxJournal) InQuarantine(correlativo string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cajasEnCuarentena[correlativo]
+}
+
+// IsProvisional indica si el correlativo fue generado por el registro local
+func IsProvisional(correlativo string) bool {
+	return strings.HasPrefix(correlativo, ProvisionalPrefix)
+}
+
+// Stats retorna el estado del registro
+func (j *BoxJournal) Stats() models.BoxJournalStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stats := models.BoxJournalStats{
+		Archivo:       j.path,
+		Pendientes:    len(j.pendientes),
+		Reconciliadas: j.reconciliadas,
+		EnCuarentena:  len(j.cuarentena),
+		UltimoError:   j.ultimoError,
+	}
+	for _, e := range j.pendientes {
+		switch e.Tipo {
+		case EntryCaja:
+			stats.CajasPendientes++
+		case EntrySalidaCaja:
+			stats.SalidasPendientes++
+		}
+	}
+	if len(j.pendientes) > 0 {
+		stats.PendienteDesde = j.pendientes[0].Fecha.Format(time.RFC3339)
+	}
+	if !j.ultimaReconciliacion.IsZero() {
+		stats.UltimaReconciliacion = j.ultimaReconciliacion.Format(time.RFC3339)
+	}
+	return stats
+}
+
+// setResultado guarda el resultado de la última pasada del reconciliador
+func (j *BoxJournal) setResultado(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.ultimaReconciliacion = time.Now()
+	j.ultimoError = ""
+	if err != nil {
+		j.ultimoError = err.Error()
+	}
+}
+
+// Close cierra el archivo del registro
+func (j *BoxJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// appendLocked asigna ID y fecha, escribe la entrada y la sincroniza a disco. Requiere j.mu.
+func (j *BoxJournal) appendLocked(e *Entry) error {
+	if j.file == nil {
+		return fmt.Errorf("registro de cajas cerrado")
+	}
+	e.ID = j.nextID
+	if e.Fecha.IsZero() {
+		e.Fecha = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error al serializar entrada del registro: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error al escribir registro de cajas: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("error al sincronizar registro de cajas: %w", err)
+	}
+	j.nextID++
+	return nil
+}
+
+// truncateLocked vacía el archivo cuando todas las entradas están reconciliadas. Requiere j.mu.
+// Los IDs siguen creciendo para que una entrada nueva nunca coincida con una ya reconciliada.
+func (j *BoxJournal) truncateLocked() error {
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("error al vaciar registro de cajas: %w", err)
+	}
+	if _, err := j.file.Seek(0, 0); err != nil {
+		return fmt.Errorf("error al vaciar registro de cajas: %w", err)
+	}
+	log.Printf("📒 Registro de cajas %s reconciliado por completo", j.path)
+	return nil
+}
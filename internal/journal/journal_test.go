@@ -0,0 +1,293 @@
+package journal
+
+import (
+	"API-GREENEX/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeStore simula PostgreSQL: asigna correlativos y guarda las salidas escritas
+type fakeStore struct {
+	caida      bool
+	rechazar   string // Variedad que la BD rechaza al insertar la caja
+	siguiente  int
+	cajas      map[string]BoxRecord
+	fechas     map[string]time.Time
+	salidas    []string // "correlativo/salida"
+	trackings  map[string]uint16
+	desvios    map[string]string
+	decisiones map[string]string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{siguiente: 1000, cajas: make(map[string]BoxRecord), fechas: make(map[string]time.Time), decisiones: make(map[string]string), trackings: make(map[string]uint16), desvios: make(map[string]string)}
+}
+
+func (f *fakeStore) Ping(ctx context.Context) error {
+	if f.caida {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (f *fakeStore) InsertNewBox(ctx context.Context, especie, variedad, calibre, embalaje string, dark int, linea string, cognexID int, calidad *models.ReadQuality) (string, error) {
+	if variedad == f.rechazar {
+		return "", fmt.Errorf("fk_caja_variedad: variedad %s no existe", variedad)
+	}
+	f.siguiente++
+	correlativo := fmt.Sprint(f.siguiente)
+	f.cajas[correlativo] = BoxRecord{CognexID: cognexID, Especie: especie, Variedad: variedad, Calibre: calibre, Embalaje: embalaje, Dark: dark, Linea: linea, Calidad: calidad}
+	return correlativo, nil
+}
+
+func (f *fakeStore) InsertSalidaCaja(ctx context.Context, correlativo string, salidaID int, salidaRelativa int, llena bool) error {
+	if _, ok := f.cajas[correlativo]; !ok {
+		return fmt.Errorf("fk_salida_caja_caja: caja %s no existe", correlativo)
+	}
+	f.salidas = append(f.salidas, fmt.Sprintf("%s/%d", correlativo, salidaID))
+	return nil
+}
+
+func (f *fakeStore) InsertSalidaCajaOverflow(ctx context.Context, correlativo string, salidaID, salidaRelativa int, llena bool, salidaOriginalID, salidaDestinoID, salto int) error {
+	return f.InsertSalidaCaja(ctx, correlativo, salidaID, salidaRelativa, llena)
+}
+
+func (f *fakeStore) SetCajaFechaEmbalaje(ctx context.Context, correlativo string, fecha time.Time) error {
+	f.fechas[correlativo] = fecha
+	return nil
+}
+
+func (f *fakeStore) SetSalidaCajaFecha(ctx context.Context, correlativo string, salidaID int, fecha time.Time) error {
+	return nil
+}
+
+func (f *fakeStore) SetSalidaCajaTracking(ctx context.Context, correlativo string, salidaID int, tracking uint16) error {
+	f.trackings[fmt.Sprintf("%s/%d", correlativo, salidaID)] = tracking
+	return nil
+}
+
+func (f *fakeStore) SetSalidaCajaDesvio(ctx context.Context, correlativo string, salidaID int, estado string, laneReal *int16) error {
+	f.desvios[fmt.Sprintf("%s/%d", correlativo, salidaID)] = estado
+	return nil
+}
+
+func (f *fakeStore) UpdateRoutingDecisionCorrelativo(ctx context.Context, anterior, nuevo string) (int64, error) {
+	f.decisiones[anterior] = nuevo
+	return 1, nil
+}
+
+func TestBoxJournalRecoversPendingAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cajas.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	prov, err := j.RecordBox(BoxRecord{CognexID: 1, Especie: "CEREZA", Variedad: "V018", Calibre: "4J", Embalaje: "CEMDCRBP44"})
+	if err != nil {
+		t.Fatalf("RecordBox: %v", err)
+	}
+	if !IsProvisional(prov) {
+		t.Fatalf("correlativo %q no es provisional", prov)
+	}
+	if err := j.RecordSalida(prov, SalidaRecord{SalidaID: 3, SealerPhysicalID: 2}); err != nil {
+		t.Fatalf("RecordSalida: %v", err)
+	}
+	j.Close()
+
+	// Un apagado a mitad de escritura deja una línea cortada al final
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"id":9,"tipo":"caja","correl`)
+	f.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open tras reinicio: %v", err)
+	}
+	defer j.Close()
+
+	pendientes := j.Pending()
+	if len(pendientes) != 2 || pendientes[0].Correlativo != prov || pendientes[1].Salida == nil {
+		t.Fatalf("pendientes = %+v", pendientes)
+	}
+	if stats := j.Stats(); stats.CajasPendientes != 1 || stats.SalidasPendientes != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Los IDs continúan después de los ya usados
+	otra, _ := j.RecordBox(BoxRecord{Variedad: "V020"})
+	if otra == prov {
+		t.Errorf("correlativo repetido tras reinicio: %s", otra)
+	}
+}
+
+func TestReconcilerReplaysInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cajas.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer j.Close()
+
+	prov, _ := j.RecordBox(BoxRecord{CognexID: 2, Variedad: "V018", Calibre: "4J", Embalaje: "CEMDCRBP44"})
+	tracking := uint16(3511)
+	j.RecordSalida(prov, SalidaRecord{SalidaID: 5, SealerPhysicalID: 1, TrackingPLC: &tracking})
+	j.RecordSalida("777", SalidaRecord{SalidaID: 6, SealerPhysicalID: 2, Desborde: true, SalidaOriginalID: 5, SalidaDestinoID: 6, Salto: 1})
+
+	store := newFakeStore()
+	store.cajas["777"] = BoxRecord{}
+	r := NewReconciler(j, store, time.Minute)
+
+	store.caida = true
+	if n, err := r.ReconcileNow(context.Background()); n != 0 || err == nil {
+		t.Fatalf("con BD caída = %d, %v; esperado error", n, err)
+	}
+	if stats := r.Stats(); stats.Pendientes != 3 || stats.UltimoError == "" {
+		t.Errorf("stats con BD caída = %+v", stats)
+	}
+
+	store.caida = false
+	n, err := r.ReconcileNow(context.Background())
+	if n != 3 || err != nil {
+		t.Fatalf("ReconcileNow = %d, %v", n, err)
+	}
+
+	real, ok := j.RealCorrelativo(prov)
+	if !ok || store.cajas[real].CognexID != 2 || store.decisiones[prov] != real {
+		t.Errorf("caja %s → %q (ok=%t), decisiones %v", prov, real, ok, store.decisiones)
+	}
+	if store.fechas[real].IsZero() {
+		t.Error("no se restauró la fecha de embalaje")
+	}
+	if len(store.salidas) != 2 || store.salidas[0] != real+"/5" || store.salidas[1] != "777/6" {
+		t.Errorf("salidas = %v", store.salidas)
+	}
+	if store.trackings[real+"/5"] != 3511 || len(store.trackings) != 1 {
+		t.Errorf("trackings = %v", store.trackings)
+	}
+
+	// Todo reconciliado: el archivo queda vacío y un reinicio no repite entradas
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("tamaño del registro = %d, esperado 0", info.Size())
+	}
+	if stats := r.Stats(); stats.Pendientes != 0 || stats.Reconciliadas != 3 || stats.UltimoError != "" {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestReconcilerQuarantinesRejectedEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cajas.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	mala, _ := j.RecordBox(BoxRecord{Variedad: "V999", Calibre: "4J"})
+	j.RecordSalida(mala, SalidaRecord{SalidaID: 5, SealerPhysicalID: 1})
+	buena, _ := j.RecordBox(BoxRecord{Variedad: "V018", Calibre: "3J"})
+	j.RecordSalida(buena, SalidaRecord{SalidaID: 6, SealerPhysicalID: 2})
+
+	store := newFakeStore()
+	store.rechazar = "V999"
+	r := NewReconciler(j, store, time.Minute)
+
+	// La caja rechazada no detiene a las siguientes; su salida espera a la caja
+	n, err := r.ReconcileNow(context.Background())
+	if n != 2 || err == nil {
+		t.Fatalf("primera pasada = %d, %v; esperado 2 escritas y el error de la caja", n, err)
+	}
+	if real, ok := j.RealCorrelativo(buena); !ok || len(store.salidas) != 1 || store.salidas[0] != real+"/6" {
+		t.Fatalf("caja buena %s → %q (ok=%t), salidas %v", buena, real, ok, store.salidas)
+	}
+	if stats := r.Stats(); stats.Pendientes != 2 || stats.EnCuarentena != 0 {
+		t.Fatalf("stats tras la primera pasada = %+v", stats)
+	}
+
+	// Tras maxEntryAttempts pasadas la caja y su salida quedan en cuarentena
+	for i := 1; i < maxEntryAttempts; i++ {
+		r.ReconcileNow(context.Background())
+	}
+	if stats := r.Stats(); stats.Pendientes != 0 || stats.EnCuarentena != 2 || stats.UltimoError != "" {
+		t.Fatalf("stats tras la cuarentena = %+v", stats)
+	}
+	j.Close()
+
+	// La cuarentena sobrevive a un reinicio y no vuelve a pendientes
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open tras reinicio: %v", err)
+	}
+	defer j.Close()
+	if stats := j.Stats(); stats.Pendientes != 0 || stats.EnCuarentena != 2 {
+		t.Errorf("stats tras reinicio = %+v", stats)
+	}
+	if !j.InQuarantine(mala) {
+		t.Errorf("caja %s no está en cuarentena tras reiniciar", mala)
+	}
+}
+
+func TestReconcilerStopsWhenDatabaseDrops(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), "cajas.jsonl"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer j.Close()
+
+	j.RecordBox(BoxRecord{Variedad: "V999"})
+	j.RecordBox(BoxRecord{Variedad: "V018"})
+
+	// La inserción falla y el ping también: se detiene sin contar el fallo contra la entrada
+	store := &pingDropStore{fakeStore: newFakeStore()}
+	store.rechazar = "V999"
+	r := NewReconciler(j, store, time.Minute)
+	for i := 0; i < maxEntryAttempts; i++ {
+		store.pings = 0
+		if n, err := r.ReconcileNow(context.Background()); n != 0 || err == nil {
+			t.Fatalf("pasada %d = %d, %v; esperado detenerse sin escribir", i, n, err)
+		}
+	}
+	if stats := r.Stats(); stats.Pendientes != 2 || stats.EnCuarentena != 0 {
+		t.Errorf("stats = %+v, una BD caída no debe poner entradas en cuarentena", stats)
+	}
+}
+
+// pingDropStore responde el primer ping de cada pasada y luego simula la BD caída
+type pingDropStore struct {
+	*fakeStore
+	pings int
+}
+
+func (p *pingDropStore) Ping(ctx context.Context) error {
+	p.pings++
+	if p.pings > 1 {
+		return errors.New("connection reset by peer")
+	}
+	return nil
+}
+
+func TestReconcilerAppliesEstadoDesvio(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), "cajas.jsonl"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer j.Close()
+
+	j.RecordSalida("777", SalidaRecord{SalidaID: 9, SealerPhysicalID: 9, EstadoDesvio: models.DesvioNoComandado})
+
+	store := newFakeStore()
+	store.cajas["777"] = BoxRecord{}
+	if n, err := NewReconciler(j, store, time.Minute).ReconcileNow(context.Background()); n != 1 || err != nil {
+		t.Fatalf("ReconcileNow = %d, %v", n, err)
+	}
+	if estado := store.desvios["777/9"]; estado != models.DesvioNoComandado {
+		t.Errorf("estado_desvio = %q, esperado %q", estado, models.DesvioNoComandado)
+	}
+	if _, ok := store.trackings["777/9"]; ok {
+		t.Error("una caja no comandada no tiene tracking del PLC")
+	}
+}
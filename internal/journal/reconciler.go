@@ -0,0 +1,218 @@
+package journal
+
+import (
+	"API-GREENEX/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Tiempo máximo para verificar que PostgreSQL volvió antes de cada pasada
+const reconcilePingTimeout = 3 * time.Second
+
+// Pasadas con la BD disponible en que una entrada puede fallar antes de ponerla en cuarentena
+const maxEntryAttempts = 3
+
+// BoxStore es la parte de PostgresManager que usa el reconciliador (evita import cycle con db)
+type BoxStore interface {
+	Ping(ctx context.Context) error
+	InsertNewBox(ctx context.Context, especie, variedad, calibre, embalaje string, dark int, linea string, cognexID int, calidad *models.ReadQuality) (string, error)
+	InsertSalidaCaja(ctx context.Context, correlativo string, salidaID int, salidaRelativa int, llena bool) error
+	InsertSalidaCajaOverflow(ctx context.Context, correlativo string, salidaID, salidaRelativa int, llena bool, salidaOriginalID, salidaDestinoID, salto int) error
+	SetCajaFechaEmbalaje(ctx context.Context, correlativo string, fecha time.Time) error
+	SetSalidaCajaFecha(ctx context.Context, correlativo string, salidaID int, fecha time.Time) error
+	SetSalidaCajaTracking(ctx context.Context, correlativo string, salidaID int, tracking uint16) error
+	SetSalidaCajaDesvio(ctx context.Context, correlativo string, salidaID int, estado string, laneReal *int16) error
+	UpdateRoutingDecisionCorrelativo(ctx context.Context, anterior, nuevo string) (int64, error)
+}
+
+// Reconciler reescribe en caja y salida_caja las entradas del registro local cuando la BD vuelve
+type Reconciler struct {
+	journal  *BoxJournal
+	store    BoxStore
+	interval time.Duration
+	mu       sync.Mutex    // Una sola pasada a la vez (periódica o manual)
+	fallos   map[int64]int // Pasadas en que falló cada entrada con la BD disponible
+}
+
+// NewReconciler crea el reconciliador del registro (interval = cada cuánto se reintenta)
+func NewReconciler(journal *BoxJournal, store BoxStore, interval time.Duration) *Reconciler {
+	return &Reconciler{journal: journal, store: store, interval: interval, fallos: make(map[int64]int)}
+}
+
+// Run reintenta la reconciliación cada interval hasta que ctx se cancele
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if len(r.journal.Pending()) == 0 {
+				continue
+			}
+			if _, err := r.ReconcileNow(ctx); err != nil {
+				log.Printf("⚠️  Registro de cajas: reconciliación pendiente: %v", err)
+			}
+		}
+	}
+}
+
+// ReconcileNow escribe en la BD las entradas pendientes en orden de llegada y retorna cuántas escribió.
+// Si la BD se cae durante la pasada se detiene, para reintentar todo después. Una entrada que falla con
+// la BD disponible se salta (junto con las salidas de esa caja) y, tras maxEntryAttempts pasadas,
+// queda en cuarentena para que no bloquee a las siguientes.
+func (r *Reconciler) ReconcileNow(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pendientes := r.journal.Pending()
+	if len(pendientes) == 0 {
+		return 0, nil
+	}
+
+	if err := r.ping(ctx); err != nil {
+		err = fmt.Errorf("PostgreSQL no disponible: %w", err)
+		r.journal.setResultado(err)
+		return 0, err
+	}
+
+	escritas, saltadas := 0, 0
+	var primerError error
+	cajasFallidas := make(map[string]bool) // Cajas que fallaron en esta pasada: sus salidas esperan
+	for _, e := range pendientes {
+		if e.Tipo == EntrySalidaCaja && IsProvisional(e.Correlativo) {
+			if r.journal.InQuarantine(e.Correlativo) {
+				if err := r.journal.Quarantine(e, fmt.Sprintf("caja %s en cuarentena", e.Correlativo)); err != nil {
+					primerError = err
+					break
+				}
+				continue
+			}
+			if cajasFallidas[e.Correlativo] {
+				saltadas++
+				continue
+			}
+		}
+
+		err := r.reconcileEntry(ctx, e)
+		if err == nil {
+			delete(r.fallos, e.ID)
+			escritas++
+			continue
+		}
+
+		// BD caída a mitad de la pasada: no es un problema de la entrada
+		if errPing := r.ping(ctx); errPing != nil {
+			primerError = fmt.Errorf("PostgreSQL no disponible: %w", err)
+			break
+		}
+
+		if e.Tipo == EntryCaja {
+			cajasFallidas[e.Correlativo] = true
+		}
+		r.fallos[e.ID]++
+		if r.fallos[e.ID] >= maxEntryAttempts {
+			delete(r.fallos, e.ID)
+			if errQ := r.journal.Quarantine(e, err.Error()); errQ != nil {
+				primerError = errQ
+				break
+			}
+			continue
+		}
+		saltadas++
+		if primerError == nil {
+			primerError = err
+		}
+	}
+
+	r.journal.setResultado(primerError)
+	if escritas > 0 || saltadas > 0 {
+		log.Printf("📒 Registro de cajas: %d entrada(s) reconciliada(s), %d con error, %d pendiente(s)",
+			escritas, saltadas, len(r.journal.Pending()))
+	}
+	return escritas, primerError
+}
+
+// ping verifica que PostgreSQL responde
+func (r *Reconciler) ping(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, reconcilePingTimeout)
+	defer cancel()
+	return r.store.Ping(pingCtx)
+}
+
+// Stats retorna el estado del registro
+func (r *Reconciler) Stats() models.BoxJournalStats {
+	return r.journal.Stats()
+}
+
+// reconcileEntry escribe una entrada en la BD y la marca como reconciliada
+func (r *Reconciler) reconcileEntry(ctx context.Context, e Entry) error {
+	switch e.Tipo {
+	case EntryCaja:
+		caja := e.Caja
+		if caja == nil {
+			return r.journal.MarkReconciled(e, "")
+		}
+		real, err := r.store.InsertNewBox(ctx, caja.Especie, caja.Variedad, caja.Calibre, caja.Embalaje, caja.Dark, caja.Linea, caja.CognexID, caja.Calidad)
+		if err != nil {
+			return fmt.Errorf("caja %s: %w", e.Correlativo, err)
+		}
+		if err := r.store.SetCajaFechaEmbalaje(ctx, real, e.Fecha); err != nil {
+			log.Printf("⚠️  Registro de cajas: %v", err)
+		}
+		if n, err := r.store.UpdateRoutingDecisionCorrelativo(ctx, e.Correlativo, real); err != nil {
+			log.Printf("⚠️  Registro de cajas: %v", err)
+		} else if n > 0 {
+			log.Printf("📒 Caja %s → %s (%d decisión(es) de ruteo actualizada(s))", e.Correlativo, real, n)
+		}
+		return r.journal.MarkReconciled(e, real)
+
+	case EntrySalidaCaja:
+		salida := e.Salida
+		if salida == nil {
+			return r.journal.MarkReconciled(e, "")
+		}
+		correlativo := e.Correlativo
+		if IsProvisional(correlativo) {
+			real, ok := r.journal.RealCorrelativo(correlativo)
+			if !ok {
+				return fmt.Errorf("salida de caja %s: la caja aún no está reconciliada", correlativo)
+			}
+			correlativo = real
+		}
+
+		var err error
+		if salida.Desborde {
+			err = r.store.InsertSalidaCajaOverflow(ctx, correlativo, salida.SalidaID, salida.SealerPhysicalID, salida.Llena,
+				salida.SalidaOriginalID, salida.SalidaDestinoID, salida.Salto)
+		} else {
+			err = r.store.InsertSalidaCaja(ctx, correlativo, salida.SalidaID, salida.SealerPhysicalID, salida.Llena)
+		}
+		if err != nil {
+			return fmt.Errorf("salida de caja %s: %w", correlativo, err)
+		}
+		if err := r.store.SetSalidaCajaFecha(ctx, correlativo, salida.SalidaID, e.Fecha); err != nil {
+			log.Printf("⚠️  Registro de cajas: %v", err)
+		}
+		if salida.TrackingPLC != nil {
+			if err := r.store.SetSalidaCajaTracking(ctx, correlativo, salida.SalidaID, *salida.TrackingPLC); err != nil {
+				log.Printf("⚠️  Registro de cajas: %v", err)
+			}
+		}
+		if salida.EstadoDesvio != "" {
+			if err := r.store.SetSalidaCajaDesvio(ctx, correlativo, salida.SalidaID, salida.EstadoDesvio, nil); err != nil {
+				log.Printf("⚠️  Registro de cajas: %v", err)
+			}
+		}
+		return r.journal.MarkReconciled(e, "")
+
+	default:
+		log.Printf("⚠️  Registro de cajas: entrada %d de tipo desconocido '%s', se descarta", e.ID, e.Tipo)
+		return r.journal.MarkReconciled(e, "")
+	}
+}
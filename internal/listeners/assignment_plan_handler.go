@@ -0,0 +1,221 @@
+package listeners
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"API-GREENEX/internal/models"
+)
+
+// AssignmentPlanStore es la interfaz de persistencia de planes de asignación (evita import cycle con db)
+type AssignmentPlanStore interface {
+	GetAssignmentPlans(ctx context.Context, sorterID int) ([]models.AssignmentPlan, error)
+	GetAssignmentPlan(ctx context.Context, id int) (*models.AssignmentPlan, error)
+	InsertAssignmentPlan(ctx context.Context, plan models.AssignmentPlan) (int, error)
+	UpdateAssignmentPlan(ctx context.Context, plan models.AssignmentPlan) error
+	DeleteAssignmentPlan(ctx context.Context, id int) error
+}
+
+// assignmentPlanApplier es implementado por los sorters que soportan planes de asignación programados
+type assignmentPlanApplier interface {
+	ValidateAssignmentPlan(plan models.AssignmentPlan) error
+	ApplyAssignmentPlan(ctx context.Context, plan models.AssignmentPlan, disparo string) (*models.AssignmentPlanResult, error)
+}
+
+// setupAssignmentPlanRoutes registra los endpoints CRUD de planes de asignación programados
+func (h *HTTPFrontend) setupAssignmentPlanRoutes() {
+	// Endpoint GET /assignment/plans/:sorter_id
+	// Lista los planes de asignación de un sorter (activos e históricos)
+	h.router.GET("/assignment/plans/:sorter_id", func(c *gin.Context) {
+		sorterIDStr := c.Param("sorter_id")
+		sorterID, err := strconv.Atoi(sorterIDStr)
+		if err != nil {
+			BadRequest(c, "sorter_id debe ser un número entero válido", gin.H{"sorter_id": sorterIDStr})
+			return
+		}
+		if _, exists := h.sorters[sorterIDStr]; !exists {
+			SorterNotFound(c, sorterIDStr)
+			return
+		}
+
+		store, ok := h.assignmentPlanStore(c)
+		if !ok {
+			return
+		}
+
+		plans, err := store.GetAssignmentPlans(c.Request.Context(), sorterID)
+		if err != nil {
+			InternalServerError(c, "Error al consultar planes de asignación", gin.H{"error": err.Error()})
+			return
+		}
+
+		Success(c, plans, fmt.Sprintf("%d plan(es) de asignación", len(plans)))
+	})
+
+	// Endpoint POST /assignment/plans
+	// Crea un plan. Body: models.AssignmentPlan con "ejecutar_en" (RFC3339) o "turno"
+	h.router.POST("/assignment/plans", func(c *gin.Context) {
+		var plan models.AssignmentPlan
+		plan.Activo = true // Default si no viene en el body
+		if err := c.ShouldBindJSON(&plan); err != nil {
+			BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+			return
+		}
+		plan.ID = 0
+		plan.UltimaEjecucion = nil
+		plan.UltimoResultado = ""
+
+		if _, ok := h.validateAssignmentPlan(c, plan); !ok {
+			return
+		}
+
+		store, ok := h.assignmentPlanStore(c)
+		if !ok {
+			return
+		}
+
+		id, err := store.InsertAssignmentPlan(c.Request.Context(), plan)
+		if err != nil {
+			InternalServerError(c, "Error al crear plan de asignación", gin.H{"error": err.Error()})
+			return
+		}
+		plan.ID = id
+
+		Created(c, plan, fmt.Sprintf("Plan de asignación #%d creado", id))
+	})
+
+	// Endpoint PUT /assignment/plans/:plan_id
+	// Modifica un plan existente (los campos omitidos conservan su valor)
+	h.router.PUT("/assignment/plans/:plan_id", func(c *gin.Context) {
+		planID, existing, ok := h.assignmentPlanFromParam(c)
+		if !ok {
+			return
+		}
+
+		plan := *existing
+		if err := c.ShouldBindJSON(&plan); err != nil {
+			BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+			return
+		}
+		plan.ID = planID
+		plan.UltimaEjecucion = existing.UltimaEjecucion
+		plan.UltimoResultado = existing.UltimoResultado
+
+		if _, ok := h.validateAssignmentPlan(c, plan); !ok {
+			return
+		}
+
+		store, _ := h.postgresMgr.(AssignmentPlanStore)
+		if err := store.UpdateAssignmentPlan(c.Request.Context(), plan); err != nil {
+			InternalServerError(c, "Error al actualizar plan de asignación", gin.H{"error": err.Error()})
+			return
+		}
+
+		Success(c, plan, fmt.Sprintf("Plan de asignación #%d actualizado", planID))
+	})
+
+	// Endpoint DELETE /assignment/plans/:plan_id
+	h.router.DELETE("/assignment/plans/:plan_id", func(c *gin.Context) {
+		planID, _, ok := h.assignmentPlanFromParam(c)
+		if !ok {
+			return
+		}
+
+		store, _ := h.postgresMgr.(AssignmentPlanStore)
+		if err := store.DeleteAssignmentPlan(c.Request.Context(), planID); err != nil {
+			InternalServerError(c, "Error al eliminar plan de asignación", gin.H{"error": err.Error()})
+			return
+		}
+
+		Success(c, gin.H{"plan_id": planID}, fmt.Sprintf("Plan de asignación #%d eliminado", planID))
+	})
+
+	// Endpoint POST /assignment/plans/:plan_id/apply
+	// Aplica un plan inmediatamente, sin esperar su disparo programado
+	h.router.POST("/assignment/plans/:plan_id/apply", func(c *gin.Context) {
+		_, plan, ok := h.assignmentPlanFromParam(c)
+		if !ok {
+			return
+		}
+
+		applier, ok := h.validateAssignmentPlan(c, *plan)
+		if !ok {
+			return
+		}
+
+		result, err := applier.ApplyAssignmentPlan(c.Request.Context(), *plan, "manual")
+		if err != nil {
+			UnprocessableEntity(c, err.Error(), gin.H{"plan_id": plan.ID})
+			return
+		}
+
+		Success(c, result, result.Summary())
+	})
+}
+
+// assignmentPlanStore obtiene la persistencia de planes, respondiendo error si no hay BD
+func (h *HTTPFrontend) assignmentPlanStore(c *gin.Context) (AssignmentPlanStore, bool) {
+	store, ok := h.postgresMgr.(AssignmentPlanStore)
+	if !ok || h.postgresMgr == nil {
+		InternalServerError(c, "Base de datos no disponible", nil)
+		return nil, false
+	}
+	return store, true
+}
+
+// assignmentPlanFromParam parsea :plan_id y carga el plan desde BD
+func (h *HTTPFrontend) assignmentPlanFromParam(c *gin.Context) (int, *models.AssignmentPlan, bool) {
+	planIDStr := c.Param("plan_id")
+	planID, err := strconv.Atoi(planIDStr)
+	if err != nil {
+		BadRequest(c, "plan_id debe ser un número entero válido", gin.H{"plan_id": planIDStr})
+		return 0, nil, false
+	}
+
+	store, ok := h.assignmentPlanStore(c)
+	if !ok {
+		return 0, nil, false
+	}
+
+	plan, err := store.GetAssignmentPlan(c.Request.Context(), planID)
+	if err != nil {
+		InternalServerError(c, "Error al consultar plan de asignación", gin.H{"error": err.Error()})
+		return 0, nil, false
+	}
+	if plan == nil {
+		NotFound(c, "Plan de asignación no encontrado", gin.H{"plan_id": planID})
+		return 0, nil, false
+	}
+	return planID, plan, true
+}
+
+// validateAssignmentPlan valida el plan contra el sorter indicado.
+// Responde el error al cliente y retorna ok=false si el plan no es válido.
+func (h *HTTPFrontend) validateAssignmentPlan(c *gin.Context, plan models.AssignmentPlan) (assignmentPlanApplier, bool) {
+	if err := plan.Validate(); err != nil {
+		ValidationError(c, "plan", err.Error())
+		return nil, false
+	}
+
+	sorterIDStr := strconv.Itoa(plan.SorterID)
+	sorter, exists := h.sorters[sorterIDStr]
+	if !exists {
+		SorterNotFound(c, sorterIDStr)
+		return nil, false
+	}
+
+	applier, ok := sorter.(assignmentPlanApplier)
+	if !ok {
+		InternalServerError(c, "El sorter no soporta planes de asignación", gin.H{"sorter_id": plan.SorterID})
+		return nil, false
+	}
+
+	if err := applier.ValidateAssignmentPlan(plan); err != nil {
+		UnprocessableEntity(c, err.Error(), gin.H{"sorter_id": plan.SorterID})
+		return nil, false
+	}
+	return applier, true
+}
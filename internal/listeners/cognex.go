@@ -1,13 +1,17 @@
 package listeners
 
 import (
+	"API-GREENEX/internal/config"
 	"API-GREENEX/internal/db"
+	"API-GREENEX/internal/journal"
 	"API-GREENEX/internal/models"
 	"context"
 	"fmt"
 	"log"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,7 +31,8 @@ type insertRequest struct {
 	linea    string
 	sku      string
 	message  string
-	resultCh chan insertResult
+	calidad  *models.ReadQuality // Datos de decodificación de la cámara (nil = no informados)
+	recibida time.Time           // Llegada de la trama (base del plazo de desvío de la caja)
 }
 
 type insertResult struct {
@@ -45,15 +50,50 @@ type CognexListener struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	dbManager      *db.PostgresManager
-	EventChan      chan models.LecturaEvent    // Canal para lecturas QR/SKU (flujo original)
-	DataMatrixChan chan models.DataMatrixEvent // Canal para lecturas DataMatrix (nuevo flujo)
-	insertChan     chan insertRequest          // Canal para inserciones asíncronas
+	EventChan      chan models.LecturaEvent            // Canal para lecturas QR/SKU (flujo original)
+	DataMatrixChan chan models.DataMatrixEvent         // Canal para lecturas DataMatrix (nuevo flujo)
+	eventos        *eventQueue[models.LecturaEvent]    // Cola acotada que alimenta EventChan
+	dataMatrix     *eventQueue[models.DataMatrixEvent] // Cola acotada que alimenta DataMatrixChan
+	insertChan     chan insertRequest                  // Canal para inserciones asíncronas
 	dispositivo    string
+	duplicados     *duplicateFilter    // Supresión de lecturas repetidas del mismo código
+	payload        *payloadParser      // Formato del QR de la etiqueta
+	fusion         *readFusion         // Lector lógico con varias cámaras (nil = cámara independiente)
+	recorder       *TrafficRecorder    // Grabación de tramas crudas (nil = deshabilitada)
+	mensajes       int64               // Mensajes recibidos (atómico)
+	trailer        *readTrailerParser  // Datos de decodificación al final de la lectura (nil = no se agregan)
+	calidad        *qualityStats       // Calidad de lectura acumulada
+	journal        *journal.BoxJournal // Registro local de cajas sin BD (nil = deshabilitado)
+
+	// Separación de tramas del stream TCP
+	delimiter         string
+	maxFrameLength    int
+	partialTimeout    time.Duration // Tiempo máximo de espera del resto de una trama incompleta
+	flushOnTimeout    bool          // Procesar la trama incompleta al vencer partialTimeout (false = descartarla)
+	tramasExcedidas   int64         // Tramas descartadas por superar maxFrameLength (atómico)
+	tramasIncompletas int64         // Tramas sin delimitador al vencer partialTimeout (atómico)
+
+	// Modo de conexión (server: escucha, client: se conecta a la cámara)
+	mode              string
+	reconnectMin      time.Duration
+	reconnectMax      time.Duration
+	clientConn        net.Conn
+	clientMutex       sync.Mutex
+	reporter          ConnectionReporter
+	reporterID        int
+	conexiones        int64             // Conexiones establecidas desde el inicio (atómico)
+	conexionesActivas int64             // Conexiones abiertas en este momento (atómico)
+	conexionesPolicy  *connectionPolicy // Orígenes permitidos y máximo de conexiones (modo server)
+
+	// Canal de control Native Mode (nil = sin control)
+	commands       *CognexCommandClient
+	offlineOnPause bool
 }
 
 func NewCognexListener(id int, remoteHost string, port int, scan_method string, dbManager *db.PostgresManager) *CognexListener {
 	ctx, cancel := context.WithCancel(context.Background())
 	dispositivo := fmt.Sprintf("Cognex-%d:%d", id, port)
+	payload, _ := newPayloadParser(config.DefaultPayloadTemplate())
 	cl := &CognexListener{
 		id:             id,
 		remoteHost:     remoteHost,
@@ -62,11 +102,25 @@ func NewCognexListener(id int, remoteHost string, port int, scan_method string,
 		scan_method:    scan_method,
 		cancel:         cancel,
 		dbManager:      dbManager,
-		EventChan:      make(chan models.LecturaEvent, 100),    // buffer para 100 eventos QR/SKU
-		DataMatrixChan: make(chan models.DataMatrixEvent, 100), // buffer para 100 eventos DataMatrix
-		insertChan:     make(chan insertRequest, 200),          // buffer para 200 inserciones pendientes
+		insertChan:     make(chan insertRequest, 200), // buffer para 200 inserciones pendientes
 		dispositivo:    dispositivo,
+		duplicados:     newDuplicateFilter(),
+		payload:        payload,
+		calidad:        newQualityStats(),
+		delimiter:      FrameDelimiterCRLF,
+		maxFrameLength: defaultMaxFrameLength,
+		partialTimeout: defaultPartialTimeout,
+		mode:           CognexModeServer,
+		reconnectMin:   defaultReconnectMin,
+		reconnectMax:   defaultReconnectMax,
 	}
+	cl.conexionesPolicy = newConnectionPolicy()
+
+	// Colas acotadas hacia el sorter (100 eventos, el lector espera si se llenan)
+	cl.eventos, _ = newEventQueue[models.LecturaEvent](ctx, defaultQueueDepth, QueuePolicyBlock)
+	cl.dataMatrix, _ = newEventQueue[models.DataMatrixEvent](ctx, defaultQueueDepth, QueuePolicyBlock)
+	cl.EventChan = cl.eventos.out
+	cl.DataMatrixChan = cl.dataMatrix.out
 
 	// Iniciar worker para inserciones asíncronas
 	go cl.insertWorker()
@@ -84,7 +138,60 @@ func (c *CognexListener) GetID() int {
 	return c.id
 }
 
-// insertWorker procesa inserciones a la base de datos de forma asíncrona
+// SetFraming configura el delimitador de tramas ("crlf", "cr", "lf", "etx"), la longitud máxima
+// de una trama y el tiempo de espera de una trama incompleta (valores <= 0 usan el default).
+// Al vencer ese tiempo la trama incompleta se descarta, salvo con flushOnTimeout (cámaras que no
+// envían delimitador), en cuyo caso se procesa lo recibido. Debe llamarse antes de Start.
+func (c *CognexListener) SetFraming(delimiter string, maxFrameLength int, partialTimeout time.Duration, flushOnTimeout bool) error {
+	if _, err := newCognexFramer(delimiter, maxFrameLength); err != nil {
+		return err
+	}
+	if delimiter == "" {
+		delimiter = FrameDelimiterCRLF
+	}
+	if maxFrameLength <= 0 {
+		maxFrameLength = defaultMaxFrameLength
+	}
+	if partialTimeout <= 0 {
+		partialTimeout = defaultPartialTimeout
+	}
+
+	c.delimiter = delimiter
+	c.maxFrameLength = maxFrameLength
+	c.partialTimeout = partialTimeout
+	c.flushOnTimeout = flushOnTimeout
+	return nil
+}
+
+// GetStats retorna las estadísticas de la cámara
+func (c *CognexListener) GetStats() models.CognexStats {
+	c.duplicados.mu.Lock()
+	defer c.duplicados.mu.Unlock()
+
+	return models.CognexStats{
+		CognexID:             c.id,
+		Dispositivo:          c.dispositivo,
+		ScanMethod:           c.scan_method,
+		Mensajes:             atomic.LoadInt64(&c.mensajes),
+		DuplicadosSuprimidos: c.duplicados.suprimidas,
+		VentanaDuplicadosMs:  int(c.duplicados.window / time.Millisecond),
+		DuplicadosConPLC:     c.duplicados.usePLC,
+		TramasExcedidas:      atomic.LoadInt64(&c.tramasExcedidas),
+		TramasIncompletas:    atomic.LoadInt64(&c.tramasIncompletas),
+		Modo:                 c.mode,
+		Conectada:            atomic.LoadInt64(&c.conexionesActivas) > 0,
+		Conexiones:           atomic.LoadInt64(&c.conexiones),
+		ConexionesRechazadas: c.conexionesRechazadas(),
+		Fusion:               c.fusionStats(),
+		Grabacion:            c.recordPath(),
+		Cola:                 c.queueStats(),
+		Calidad:              c.qualityStats(),
+	}
+}
+
+// insertWorker procesa inserciones a la base de datos de forma asíncrona y entrega cada lectura
+// al sorter en orden. Si la cola de eventos bloquea (política block), el worker espera y las
+// lecturas siguientes se acumulan en insertChan (acotado), sin crear goroutines por lectura.
 func (c *CognexListener) insertWorker() {
 	for {
 		select {
@@ -102,40 +209,72 @@ func (c *CognexListener) insertWorker() {
 	}
 }
 
-// processInsert realiza la inserción real en la base de datos
+// processInsert realiza la inserción real en la base de datos y emite la lectura resultante
 func (c *CognexListener) processInsert(req insertRequest) {
-	ctx := context.Background()
-	correlativo, err := c.dbManager.InsertNewBox(
-		ctx,
+	c.emitirInsercion(req, c.insertarCaja(req))
+}
+
+// emitirInsercion emite la lectura de una caja según el resultado de su inserción en la BD
+func (c *CognexListener) emitirInsercion(req insertRequest, result insertResult) {
+	if result.err != nil {
+		log.Printf("❌ Error al insertar caja en DB desde mensaje: %s | Error: %v", req.message, result.err)
+		evento := models.NewLecturaFallidaConDatos(
+			fmt.Errorf("error al insertar: %w", result.err),
+			req.especie,
+			req.calibre,
+			req.variedad,
+			req.embalaje,
+			req.message,
+			c.dispositivo,
+		)
+		evento.Recibida = req.recibida
+		c.emitir(evento)
+		return
+	}
+
+	// Reconstruir SKU con nombre de variedad en vez de código
+	skuFinal := fmt.Sprintf("%s-%s-%s-%d",
+		req.calibre,
+		strings.ToUpper(result.nombreVariedad),
+		req.embalaje,
+		req.dark)
+
+	log.Printf("📦 Correlativo de caja insertado: %s", result.correlativo)
+	log.Printf("✅ Caja insertada | Correlativo: %s | SKU: %s | Especie: %s", result.correlativo, skuFinal, req.especie)
+	evento := models.NewLecturaExitosa(
+		skuFinal,
 		req.especie,
-		req.variedad,
 		req.calibre,
+		req.variedad,
 		req.embalaje,
-		req.dark,
-		req.linea,
+		result.correlativo,
+		req.message,
+		c.dispositivo,
 	)
+	evento.Dark = req.dark
+	evento.Calidad = req.calidad
+	evento.Recibida = req.recibida
+	c.emitir(evento)
+}
 
-	// Obtener nombre de variedad para construir SKU correctamente
-	nombreVariedad := ""
-	if err == nil {
-		nombreVar, errNombre := c.dbManager.GetNombreVariedad(ctx, req.variedad)
-		if errNombre == nil && nombreVar != "" {
-			nombreVariedad = nombreVar
-		} else {
-			// Si no se encuentra nombre, usar código
-			nombreVariedad = req.variedad
+// Start inicia el servidor TCP para escuchar mensajes de Cognex,
+// o en modo cliente la conexión saliente con reconexión automática
+func (c *CognexListener) Start() error {
+	// La cámara principal de un lector inicia también las demás cámaras del grupo
+	if c.fusion != nil && c.fusion.principal == c {
+		for _, cam := range c.fusion.camaras[1:] {
+			if err := cam.Start(); err != nil {
+				return fmt.Errorf("error al iniciar cámara #%d del lector: %w", cam.id, err)
+			}
 		}
 	}
 
-	req.resultCh <- insertResult{
-		correlativo:    correlativo,
-		nombreVariedad: nombreVariedad,
-		err:            err,
+	if c.mode == CognexModeClient {
+		log.Printf("✓ CognexListener #%d en modo cliente → %s:%d", c.id, c.remoteHost, c.port)
+		go c.dialLoop()
+		return nil
 	}
-}
 
-// Start inicia el servidor TCP para escuchar mensajes de Cognex
-func (c *CognexListener) Start() error {
 	// Siempre escuchar en todas las interfaces (0.0.0.0)
 	address := fmt.Sprintf("0.0.0.0:%d", c.port)
 
@@ -174,7 +313,12 @@ func (c *CognexListener) acceptConnections() {
 				continue
 			}
 
+			if !c.admitConnection(conn) {
+				continue
+			}
+
 			log.Printf("✓ Nueva conexión desde: %s\n", conn.RemoteAddr().String())
+			atomic.AddInt64(&c.conexiones, 1)
 
 			// Manejar cada conexión en su propia goroutine
 			go c.handleConnection(conn)
@@ -182,10 +326,14 @@ func (c *CognexListener) acceptConnections() {
 	}
 }
 
-// handleConnection maneja los mensajes de una conexión Cognex
-// handleConnection maneja los mensajes de una conexión Cognex
+// handleConnection maneja los mensajes de una conexión Cognex.
+// Separa el stream en tramas: cada trama completa llega individualmente a processMessage.
 func (c *CognexListener) handleConnection(conn net.Conn) {
 	defer conn.Close()
+	atomic.AddInt64(&c.conexionesActivas, 1)
+	defer atomic.AddInt64(&c.conexionesActivas, -1)
+	c.trackConnection(conn)
+	defer c.untrackConnection(conn)
 
 	// ⚡ OPTIMIZACIÓN: TCP Keepalive + NoDelay para latencia mínima
 	if tcpConn, ok := conn.(*net.TCPConn); ok {
@@ -196,7 +344,14 @@ func (c *CognexListener) handleConnection(conn net.Conn) {
 		tcpConn.SetWriteBuffer(256 * 1024)
 	}
 
+	framer, err := newCognexFramer(c.delimiter, c.maxFrameLength)
+	if err != nil {
+		log.Printf("❌ [Cognex#%d] %v", c.id, err)
+		return
+	}
+
 	buffer := make([]byte, 4096) // Buffer para lectura directa
+	var recibida time.Time       // Llegada de los últimos datos (base del plazo de desvío de la caja)
 
 	for {
 		select {
@@ -204,92 +359,113 @@ func (c *CognexListener) handleConnection(conn net.Conn) {
 			log.Printf("Cerrando conexión con %s\n", conn.RemoteAddr().String())
 			return
 		default:
-			// ⚡ SIN TIMEOUT - TCP Keepalive detecta conexiones muertas
-			// La goroutine NUNCA se cierra por inactividad
+			// ⚡ SIN TIMEOUT mientras no haya trama incompleta - TCP Keepalive detecta conexiones muertas
+			// Con una trama a medias, esperar el resto como máximo partialTimeout
+			if framer.Pending() {
+				conn.SetReadDeadline(time.Now().Add(c.partialTimeout))
+			} else {
+				conn.SetReadDeadline(time.Time{})
+			}
+
 			n, err := conn.Read(buffer)
+			if n > 0 {
+				recibida = time.Now()
+				logTs("📦 Datos recibidos (%d bytes): %q", n, buffer[:n])
+				tramas, excedidas := framer.Feed(buffer[:n])
+				if excedidas > 0 {
+					atomic.AddInt64(&c.tramasExcedidas, int64(excedidas))
+					log.Printf("⚠️  [Cognex#%d] %d trama(s) descartada(s) por superar %d bytes", c.id, excedidas, c.maxFrameLength)
+				}
+				for _, trama := range tramas {
+					c.record(trama, conn)
+					c.processMessage(trama, conn, recibida)
+				}
+			}
+
 			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() && framer.Pending() {
+					// La cámara no completó la trama: una etiqueta cortada puede parecer válida (ej: V02 en vez de V020),
+					// así que solo se procesa si el dispositivo no envía delimitador (flush_on_timeout)
+					atomic.AddInt64(&c.tramasIncompletas, 1)
+					trama := framer.Flush()
+					if !c.flushOnTimeout {
+						log.Printf("⚠️  [Cognex#%d] Trama incompleta tras %v, descartada: %q", c.id, c.partialTimeout, trama)
+						continue
+					}
+					log.Printf("⚠️  [Cognex#%d] Trama sin delimitador tras %v, procesando: %q", c.id, c.partialTimeout, trama)
+					c.record(trama, conn)
+					c.processMessage(trama, conn, recibida)
+					continue
+				}
 				log.Printf("Conexión cerrada o error de lectura: %v\n", err)
 				return
 			}
-
-			if n > 0 {
-				// Convertir a string y procesar
-				message := string(buffer[:n])
-				logTs("📦 Datos recibidos (%d bytes): %s", n, message)
-				c.processMessage(message, conn)
-			}
 		}
 	}
 }
 
-// processMessage procesa los mensajes recibidos de Cognex
-func (c *CognexListener) processMessage(message string, conn net.Conn) {
+// processMessage procesa los mensajes recibidos de Cognex. recibida es la llegada de la trama,
+// desde la que corre el plazo para desviar la caja (no incluye la espera de la BD).
+func (c *CognexListener) processMessage(message string, conn net.Conn, recibida time.Time) {
 	logTs("📦 Mensaje recibido de %s: %s", conn.RemoteAddr().String(), message)
+	atomic.AddInt64(&c.mensajes, 1)
+
+	// Las lecturas fallidas también se desvían (a REJECT) con el mismo plazo
+	emitirFallo := func(evento models.LecturaEvent) {
+		evento.Recibida = recibida
+		c.emitirFallo(evento)
+	}
 
 	message = strings.TrimSpace(message)
 	switch c.scan_method {
 	case "QR":
-		message_splitted := strings.Split(message, ";")
 		if message == "" {
 			log.Printf("❌ Mensaje vacío recibido")
 			response := "NACK\r\n"
 
-			c.EventChan <- models.NewLecturaFallida(fmt.Errorf("mensaje vacío"), message, c.dispositivo)
+			emitirFallo(models.NewLecturaFallida(fmt.Errorf("mensaje vacío"), message, c.dispositivo))
 
 			conn.Write([]byte(response))
 			return
 		}
 
-		if strings.TrimSpace(message) == models.NO_READ_CODE {
-			log.Printf("❌ Código NO_READ recibido")
+		// Separar los datos de decodificación que agrega la cámara (simbología, tiempo, grado)
+		codigo, calidad, err := c.splitTrailer(message)
+		if err != nil {
+			log.Printf("❌ Datos de decodificación inválidos (%v): %s", err, message)
 			response := "NACK\r\n"
-			c.EventChan <- models.NewLecturaFallida(fmt.Errorf("NO_READ"), message, c.dispositivo)
+			emitirFallo(models.NewLecturaFallida(errPayloadFormato, message, c.dispositivo))
 			conn.Write([]byte(response))
 			return
 		}
-		// Validar que el mensaje tiene el formato correcto (5 partes)
-		if len(message_splitted) < 5 {
-			log.Printf("❌ Mensaje inválido (partes insuficientes): %s (tiene %d partes, necesita 5)", message, len(message_splitted))
+
+		if codigo == models.NO_READ_CODE {
+			log.Printf("❌ Código NO_READ recibido")
 			response := "NACK\r\n"
-			c.EventChan <- models.NewLecturaFallida(fmt.Errorf("formato inválido"), message, c.dispositivo)
+			evento := models.NewLecturaFallida(fmt.Errorf("NO_READ"), message, c.dispositivo)
+			evento.Calidad = calidad
+			emitirFallo(evento)
 			conn.Write([]byte(response))
 			return
 		}
 
-		// Extraer componentes (formato: Especie;Calibre;Dark;Embalaje;Variedad)
-		especie := strings.TrimSpace(message_splitted[0])
-		calibre := strings.TrimSpace(message_splitted[1])
-		darkStr := strings.TrimSpace(message_splitted[2])
-		embalaje := strings.TrimSpace(message_splitted[3])
-		// message_splitted[4] es etiqueta/marca (no se usa)
-		variedad := strings.TrimSpace(message_splitted[4])
-
-		// Validar que los componentes no estén vacíos
-		if especie == "" || calibre == "" || embalaje == "" || variedad == "" {
-			log.Printf("❌ Componentes vacíos en mensaje: %s", message)
+		// Extraer componentes según la plantilla del dispositivo (default: Especie;Calibre;Dark;Embalaje;Variedad)
+		qr, detalle, err := c.payload.Parse(codigo)
+		if err != nil {
+			log.Printf("❌ Mensaje inválido (%v: %s): %s", err, detalle, message)
 			response := "NACK\r\n"
-			c.EventChan <- models.NewLecturaFallida(fmt.Errorf("componentes vacíos"), message, c.dispositivo)
+			emitirFallo(models.NewLecturaFallida(err, message, c.dispositivo))
 			conn.Write([]byte(response))
 			return
 		}
-
-		// Parsear el valor de dark (esperamos "0" o "1")
-		var dark int
-		if darkStr == "0" || darkStr == "" {
-			dark = 0
-		} else if darkStr == "1" {
-			dark = 1
-		} else {
-			log.Printf("⚠️  Valor dark inválido '%s', usando 0 por defecto", darkStr)
-			dark = 0
-		}
+		especie, calibre, embalaje, variedad, dark := qr.Especie, qr.Calibre, qr.Embalaje, qr.Variedad, qr.Dark
 
 		// Generar SKU para validación
 		sku, err := models.RequestSKU(variedad, calibre, embalaje, dark)
 		if err != nil {
 			log.Printf("❌ SKU inválido generado desde mensaje: %s | Error: %v", message, err)
 			response := "NACK\r\n"
-			c.EventChan <- models.NewLecturaFallidaConDatos(
+			emitirFallo(models.NewLecturaFallidaConDatos(
 				err,
 				especie,
 				calibre,
@@ -297,13 +473,26 @@ func (c *CognexListener) processMessage(message string, conn net.Conn) {
 				embalaje,
 				message,
 				c.dispositivo,
-			)
+			))
 			conn.Write([]byte(response))
 			return
 		}
 
+		// Lectura repetida de la misma etiqueta: no crear correlativo ni un segundo desvío
+		if c.duplicados.isDuplicate(codigo, time.Now()) {
+			logTs("🔁 [Cognex#%d] Lectura duplicada suprimida: %s", c.id, message)
+			conn.Write([]byte("ACK\r\n"))
+			return
+		}
+
+		// Lector con varias cámaras: solo la primera lectura exitosa de la caja crea correlativo
+		if c.fusion != nil && !c.fusion.ganar(c.id) {
+			logTs("🔀 [Cognex#%d] Caja ya leída por otra cámara del lector, lectura descartada: %s", c.id, message)
+			conn.Write([]byte("ACK\r\n"))
+			return
+		}
+
 		// Inserción asíncrona en DB para máxima velocidad
-		resultCh := make(chan insertResult, 1)
 		insertReq := insertRequest{
 			especie:  especie,
 			variedad: variedad,
@@ -313,10 +502,11 @@ func (c *CognexListener) processMessage(message string, conn net.Conn) {
 			linea:    "",   // Valor por defecto, se convertirá en "1" en InsertNewBox
 			sku:      sku.SKU,
 			message:  message,
-			resultCh: resultCh,
+			calidad:  calidad,
+			recibida: recibida,
 		}
 
-		// Enviar al worker (no bloqueante si hay buffer disponible)
+		// Enviar al worker (no bloqueante si hay buffer disponible); el worker emite la lectura
 		select {
 		case c.insertChan <- insertReq:
 			// Enviado al worker, responder inmediatamente ACK
@@ -324,119 +514,43 @@ func (c *CognexListener) processMessage(message string, conn net.Conn) {
 			conn.Write([]byte(response))
 			logTs("✅ ACK enviado (async insert en cola)")
 
-			// Procesar resultado en goroutine para no bloquear
-			go func() {
-				result := <-resultCh
-				if result.err != nil {
-					log.Printf("❌ Error al insertar caja en DB desde mensaje: %s | Error: %v", message, result.err)
-					c.EventChan <- models.NewLecturaFallidaConDatos(
-						fmt.Errorf("error al insertar: %w", result.err),
-						especie,
-						calibre,
-						variedad,
-						embalaje,
-						message,
-						c.dispositivo,
-					)
-				} else {
-					// Reconstruir SKU con nombre de variedad en vez de código
-					skuFinal := fmt.Sprintf("%s-%s-%s-%d",
-						calibre,
-						strings.ToUpper(result.nombreVariedad),
-						embalaje,
-						dark)
-
-					log.Printf("📦 Correlativo de caja insertado: %s", result.correlativo)
-					log.Printf("✅ Caja insertada | Correlativo: %s | SKU: %s | Especie: %s", result.correlativo, skuFinal, especie)
-					c.EventChan <- models.NewLecturaExitosa(
-						skuFinal,
-						especie,
-						calibre,
-						variedad,
-						embalaje,
-						result.correlativo,
-						message,
-						c.dispositivo,
-					)
-				}
-			}()
-
 		default:
-			// Buffer lleno, responder NACK y procesar síncrono
+			// Buffer lleno (BD lenta o sorter detenido): procesar síncrono en la conexión,
+			// que deja de leer de la cámara mientras la cola de eventos no tenga espacio
 			log.Printf("⚠️  Buffer de inserciones lleno, procesando síncronamente")
-			ctx := context.Background()
-			correlativo, err := c.dbManager.InsertNewBox(
-				ctx,
-				especie,
-				variedad,
-				calibre,
-				embalaje,
-				dark, // Usar el dark extraído del QR
-				"",   // linea vacío, usará valor por defecto "1"
-			)
-
-			if err != nil {
-				log.Printf("❌ Error al insertar caja en DB desde mensaje: %s | Error: %v", message, err)
-				response := "NACK\r\n"
-				c.EventChan <- models.NewLecturaFallidaConDatos(
-					fmt.Errorf("error al insertar: %w", err),
-					especie,
-					calibre,
-					variedad,
-					embalaje,
-					message,
-					c.dispositivo,
-				)
-				conn.Write([]byte(response))
-				return
-			}
-
-			// Obtener nombre de variedad para construir SKU correctamente
-			nombreVariedad := variedad
-			nombreVar, errNombre := c.dbManager.GetNombreVariedad(ctx, variedad)
-			if errNombre == nil && nombreVar != "" {
-				nombreVariedad = nombreVar
+			result := c.insertarCaja(insertReq)
+			if result.err != nil {
+				conn.Write([]byte("NACK\r\n"))
+			} else {
+				conn.Write([]byte("ACK\r\n"))
 			}
-
-			// Reconstruir SKU con nombre de variedad en vez de código
-			skuFinal := fmt.Sprintf("%s-%s-%s-%d",
-				calibre,
-				strings.ToUpper(nombreVariedad),
-				embalaje,
-				dark)
-
-			response := "ACK\r\n"
-			conn.Write([]byte(response))
-			log.Printf("📦 Correlativo de caja insertado: %s", correlativo)
-			log.Printf("✅ Caja insertada | Correlativo: %s | SKU: %s | Especie: %s", correlativo, skuFinal, especie)
-			c.EventChan <- models.NewLecturaExitosa(
-				skuFinal,
-				especie,
-				calibre,
-				variedad,
-				embalaje,
-				correlativo,
-				message,
-				c.dispositivo,
-			)
+			c.emitirInsercion(insertReq, result)
+			return
 		}
 	case "DATAMATRIX":
 		logTs("📊 DataMatrix detectado: %s", strings.TrimSpace(message))
 		message = strings.TrimSpace(message)
 
+		codigo, calidad, err := c.splitTrailer(message)
+		if err != nil {
+			log.Printf("❌ [Cognex#%d] Datos de decodificación inválidos (%v): %s", c.id, err, message)
+			conn.Write([]byte("NACK\r\n"))
+			return
+		}
+
 		// Crear y enviar evento DataMatrix a un canal dedicado
 		// Este flujo es SEPARADO del flujo QR/SKU original
-		if message == models.NO_READ_CODE {
-			message = ""
+		if codigo == models.NO_READ_CODE {
+			codigo = ""
 		}
-		dmEvent := models.NewDataMatrixEvent(message, c.dispositivo, c.id, message)
-		log.Printf("✅ [Cognex#%d] DataMatrix → Canal dedicado | Código: %s", c.id, message)
+		dmEvent := models.NewDataMatrixEvent(codigo, c.dispositivo, c.id, message)
+		dmEvent.Calidad = calidad
+		log.Printf("✅ [Cognex#%d] DataMatrix → Canal dedicado | Código: %s", c.id, codigo)
 
-		select {
-		case c.DataMatrixChan <- dmEvent:
-			log.Printf("   ✓ Evento DataMatrix enviado correctamente")
-		case <-time.After(2 * time.Second):
-			log.Printf("   ⚠️  Timeout enviando evento DataMatrix (canal lleno?)")
+		if c.dataMatrix.push(dmEvent) {
+			log.Printf("   ✓ Evento DataMatrix encolado")
+		} else {
+			log.Printf("   ⚠️  Cola DataMatrix llena (política %s), evento descartado", c.dataMatrix.policy)
 		}
 
 		// Enviar confirmación inmediata a la cámara
@@ -466,11 +580,18 @@ func (c *CognexListener) Stop() error {
 	log.Println("Deteniendo CognexListener...")
 	c.cancel()
 
+	if c.commands != nil {
+		c.commands.Close()
+	}
+
+	if c.mode == CognexModeClient {
+		c.closeClientConn()
+		return nil
+	}
+
 	if c.listener != nil {
 		return c.listener.Close()
 	}
 
-	close(c.EventChan)
-
 	return nil
 }
@@ -0,0 +1,135 @@
+package listeners
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Modos de conexión con la cámara Cognex
+const (
+	CognexModeServer = "server" // La API escucha en 0.0.0.0:port y la cámara se conecta (default)
+	CognexModeClient = "client" // La API se conecta a host:port (cámara configurada como servidor TCP)
+)
+
+const (
+	defaultReconnectMin = 1 * time.Second
+	defaultReconnectMax = 30 * time.Second
+	cognexDialTimeout   = 5 * time.Second
+)
+
+// ConnectionReporter recibe el estado de conexión de un dispositivo (implementado por monitoring.DeviceMonitor)
+type ConnectionReporter interface {
+	ReportConnection(deviceID int, connected bool, err error)
+}
+
+// SetMode configura el modo de conexión ("server" o "client") y el backoff de reconexión
+// del modo cliente (valores <= 0 usan el default). Debe llamarse antes de Start.
+func (c *CognexListener) SetMode(mode string, reconnectMin, reconnectMax time.Duration) error {
+	switch mode {
+	case "", CognexModeServer:
+		mode = CognexModeServer
+	case CognexModeClient:
+		if c.remoteHost == "" {
+			return fmt.Errorf("modo cliente requiere 'host'")
+		}
+	default:
+		return fmt.Errorf("modo '%s' no soportado (server, client)", mode)
+	}
+
+	if reconnectMin <= 0 {
+		reconnectMin = defaultReconnectMin
+	}
+	if reconnectMax < reconnectMin {
+		reconnectMax = defaultReconnectMax
+		if reconnectMax < reconnectMin {
+			reconnectMax = reconnectMin
+		}
+	}
+
+	c.mode = mode
+	c.reconnectMin = reconnectMin
+	c.reconnectMax = reconnectMax
+	return nil
+}
+
+// IsClientMode indica si la API se conecta a la cámara (en vez de esperar su conexión)
+func (c *CognexListener) IsClientMode() bool {
+	return c.mode == CognexModeClient
+}
+
+// SetConnectionReporter vincula el monitor que recibe el estado de conexión de la cámara
+func (c *CognexListener) SetConnectionReporter(reporter ConnectionReporter, deviceID int) {
+	c.reporter = reporter
+	c.reporterID = deviceID
+}
+
+// reportConnection informa el estado de conexión al monitor (si hay uno vinculado)
+func (c *CognexListener) reportConnection(connected bool, err error) {
+	if c.reporter != nil {
+		c.reporter.ReportConnection(c.reporterID, connected, err)
+	}
+}
+
+// dialLoop mantiene la conexión saliente con la cámara, reconectando con backoff exponencial
+func (c *CognexListener) dialLoop() {
+	address := net.JoinHostPort(c.remoteHost, strconv.Itoa(c.port))
+	backoff := c.reconnectMin
+	dialer := net.Dialer{Timeout: cognexDialTimeout}
+
+	for {
+		conn, err := dialer.DialContext(c.ctx, "tcp", address)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.reportConnection(false, err)
+			log.Printf("⚠️  [Cognex#%d] No se pudo conectar a %s: %v (reintento en %v)", c.id, address, err, backoff)
+		} else {
+			log.Printf("✓ [Cognex#%d] Conectado a cámara en %s (modo cliente)", c.id, address)
+			atomic.AddInt64(&c.conexiones, 1)
+			c.reportConnection(true, nil)
+			backoff = c.reconnectMin
+
+			c.setClientConn(conn)
+			c.handleConnection(conn)
+			c.setClientConn(nil)
+
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.reportConnection(false, fmt.Errorf("conexión cerrada por la cámara"))
+			log.Printf("⚠️  [Cognex#%d] Conexión con %s perdida, reconectando en %v", c.id, address, backoff)
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.reconnectMax {
+			backoff = c.reconnectMax
+		}
+	}
+}
+
+// setClientConn guarda la conexión saliente activa (para cerrarla en Stop)
+func (c *CognexListener) setClientConn(conn net.Conn) {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+	c.clientConn = conn
+}
+
+// closeClientConn cierra la conexión saliente activa, desbloqueando la lectura en curso
+func (c *CognexListener) closeClientConn() {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+	if c.clientConn != nil {
+		c.clientConn.Close()
+	}
+}
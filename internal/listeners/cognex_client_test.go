@@ -0,0 +1,157 @@
+package listeners
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// reporteConexion es un estado de conexión informado al monitor
+type reporteConexion struct {
+	conectado bool
+	err       error
+	fecha     time.Time
+}
+
+// fakeReporter registra los estados de conexión informados por el listener
+type fakeReporter chan reporteConexion
+
+func (r fakeReporter) ReportConnection(deviceID int, connected bool, err error) {
+	r <- reporteConexion{conectado: connected, err: err, fecha: time.Now()}
+}
+
+// esperarReporte espera el siguiente estado de conexión informado
+func esperarReporte(t *testing.T, r fakeReporter) reporteConexion {
+	t.Helper()
+	select {
+	case reporte := <-r:
+		return reporte
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout esperando estado de conexión")
+	}
+	return reporteConexion{}
+}
+
+func TestCognexSetMode(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		host     string
+		mode     string
+		min, max time.Duration
+		valido   bool
+		modo     string
+		esperMin time.Duration
+		esperMax time.Duration
+	}{
+		{"servidor por defecto", "", "", 0, 0, true, CognexModeServer, defaultReconnectMin, defaultReconnectMax},
+		{"cliente", "10.0.0.5", CognexModeClient, 200 * time.Millisecond, 2 * time.Second, true, CognexModeClient, 200 * time.Millisecond, 2 * time.Second},
+		{"máximo menor que el mínimo", "10.0.0.5", CognexModeClient, 2 * time.Second, time.Second, true, CognexModeClient, 2 * time.Second, defaultReconnectMax},
+		{"mínimo mayor que el máximo por defecto", "10.0.0.5", CognexModeClient, time.Minute, 0, true, CognexModeClient, time.Minute, time.Minute},
+		{"cliente sin host", "", CognexModeClient, 0, 0, false, "", 0, 0},
+		{"modo desconocido", "10.0.0.5", "udp", 0, 0, false, "", 0, 0},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			c := NewCognexListener(97, caso.host, 2001, "QR", nil)
+			t.Cleanup(c.cancel)
+
+			err := c.SetMode(caso.mode, caso.min, caso.max)
+			if (err == nil) != caso.valido {
+				t.Fatalf("SetMode = %v, esperado válido=%v", err, caso.valido)
+			}
+			if !caso.valido {
+				return
+			}
+			if c.mode != caso.modo || c.reconnectMin != caso.esperMin || c.reconnectMax != caso.esperMax {
+				t.Errorf("modo %s, backoff %v-%v; esperado %s, %v-%v",
+					c.mode, c.reconnectMin, c.reconnectMax, caso.modo, caso.esperMin, caso.esperMax)
+			}
+		})
+	}
+}
+
+func TestCognexClientReconecta(t *testing.T) {
+	camara, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer camara.Close()
+
+	c := NewCognexListener(98, "127.0.0.1", camara.Addr().(*net.TCPAddr).Port, "QR", nil)
+	t.Cleanup(c.cancel)
+	if err := c.SetMode(CognexModeClient, 10*time.Millisecond, 40*time.Millisecond); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	reporter := make(fakeReporter, 16)
+	c.SetConnectionReporter(reporter, 7)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// La cámara corta la conexión: se informa la caída y la API vuelve a conectarse
+	conn, err := camara.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if reporte := esperarReporte(t, reporter); !reporte.conectado {
+		t.Fatalf("primer estado = %+v, esperado conectado", reporte)
+	}
+	conn.Close()
+	if reporte := esperarReporte(t, reporter); reporte.conectado || reporte.err == nil {
+		t.Fatalf("estado tras el corte = %+v, esperado desconectado con error", reporte)
+	}
+
+	conn, err = camara.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer conn.Close()
+	if reporte := esperarReporte(t, reporter); !reporte.conectado {
+		t.Fatalf("estado tras reconectar = %+v, esperado conectado", reporte)
+	}
+
+	// Stop cierra la conexión activa sin informarla como caída ni reconectar
+	c.Stop()
+	select {
+	case reporte := <-reporter:
+		t.Errorf("estado informado tras Stop: %+v", reporte)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCognexClientBackoff(t *testing.T) {
+	// Puerto sin cámara escuchando: cada intento falla de inmediato
+	camara, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	puerto := camara.Addr().(*net.TCPAddr).Port
+	camara.Close()
+
+	c := NewCognexListener(96, "127.0.0.1", puerto, "QR", nil)
+	t.Cleanup(c.cancel)
+	if err := c.SetMode(CognexModeClient, 20*time.Millisecond, 80*time.Millisecond); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	reporter := make(fakeReporter, 16)
+	c.SetConnectionReporter(reporter, 7)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// El intervalo entre intentos se duplica hasta el máximo
+	esperados := []time.Duration{20, 40, 80, 80}
+	anterior := esperarReporte(t, reporter)
+	for i, minimo := range esperados {
+		reporte := esperarReporte(t, reporter)
+		if reporte.conectado || reporte.err == nil {
+			t.Fatalf("intento %d = %+v, esperado error de conexión", i, reporte)
+		}
+		if espera := reporte.fecha.Sub(anterior.fecha); espera < minimo*time.Millisecond {
+			t.Errorf("intento %d tras %v, esperado al menos %v", i, espera, minimo*time.Millisecond)
+		}
+		anterior = reporte
+	}
+	c.Stop()
+}
@@ -0,0 +1,362 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Valores por defecto del canal de control (Native Mode de In-Sight sobre telnet)
+const (
+	defaultCommandPort    = 23
+	defaultCommandUser    = "admin"
+	defaultCommandTimeout = 2 * time.Second
+)
+
+// ErrCognexSinControl indica que la cámara no tiene canal de control configurado
+var ErrCognexSinControl = errors.New("la cámara no tiene canal de control configurado (control en cognex_devices)")
+
+// Códigos de estado de Native Mode (primera línea de cada respuesta)
+var nativeStatus = map[int]string{
+	1:  "ok",
+	0:  "comando no reconocido",
+	-1: "argumento inválido o job inexistente",
+	-2: "la cámara no pudo ejecutar el comando",
+	-3: "error al cargar el job",
+	-4: "memoria insuficiente",
+	-5: "comando no permitido en el estado actual",
+	-6: "el usuario no tiene acceso completo",
+}
+
+// CognexCommandClient envía comandos Native Mode a una cámara In-Sight (online/offline, trigger,
+// carga de job y estado). Mantiene una sesión telnet autenticada y reconecta ante errores.
+type CognexCommandClient struct {
+	address  string
+	user     string
+	password string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewCognexCommandClient crea el cliente de control (port/user/timeout <= 0 o vacíos usan el default)
+func NewCognexCommandClient(host string, port int, user, password string, timeout time.Duration) *CognexCommandClient {
+	if port <= 0 {
+		port = defaultCommandPort
+	}
+	if user == "" {
+		user = defaultCommandUser
+	}
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	return &CognexCommandClient{
+		address:  net.JoinHostPort(host, strconv.Itoa(port)),
+		user:     user,
+		password: password,
+		timeout:  timeout,
+	}
+}
+
+// Address retorna host:puerto del canal de control
+func (cc *CognexCommandClient) Address() string {
+	return cc.address
+}
+
+// Execute ejecuta un comando de control
+func (cc *CognexCommandClient) Execute(cmd models.CognexCommand) (*models.CognexCameraStatus, error) {
+	switch cmd.Command {
+	case models.CognexCommandOnline:
+		return nil, cc.SetOnline(true)
+	case models.CognexCommandOffline:
+		return nil, cc.SetOnline(false)
+	case models.CognexCommandTrigger:
+		return nil, cc.Trigger()
+	case models.CognexCommandLoadJob:
+		return nil, cc.LoadJob(cmd.Job)
+	case models.CognexCommandStatus:
+		return cc.Status()
+	default:
+		return nil, fmt.Errorf("comando no soportado: %s", cmd.Command)
+	}
+}
+
+// SetOnline pone la cámara online u offline (SO1 / SO0)
+func (cc *CognexCommandClient) SetOnline(online bool) error {
+	arg := "0"
+	if online {
+		arg = "1"
+	}
+	_, err := cc.send("SO"+arg, false)
+	return err
+}
+
+// Trigger dispara una adquisición por software (SE8)
+func (cc *CognexCommandClient) Trigger() error {
+	_, err := cc.send("SE8", false)
+	return err
+}
+
+// LoadJob carga un job de la memoria de la cámara (LF<job>)
+func (cc *CognexCommandClient) LoadJob(job string) error {
+	if err := ValidateCognexCommand(models.CognexCommand{Command: models.CognexCommandLoadJob, Job: job}); err != nil {
+		return err
+	}
+	_, err := cc.send("LF"+strings.TrimSpace(job), false)
+	return err
+}
+
+// Status lee si la cámara está online (GO) y el job cargado (GF)
+func (cc *CognexCommandClient) Status() (*models.CognexCameraStatus, error) {
+	online, err := cc.send("GO", true)
+	if err != nil {
+		return nil, err
+	}
+	job, err := cc.send("GF", true)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CognexCameraStatus{Online: online == "1", Job: job}, nil
+}
+
+// Close cierra la sesión de control
+func (cc *CognexCommandClient) Close() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.closeLocked()
+}
+
+// send envía un comando y lee el código de estado (y la línea de datos si conDatos).
+// Ante un error de conexión reintenta una vez con una sesión nueva.
+func (cc *CognexCommandClient) send(comando string, conDatos bool) (string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	var err error
+	for intento := 0; intento < 2; intento++ {
+		if cc.conn == nil {
+			if err = cc.login(); err != nil {
+				continue
+			}
+		}
+
+		var datos string
+		var status int
+		datos, status, err = cc.roundTrip(comando, conDatos)
+		if err != nil {
+			// Error de red: descartar la sesión y reintentar
+			cc.closeLocked()
+			continue
+		}
+		if status != 1 {
+			return "", fmt.Errorf("comando %s rechazado por la cámara (%d: %s)", comando, status, nativeStatusText(status))
+		}
+		return datos, nil
+	}
+	return "", fmt.Errorf("error al enviar comando %s a %s: %w", comando, cc.address, err)
+}
+
+// login abre la conexión telnet y se autentica (prompts "User:" y "Password:"). Requiere cc.mu.
+func (cc *CognexCommandClient) login() error {
+	conn, err := net.DialTimeout("tcp", cc.address, cc.timeout)
+	if err != nil {
+		return fmt.Errorf("error al conectar: %w", err)
+	}
+	cc.conn = conn
+	cc.reader = bufio.NewReader(conn)
+
+	pasos := []struct {
+		prompt    string
+		respuesta string
+	}{
+		{"User:", cc.user},
+		{"Password:", cc.password},
+	}
+	for _, paso := range pasos {
+		if err := cc.readUntil(paso.prompt); err != nil {
+			cc.closeLocked()
+			return fmt.Errorf("error en login (%s): %w", paso.prompt, err)
+		}
+		if err := cc.write(paso.respuesta); err != nil {
+			cc.closeLocked()
+			return err
+		}
+	}
+
+	linea, err := cc.readLine()
+	if err != nil {
+		cc.closeLocked()
+		return fmt.Errorf("error en login: %w", err)
+	}
+	if !strings.Contains(linea, "Logged In") {
+		cc.closeLocked()
+		return fmt.Errorf("login rechazado por la cámara: %q", linea)
+	}
+	log.Printf("🔑 Canal de control Cognex conectado a %s (usuario %s)", cc.address, cc.user)
+	return nil
+}
+
+// roundTrip escribe el comando y lee la respuesta. Requiere cc.mu.
+func (cc *CognexCommandClient) roundTrip(comando string, conDatos bool) (string, int, error) {
+	if err := cc.write(comando); err != nil {
+		return "", 0, err
+	}
+	linea, err := cc.readLine()
+	if err != nil {
+		return "", 0, err
+	}
+	status, err := strconv.Atoi(linea)
+	if err != nil {
+		return "", 0, fmt.Errorf("respuesta inválida a %s: %q", comando, linea)
+	}
+	if status != 1 || !conDatos {
+		return "", status, nil
+	}
+	datos, err := cc.readLine()
+	if err != nil {
+		return "", 0, err
+	}
+	return datos, status, nil
+}
+
+// write envía una línea terminada en CRLF. Requiere cc.mu.
+func (cc *CognexCommandClient) write(linea string) error {
+	cc.conn.SetWriteDeadline(time.Now().Add(cc.timeout))
+	if _, err := cc.conn.Write([]byte(linea + "\r\n")); err != nil {
+		return fmt.Errorf("error al escribir: %w", err)
+	}
+	return nil
+}
+
+// readLine lee una línea no vacía de la respuesta. Requiere cc.mu.
+func (cc *CognexCommandClient) readLine() (string, error) {
+	cc.conn.SetReadDeadline(time.Now().Add(cc.timeout))
+	for {
+		linea, err := cc.reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("error al leer: %w", err)
+		}
+		if linea = strings.TrimSpace(linea); linea != "" {
+			return linea, nil
+		}
+	}
+}
+
+// readUntil lee hasta encontrar el prompt (los prompts no terminan en salto de línea). Requiere cc.mu.
+func (cc *CognexCommandClient) readUntil(prompt string) error {
+	cc.conn.SetReadDeadline(time.Now().Add(cc.timeout))
+	var recibido strings.Builder
+	for {
+		b, err := cc.reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("error al leer: %w", err)
+		}
+		recibido.WriteByte(b)
+		if strings.HasSuffix(recibido.String(), prompt) {
+			return nil
+		}
+	}
+}
+
+// closeLocked cierra la conexión actual. Requiere cc.mu.
+func (cc *CognexCommandClient) closeLocked() {
+	if cc.conn != nil {
+		cc.conn.Close()
+		cc.conn = nil
+		cc.reader = nil
+	}
+}
+
+// nativeStatusText describe un código de estado de Native Mode
+func nativeStatusText(status int) string {
+	if texto, ok := nativeStatus[status]; ok {
+		return texto
+	}
+	return "código desconocido"
+}
+
+// HasCommandChannel indica si la cámara tiene canal de control configurado
+func (c *CognexListener) HasCommandChannel() bool {
+	return c.commands != nil
+}
+
+// SetCommandClient vincula el canal de control de la cámara. Con offlineOnPause la cámara
+// se pone offline mientras el sorter está en pausa.
+func (c *CognexListener) SetCommandClient(client *CognexCommandClient, offlineOnPause bool) {
+	c.commands = client
+	c.offlineOnPause = offlineOnPause
+}
+
+// ValidateCognexCommand valida el nombre del comando y sus argumentos antes de enviarlo
+func ValidateCognexCommand(cmd models.CognexCommand) error {
+	switch cmd.Command {
+	case models.CognexCommandOnline, models.CognexCommandOffline, models.CognexCommandTrigger, models.CognexCommandStatus:
+		return nil
+	case models.CognexCommandLoadJob:
+		job := strings.TrimSpace(cmd.Job)
+		if job == "" {
+			return fmt.Errorf("job requerido para load_job")
+		}
+		if strings.ContainsAny(job, "\r\n") {
+			return fmt.Errorf("nombre de job inválido: %q", job)
+		}
+		return nil
+	default:
+		return fmt.Errorf("comando no soportado: %s (válidos: online, offline, trigger, load_job, status)", cmd.Command)
+	}
+}
+
+// ExecuteCommand ejecuta un comando de control en la cámara
+func (c *CognexListener) ExecuteCommand(cmd models.CognexCommand) (models.CognexCommandResult, error) {
+	result := models.CognexCommandResult{CognexID: c.id, Command: cmd.Command}
+	if err := ValidateCognexCommand(cmd); err != nil {
+		return result, err
+	}
+	if c.commands == nil {
+		return result, ErrCognexSinControl
+	}
+
+	status, err := c.commands.Execute(cmd)
+	if err != nil {
+		return result, err
+	}
+	result.Status = status
+	log.Printf("🎛️  [Cognex#%d] Comando '%s' ejecutado", c.id, cmd.Command)
+	return result, nil
+}
+
+// SetPaused pone offline (pausa) u online (reanudación) las cámaras del lector configuradas con
+// offline_on_pause. Retorna true si alguna cámara cambió de estado.
+func (c *CognexListener) SetPaused(paused bool) (bool, error) {
+	camaras := []*CognexListener{c}
+	if c.fusion != nil {
+		camaras = c.fusion.camaras
+	}
+
+	cambiadas := 0
+	var errs []string
+	for _, cam := range camaras {
+		if cam.commands == nil || !cam.offlineOnPause {
+			continue
+		}
+		if err := cam.commands.SetOnline(!paused); err != nil {
+			errs = append(errs, fmt.Sprintf("cámara #%d: %v", cam.id, err))
+			continue
+		}
+		cambiadas++
+	}
+
+	if len(errs) > 0 {
+		return cambiadas > 0, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return cambiadas > 0, nil
+}
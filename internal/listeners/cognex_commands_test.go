@@ -0,0 +1,286 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInSight simula el Native Mode de una cámara In-Sight: login telnet y comandos SO, SE8, LF, GO y GF
+type fakeInSight struct {
+	ln       net.Listener
+	password string
+	jobs     map[string]bool // Jobs existentes en la memoria de la cámara
+
+	mu       sync.Mutex
+	online   bool
+	job      string
+	triggers int
+	sesiones int
+}
+
+func newFakeInSight(t *testing.T, password string, jobs ...string) *fakeInSight {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	f := &fakeInSight{ln: ln, password: password, jobs: make(map[string]bool), online: true}
+	for _, job := range jobs {
+		f.jobs[job] = true
+	}
+	if len(jobs) > 0 {
+		f.job = jobs[0]
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeInSight) client() *CognexCommandClient {
+	addr := f.ln.Addr().(*net.TCPAddr)
+	return NewCognexCommandClient("127.0.0.1", addr.Port, "", f.password, time.Second)
+}
+
+func (f *fakeInSight) serve(conn net.Conn) {
+	defer conn.Close()
+	f.mu.Lock()
+	f.sesiones++
+	f.mu.Unlock()
+
+	reader := bufio.NewReader(conn)
+	leer := func() (string, bool) {
+		linea, err := reader.ReadString('\n')
+		return strings.TrimSpace(linea), err == nil
+	}
+
+	conn.Write([]byte("Welcome to In-Sight(R) 2000 Session 0\r\nUser: "))
+	user, ok := leer()
+	if !ok {
+		return
+	}
+	conn.Write([]byte("Password: "))
+	password, ok := leer()
+	if !ok {
+		return
+	}
+	if user != defaultCommandUser || password != f.password {
+		conn.Write([]byte("Invalid Password\r\n"))
+		return
+	}
+	conn.Write([]byte("User Logged In\r\n"))
+
+	for {
+		comando, ok := leer()
+		if !ok {
+			return
+		}
+		conn.Write([]byte(f.ejecutar(comando)))
+	}
+}
+
+// ejecutar aplica el comando al estado de la cámara y arma la respuesta Native Mode
+func (f *fakeInSight) ejecutar(comando string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case comando == "SO0" || comando == "SO1":
+		f.online = comando == "SO1"
+		return "1\r\n"
+	case comando == "SE8":
+		if !f.online {
+			return "-5\r\n"
+		}
+		f.triggers++
+		return "1\r\n"
+	case strings.HasPrefix(comando, "LF"):
+		job := strings.TrimPrefix(comando, "LF")
+		if !f.jobs[job] {
+			return "-1\r\n"
+		}
+		f.job = job
+		return "1\r\n"
+	case comando == "GO":
+		online := 0
+		if f.online {
+			online = 1
+		}
+		return "1\r\n" + strconv.Itoa(online) + "\r\n"
+	case comando == "GF":
+		return "1\r\n" + f.job + "\r\n"
+	default:
+		return "0\r\n"
+	}
+}
+
+func (f *fakeInSight) estado() (online bool, job string, triggers int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.online, f.job, f.triggers
+}
+
+func (f *fakeInSight) sesionesAbiertas() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sesiones
+}
+
+func TestCognexCommandClientCommands(t *testing.T) {
+	cam := newFakeInSight(t, "", "qr_linea1.job", "qr_linea2.job")
+	cc := cam.client()
+	defer cc.Close()
+
+	if err := cc.Trigger(); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	if err := cc.LoadJob("qr_linea2.job"); err != nil {
+		t.Fatalf("LoadJob: %v", err)
+	}
+	if err := cc.SetOnline(false); err != nil {
+		t.Fatalf("SetOnline(false): %v", err)
+	}
+
+	status, err := cc.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Online || status.Job != "qr_linea2.job" {
+		t.Errorf("Status = %+v, esperado offline con qr_linea2.job", *status)
+	}
+
+	online, job, triggers := cam.estado()
+	if online || job != "qr_linea2.job" || triggers != 1 {
+		t.Errorf("cámara: online=%t job=%q triggers=%d", online, job, triggers)
+	}
+	if cam.sesionesAbiertas() != 1 {
+		t.Errorf("sesiones = %d, esperado 1 (la sesión se reutiliza)", cam.sesionesAbiertas())
+	}
+}
+
+func TestCognexCommandClientRejected(t *testing.T) {
+	cam := newFakeInSight(t, "", "qr.job")
+	cc := cam.client()
+	defer cc.Close()
+
+	err := cc.LoadJob("inexistente.job")
+	if err == nil || !strings.Contains(err.Error(), "-1") {
+		t.Errorf("LoadJob(inexistente) = %v, esperado rechazo -1", err)
+	}
+
+	// Un rechazo no corta la sesión
+	if err := cc.SetOnline(false); err != nil {
+		t.Fatalf("SetOnline(false): %v", err)
+	}
+	if err := cc.Trigger(); err == nil {
+		t.Error("Trigger offline: esperado rechazo -5")
+	}
+	if cam.sesionesAbiertas() != 1 {
+		t.Errorf("sesiones = %d, esperado 1", cam.sesionesAbiertas())
+	}
+}
+
+func TestCognexCommandClientLoginRejected(t *testing.T) {
+	cam := newFakeInSight(t, "secreta")
+	addr := cam.ln.Addr().(*net.TCPAddr)
+	cc := NewCognexCommandClient("127.0.0.1", addr.Port, "", "otra", time.Second)
+	defer cc.Close()
+
+	if err := cc.Trigger(); err == nil || !strings.Contains(err.Error(), "login rechazado") {
+		t.Errorf("Trigger con contraseña incorrecta = %v, esperado login rechazado", err)
+	}
+}
+
+func TestCognexCommandClientReconnects(t *testing.T) {
+	cam := newFakeInSight(t, "")
+	cc := cam.client()
+	defer cc.Close()
+
+	if err := cc.Trigger(); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+
+	// La cámara corta la sesión (ej: reinicio): el siguiente comando reconecta
+	cc.mu.Lock()
+	cc.conn.Close()
+	cc.mu.Unlock()
+
+	if err := cc.Trigger(); err != nil {
+		t.Fatalf("Trigger tras corte: %v", err)
+	}
+	if _, _, triggers := cam.estado(); triggers != 2 {
+		t.Errorf("triggers = %d, esperado 2", triggers)
+	}
+	if cam.sesionesAbiertas() != 2 {
+		t.Errorf("sesiones = %d, esperado 2", cam.sesionesAbiertas())
+	}
+}
+
+func TestCognexListenerSetPaused(t *testing.T) {
+	cam := newFakeInSight(t, "")
+	c := NewCognexListener(98, "127.0.0.1", 0, "QR", nil)
+	defer c.cancel()
+
+	// Sin offline_on_pause la cámara no se toca
+	c.SetCommandClient(cam.client(), false)
+	if cambiadas, err := c.SetPaused(true); cambiadas || err != nil {
+		t.Fatalf("SetPaused sin offline_on_pause = %t, %v", cambiadas, err)
+	}
+	if online, _, _ := cam.estado(); !online {
+		t.Fatal("la cámara quedó offline sin offline_on_pause")
+	}
+
+	c.SetCommandClient(cam.client(), true)
+	if cambiadas, err := c.SetPaused(true); !cambiadas || err != nil {
+		t.Fatalf("SetPaused(true) = %t, %v", cambiadas, err)
+	}
+	if online, _, _ := cam.estado(); online {
+		t.Error("cámara online durante la pausa")
+	}
+	if cambiadas, err := c.SetPaused(false); !cambiadas || err != nil {
+		t.Fatalf("SetPaused(false) = %t, %v", cambiadas, err)
+	}
+	if online, _, _ := cam.estado(); !online {
+		t.Error("cámara offline después de reanudar")
+	}
+}
+
+func TestCognexListenerExecuteCommand(t *testing.T) {
+	c := NewCognexListener(97, "127.0.0.1", 0, "QR", nil)
+	defer c.cancel()
+
+	if _, err := c.ExecuteCommand(models.CognexCommand{Command: models.CognexCommandTrigger}); err != ErrCognexSinControl {
+		t.Errorf("sin control = %v, esperado ErrCognexSinControl", err)
+	}
+
+	cam := newFakeInSight(t, "", "qr.job")
+	c.SetCommandClient(cam.client(), false)
+
+	if _, err := c.ExecuteCommand(models.CognexCommand{Command: "reboot"}); err == nil {
+		t.Error("esperado error para comando no soportado")
+	}
+	if _, err := c.ExecuteCommand(models.CognexCommand{Command: models.CognexCommandLoadJob}); err == nil {
+		t.Error("esperado error para load_job sin job")
+	}
+
+	result, err := c.ExecuteCommand(models.CognexCommand{Command: models.CognexCommandStatus})
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if result.CognexID != 97 || result.Status == nil || !result.Status.Online || result.Status.Job != "qr.job" {
+		t.Errorf("resultado = %+v", result)
+	}
+}
@@ -0,0 +1,238 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conexiones rechazadas recientes que se conservan por cámara
+const rechazosRecientesBuffer = 20
+
+// Motivos de rechazo de una conexión entrante
+const (
+	MotivoOrigenNoPermitido = "origen_no_permitido"
+	MotivoMaxConexiones     = "max_conexiones"
+)
+
+// connectionPolicy controla qué conexiones acepta el puerto de una cámara (modo server)
+type connectionPolicy struct {
+	allowed  []*net.IPNet // Orígenes permitidos (vacío = cualquiera)
+	maxConns int          // Conexiones simultáneas máximas (0 = sin límite)
+	replace  bool         // Una reconexión desde el mismo origen (o sobre el límite) reemplaza la conexión más antigua
+
+	mu           sync.Mutex
+	activas      map[net.Conn]time.Time
+	rechazadas   int64
+	reemplazadas int64
+	recientes    []models.CognexConnectionReject // buffer circular
+	next         int
+}
+
+func newConnectionPolicy() *connectionPolicy {
+	return &connectionPolicy{activas: make(map[net.Conn]time.Time)}
+}
+
+// SetConnectionPolicy configura los orígenes permitidos (IPs o CIDR), el máximo de conexiones
+// simultáneas y si una reconexión reemplaza a la conexión anterior. Debe llamarse antes de Start.
+func (c *CognexListener) SetConnectionPolicy(allowedSources []string, maxConnections int, replaceOnReconnect bool) error {
+	allowed := make([]*net.IPNet, 0, len(allowedSources))
+	for _, origen := range allowedSources {
+		origen = strings.TrimSpace(origen)
+		if !strings.Contains(origen, "/") {
+			ip := net.ParseIP(origen)
+			if ip == nil {
+				return fmt.Errorf("origen permitido inválido: '%s'", origen)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			allowed = append(allowed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, red, err := net.ParseCIDR(origen)
+		if err != nil {
+			return fmt.Errorf("origen permitido inválido: '%s': %w", origen, err)
+		}
+		allowed = append(allowed, red)
+	}
+	if maxConnections < 0 {
+		return fmt.Errorf("max_connections no puede ser negativo (%d)", maxConnections)
+	}
+
+	c.conexionesPolicy.mu.Lock()
+	defer c.conexionesPolicy.mu.Unlock()
+	c.conexionesPolicy.allowed = allowed
+	c.conexionesPolicy.maxConns = maxConnections
+	c.conexionesPolicy.replace = replaceOnReconnect
+	return nil
+}
+
+// admitConnection aplica la política a una conexión entrante. Si la rechaza la cierra y retorna false.
+func (c *CognexListener) admitConnection(conn net.Conn) bool {
+	p := c.conexionesPolicy
+	remote := conn.RemoteAddr().String()
+	ip := remoteIP(conn)
+
+	p.mu.Lock()
+	if !p.permitido(ip) {
+		p.rechazar(remote, MotivoOrigenNoPermitido)
+		p.mu.Unlock()
+		log.Printf("🚫 [Cognex#%d] Conexión rechazada desde %s: origen no permitido", c.id, remote)
+		conn.Close()
+		return false
+	}
+
+	// Reconexión de la misma cámara: la conexión anterior quedó colgada
+	var reemplazar []net.Conn
+	if p.replace {
+		for activa := range p.activas {
+			if remoteIP(activa).Equal(ip) {
+				reemplazar = append(reemplazar, activa)
+			}
+		}
+		if p.maxConns > 0 && len(p.activas)-len(reemplazar) >= p.maxConns {
+			reemplazar = append(reemplazar, p.masAntiguas(len(p.activas)-len(reemplazar)-p.maxConns+1, reemplazar)...)
+		}
+	}
+	if p.maxConns > 0 && len(p.activas)-len(reemplazar) >= p.maxConns {
+		p.rechazar(remote, MotivoMaxConexiones)
+		p.mu.Unlock()
+		log.Printf("🚫 [Cognex#%d] Conexión rechazada desde %s: máximo de %d conexión(es) alcanzado", c.id, remote, p.maxConns)
+		conn.Close()
+		return false
+	}
+	for _, vieja := range reemplazar {
+		delete(p.activas, vieja)
+		p.reemplazadas++
+	}
+	p.activas[conn] = time.Now()
+	p.mu.Unlock()
+
+	for _, vieja := range reemplazar {
+		log.Printf("🔁 [Cognex#%d] Conexión de %s reemplazada por %s", c.id, vieja.RemoteAddr().String(), remote)
+		vieja.Close()
+	}
+	return true
+}
+
+// trackConnection registra una conexión activa (idempotente, también para el modo client)
+func (c *CognexListener) trackConnection(conn net.Conn) {
+	p := c.conexionesPolicy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.activas[conn]; !ok {
+		p.activas[conn] = time.Now()
+	}
+}
+
+// untrackConnection quita una conexión cerrada del registro
+func (c *CognexListener) untrackConnection(conn net.Conn) {
+	p := c.conexionesPolicy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.activas, conn)
+}
+
+// GetConnections retorna las conexiones activas y los rechazos recientes de la cámara
+func (c *CognexListener) GetConnections() models.CognexConnections {
+	p := c.conexionesPolicy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := models.CognexConnections{
+		CognexID:           c.id,
+		Modo:               c.mode,
+		MaxConexiones:      p.maxConns,
+		ReemplazoActivo:    p.replace,
+		Activas:            make([]models.CognexConnection, 0, len(p.activas)),
+		Rechazadas:         p.rechazadas,
+		Reemplazadas:       p.reemplazadas,
+		RechazosRecientes:  make([]models.CognexConnectionReject, 0, len(p.recientes)),
+		OrigenesPermitidos: make([]string, 0, len(p.allowed)),
+	}
+	for _, red := range p.allowed {
+		result.OrigenesPermitidos = append(result.OrigenesPermitidos, red.String())
+	}
+	for conn, desde := range p.activas {
+		result.Activas = append(result.Activas, models.CognexConnection{Remote: conn.RemoteAddr().String(), Desde: desde})
+	}
+	sort.Slice(result.Activas, func(i, j int) bool { return result.Activas[i].Desde.Before(result.Activas[j].Desde) })
+
+	// Rechazos del más nuevo al más antiguo
+	total := len(p.recientes)
+	for i := 0; i < total; i++ {
+		result.RechazosRecientes = append(result.RechazosRecientes, p.recientes[(p.next-1-i+total)%total])
+	}
+	return result
+}
+
+// permitido indica si la IP está en los orígenes permitidos. Requiere p.mu.
+func (p *connectionPolicy) permitido(ip net.IP) bool {
+	if len(p.allowed) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, red := range p.allowed {
+		if red.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rechazar registra un rechazo en los contadores y el buffer de recientes. Requiere p.mu.
+func (p *connectionPolicy) rechazar(remote, motivo string) {
+	p.rechazadas++
+	rechazo := models.CognexConnectionReject{Remote: remote, Motivo: motivo, Fecha: time.Now()}
+	if len(p.recientes) < rechazosRecientesBuffer {
+		p.recientes = append(p.recientes, rechazo)
+		p.next = len(p.recientes) % rechazosRecientesBuffer
+		return
+	}
+	p.recientes[p.next] = rechazo
+	p.next = (p.next + 1) % rechazosRecientesBuffer
+}
+
+// masAntiguas retorna las n conexiones activas más antiguas, excluyendo las ya elegidas. Requiere p.mu.
+func (p *connectionPolicy) masAntiguas(n int, excluir []net.Conn) []net.Conn {
+	excluidas := make(map[net.Conn]bool, len(excluir))
+	for _, conn := range excluir {
+		excluidas[conn] = true
+	}
+	candidatas := make([]net.Conn, 0, len(p.activas))
+	for conn := range p.activas {
+		if !excluidas[conn] {
+			candidatas = append(candidatas, conn)
+		}
+	}
+	sort.Slice(candidatas, func(i, j int) bool { return p.activas[candidatas[i]].Before(p.activas[candidatas[j]]) })
+	if n > len(candidatas) {
+		n = len(candidatas)
+	}
+	return candidatas[:n]
+}
+
+// remoteIP extrae la IP remota de la conexión (nil si no es TCP/IP)
+func remoteIP(conn net.Conn) net.IP {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// conexionesRechazadas retorna el total de conexiones rechazadas por la política del puerto
+func (c *CognexListener) conexionesRechazadas() int64 {
+	c.conexionesPolicy.mu.Lock()
+	defer c.conexionesPolicy.mu.Unlock()
+	return c.conexionesPolicy.rechazadas
+}
@@ -0,0 +1,178 @@
+package listeners
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeConn es una conexión entrante desde un origen dado; solo registra si fue cerrada
+type fakeConn struct {
+	net.Conn
+	remote  net.Addr
+	cerrada bool
+}
+
+func newFakeConn(ip string) *fakeConn {
+	return &fakeConn{remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}}
+}
+
+func (f *fakeConn) RemoteAddr() net.Addr { return f.remote }
+func (f *fakeConn) Close() error         { f.cerrada = true; return nil }
+
+func TestSetConnectionPolicyInvalida(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		origenes []string
+		max      int
+	}{
+		{"IP inválida", []string{"10.0.0.300"}, 0},
+		{"nombre de host", []string{"camara-1"}, 0},
+		{"CIDR inválido", []string{"10.0.0.0/33"}, 0},
+		{"máximo negativo", nil, -1},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			c := NewCognexListener(95, "", 2001, "QR", nil)
+			t.Cleanup(c.cancel)
+			if err := c.SetConnectionPolicy(caso.origenes, caso.max, false); err == nil {
+				t.Error("política aceptada")
+			}
+		})
+	}
+}
+
+func TestAdmitConnectionOrigenes(t *testing.T) {
+	c := NewCognexListener(95, "", 2001, "QR", nil)
+	t.Cleanup(c.cancel)
+	if err := c.SetConnectionPolicy([]string{" 10.0.0.5 ", "192.168.1.0/24", "fd00::1"}, 0, false); err != nil {
+		t.Fatalf("SetConnectionPolicy: %v", err)
+	}
+
+	casos := []struct {
+		ip       string
+		admitida bool
+	}{
+		{"10.0.0.5", true},
+		{"10.0.0.6", false},
+		{"192.168.1.77", true},
+		{"192.168.2.1", false},
+		{"::ffff:10.0.0.5", true},
+		{"fd00::1", true},
+		{"fd00::2", false},
+	}
+	rechazos := 0
+	for _, caso := range casos {
+		conn := newFakeConn(caso.ip)
+		if admitida := c.admitConnection(conn); admitida != caso.admitida || conn.cerrada == caso.admitida {
+			t.Errorf("%s: admitida=%v (cerrada=%v), esperado %v", caso.ip, admitida, conn.cerrada, caso.admitida)
+		}
+		if !caso.admitida {
+			rechazos++
+		}
+	}
+
+	estado := c.GetConnections()
+	if estado.Rechazadas != int64(rechazos) || len(estado.RechazosRecientes) != rechazos || len(estado.Activas) != len(casos)-rechazos {
+		t.Fatalf("estado = %+v, esperado %d rechazos", estado, rechazos)
+	}
+	if ultimo := estado.RechazosRecientes[0]; ultimo.Motivo != MotivoOrigenNoPermitido || ultimo.Remote != "[fd00::2]:50000" {
+		t.Errorf("rechazo más reciente = %+v", ultimo)
+	}
+}
+
+func TestAdmitConnectionMaxConexiones(t *testing.T) {
+	casos := []struct {
+		nombre       string
+		max          int
+		replace      bool
+		ips          []string
+		admitidas    []bool
+		cerradas     []bool // conexiones cerradas al final (rechazadas o reemplazadas)
+		reemplazadas int64
+	}{
+		{
+			nombre:    "rechaza sobre el límite",
+			max:       1,
+			ips:       []string{"10.0.0.5", "10.0.0.5", "10.0.0.6"},
+			admitidas: []bool{true, false, false},
+			cerradas:  []bool{false, true, true},
+		},
+		{
+			nombre:       "reconexión del mismo origen reemplaza",
+			max:          1,
+			replace:      true,
+			ips:          []string{"10.0.0.5", "10.0.0.5"},
+			admitidas:    []bool{true, true},
+			cerradas:     []bool{true, false},
+			reemplazadas: 1,
+		},
+		{
+			nombre:       "otro origen sobre el límite reemplaza a la más antigua",
+			max:          2,
+			replace:      true,
+			ips:          []string{"10.0.0.5", "10.0.0.6", "10.0.0.7"},
+			admitidas:    []bool{true, true, true},
+			cerradas:     []bool{true, false, false},
+			reemplazadas: 1,
+		},
+		{
+			nombre:       "reemplazo sin límite solo afecta al mismo origen",
+			replace:      true,
+			ips:          []string{"10.0.0.5", "10.0.0.6", "10.0.0.5"},
+			admitidas:    []bool{true, true, true},
+			cerradas:     []bool{true, false, false},
+			reemplazadas: 1,
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			c := NewCognexListener(95, "", 2001, "QR", nil)
+			t.Cleanup(c.cancel)
+			if err := c.SetConnectionPolicy(nil, caso.max, caso.replace); err != nil {
+				t.Fatalf("SetConnectionPolicy: %v", err)
+			}
+
+			conns := make([]*fakeConn, len(caso.ips))
+			for i, ip := range caso.ips {
+				conns[i] = newFakeConn(ip)
+				if admitida := c.admitConnection(conns[i]); admitida != caso.admitidas[i] {
+					t.Fatalf("conexión %d desde %s: admitida=%v, esperado %v", i, ip, admitida, caso.admitidas[i])
+				}
+				time.Sleep(time.Millisecond) // antigüedad distinta para elegir la más antigua
+			}
+			for i, conn := range conns {
+				if conn.cerrada != caso.cerradas[i] {
+					t.Errorf("conexión %d cerrada=%v, esperado %v", i, conn.cerrada, caso.cerradas[i])
+				}
+			}
+			if estado := c.GetConnections(); estado.Reemplazadas != caso.reemplazadas {
+				t.Errorf("reemplazadas = %d, esperado %d", estado.Reemplazadas, caso.reemplazadas)
+			}
+		})
+	}
+}
+
+func TestAdmitConnectionLiberaAlCerrar(t *testing.T) {
+	c := NewCognexListener(95, "", 2001, "QR", nil)
+	t.Cleanup(c.cancel)
+	if err := c.SetConnectionPolicy(nil, 1, false); err != nil {
+		t.Fatalf("SetConnectionPolicy: %v", err)
+	}
+
+	primera := newFakeConn("10.0.0.5")
+	if !c.admitConnection(primera) {
+		t.Fatal("primera conexión rechazada")
+	}
+	if c.admitConnection(newFakeConn("10.0.0.5")) {
+		t.Fatal("segunda conexión admitida sobre el límite")
+	}
+	c.untrackConnection(primera)
+	if !c.admitConnection(newFakeConn("10.0.0.5")) {
+		t.Error("conexión rechazada tras cerrarse la anterior")
+	}
+	if estado := c.GetConnections(); estado.Rechazadas != 1 || estado.RechazosRecientes[0].Motivo != MotivoMaxConexiones {
+		t.Errorf("estado = %+v, esperado un rechazo por %s", estado, MotivoMaxConexiones)
+	}
+}
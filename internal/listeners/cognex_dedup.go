@@ -0,0 +1,116 @@
+package listeners
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Separación mínima por defecto entre dos cajas consecutivas frente a la cámara.
+// Las etiquetas son por SKU: un tren de cajas del mismo SKU llega cada ~0,55 s.
+const defaultBoxPitch = 500 * time.Millisecond
+
+// BoxTracker retorna el valor actual del tracking de cajas del PLC (ej: contador de cajas ingresadas).
+// ok=false si el valor no está disponible.
+type BoxTracker func() (valor string, ok bool)
+
+// lecturaReciente es la última lectura aceptada de un código dentro de la ventana de duplicados
+type lecturaReciente struct {
+	fecha       time.Time
+	tracking    string
+	conTracking bool
+}
+
+// duplicateFilter detecta lecturas repetidas del mismo código en una ventana de tiempo.
+// Si usePLC está activo y hay tracker, una lectura repetida solo es duplicada
+// cuando el tracking de cajas del PLC no cambió (no ingresó otra caja). Sin tracking,
+// solo se suprime una repetición más cercana que la separación entre cajas (pitch),
+// para no descartar las cajas de un tren del mismo SKU.
+type duplicateFilter struct {
+	window     time.Duration
+	pitch      time.Duration
+	usePLC     bool
+	tracker    BoxTracker
+	recientes  map[string]lecturaReciente
+	suprimidas int64
+	mu         sync.Mutex
+}
+
+func newDuplicateFilter() *duplicateFilter {
+	return &duplicateFilter{recientes: make(map[string]lecturaReciente)}
+}
+
+// isDuplicate registra la lectura y retorna true si es un duplicado que debe suprimirse
+func (f *duplicateFilter) isDuplicate(payload string, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.window <= 0 {
+		return false
+	}
+
+	// Descartar lecturas fuera de la ventana
+	for codigo, lectura := range f.recientes {
+		if now.Sub(lectura.fecha) > f.window {
+			delete(f.recientes, codigo)
+		}
+	}
+
+	tracking, conTracking := "", false
+	if f.usePLC && f.tracker != nil {
+		tracking, conTracking = f.tracker()
+	}
+
+	if anterior, exists := f.recientes[payload]; exists {
+		duplicada := now.Sub(anterior.fecha) < f.pitch
+		if conTracking && anterior.conTracking {
+			// El tracking del PLC decide: si cambió, ingresó otra caja con la misma etiqueta
+			duplicada = tracking == anterior.tracking
+		}
+		if duplicada {
+			f.suprimidas++
+			return true
+		}
+	}
+
+	f.recientes[payload] = lecturaReciente{fecha: now, tracking: tracking, conTracking: conTracking}
+	return false
+}
+
+// SetDuplicateSuppression configura la ventana de supresión de lecturas duplicadas (0 = deshabilitada),
+// la separación mínima entre cajas (pitch <= 0 usa el default) y si los duplicados se confirman con el
+// tracking de cajas del PLC. Una ventana igual o mayor al pitch solo es válida con usePLC: sin el
+// contador de cajas descartaría la mitad de cada tren de cajas del mismo SKU.
+func (c *CognexListener) SetDuplicateSuppression(window, pitch time.Duration, usePLC bool) error {
+	if pitch <= 0 {
+		pitch = defaultBoxPitch
+	}
+	if window < 0 {
+		return fmt.Errorf("ventana de duplicados inválida: %v", window)
+	}
+	if window >= pitch && !usePLC {
+		return fmt.Errorf("ventana de duplicados (%v) >= separación entre cajas (%v): requiere duplicate_use_plc con plc.box_counter_node_id",
+			window, pitch)
+	}
+
+	c.duplicados.mu.Lock()
+	defer c.duplicados.mu.Unlock()
+	c.duplicados.window = window
+	c.duplicados.pitch = pitch
+	c.duplicados.usePLC = usePLC
+	return nil
+}
+
+// SetBoxTracker vincula la fuente del tracking de cajas del PLC (usada si la supresión lo requiere)
+func (c *CognexListener) SetBoxTracker(tracker BoxTracker) {
+	c.duplicados.mu.Lock()
+	defer c.duplicados.mu.Unlock()
+	c.duplicados.tracker = tracker
+}
+
+// UsesPLCTracking indica si la supresión de duplicados requiere el tracking de cajas del PLC
+func (c *CognexListener) UsesPLCTracking() bool {
+	c.duplicados.mu.Lock()
+	defer c.duplicados.mu.Unlock()
+	return c.duplicados.window > 0 && c.duplicados.usePLC
+}
@@ -0,0 +1,112 @@
+package listeners
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// lecturaDedup es una lectura de prueba: instante (ms desde el inicio), código y tracking del PLC ("" = no disponible)
+type lecturaDedup struct {
+	ms       int
+	codigo   string
+	tracking string
+}
+
+func TestIsDuplicate(t *testing.T) {
+	const tren = "E003;3J;0;CEMDCRBP44;V020"
+	casos := []struct {
+		nombre   string
+		window   time.Duration
+		usePLC   bool
+		lecturas []lecturaDedup
+		esperado []bool // true = suprimida
+	}{
+		{
+			nombre:   "repetición dentro de la ventana",
+			window:   400 * time.Millisecond,
+			lecturas: []lecturaDedup{{0, tren, ""}, {150, tren, ""}},
+			esperado: []bool{false, true},
+		},
+		{
+			nombre:   "repetición fuera de la ventana",
+			window:   400 * time.Millisecond,
+			lecturas: []lecturaDedup{{0, tren, ""}, {450, tren, ""}},
+			esperado: []bool{false, false},
+		},
+		{
+			nombre:   "otro código dentro de la ventana",
+			window:   400 * time.Millisecond,
+			lecturas: []lecturaDedup{{0, tren, ""}, {100, "E003;J;0;CEMDCRAM44;V020", ""}},
+			esperado: []bool{false, false},
+		},
+		{
+			nombre:   "tren del mismo SKU al pitch",
+			window:   400 * time.Millisecond,
+			lecturas: []lecturaDedup{{0, tren, ""}, {550, tren, ""}, {1100, tren, ""}, {1650, tren, ""}, {2200, tren, ""}, {2750, tren, ""}},
+			esperado: []bool{false, false, false, false, false, false},
+		},
+		{
+			nombre:   "tracking del PLC cambió",
+			window:   2 * time.Second,
+			usePLC:   true,
+			lecturas: []lecturaDedup{{0, tren, "3511"}, {550, tren, "3512"}, {1100, tren, "3513"}},
+			esperado: []bool{false, false, false},
+		},
+		{
+			nombre:   "tracking del PLC sin cambio",
+			window:   2 * time.Second,
+			usePLC:   true,
+			lecturas: []lecturaDedup{{0, tren, "3511"}, {550, tren, "3511"}, {1100, tren, "3512"}},
+			esperado: []bool{false, true, false},
+		},
+		{
+			nombre:   "tracking no disponible limita la supresión al pitch",
+			window:   2 * time.Second,
+			usePLC:   true,
+			lecturas: []lecturaDedup{{0, tren, ""}, {100, tren, ""}, {550, tren, ""}},
+			esperado: []bool{false, true, false},
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			c := NewCognexListener(70, "127.0.0.1", 0, "QR", nil)
+			t.Cleanup(c.cancel)
+			if err := c.SetDuplicateSuppression(caso.window, 0, caso.usePLC); err != nil {
+				t.Fatalf("SetDuplicateSuppression: %v", err)
+			}
+
+			var tracking string
+			c.SetBoxTracker(func() (string, bool) { return tracking, tracking != "" })
+
+			inicio := time.Now()
+			suprimidas := make([]bool, len(caso.lecturas))
+			for i, lectura := range caso.lecturas {
+				tracking = lectura.tracking
+				suprimidas[i] = c.duplicados.isDuplicate(lectura.codigo, inicio.Add(time.Duration(lectura.ms)*time.Millisecond))
+			}
+			if !reflect.DeepEqual(suprimidas, caso.esperado) {
+				t.Errorf("suprimidas = %v, esperado %v", suprimidas, caso.esperado)
+			}
+		})
+	}
+}
+
+func TestSetDuplicateSuppressionRequierePLC(t *testing.T) {
+	c := NewCognexListener(71, "127.0.0.1", 0, "QR", nil)
+	t.Cleanup(c.cancel)
+
+	if err := c.SetDuplicateSuppression(800*time.Millisecond, 0, false); err == nil {
+		t.Error("una ventana >= pitch sin tracking del PLC debe rechazarse")
+	}
+	if err := c.SetDuplicateSuppression(800*time.Millisecond, time.Second, false); err != nil {
+		t.Errorf("ventana menor al pitch configurado: %v", err)
+	}
+	if err := c.SetDuplicateSuppression(800*time.Millisecond, 0, true); err != nil {
+		t.Errorf("ventana con tracking del PLC: %v", err)
+	}
+	if !c.UsesPLCTracking() {
+		t.Error("UsesPLCTracking = false con duplicate_use_plc")
+	}
+}
@@ -0,0 +1,111 @@
+package listeners
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delimitadores de trama soportados para el protocolo Cognex
+const (
+	FrameDelimiterCRLF = "crlf" // CR o LF terminan la trama (default)
+	FrameDelimiterCR   = "cr"
+	FrameDelimiterLF   = "lf"
+	FrameDelimiterETX  = "etx" // STX (0x02) opcional al inicio, ETX (0x03) al final
+)
+
+const (
+	stx = 0x02
+	etx = 0x03
+
+	defaultMaxFrameLength = 1024
+	defaultPartialTimeout = 200 * time.Millisecond
+)
+
+// cognexFramer separa el stream TCP de una cámara en tramas completas.
+// Una lectura de la conexión puede traer varias tramas o solo parte de una.
+type cognexFramer struct {
+	delimitadores []byte
+	stripSTX      bool
+	maxLen        int
+	buf           []byte
+	descartando   bool // Trama excedida: descartar hasta el próximo delimitador
+}
+
+// newCognexFramer crea el separador de tramas para el delimitador indicado ("" = crlf)
+func newCognexFramer(delimiter string, maxLen int) (*cognexFramer, error) {
+	if maxLen <= 0 {
+		maxLen = defaultMaxFrameLength
+	}
+
+	f := &cognexFramer{maxLen: maxLen}
+	switch strings.ToLower(delimiter) {
+	case "", FrameDelimiterCRLF:
+		f.delimitadores = []byte{'\r', '\n'}
+	case FrameDelimiterCR:
+		f.delimitadores = []byte{'\r'}
+	case FrameDelimiterLF:
+		f.delimitadores = []byte{'\n'}
+	case FrameDelimiterETX:
+		f.delimitadores = []byte{etx}
+		f.stripSTX = true
+	default:
+		return nil, fmt.Errorf("delimitador de trama '%s' no soportado (crlf, cr, lf, etx)", delimiter)
+	}
+	return f, nil
+}
+
+// Feed agrega datos recibidos y retorna las tramas completas (sin delimitador, en orden).
+// excedidas es la cantidad de tramas descartadas por superar la longitud máxima.
+func (f *cognexFramer) Feed(data []byte) (tramas []string, excedidas int) {
+	for len(data) > 0 {
+		idx := bytes.IndexAny(data, string(f.delimitadores))
+		if idx < 0 {
+			if !f.descartando {
+				f.buf = append(f.buf, data...)
+				if len(f.buf) > f.maxLen {
+					f.buf = f.buf[:0]
+					f.descartando = true
+					excedidas++
+				}
+			}
+			return tramas, excedidas
+		}
+
+		if f.descartando {
+			// Fin de la trama excedida: retomar desde el siguiente byte
+			f.descartando = false
+		} else if len(f.buf)+idx > f.maxLen {
+			excedidas++
+		} else {
+			f.buf = append(f.buf, data[:idx]...)
+			if trama := f.trama(f.buf); trama != "" {
+				tramas = append(tramas, trama)
+			}
+		}
+		f.buf = f.buf[:0]
+		data = data[idx+1:]
+	}
+	return tramas, excedidas
+}
+
+// Pending indica si hay una trama incompleta en el buffer
+func (f *cognexFramer) Pending() bool {
+	return len(f.buf) > 0
+}
+
+// Flush retorna la trama incompleta pendiente (ej: tras el timeout de trama parcial) y vacía el buffer
+func (f *cognexFramer) Flush() string {
+	trama := f.trama(f.buf)
+	f.buf = f.buf[:0]
+	return trama
+}
+
+// trama convierte el contenido del buffer en una trama (quitando STX si corresponde)
+func (f *cognexFramer) trama(b []byte) string {
+	if f.stripSTX {
+		b = bytes.TrimPrefix(b, []byte{stx})
+	}
+	return string(b)
+}
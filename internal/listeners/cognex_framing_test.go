@@ -0,0 +1,265 @@
+package listeners
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// feedAll entrega los fragmentos al framer en orden y acumula las tramas resultantes
+func feedAll(t *testing.T, f *cognexFramer, fragmentos ...string) ([]string, int) {
+	t.Helper()
+	var tramas []string
+	total := 0
+	for _, fragmento := range fragmentos {
+		nuevas, excedidas := f.Feed([]byte(fragmento))
+		tramas = append(tramas, nuevas...)
+		total += excedidas
+	}
+	return tramas, total
+}
+
+func TestCognexFramerFragmentedAndCoalesced(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		delimiter  string
+		fragmentos []string
+		esperado   []string
+	}{
+		{
+			nombre:     "una trama por lectura",
+			delimiter:  FrameDelimiterCRLF,
+			fragmentos: []string{"E003;4J;0;CEMDCRBP44;V020\r\n"},
+			esperado:   []string{"E003;4J;0;CEMDCRBP44;V020"},
+		},
+		{
+			nombre:     "dos tramas en un segmento",
+			delimiter:  FrameDelimiterCRLF,
+			fragmentos: []string{"E003;4J;0;CEMDCRBP44;V020\r\nE003;3J;1;CEMDCRBP44;V018\r\n"},
+			esperado:   []string{"E003;4J;0;CEMDCRBP44;V020", "E003;3J;1;CEMDCRBP44;V018"},
+		},
+		{
+			nombre:     "trama partida en dos lecturas",
+			delimiter:  FrameDelimiterCRLF,
+			fragmentos: []string{"E003;4J;0;CEM", "DCRBP44;V020\r\n"},
+			esperado:   []string{"E003;4J;0;CEMDCRBP44;V020"},
+		},
+		{
+			nombre:     "CR y LF en lecturas distintas",
+			delimiter:  FrameDelimiterCRLF,
+			fragmentos: []string{"E003;4J;0;CEMDCRBP44;V020\r", "\nNO_READ\r", "\n"},
+			esperado:   []string{"E003;4J;0;CEMDCRBP44;V020", "NO_READ"},
+		},
+		{
+			nombre:     "byte a byte con segunda trama coalescida",
+			delimiter:  FrameDelimiterLF,
+			fragmentos: []string{"A", "B", "C\nD", "EF\nGH"},
+			esperado:   []string{"ABC", "DEF"},
+		},
+		{
+			nombre:     "solo CR como delimitador",
+			delimiter:  FrameDelimiterCR,
+			fragmentos: []string{"ABC\rDEF\r"},
+			esperado:   []string{"ABC", "DEF"},
+		},
+		{
+			nombre:     "ETX con STX opcional",
+			delimiter:  FrameDelimiterETX,
+			fragmentos: []string{"\x02ABC\x03\x02DE", "F\x03GHI\x03"},
+			esperado:   []string{"ABC", "DEF", "GHI"},
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			f, err := newCognexFramer(caso.delimiter, 0)
+			if err != nil {
+				t.Fatalf("newCognexFramer: %v", err)
+			}
+
+			tramas, excedidas := feedAll(t, f, caso.fragmentos...)
+			if !reflect.DeepEqual(tramas, caso.esperado) {
+				t.Errorf("tramas = %q, esperado %q", tramas, caso.esperado)
+			}
+			if excedidas != 0 {
+				t.Errorf("excedidas = %d, esperado 0", excedidas)
+			}
+		})
+	}
+}
+
+func TestCognexFramerMaxFrameLength(t *testing.T) {
+	f, err := newCognexFramer(FrameDelimiterCRLF, 8)
+	if err != nil {
+		t.Fatalf("newCognexFramer: %v", err)
+	}
+
+	// La trama larga llega partida: se descarta completa y la siguiente se procesa normal
+	tramas, excedidas := feedAll(t, f, "0123456", "789ABC", "DEF\r\nOK\r\n")
+	if !reflect.DeepEqual(tramas, []string{"OK"}) {
+		t.Errorf("tramas = %q, esperado [\"OK\"]", tramas)
+	}
+	if excedidas != 1 {
+		t.Errorf("excedidas = %d, esperado 1", excedidas)
+	}
+
+	// Trama larga completa en una sola lectura
+	tramas, excedidas = feedAll(t, f, "0123456789\r\nOK\r\n")
+	if !reflect.DeepEqual(tramas, []string{"OK"}) {
+		t.Errorf("tramas = %q, esperado [\"OK\"]", tramas)
+	}
+	if excedidas != 1 {
+		t.Errorf("excedidas = %d, esperado 1", excedidas)
+	}
+}
+
+func TestCognexFramerFlushPartial(t *testing.T) {
+	f, err := newCognexFramer(FrameDelimiterCRLF, 0)
+	if err != nil {
+		t.Fatalf("newCognexFramer: %v", err)
+	}
+
+	tramas, _ := feedAll(t, f, "ABC\r\nDE")
+	if !reflect.DeepEqual(tramas, []string{"ABC"}) {
+		t.Fatalf("tramas = %q, esperado [\"ABC\"]", tramas)
+	}
+	if !f.Pending() {
+		t.Fatal("Pending() = false, esperado trama incompleta")
+	}
+	if trama := f.Flush(); trama != "DE" {
+		t.Errorf("Flush() = %q, esperado \"DE\"", trama)
+	}
+	if f.Pending() {
+		t.Error("Pending() = true después de Flush")
+	}
+}
+
+func TestNewCognexFramerInvalidDelimiter(t *testing.T) {
+	if _, err := newCognexFramer("tab", 0); err == nil {
+		t.Error("esperado error para delimitador no soportado")
+	}
+}
+
+// startFramingConnection inicia handleConnection sobre net.Pipe y retorna el extremo de la cámara
+func startFramingConnection(t *testing.T, flushOnTimeout bool) (*CognexListener, net.Conn) {
+	t.Helper()
+	c := NewCognexListener(99, "127.0.0.1", 0, "DATAMATRIX", nil)
+	t.Cleanup(c.cancel)
+	if err := c.SetFraming(FrameDelimiterCRLF, 0, 50*time.Millisecond, flushOnTimeout); err != nil {
+		t.Fatalf("SetFraming: %v", err)
+	}
+
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go c.handleConnection(server)
+
+	// Leer los ACK de la cámara para no bloquear net.Pipe
+	go func() {
+		scanner := bufio.NewScanner(client)
+		for scanner.Scan() {
+		}
+	}()
+	return c, client
+}
+
+// expectCodes espera los códigos DataMatrix en orden y verifica que no llegue ninguno más
+func expectCodes(t *testing.T, c *CognexListener, esperado ...string) {
+	t.Helper()
+	for _, codigo := range esperado {
+		select {
+		case evento := <-c.DataMatrixChan:
+			if evento.Codigo != codigo {
+				t.Errorf("código = %q, esperado %q", evento.Codigo, codigo)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout esperando trama %q", codigo)
+		}
+	}
+	select {
+	case evento := <-c.DataMatrixChan:
+		t.Errorf("trama inesperada %q", evento.Codigo)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+// TestHandleConnectionFraming verifica que cada trama del stream llega individualmente
+// a processMessage, sin importar cómo se fragmenten las lecturas TCP
+func TestHandleConnectionFraming(t *testing.T) {
+	c, client := startFramingConnection(t, true)
+
+	escrituras := []string{
+		"AAA\r\nBB",    // una trama completa y el inicio de otra
+		"B\r\nCCC\r\n", // fin de la anterior y otra completa
+		"DDD",          // sin delimitador: se procesa por timeout de trama parcial (flush_on_timeout)
+	}
+	for _, escritura := range escrituras {
+		if _, err := client.Write([]byte(escritura)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	expectCodes(t, c, "AAA", "BBB", "CCC", "DDD")
+	if stats := c.GetStats(); stats.TramasIncompletas != 1 {
+		t.Errorf("TramasIncompletas = %d, esperado 1", stats.TramasIncompletas)
+	}
+}
+
+// TestHandleConnectionPartialTimeoutDiscards verifica que, sin flush_on_timeout, una etiqueta
+// cortada cuyo resto llega después de partial_timeout no se procesa como lectura
+func TestHandleConnectionPartialTimeoutDiscards(t *testing.T) {
+	c, client := startFramingConnection(t, false)
+
+	if _, err := client.Write([]byte("AAA\r\nE003;4J;0;CEMDCRBP44;V02")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectCodes(t, c, "AAA")
+
+	// El resto de la etiqueta llega tarde: se pierde la trama cortada, la siguiente llega normal
+	if _, err := client.Write([]byte("0\r\nBBB\r\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expectCodes(t, c, "0", "BBB")
+
+	stats := c.GetStats()
+	if stats.TramasIncompletas != 1 {
+		t.Errorf("TramasIncompletas = %d, esperado 1", stats.TramasIncompletas)
+	}
+	if stats.Mensajes != 3 {
+		t.Errorf("Mensajes = %d, esperado 3 (la trama cortada no se procesa)", stats.Mensajes)
+	}
+}
+
+// TestHandleConnectionRecibida verifica que la lectura lleva la llegada de la trama,
+// tomada antes de procesarla (base del plazo de desvío en el sorter)
+func TestHandleConnectionRecibida(t *testing.T) {
+	c := NewCognexListener(98, "127.0.0.1", 0, "QR", nil)
+	defer c.cancel()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go c.handleConnection(server)
+	go func() {
+		scanner := bufio.NewScanner(client)
+		for scanner.Scan() {
+		}
+	}()
+
+	antes := time.Now()
+	if _, err := client.Write([]byte("NO_READ\r\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	select {
+	case evento := <-c.EventChan:
+		if evento.Recibida.Before(antes) || evento.Recibida.After(evento.Timestamp) {
+			t.Errorf("Recibida = %v, esperado entre %v y Timestamp %v", evento.Recibida, antes, evento.Timestamp)
+		}
+		if !evento.InstanteLectura().Equal(evento.Recibida) {
+			t.Errorf("InstanteLectura = %v, esperado Recibida", evento.InstanteLectura())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout esperando la lectura NO_READ")
+	}
+}
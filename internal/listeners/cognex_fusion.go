@@ -0,0 +1,226 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Ventana de fusión por defecto entre las lecturas de las cámaras de un mismo lector
+const defaultFusionWindow = 150 * time.Millisecond
+
+// readFusion agrupa varias cámaras QR (ej: superior y lateral) como un solo lector lógico.
+// Cada caja abre una ventana: la primera lectura exitosa gana (solo ella crea correlativo y evento)
+// y el fallo se emite únicamente si ninguna cámara leyó la caja dentro de la ventana.
+type readFusion struct {
+	window    time.Duration
+	principal *CognexListener
+	camaras   []*CognexListener // Incluye la principal
+
+	mu      sync.Mutex
+	ventana *fusionWindow
+	stats   models.ReadFusionStats
+}
+
+// fusionWindow es el estado de la caja en curso
+type fusionWindow struct {
+	ganadora    int                 // ID de la cámara con lectura exitosa (0 = ninguna aún)
+	reportadas  map[int]bool        // Cámaras que ya entregaron su lectura para esta caja
+	primerFallo models.LecturaEvent // Fallo que se emite si ninguna cámara lee la caja
+	fallos      int
+	timer       *time.Timer
+}
+
+// FuseWith agrupa las cámaras con este listener (la principal) en un lector lógico.
+// Todas entregan sus eventos por la cola (y el EventChan) de la principal, y Start de la principal
+// inicia también las demás. Debe llamarse antes de Start.
+func (c *CognexListener) FuseWith(window time.Duration, camaras ...*CognexListener) error {
+	if window <= 0 {
+		window = defaultFusionWindow
+	}
+
+	grupo := append([]*CognexListener{c}, camaras...)
+	vistas := make(map[int]bool, len(grupo))
+	for _, cam := range grupo {
+		if cam.scan_method != "QR" {
+			return fmt.Errorf("la cámara #%d no es QR (scan_method=%s)", cam.id, cam.scan_method)
+		}
+		if cam.fusion != nil {
+			return fmt.Errorf("la cámara #%d ya pertenece a otro lector", cam.id)
+		}
+		if vistas[cam.id] {
+			return fmt.Errorf("cámara #%d repetida en el lector", cam.id)
+		}
+		vistas[cam.id] = true
+	}
+
+	f := &readFusion{
+		window:    window,
+		principal: c,
+		camaras:   grupo,
+		stats: models.ReadFusionStats{
+			VentanaMs:        int(window / time.Millisecond),
+			GanadasPorCamara: make(map[int]int64, len(grupo)),
+		},
+	}
+	for _, cam := range grupo {
+		f.stats.Camaras = append(f.stats.Camaras, cam.id)
+		cam.fusion = f
+		cam.eventos = c.eventos
+		cam.EventChan = c.EventChan
+	}
+	return nil
+}
+
+// FusedCameras retorna las cámaras del lector lógico, la principal primero ([c] si no está agrupada)
+func (c *CognexListener) FusedCameras() []*CognexListener {
+	if c.fusion == nil {
+		return []*CognexListener{c}
+	}
+	return append([]*CognexListener(nil), c.fusion.camaras...)
+}
+
+// IsFusedSecondary indica si la cámara es secundaria de un lector multi-cámara (entrega por la principal)
+func (c *CognexListener) IsFusedSecondary() bool {
+	return c.fusion != nil && c.fusion.principal != c
+}
+
+// fusionStats retorna una copia de las estadísticas de fusión (nil si la cámara no está agrupada)
+func (c *CognexListener) fusionStats() *models.ReadFusionStats {
+	if c.fusion == nil {
+		return nil
+	}
+	f := c.fusion
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := f.stats
+	stats.Camaras = append([]int(nil), f.stats.Camaras...)
+	stats.GanadasPorCamara = make(map[int]int64, len(f.stats.GanadasPorCamara))
+	for id, n := range f.stats.GanadasPorCamara {
+		stats.GanadasPorCamara[id] = n
+	}
+	return &stats
+}
+
+// emitirFallo entrega una lectura fallida: directo al sorter, o a la fusión si la cámara está agrupada
+func (c *CognexListener) emitirFallo(evento models.LecturaEvent) {
+	if c.fusion != nil {
+		c.fusion.fallo(c.id, evento)
+		return
+	}
+	c.emitir(evento)
+}
+
+// ganar registra una lectura exitosa de la cámara. Retorna false si otra cámara ya leyó la caja.
+func (f *readFusion) ganar(camaraID int) bool {
+	f.mu.Lock()
+	pendiente := f.abrirVentana(camaraID)
+	w := f.ventana
+	w.reportadas[camaraID] = true
+
+	gana := w.ganadora == 0
+	if gana {
+		w.ganadora = camaraID
+		f.stats.GanadasPorCamara[camaraID]++
+	} else {
+		f.stats.LecturasDescartadas++
+	}
+	f.cerrarSiCompleta(w)
+	f.mu.Unlock()
+
+	f.emitirNoRead(pendiente)
+	return gana
+}
+
+// fallo registra una lectura fallida. El fallo se emite solo cuando todas las cámaras fallaron
+// o cuando la ventana expira sin lectura exitosa.
+func (f *readFusion) fallo(camaraID int, evento models.LecturaEvent) {
+	f.mu.Lock()
+	pendiente := f.abrirVentana(camaraID)
+	w := f.ventana
+	w.reportadas[camaraID] = true
+
+	if w.ganadora != 0 {
+		f.stats.FallosAbsorbidos++
+		f.cerrarSiCompleta(w)
+		f.mu.Unlock()
+		f.emitirNoRead(pendiente)
+		return
+	}
+
+	if w.fallos == 0 {
+		w.primerFallo = evento
+	}
+	w.fallos++
+	var noRead *models.LecturaEvent
+	if len(w.reportadas) == len(f.camaras) {
+		noRead = f.cerrar(w)
+	}
+	f.mu.Unlock()
+
+	f.emitirNoRead(pendiente)
+	f.emitirNoRead(noRead)
+}
+
+// abrirVentana asegura una ventana abierta para la lectura de la cámara. Si la cámara ya había
+// entregado lectura en la ventana actual, se trata de la caja siguiente: la ventana anterior se
+// cierra y retorna su NO_READ pendiente (si lo hay) para emitirlo fuera del lock. Requiere f.mu.
+func (f *readFusion) abrirVentana(camaraID int) *models.LecturaEvent {
+	var pendiente *models.LecturaEvent
+	if f.ventana != nil && f.ventana.reportadas[camaraID] {
+		pendiente = f.cerrar(f.ventana)
+	}
+
+	if f.ventana == nil {
+		w := &fusionWindow{reportadas: make(map[int]bool, len(f.camaras))}
+		w.timer = time.AfterFunc(f.window, func() { f.expirar(w) })
+		f.ventana = w
+	}
+	return pendiente
+}
+
+// cerrarSiCompleta cierra la ventana con lectura exitosa cuando todas las cámaras ya reportaron. Requiere f.mu.
+func (f *readFusion) cerrarSiCompleta(w *fusionWindow) {
+	if len(w.reportadas) == len(f.camaras) {
+		f.cerrar(w)
+	}
+}
+
+// cerrar termina la ventana y retorna el fallo a emitir si ninguna cámara leyó la caja. Requiere f.mu.
+func (f *readFusion) cerrar(w *fusionWindow) *models.LecturaEvent {
+	if f.ventana != w {
+		return nil
+	}
+	w.timer.Stop()
+	f.ventana = nil
+	f.stats.Cajas++
+
+	if w.ganadora != 0 || w.fallos == 0 {
+		return nil
+	}
+	f.stats.NoReads++
+	evento := w.primerFallo
+	return &evento
+}
+
+// expirar cierra la ventana cuando se cumple el tiempo de fusión
+func (f *readFusion) expirar(w *fusionWindow) {
+	f.mu.Lock()
+	noRead := f.cerrar(w)
+	f.mu.Unlock()
+
+	f.emitirNoRead(noRead)
+}
+
+// emitirNoRead envía al sorter el fallo de una caja que ninguna cámara leyó (llamar sin f.mu)
+func (f *readFusion) emitirNoRead(evento *models.LecturaEvent) {
+	if evento == nil {
+		return
+	}
+	log.Printf("❌ [Lector Cognex#%d] Ninguna de las %d cámara(s) leyó la caja: %v",
+		f.principal.id, len(f.camaras), evento.Error)
+	f.principal.emitir(*evento)
+}
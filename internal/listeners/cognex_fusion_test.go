@@ -0,0 +1,140 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newFusionGroup crea un lector lógico con n cámaras QR; la primera es la principal
+func newFusionGroup(t *testing.T, window time.Duration, n int) []*CognexListener {
+	t.Helper()
+	camaras := make([]*CognexListener, n)
+	for i := range camaras {
+		camaras[i] = NewCognexListener(80+i, "127.0.0.1", 0, "QR", nil)
+		t.Cleanup(camaras[i].cancel)
+	}
+	if err := camaras[0].FuseWith(window, camaras[1:]...); err != nil {
+		t.Fatalf("FuseWith: %v", err)
+	}
+	return camaras
+}
+
+// sinEventos verifica que el lector no entregó eventos al sorter durante espera
+func sinEventos(t *testing.T, c *CognexListener, espera time.Duration) {
+	t.Helper()
+	select {
+	case evento := <-c.EventChan:
+		t.Fatalf("evento inesperado: %+v", evento)
+	case <-time.After(espera):
+	}
+}
+
+func TestFusionPrimeraLecturaGana(t *testing.T) {
+	camaras := newFusionGroup(t, time.Minute, 3)
+	f := camaras[0].fusion
+
+	if !f.ganar(camaras[1].id) {
+		t.Fatal("la primera lectura exitosa debe ganar")
+	}
+	if f.ganar(camaras[0].id) {
+		t.Error("una lectura posterior dentro de la ventana no debe ganar")
+	}
+	camaras[2].emitirFallo(models.LecturaEvent{Exitoso: false, Error: errors.New("NO_READ")})
+
+	// Las tres cámaras reportaron: la ventana se cierra sin emitir NO_READ
+	sinEventos(t, camaras[0], 50*time.Millisecond)
+	stats := camaras[0].fusionStats()
+	if stats.Cajas != 1 || stats.GanadasPorCamara[camaras[1].id] != 1 || stats.LecturasDescartadas != 1 ||
+		stats.FallosAbsorbidos != 1 || stats.NoReads != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// La siguiente caja abre una ventana nueva
+	if !f.ganar(camaras[0].id) {
+		t.Error("la primera lectura de la caja siguiente debe ganar")
+	}
+}
+
+func TestFusionNoRead(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		window   time.Duration
+		lecturas func(camaras []*CognexListener)
+		noRead   bool
+	}{
+		{
+			nombre: "todas las cámaras fallan",
+			window: time.Minute,
+			lecturas: func(camaras []*CognexListener) {
+				camaras[0].emitirFallo(models.LecturaEvent{Error: errors.New("NO_READ superior")})
+				camaras[1].emitirFallo(models.LecturaEvent{Error: errors.New("NO_READ lateral")})
+			},
+			noRead: true,
+		},
+		{
+			nombre: "ventana expira tras un fallo",
+			window: 20 * time.Millisecond,
+			lecturas: func(camaras []*CognexListener) {
+				camaras[0].emitirFallo(models.LecturaEvent{Error: errors.New("NO_READ superior")})
+			},
+			noRead: true,
+		},
+		{
+			nombre: "otra cámara lee dentro de la ventana",
+			window: 20 * time.Millisecond,
+			lecturas: func(camaras []*CognexListener) {
+				camaras[0].emitirFallo(models.LecturaEvent{Error: errors.New("NO_READ superior")})
+				camaras[0].fusion.ganar(camaras[1].id)
+			},
+			noRead: false,
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			camaras := newFusionGroup(t, c.window, 2)
+			c.lecturas(camaras)
+
+			if !c.noRead {
+				sinEventos(t, camaras[0], c.window+50*time.Millisecond)
+				if stats := camaras[0].fusionStats(); stats.NoReads != 0 {
+					t.Fatalf("stats = %+v", stats)
+				}
+				return
+			}
+
+			select {
+			case evento := <-camaras[0].EventChan:
+				// Se emite el primer fallo de la caja, una sola vez
+				if evento.Exitoso || evento.Error == nil || evento.Error.Error() != "NO_READ superior" {
+					t.Fatalf("evento = %+v", evento)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no se emitió NO_READ")
+			}
+			sinEventos(t, camaras[0], 100*time.Millisecond)
+			if stats := camaras[0].fusionStats(); stats.NoReads != 1 || stats.Cajas != 1 {
+				t.Fatalf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestFusedCameras(t *testing.T) {
+	camaras := newFusionGroup(t, time.Minute, 3)
+
+	grupo := camaras[2].FusedCameras()
+	if len(grupo) != 3 || grupo[0] != camaras[0] {
+		t.Fatalf("FusedCameras = %v, la principal debe ir primero", grupo)
+	}
+	if camaras[0].IsFusedSecondary() || !camaras[1].IsFusedSecondary() || !camaras[2].IsFusedSecondary() {
+		t.Error("solo las cámaras no principales son secundarias")
+	}
+
+	sola := NewCognexListener(90, "127.0.0.1", 0, "QR", nil)
+	t.Cleanup(sola.cancel)
+	if g := sola.FusedCameras(); len(g) != 1 || g[0] != sola || sola.IsFusedSecondary() {
+		t.Errorf("cámara sin agrupar: FusedCameras = %v", g)
+	}
+}
@@ -0,0 +1,201 @@
+package listeners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"API-GREENEX/internal/models"
+)
+
+// ReadQualityStore es la interfaz de consulta de la calidad de lectura persistida (evita import cycle con db)
+type ReadQualityStore interface {
+	GetReadQualityHistory(ctx context.Context, cognexID int, desde, hasta time.Time, intervalo string) ([]models.ReadQualityBucket, error)
+}
+
+// setupCognexRoutes registra los endpoints de estadísticas de cámaras Cognex
+func (h *HTTPFrontend) setupCognexRoutes() {
+	// Endpoint GET /cognex/stats
+	// Estadísticas de todas las cámaras (mensajes recibidos, duplicados suprimidos)
+	h.router.GET("/cognex/stats", func(c *gin.Context) {
+		stats := make([]models.CognexStats, 0, len(h.cognexDevices))
+		for _, cognex := range h.cognexDevices {
+			stats = append(stats, cognex.GetStats())
+		}
+		sort.Slice(stats, func(i, j int) bool { return stats[i].CognexID < stats[j].CognexID })
+
+		Success(c, stats, fmt.Sprintf("%d cámara(s) Cognex", len(stats)))
+	})
+
+	// Endpoint GET /cognex/queues
+	// Cola de eventos de cada cámara hacia el sorter (profundidad, espera, descartes)
+	h.router.GET("/cognex/queues", func(c *gin.Context) {
+		colas := make([]gin.H, 0, len(h.cognexDevices))
+		for _, cognex := range h.cognexDevices {
+			colas = append(colas, gin.H{
+				"cognex_id":   cognex.GetID(),
+				"dispositivo": cognex.dispositivo,
+				"scan_method": cognex.scan_method,
+				"cola":        cognex.queueStats(),
+			})
+		}
+		sort.Slice(colas, func(i, j int) bool { return colas[i]["cognex_id"].(int) < colas[j]["cognex_id"].(int) })
+
+		Success(c, colas, fmt.Sprintf("%d cola(s) de eventos Cognex", len(colas)))
+	})
+
+	// Endpoint GET /cognex/quality
+	// Calidad de lectura de las cámaras con read_trailer (grados, simbologías, tiempo de decodificación)
+	h.router.GET("/cognex/quality", func(c *gin.Context) {
+		calidad := make([]gin.H, 0, len(h.cognexDevices))
+		degradadas := 0
+		for _, cognex := range h.cognexDevices {
+			stats := cognex.qualityStats()
+			if stats == nil {
+				continue
+			}
+			if stats.Degradada {
+				degradadas++
+			}
+			calidad = append(calidad, gin.H{
+				"cognex_id":   cognex.GetID(),
+				"dispositivo": cognex.dispositivo,
+				"scan_method": cognex.scan_method,
+				"calidad":     stats,
+			})
+		}
+		sort.Slice(calidad, func(i, j int) bool { return calidad[i]["cognex_id"].(int) < calidad[j]["cognex_id"].(int) })
+
+		Success(c, calidad, fmt.Sprintf("%d cámara(s) con datos de calidad, %d degradada(s)", len(calidad), degradadas))
+	})
+
+	// Endpoint GET /cognex/:cognex_id/quality/history?desde=...&hasta=...&intervalo=hour|day
+	// Calidad de lectura persistida con las cajas, agrupada por hora (default) o día. Default: últimas 24 horas
+	h.router.GET("/cognex/:cognex_id/quality/history", func(c *gin.Context) {
+		cognex, ok := h.cognexFromParam(c)
+		if !ok {
+			return
+		}
+
+		var err error
+		hasta := time.Now()
+		if v := c.Query("hasta"); v != "" {
+			if hasta, err = time.Parse(time.RFC3339, v); err != nil {
+				BadRequest(c, "hasta debe tener formato RFC3339", gin.H{"hasta": v})
+				return
+			}
+		}
+		desde := hasta.Add(-24 * time.Hour)
+		if v := c.Query("desde"); v != "" {
+			if desde, err = time.Parse(time.RFC3339, v); err != nil {
+				BadRequest(c, "desde debe tener formato RFC3339", gin.H{"desde": v})
+				return
+			}
+		}
+		if !desde.Before(hasta) {
+			BadRequest(c, "desde debe ser anterior a hasta", gin.H{"desde": desde, "hasta": hasta})
+			return
+		}
+
+		intervalo := c.DefaultQuery("intervalo", "hour")
+		if intervalo != "hour" && intervalo != "day" {
+			BadRequest(c, "intervalo debe ser 'hour' o 'day'", gin.H{"intervalo": intervalo})
+			return
+		}
+
+		store, ok := h.postgresMgr.(ReadQualityStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", gin.H{"cognex_id": cognex.GetID()})
+			return
+		}
+
+		buckets, err := store.GetReadQualityHistory(c.Request.Context(), cognex.GetID(), desde, hasta, intervalo)
+		if err != nil {
+			InternalServerError(c, "Error al consultar calidad de lectura", gin.H{"error": err.Error()})
+			return
+		}
+
+		Success(c, buckets, fmt.Sprintf("Cognex #%d: %d intervalo(s) entre %s y %s", cognex.GetID(), len(buckets),
+			desde.Format(time.RFC3339), hasta.Format(time.RFC3339)))
+	})
+
+	// Endpoint GET /cognex/:cognex_id/stats
+	h.router.GET("/cognex/:cognex_id/stats", func(c *gin.Context) {
+		cognex, ok := h.cognexFromParam(c)
+		if !ok {
+			return
+		}
+
+		Success(c, cognex.GetStats(), fmt.Sprintf("Estadísticas de Cognex #%d", cognex.GetID()))
+	})
+
+	// Endpoint GET /cognex/:cognex_id/connections
+	// Conexiones activas, rechazadas (allowed_sources / max_connections) y reemplazadas del puerto
+	h.router.GET("/cognex/:cognex_id/connections", func(c *gin.Context) {
+		cognex, ok := h.cognexFromParam(c)
+		if !ok {
+			return
+		}
+
+		conexiones := cognex.GetConnections()
+		Success(c, conexiones, fmt.Sprintf("Cognex #%d: %d conexión(es) activa(s), %d rechazada(s)",
+			cognex.GetID(), len(conexiones.Activas), conexiones.Rechazadas))
+	})
+
+	// Endpoint POST /cognex/:cognex_id/commands
+	// Comando Native Mode a la cámara. Body: models.CognexCommand
+	// (online, offline, trigger, load_job con "job", status)
+	h.router.POST("/cognex/:cognex_id/commands", func(c *gin.Context) {
+		cognex, ok := h.cognexFromParam(c)
+		if !ok {
+			return
+		}
+
+		var cmd models.CognexCommand
+		if err := c.ShouldBindJSON(&cmd); err != nil {
+			BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+			return
+		}
+		if err := ValidateCognexCommand(cmd); err != nil {
+			BadRequest(c, err.Error(), gin.H{"command": cmd.Command})
+			return
+		}
+
+		result, err := cognex.ExecuteCommand(cmd)
+		if errors.Is(err, ErrCognexSinControl) {
+			UnprocessableEntity(c, err.Error(), gin.H{"cognex_id": cognex.GetID()})
+			return
+		}
+		if err != nil {
+			RespondWithError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavail,
+				"Error al ejecutar el comando en la cámara", gin.H{"cognex_id": cognex.GetID(), "command": cmd.Command, "error": err.Error()},
+				"Verifique que la cámara esté encendida y que el usuario tenga acceso Native Mode")
+			return
+		}
+
+		Success(c, result, fmt.Sprintf("Comando '%s' ejecutado en Cognex #%d", cmd.Command, cognex.GetID()))
+	})
+}
+
+// cognexFromParam parsea :cognex_id y busca la cámara registrada
+func (h *HTTPFrontend) cognexFromParam(c *gin.Context) (*CognexListener, bool) {
+	cognexIDStr := c.Param("cognex_id")
+	cognexID, err := strconv.Atoi(cognexIDStr)
+	if err != nil {
+		BadRequest(c, "cognex_id debe ser un número entero válido", gin.H{"cognex_id": cognexIDStr})
+		return nil, false
+	}
+
+	cognex, exists := h.cognexDevices[cognexID]
+	if !exists {
+		NotFound(c, "Cámara Cognex no encontrada", gin.H{"cognex_id": cognexID})
+		return nil, false
+	}
+	return cognex, true
+}
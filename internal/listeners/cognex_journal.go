@@ -0,0 +1,86 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/journal"
+	"context"
+	"log"
+	"time"
+)
+
+// Tiempo máximo para confirmar que PostgreSQL no responde antes de registrar la caja localmente
+const journalPingTimeout = 2 * time.Second
+
+// Tiempo máximo de la inserción de una caja: un PostgreSQL colgado no debe detener el worker de inserción
+const insertTimeout = 3 * time.Second
+
+// SetJournal habilita el registro local de cajas: si PostgreSQL no está disponible la caja recibe
+// un correlativo provisional y se sigue desviando. Debe llamarse antes de Start.
+func (c *CognexListener) SetJournal(j *journal.BoxJournal) {
+	c.journal = j
+}
+
+// insertarCaja inserta la caja en la BD y resuelve el nombre de variedad para el SKU.
+// Si la BD no responde y hay registro local, la caja queda registrada con correlativo provisional.
+func (c *CognexListener) insertarCaja(req insertRequest) insertResult {
+	ctx, cancel := context.WithTimeout(context.Background(), insertTimeout)
+	defer cancel()
+	correlativo, err := c.dbManager.InsertNewBox(
+		ctx,
+		req.especie,
+		req.variedad,
+		req.calibre,
+		req.embalaje,
+		req.dark,
+		req.linea,
+		c.id,
+		req.calidad,
+	)
+	if err != nil {
+		if provisional, ok := c.registrarSinBD(req, err); ok {
+			return insertResult{
+				correlativo:    provisional,
+				nombreVariedad: c.dbManager.CachedNombreVariedad(req.variedad),
+			}
+		}
+		return insertResult{err: err}
+	}
+
+	// Obtener nombre de variedad para construir SKU correctamente (si no se encuentra, el último leído o el código)
+	nombreVariedad := c.dbManager.CachedNombreVariedad(req.variedad)
+	if nombreVar, errNombre := c.dbManager.GetNombreVariedad(ctx, req.variedad); errNombre == nil && nombreVar != "" {
+		nombreVariedad = nombreVar
+	}
+
+	return insertResult{correlativo: correlativo, nombreVariedad: nombreVariedad}
+}
+
+// registrarSinBD guarda la caja en el registro local cuando el error se debe a que PostgreSQL no responde.
+// Con la BD disponible el error es de la caja (ej: SKU inválida) y se informa como lectura fallida.
+func (c *CognexListener) registrarSinBD(req insertRequest, errInsert error) (string, bool) {
+	if c.journal == nil {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), journalPingTimeout)
+	defer cancel()
+	if c.dbManager.Ping(ctx) == nil {
+		return "", false
+	}
+
+	correlativo, err := c.journal.RecordBox(journal.BoxRecord{
+		CognexID: c.id,
+		Especie:  req.especie,
+		Variedad: req.variedad,
+		Calibre:  req.calibre,
+		Embalaje: req.embalaje,
+		Dark:     req.dark,
+		Linea:    req.linea,
+		Calidad:  req.calidad,
+	})
+	if err != nil {
+		log.Printf("❌ [Cognex#%d] PostgreSQL no disponible (%v) y no se pudo usar el registro local: %v", c.id, errInsert, err)
+		return "", false
+	}
+	log.Printf("⚠️  [Cognex#%d] PostgreSQL no disponible (%v): caja %s registrada localmente", c.id, errInsert, correlativo)
+	return correlativo, true
+}
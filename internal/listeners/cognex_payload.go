@@ -0,0 +1,215 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/config"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Errores de lectura QR (el texto es el que usa LecturaEvent.GetTipo para clasificar el fallo)
+var (
+	errPayloadFormato = errors.New("formato inválido")
+	errPayloadVacio   = errors.New("componentes vacíos")
+)
+
+// Campos obligatorios en toda plantilla: se usan para el SKU y para insertar la caja
+var payloadCamposSKU = []string{config.PayloadEspecie, config.PayloadCalibre, config.PayloadEmbalaje, config.PayloadVariedad}
+
+// QRPayload son los datos extraídos del QR de una etiqueta
+type QRPayload struct {
+	Especie  string
+	Calibre  string
+	Dark     int
+	Embalaje string
+	Variedad string
+	Marca    string
+}
+
+// payloadParser extrae los campos del QR según la plantilla del dispositivo
+type payloadParser struct {
+	tpl       config.PayloadTemplate
+	regex     *regexp.Regexp
+	minPartes int // Partes mínimas para contener todos los campos obligatorios (modo posiciones)
+}
+
+// newPayloadParser valida la plantilla y construye el parser
+func newPayloadParser(tpl config.PayloadTemplate) (*payloadParser, error) {
+	conocidos := map[string]bool{
+		config.PayloadEspecie:  true,
+		config.PayloadCalibre:  true,
+		config.PayloadDark:     true,
+		config.PayloadEmbalaje: true,
+		config.PayloadVariedad: true,
+		config.PayloadMarca:    true,
+	}
+
+	p := &payloadParser{tpl: tpl}
+	mapeados := make(map[string]bool)
+
+	switch {
+	case tpl.Regex != "" && len(tpl.Fields) > 0:
+		return nil, fmt.Errorf("usar 'fields' o 'regex', no ambos")
+
+	case tpl.Regex != "":
+		re, err := regexp.Compile(tpl.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("regex inválida: %w", err)
+		}
+		for _, nombre := range re.SubexpNames() {
+			if nombre == "" {
+				continue
+			}
+			if !conocidos[nombre] {
+				return nil, fmt.Errorf("grupo '%s' de la regex no es un campo conocido", nombre)
+			}
+			mapeados[nombre] = true
+		}
+		p.regex = re
+
+	case len(tpl.Fields) > 0:
+		if tpl.Delimiter == "" {
+			return nil, fmt.Errorf("delimitador vacío")
+		}
+		posiciones := make(map[int]string)
+		for nombre, pos := range tpl.Fields {
+			if !conocidos[nombre] {
+				return nil, fmt.Errorf("campo '%s' no es un campo conocido", nombre)
+			}
+			if pos < 0 {
+				return nil, fmt.Errorf("campo '%s': posición %d inválida", nombre, pos)
+			}
+			if otro, exists := posiciones[pos]; exists {
+				return nil, fmt.Errorf("campos '%s' y '%s' en la misma posición %d", otro, nombre, pos)
+			}
+			posiciones[pos] = nombre
+			mapeados[nombre] = true
+		}
+
+	default:
+		return nil, fmt.Errorf("la plantilla necesita 'fields' o 'regex'")
+	}
+
+	for _, nombre := range payloadCamposSKU {
+		if !mapeados[nombre] {
+			return nil, fmt.Errorf("falta el campo '%s'", nombre)
+		}
+	}
+	for _, nombre := range tpl.Required {
+		if !mapeados[nombre] {
+			return nil, fmt.Errorf("campo obligatorio '%s' no está en la plantilla", nombre)
+		}
+		if pos, ok := tpl.Fields[nombre]; ok && pos+1 > p.minPartes {
+			p.minPartes = pos + 1
+		}
+	}
+
+	if tpl.DarkDefault != 0 && tpl.DarkDefault != 1 {
+		return nil, fmt.Errorf("dark_default debe ser 0 o 1")
+	}
+	for nombre, norm := range tpl.Normalize {
+		if !mapeados[nombre] {
+			return nil, fmt.Errorf("normalize: campo '%s' no está en la plantilla", nombre)
+		}
+		if norm.Case != "" && norm.Case != "upper" && norm.Case != "lower" {
+			return nil, fmt.Errorf("normalize '%s': case '%s' no soportado (upper, lower)", nombre, norm.Case)
+		}
+	}
+
+	return p, nil
+}
+
+// Parse extrae y normaliza los campos del mensaje.
+// Retorna errPayloadFormato o errPayloadVacio (con el detalle para el log) si el mensaje no cumple la plantilla.
+func (p *payloadParser) Parse(message string) (QRPayload, string, error) {
+	valores := make(map[string]string)
+
+	if p.regex != nil {
+		match := p.regex.FindStringSubmatch(message)
+		if match == nil {
+			return QRPayload{}, "no coincide con la regex de la plantilla", errPayloadFormato
+		}
+		for i, nombre := range p.regex.SubexpNames() {
+			if nombre != "" {
+				valores[nombre] = match[i]
+			}
+		}
+	} else {
+		partes := strings.Split(message, p.tpl.Delimiter)
+		if len(partes) < p.minPartes {
+			return QRPayload{}, fmt.Sprintf("tiene %d partes, necesita %d", len(partes), p.minPartes), errPayloadFormato
+		}
+		for nombre, pos := range p.tpl.Fields {
+			if pos < len(partes) {
+				valores[nombre] = partes[pos]
+			}
+		}
+	}
+
+	for nombre, valor := range valores {
+		valores[nombre] = p.normalizar(nombre, valor)
+	}
+
+	for _, nombre := range p.tpl.Required {
+		if valores[nombre] == "" {
+			return QRPayload{}, fmt.Sprintf("campo '%s' vacío", nombre), errPayloadVacio
+		}
+	}
+
+	payload := QRPayload{
+		Especie:  valores[config.PayloadEspecie],
+		Calibre:  valores[config.PayloadCalibre],
+		Embalaje: valores[config.PayloadEmbalaje],
+		Variedad: valores[config.PayloadVariedad],
+		Marca:    valores[config.PayloadMarca],
+		Dark:     p.tpl.DarkDefault,
+	}
+
+	switch darkStr := valores[config.PayloadDark]; darkStr {
+	case "":
+	case "0":
+		payload.Dark = 0
+	case "1":
+		payload.Dark = 1
+	default:
+		log.Printf("⚠️  Valor dark inválido '%s', usando %d por defecto", darkStr, p.tpl.DarkDefault)
+	}
+
+	return payload, "", nil
+}
+
+// normalizar aplica la normalización configurada al valor de un campo
+func (p *payloadParser) normalizar(nombre, valor string) string {
+	valor = strings.TrimSpace(valor)
+
+	norm, ok := p.tpl.Normalize[nombre]
+	if !ok {
+		return valor
+	}
+	if norm.Trim != "" {
+		valor = strings.Trim(valor, norm.Trim)
+	}
+	switch norm.Case {
+	case "upper":
+		valor = strings.ToUpper(valor)
+	case "lower":
+		valor = strings.ToLower(valor)
+	}
+	if reemplazo, exists := norm.Map[valor]; exists {
+		valor = reemplazo
+	}
+	return valor
+}
+
+// SetPayloadTemplate valida la plantilla de QR del dispositivo y la usa para parsear las lecturas.
+// Debe llamarse antes de Start.
+func (c *CognexListener) SetPayloadTemplate(tpl config.PayloadTemplate) error {
+	parser, err := newPayloadParser(tpl)
+	if err != nil {
+		return fmt.Errorf("plantilla de QR inválida: %w", err)
+	}
+	c.payload = parser
+	return nil
+}
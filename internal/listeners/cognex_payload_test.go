@@ -0,0 +1,163 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/config"
+	"errors"
+	"testing"
+)
+
+func TestNewPayloadParserInvalida(t *testing.T) {
+	campos := func(extra map[string]int) map[string]int {
+		fields := map[string]int{"especie": 0, "calibre": 1, "embalaje": 2, "variedad": 3}
+		for nombre, pos := range extra {
+			fields[nombre] = pos
+		}
+		return fields
+	}
+
+	casos := []struct {
+		nombre string
+		tpl    config.PayloadTemplate
+	}{
+		{"sin fields ni regex", config.PayloadTemplate{Delimiter: ";"}},
+		{"fields y regex", config.PayloadTemplate{Delimiter: ";", Fields: campos(nil), Regex: "(?P<especie>.*)"}},
+		{"regex que no compila", config.PayloadTemplate{Regex: "(?P<especie>[a-z"}},
+		{"grupo desconocido", config.PayloadTemplate{Regex: "(?P<especie>.)(?P<calibre>.)(?P<embalaje>.)(?P<variedad>.)(?P<lote>.)"}},
+		{"regex sin campos del SKU", config.PayloadTemplate{Regex: "(?P<especie>.)(?P<calibre>.)"}},
+		{"delimitador vacío", config.PayloadTemplate{Fields: campos(nil)}},
+		{"campo desconocido", config.PayloadTemplate{Delimiter: ";", Fields: campos(map[string]int{"lote": 4})}},
+		{"posición negativa", config.PayloadTemplate{Delimiter: ";", Fields: campos(map[string]int{"marca": -1})}},
+		{"posición repetida", config.PayloadTemplate{Delimiter: ";", Fields: campos(map[string]int{"marca": 3})}},
+		{"falta campo del SKU", config.PayloadTemplate{Delimiter: ";", Fields: map[string]int{"especie": 0, "calibre": 1, "embalaje": 2}}},
+		{"obligatorio fuera de la plantilla", config.PayloadTemplate{Delimiter: ";", Fields: campos(nil), Required: []string{"marca"}}},
+		{"dark_default inválido", config.PayloadTemplate{Delimiter: ";", Fields: campos(nil), DarkDefault: 2}},
+		{"normalize de campo ausente", config.PayloadTemplate{Delimiter: ";", Fields: campos(nil),
+			Normalize: map[string]config.FieldNormalization{"marca": {Case: "upper"}}}},
+		{"normalize con case desconocido", config.PayloadTemplate{Delimiter: ";", Fields: campos(nil),
+			Normalize: map[string]config.FieldNormalization{"calibre": {Case: "title"}}}},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if p, err := newPayloadParser(caso.tpl); err == nil {
+				t.Errorf("plantilla aceptada: %+v", p.tpl)
+			}
+		})
+	}
+}
+
+func TestPayloadParserParse(t *testing.T) {
+	porDefecto := config.DefaultPayloadTemplate()
+	conMarca := config.DefaultPayloadTemplate()
+	conMarca.Fields[config.PayloadMarca] = 5
+	conMarca.DarkDefault = 1
+	regex := config.PayloadTemplate{
+		Regex:    `^(?P<especie>[A-Z]\d{3})-(?P<calibre>\w+)/(?P<embalaje>\w+)/(?P<variedad>\w+)$`,
+		Required: []string{config.PayloadEspecie, config.PayloadCalibre, config.PayloadEmbalaje, config.PayloadVariedad},
+	}
+	normalizada := config.DefaultPayloadTemplate()
+	normalizada.Normalize = map[string]config.FieldNormalization{
+		config.PayloadCalibre:  {Case: "upper", Map: map[string]string{"XLD": "XL"}},
+		config.PayloadVariedad: {Trim: "0", Case: "upper"},
+	}
+
+	casos := []struct {
+		nombre  string
+		tpl     config.PayloadTemplate
+		mensaje string
+		payload QRPayload
+		err     error
+	}{
+		{
+			nombre:  "formato histórico",
+			tpl:     porDefecto,
+			mensaje: "E003;4J;1;CEMDCRBP44;V020",
+			payload: QRPayload{Especie: "E003", Calibre: "4J", Dark: 1, Embalaje: "CEMDCRBP44", Variedad: "V020"},
+		},
+		{
+			nombre:  "espacios y partes extra",
+			tpl:     porDefecto,
+			mensaje: " E003 ;4J;0; CEMDCRBP44;V020;sobra",
+			payload: QRPayload{Especie: "E003", Calibre: "4J", Embalaje: "CEMDCRBP44", Variedad: "V020"},
+		},
+		{
+			nombre:  "faltan partes",
+			tpl:     porDefecto,
+			mensaje: "E003;4J;0;CEMDCRBP44",
+			err:     errPayloadFormato,
+		},
+		{
+			nombre:  "sin delimitador",
+			tpl:     porDefecto,
+			mensaje: "E0034J0CEMDCRBP44V020",
+			err:     errPayloadFormato,
+		},
+		{
+			nombre:  "campo obligatorio vacío",
+			tpl:     porDefecto,
+			mensaje: "E003;;0;CEMDCRBP44;V020",
+			err:     errPayloadVacio,
+		},
+		{
+			nombre:  "campo obligatorio solo con espacios",
+			tpl:     porDefecto,
+			mensaje: "E003;4J;0;CEMDCRBP44;   ",
+			err:     errPayloadVacio,
+		},
+		{
+			nombre:  "mensaje vacío",
+			tpl:     porDefecto,
+			mensaje: "",
+			err:     errPayloadFormato,
+		},
+		{
+			nombre:  "dark inválido usa el valor por defecto",
+			tpl:     conMarca,
+			mensaje: "E003;4J;X;CEMDCRBP44;V020;GREENEX",
+			payload: QRPayload{Especie: "E003", Calibre: "4J", Dark: 1, Embalaje: "CEMDCRBP44", Variedad: "V020", Marca: "GREENEX"},
+		},
+		{
+			nombre:  "campo opcional ausente",
+			tpl:     conMarca,
+			mensaje: "E003;4J;0;CEMDCRBP44;V020",
+			payload: QRPayload{Especie: "E003", Calibre: "4J", Embalaje: "CEMDCRBP44", Variedad: "V020"},
+		},
+		{
+			nombre:  "regex",
+			tpl:     regex,
+			mensaje: "E003-4J/CEMDCRBP44/V020",
+			payload: QRPayload{Especie: "E003", Calibre: "4J", Embalaje: "CEMDCRBP44", Variedad: "V020"},
+		},
+		{
+			nombre:  "regex que no coincide",
+			tpl:     regex,
+			mensaje: "E003;4J;0;CEMDCRBP44;V020",
+			err:     errPayloadFormato,
+		},
+		{
+			nombre:  "normalización",
+			tpl:     normalizada,
+			mensaje: "E003;xld;0;CEMDCRBP44;00v20",
+			payload: QRPayload{Especie: "E003", Calibre: "XL", Embalaje: "CEMDCRBP44", Variedad: "V2"},
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			p, err := newPayloadParser(caso.tpl)
+			if err != nil {
+				t.Fatalf("newPayloadParser: %v", err)
+			}
+			payload, detalle, err := p.Parse(caso.mensaje)
+			if !errors.Is(err, caso.err) {
+				t.Fatalf("error = %v (%s), esperado %v", err, detalle, caso.err)
+			}
+			if err != nil && detalle == "" {
+				t.Error("error sin detalle para el log")
+			}
+			if payload != caso.payload {
+				t.Errorf("payload = %+v, esperado %+v", payload, caso.payload)
+			}
+		})
+	}
+}
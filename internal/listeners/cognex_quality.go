@@ -0,0 +1,338 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/config"
+	"API-GREENEX/internal/models"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Lecturas usadas para el puntaje reciente de calidad de una cámara
+const qualityRecentWindow = 100
+
+// errSimbologiaNoPermitida indica una lectura de una simbología fuera de read_trailer.symbologies
+var errSimbologiaNoPermitida = errors.New("simbología no permitida")
+
+// Simbologías por identificador AIM (ISO/IEC 15424): "]" + letra + modificador
+var aimSymbologies = map[byte]string{
+	'Q': "QR",
+	'd': "DATAMATRIX",
+	'C': "CODE128",
+	'A': "CODE39",
+	'E': "EAN_UPC",
+	'I': "ITF",
+	'L': "PDF417",
+	'z': "AZTEC",
+	'e': "GS1_DATABAR",
+}
+
+// Grado ISO 15415 por puntaje (A=4 ... F=0)
+var gradeScores = map[string]float64{"A": 4, "B": 3, "C": 2, "D": 1, "F": 0}
+
+// readTrailerParser separa los datos de decodificación que la cámara agrega a cada lectura
+type readTrailerParser struct {
+	cfg               config.ReadTrailer
+	permitidas        map[string]bool // Simbologías aceptadas (vacío = cualquiera)
+	minPuntaje        float64         // Puntaje reciente mínimo (-1 = sin mínimo)
+	informaSimbologia bool            // La configuración informa simbología (prefijo AIM o campo)
+}
+
+// newReadTrailerParser valida la configuración de datos agregados
+func newReadTrailerParser(cfg config.ReadTrailer) (*readTrailerParser, error) {
+	if cfg.Delimiter == "" {
+		cfg.Delimiter = "|"
+	}
+	if len(cfg.Fields) == 0 && !cfg.SymbologyPrefix {
+		return nil, fmt.Errorf("read_trailer necesita 'fields' o 'symbology_prefix'")
+	}
+
+	p := &readTrailerParser{cfg: cfg, permitidas: make(map[string]bool), minPuntaje: -1, informaSimbologia: cfg.SymbologyPrefix}
+	vistos := make(map[string]bool)
+	for _, campo := range cfg.Fields {
+		switch campo {
+		case config.TrailerSymbology:
+			p.informaSimbologia = true
+		case config.TrailerDecodeMs, config.TrailerGrade:
+		default:
+			return nil, fmt.Errorf("campo '%s' no soportado (symbology, decode_ms, grade)", campo)
+		}
+		if vistos[campo] {
+			return nil, fmt.Errorf("campo '%s' repetido", campo)
+		}
+		vistos[campo] = true
+	}
+
+	for _, simbologia := range cfg.Symbologies {
+		p.permitidas[normalizeSymbology(simbologia)] = true
+	}
+	if len(p.permitidas) > 0 && !p.informaSimbologia {
+		return nil, fmt.Errorf("'symbologies' requiere symbology_prefix o el campo symbology")
+	}
+
+	if cfg.MinGrade != "" {
+		puntaje, ok := gradeScores[strings.ToUpper(cfg.MinGrade)]
+		if !ok {
+			return nil, fmt.Errorf("min_grade '%s' inválido (A, B, C, D, F)", cfg.MinGrade)
+		}
+		p.minPuntaje = puntaje
+	}
+	return p, nil
+}
+
+// Split retorna el código sin los datos agregados y la calidad de la lectura.
+// Si la lectura no trae los datos (ej: NO_READ sin trailer), retorna el mensaje intacto y calidad nil.
+func (p *readTrailerParser) Split(message string) (string, *models.ReadQuality, error) {
+	calidad := &models.ReadQuality{DecodeMs: -1}
+	codigo := message
+
+	if n := len(p.cfg.Fields); n > 0 {
+		partes := strings.Split(codigo, p.cfg.Delimiter)
+		if len(partes) <= n {
+			return message, nil, nil
+		}
+		datos := partes[len(partes)-n:]
+		codigo = strings.Join(partes[:len(partes)-n], p.cfg.Delimiter)
+
+		for i, campo := range p.cfg.Fields {
+			valor := strings.TrimSpace(datos[i])
+			switch campo {
+			case config.TrailerSymbology:
+				calidad.Simbologia = normalizeSymbology(valor)
+			case config.TrailerDecodeMs:
+				ms, err := strconv.Atoi(valor)
+				if err != nil || ms < 0 {
+					return message, nil, fmt.Errorf("decode_ms inválido: %q", valor)
+				}
+				calidad.DecodeMs = ms
+			case config.TrailerGrade:
+				grado, puntaje, err := parseGrade(valor)
+				if err != nil {
+					return message, nil, err
+				}
+				calidad.Grado, calidad.Puntaje = grado, puntaje
+			}
+		}
+	}
+
+	if p.cfg.SymbologyPrefix && len(codigo) >= 3 && codigo[0] == ']' {
+		calidad.Simbologia = normalizeSymbology(codigo[:3])
+		codigo = codigo[3:]
+	}
+
+	if len(p.permitidas) > 0 && !p.permitidas[calidad.Simbologia] {
+		return codigo, calidad, fmt.Errorf("%w: '%s'", errSimbologiaNoPermitida, calidad.Simbologia)
+	}
+	return codigo, calidad, nil
+}
+
+// normalizeSymbology convierte un identificador AIM (]Q1) o un nombre a su nombre canónico
+func normalizeSymbology(valor string) string {
+	valor = strings.TrimSpace(valor)
+	if len(valor) >= 2 && valor[0] == ']' {
+		if nombre, ok := aimSymbologies[valor[1]]; ok {
+			return nombre
+		}
+		return "AIM" + valor[1:2]
+	}
+	nombre := strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(valor))
+	switch nombre {
+	case "DATA_MATRIX", "DM":
+		return "DATAMATRIX"
+	case "QRCODE", "QR_CODE":
+		return "QR"
+	}
+	return nombre
+}
+
+// parseGrade acepta un grado en letra (A-F) o numérico (0-4) y retorna la letra y el puntaje
+func parseGrade(valor string) (string, float64, error) {
+	letra := strings.ToUpper(valor)
+	if letra == "E" {
+		letra = "F"
+	}
+	if puntaje, ok := gradeScores[letra]; ok {
+		return letra, puntaje, nil
+	}
+
+	puntaje, err := strconv.ParseFloat(valor, 64)
+	if err != nil || puntaje < 0 || puntaje > 4 {
+		return "", 0, fmt.Errorf("grado inválido: %q (A-F o 0-4)", valor)
+	}
+	return gradeFromScore(puntaje), puntaje, nil
+}
+
+// gradeFromScore redondea un puntaje (0-4) al grado ISO 15415 más cercano
+func gradeFromScore(puntaje float64) string {
+	switch {
+	case puntaje >= 3.5:
+		return "A"
+	case puntaje >= 2.5:
+		return "B"
+	case puntaje >= 1.5:
+		return "C"
+	case puntaje >= 0.5:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+// qualityStats acumula las métricas de calidad de lectura de una cámara
+type qualityStats struct {
+	lecturas      int64
+	sinDatos      int64
+	noReads       int64
+	rechazadas    int64
+	porGrado      map[string]int64
+	porSimbologia map[string]int64
+	conGrado      int64
+	sumaPuntaje   float64
+	recientes     []float64 // buffer circular de los últimos puntajes
+	next          int
+	conDecode     int64
+	sumaDecodeMs  int64
+	maxDecodeMs   int
+	mu            sync.Mutex
+}
+
+func newQualityStats() *qualityStats {
+	return &qualityStats{
+		porGrado:      make(map[string]int64),
+		porSimbologia: make(map[string]int64),
+		recientes:     make([]float64, 0, qualityRecentWindow),
+	}
+}
+
+// registrar acumula la calidad de una lectura decodificada (nil = sin datos de calidad)
+func (q *qualityStats) registrar(calidad *models.ReadQuality) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if calidad == nil {
+		q.sinDatos++
+		return
+	}
+	q.lecturas++
+	if calidad.Simbologia != "" {
+		q.porSimbologia[calidad.Simbologia]++
+	}
+	if calidad.Grado != "" {
+		q.porGrado[calidad.Grado]++
+		q.conGrado++
+		q.sumaPuntaje += calidad.Puntaje
+		if len(q.recientes) < qualityRecentWindow {
+			q.recientes = append(q.recientes, calidad.Puntaje)
+		} else {
+			q.recientes[q.next] = calidad.Puntaje
+			q.next = (q.next + 1) % qualityRecentWindow
+		}
+	}
+	if calidad.DecodeMs >= 0 {
+		q.conDecode++
+		q.sumaDecodeMs += int64(calidad.DecodeMs)
+		if calidad.DecodeMs > q.maxDecodeMs {
+			q.maxDecodeMs = calidad.DecodeMs
+		}
+	}
+}
+
+// registrarNoRead cuenta un NO_READ (el extremo de la degradación de calidad)
+func (q *qualityStats) registrarNoRead() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.noReads++
+}
+
+// registrarRechazo cuenta una lectura descartada por simbología no permitida
+func (q *qualityStats) registrarRechazo() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rechazadas++
+}
+
+// snapshot arma las estadísticas (minPuntaje < 0 = sin umbral de degradación)
+func (q *qualityStats) snapshot(minPuntaje float64) models.CognexQualityStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := models.CognexQualityStats{
+		Lecturas:            q.lecturas,
+		SinDatos:            q.sinDatos,
+		NoReads:             q.noReads,
+		SimbologiaRechazada: q.rechazadas,
+		PorGrado:            make(map[string]int64, len(q.porGrado)),
+		PorSimbologia:       make(map[string]int64, len(q.porSimbologia)),
+		DecodeMaxMs:         q.maxDecodeMs,
+	}
+	for grado, n := range q.porGrado {
+		stats.PorGrado[grado] = n
+	}
+	for simbologia, n := range q.porSimbologia {
+		stats.PorSimbologia[simbologia] = n
+	}
+	if q.conGrado > 0 {
+		stats.PuntajePromedio = round2(q.sumaPuntaje / float64(q.conGrado))
+	}
+	if len(q.recientes) > 0 {
+		suma := 0.0
+		for _, puntaje := range q.recientes {
+			suma += puntaje
+		}
+		stats.PuntajeReciente = round2(suma / float64(len(q.recientes)))
+		stats.GradoReciente = gradeFromScore(stats.PuntajeReciente)
+		stats.Degradada = minPuntaje >= 0 && stats.PuntajeReciente < minPuntaje
+	}
+	if q.conDecode > 0 {
+		stats.DecodePromedioMs = round2(float64(q.sumaDecodeMs) / float64(q.conDecode))
+	}
+	return stats
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// SetReadTrailer configura los datos de decodificación que la cámara agrega a cada lectura
+// (simbología, tiempo de decodificación, grado). Debe llamarse antes de Start.
+func (c *CognexListener) SetReadTrailer(cfg config.ReadTrailer) error {
+	parser, err := newReadTrailerParser(cfg)
+	if err != nil {
+		return fmt.Errorf("read_trailer inválido: %w", err)
+	}
+	c.trailer = parser
+	return nil
+}
+
+// splitTrailer separa el código de los datos de calidad y actualiza las métricas de la cámara
+func (c *CognexListener) splitTrailer(message string) (string, *models.ReadQuality, error) {
+	if c.trailer == nil {
+		return message, nil, nil
+	}
+
+	codigo, calidad, err := c.trailer.Split(message)
+	if err != nil {
+		if errors.Is(err, errSimbologiaNoPermitida) {
+			c.calidad.registrarRechazo()
+		}
+		return codigo, calidad, err
+	}
+	if codigo == models.NO_READ_CODE {
+		c.calidad.registrarNoRead()
+		return codigo, calidad, nil
+	}
+	c.calidad.registrar(calidad)
+	return codigo, calidad, nil
+}
+
+// qualityStats retorna la calidad de lectura de la cámara (nil si no tiene read_trailer)
+func (c *CognexListener) qualityStats() *models.CognexQualityStats {
+	if c.trailer == nil {
+		return nil
+	}
+	stats := c.calidad.snapshot(c.trailer.minPuntaje)
+	return &stats
+}
@@ -0,0 +1,128 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/config"
+	"API-GREENEX/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestReadTrailerSplit(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		cfg     config.ReadTrailer
+		mensaje string
+		codigo  string
+		calidad *models.ReadQuality
+	}{
+		{
+			nombre:  "tiempo y grado en letra",
+			cfg:     config.ReadTrailer{Fields: []string{config.TrailerDecodeMs, config.TrailerGrade}},
+			mensaje: "E003;4J;0;CEMDCRBP44;V020|12|B",
+			codigo:  "E003;4J;0;CEMDCRBP44;V020",
+			calidad: &models.ReadQuality{DecodeMs: 12, Grado: "B", Puntaje: 3},
+		},
+		{
+			nombre:  "mismo delimitador que el QR",
+			cfg:     config.ReadTrailer{Delimiter: ";", Fields: []string{config.TrailerSymbology, config.TrailerGrade}},
+			mensaje: "E003;4J;0;CEMDCRBP44;V020;QR Code;2.7",
+			codigo:  "E003;4J;0;CEMDCRBP44;V020",
+			calidad: &models.ReadQuality{Simbologia: "QR", DecodeMs: -1, Grado: "B", Puntaje: 2.7},
+		},
+		{
+			nombre:  "prefijo AIM",
+			cfg:     config.ReadTrailer{SymbologyPrefix: true, Fields: []string{config.TrailerGrade}},
+			mensaje: "]d2ABC123|A",
+			codigo:  "ABC123",
+			calidad: &models.ReadQuality{Simbologia: "DATAMATRIX", DecodeMs: -1, Grado: "A", Puntaje: 4},
+		},
+		{
+			nombre:  "NO_READ sin datos agregados",
+			cfg:     config.ReadTrailer{Fields: []string{config.TrailerDecodeMs, config.TrailerGrade}},
+			mensaje: "NO_READ",
+			codigo:  "NO_READ",
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			p, err := newReadTrailerParser(caso.cfg)
+			if err != nil {
+				t.Fatalf("newReadTrailerParser: %v", err)
+			}
+			codigo, calidad, err := p.Split(caso.mensaje)
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			if codigo != caso.codigo {
+				t.Errorf("código = %q, esperado %q", codigo, caso.codigo)
+			}
+			switch {
+			case caso.calidad == nil && calidad != nil:
+				t.Errorf("calidad = %+v, esperado nil", *calidad)
+			case caso.calidad != nil && (calidad == nil || *calidad != *caso.calidad):
+				t.Errorf("calidad = %+v, esperado %+v", calidad, *caso.calidad)
+			}
+		})
+	}
+}
+
+func TestReadTrailerRejects(t *testing.T) {
+	p, err := newReadTrailerParser(config.ReadTrailer{
+		SymbologyPrefix: true,
+		Fields:          []string{config.TrailerGrade},
+		Symbologies:     []string{"QR"},
+	})
+	if err != nil {
+		t.Fatalf("newReadTrailerParser: %v", err)
+	}
+
+	if _, _, err := p.Split("]C1ABC|A"); !errors.Is(err, errSimbologiaNoPermitida) {
+		t.Errorf("Code128 = %v, esperado simbología no permitida", err)
+	}
+	if _, _, err := p.Split("]Q1ABC|X"); err == nil || errors.Is(err, errSimbologiaNoPermitida) {
+		t.Errorf("grado X = %v, esperado grado inválido", err)
+	}
+}
+
+func TestNewReadTrailerParserInvalid(t *testing.T) {
+	invalidas := map[string]config.ReadTrailer{
+		"sin campos":           {},
+		"campo desconocido":    {Fields: []string{"contraste"}},
+		"campo repetido":       {Fields: []string{config.TrailerGrade, config.TrailerGrade}},
+		"simbologías sin dato": {Fields: []string{config.TrailerGrade}, Symbologies: []string{"QR"}},
+		"min_grade inválido":   {Fields: []string{config.TrailerGrade}, MinGrade: "Z"},
+	}
+	for nombre, cfg := range invalidas {
+		if _, err := newReadTrailerParser(cfg); err == nil {
+			t.Errorf("%s: esperado error", nombre)
+		}
+	}
+}
+
+func TestQualityStatsDegradada(t *testing.T) {
+	q := newQualityStats()
+	for i := 0; i < qualityRecentWindow; i++ {
+		q.registrar(&models.ReadQuality{Simbologia: "QR", DecodeMs: 10, Grado: "A", Puntaje: 4})
+	}
+	if stats := q.snapshot(2); stats.Degradada || stats.GradoReciente != "A" {
+		t.Fatalf("stats = %+v, esperado grado A sin degradación", stats)
+	}
+
+	// La impresión empeora: las últimas lecturas desplazan a las antiguas del puntaje reciente
+	for i := 0; i < qualityRecentWindow; i++ {
+		q.registrar(&models.ReadQuality{Simbologia: "QR", DecodeMs: 30, Grado: "D", Puntaje: 1})
+	}
+	q.registrarNoRead()
+
+	stats := q.snapshot(2)
+	if !stats.Degradada || stats.GradoReciente != "D" {
+		t.Errorf("Degradada=%t GradoReciente=%s, esperado degradada con grado D", stats.Degradada, stats.GradoReciente)
+	}
+	if stats.PuntajePromedio != 2.5 || stats.DecodePromedioMs != 20 || stats.DecodeMaxMs != 30 {
+		t.Errorf("promedios = %+v", stats)
+	}
+	if stats.PorGrado["A"] != 100 || stats.PorGrado["D"] != 100 || stats.NoReads != 1 {
+		t.Errorf("conteos = %+v", stats)
+	}
+}
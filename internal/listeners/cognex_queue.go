@@ -0,0 +1,225 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Políticas de desborde de la cola de eventos de una cámara
+const (
+	QueuePolicyBlock          = "block"            // El lector espera hasta que el sorter libere espacio
+	QueuePolicyDropOldest     = "drop_oldest"      // Se descarta el evento más antiguo pendiente
+	QueuePolicyDivertToReject = "divert_to_reject" // El evento nuevo no se encola: se entrega al handler de rechazo
+)
+
+// Profundidad por defecto de las colas de eventos (igual al buffer histórico de los canales)
+const defaultQueueDepth = 100
+
+// DivertHandler recibe las lecturas QR que no caben en la cola con política divert_to_reject.
+// Se llama en la goroutine que emite la lectura (worker de inserción o conexión): no debe bloquear.
+type DivertHandler func(evento models.LecturaEvent)
+
+// queuedEvent es un evento pendiente con su instante de encolado
+type queuedEvent[T any] struct {
+	evento   T
+	encolado time.Time
+}
+
+// eventQueue es una cola acotada entre la cámara y el sorter. Los eventos se entregan por out
+// (sin buffer), de modo que el tiempo de espera se mide hasta que el sorter toma cada evento.
+type eventQueue[T any] struct {
+	ctx    context.Context
+	policy string
+	buf    chan queuedEvent[T]
+	out    chan T
+	divert func(T)
+	inicio sync.Once
+
+	encolados    int64 // atómicos
+	entregados   int64
+	descartados  int64
+	desviados    int64
+	bloqueos     int64 // Encolados que tuvieron que esperar espacio (política block)
+	esperando    int64 // Lectores bloqueados en este momento
+	maxOcupacion int64
+
+	statsMutex  sync.Mutex
+	esperaTotal time.Duration
+	esperaMax   time.Duration
+}
+
+// newEventQueue crea una cola con la profundidad y política indicadas (valores vacíos usan el default)
+func newEventQueue[T any](ctx context.Context, depth int, policy string) (*eventQueue[T], error) {
+	if depth <= 0 {
+		depth = defaultQueueDepth
+	}
+	switch policy {
+	case "":
+		policy = QueuePolicyBlock
+	case QueuePolicyBlock, QueuePolicyDropOldest, QueuePolicyDivertToReject:
+	default:
+		return nil, fmt.Errorf("política de cola no soportada: %s (use %s, %s o %s)",
+			policy, QueuePolicyBlock, QueuePolicyDropOldest, QueuePolicyDivertToReject)
+	}
+
+	return &eventQueue[T]{
+		ctx:    ctx,
+		policy: policy,
+		buf:    make(chan queuedEvent[T], depth),
+		out:    make(chan T),
+	}, nil
+}
+
+// push encola un evento aplicando la política de desborde. Retorna false si el evento no se encoló.
+func (q *eventQueue[T]) push(evento T) bool {
+	q.inicio.Do(func() { go q.forward() })
+
+	item := queuedEvent[T]{evento: evento, encolado: time.Now()}
+	select {
+	case q.buf <- item:
+		q.encolado()
+		return true
+	default:
+	}
+
+	// Cola llena
+	switch q.policy {
+	case QueuePolicyDropOldest:
+		for {
+			select {
+			case q.buf <- item:
+				q.encolado()
+				return true
+			default:
+			}
+			select {
+			case <-q.buf:
+				atomic.AddInt64(&q.descartados, 1)
+			default:
+			}
+		}
+
+	case QueuePolicyDivertToReject:
+		atomic.AddInt64(&q.desviados, 1)
+		if q.divert != nil {
+			q.divert(evento)
+		}
+		return false
+
+	default:
+		atomic.AddInt64(&q.bloqueos, 1)
+		atomic.AddInt64(&q.esperando, 1)
+		defer atomic.AddInt64(&q.esperando, -1)
+		select {
+		case q.buf <- item:
+			q.encolado()
+			return true
+		case <-q.ctx.Done():
+			atomic.AddInt64(&q.descartados, 1)
+			return false
+		}
+	}
+}
+
+// encolado actualiza los contadores tras encolar un evento
+func (q *eventQueue[T]) encolado() {
+	atomic.AddInt64(&q.encolados, 1)
+	ocupacion := int64(len(q.buf))
+	for {
+		max := atomic.LoadInt64(&q.maxOcupacion)
+		if ocupacion <= max || atomic.CompareAndSwapInt64(&q.maxOcupacion, max, ocupacion) {
+			return
+		}
+	}
+}
+
+// forward entrega los eventos al sorter en orden y mide cuánto esperó cada uno en la cola
+func (q *eventQueue[T]) forward() {
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case item := <-q.buf:
+			select {
+			case q.out <- item.evento:
+			case <-q.ctx.Done():
+				return
+			}
+			espera := time.Since(item.encolado)
+			atomic.AddInt64(&q.entregados, 1)
+
+			q.statsMutex.Lock()
+			q.esperaTotal += espera
+			if espera > q.esperaMax {
+				q.esperaMax = espera
+			}
+			q.statsMutex.Unlock()
+		}
+	}
+}
+
+// stats retorna el estado de la cola
+func (q *eventQueue[T]) stats() models.CognexQueueStats {
+	stats := models.CognexQueueStats{
+		Politica:           q.policy,
+		Capacidad:          cap(q.buf),
+		Profundidad:        len(q.buf),
+		ProfundidadMax:     int(atomic.LoadInt64(&q.maxOcupacion)),
+		Encolados:          atomic.LoadInt64(&q.encolados),
+		Entregados:         atomic.LoadInt64(&q.entregados),
+		Descartados:        atomic.LoadInt64(&q.descartados),
+		Desviados:          atomic.LoadInt64(&q.desviados),
+		Bloqueos:           atomic.LoadInt64(&q.bloqueos),
+		LectoresBloqueados: int(atomic.LoadInt64(&q.esperando)),
+	}
+
+	q.statsMutex.Lock()
+	defer q.statsMutex.Unlock()
+	if stats.Entregados > 0 {
+		stats.EsperaPromedioMs = float64(q.esperaTotal.Microseconds()) / float64(stats.Entregados) / 1000
+	}
+	stats.EsperaMaxMs = float64(q.esperaMax.Microseconds()) / 1000
+	return stats
+}
+
+// SetQueue configura la profundidad y la política de desborde de las colas de eventos QR y DataMatrix.
+// Debe llamarse antes de Start y antes de agrupar la cámara en un lector (FuseWith).
+func (c *CognexListener) SetQueue(depth int, policy string) error {
+	eventos, err := newEventQueue[models.LecturaEvent](c.ctx, depth, policy)
+	if err != nil {
+		return err
+	}
+	dataMatrix, err := newEventQueue[models.DataMatrixEvent](c.ctx, depth, policy)
+	if err != nil {
+		return err
+	}
+
+	eventos.divert = c.eventos.divert
+	c.eventos = eventos
+	c.EventChan = eventos.out
+	c.dataMatrix = dataMatrix
+	c.DataMatrixChan = dataMatrix.out
+	return nil
+}
+
+// SetDivertHandler define qué hacer con las lecturas QR que no caben en la cola (política divert_to_reject)
+func (c *CognexListener) SetDivertHandler(handler DivertHandler) {
+	c.eventos.divert = handler
+}
+
+// emitir encola una lectura QR para el sorter
+func (c *CognexListener) emitir(evento models.LecturaEvent) {
+	c.eventos.push(evento)
+}
+
+// queueStats retorna el estado de la cola que usa la cámara según su método de escaneo
+func (c *CognexListener) queueStats() models.CognexQueueStats {
+	if c.scan_method == "DATAMATRIX" {
+		return c.dataMatrix.stats()
+	}
+	return c.eventos.stats()
+}
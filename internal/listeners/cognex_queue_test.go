@@ -0,0 +1,130 @@
+package listeners
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestQueue crea una cola de enteros; el primer evento queda retenido en forward
+// (esperando al sorter), de modo que buf contiene solo los eventos siguientes
+func newTestQueue(t *testing.T, depth int, policy string) *eventQueue[int] {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	q, err := newEventQueue[int](ctx, depth, policy)
+	if err != nil {
+		t.Fatalf("newEventQueue: %v", err)
+	}
+	if !q.push(0) {
+		t.Fatal("push(0) = false")
+	}
+	esperarHasta(t, func() bool { return len(q.buf) == 0 })
+	return q
+}
+
+// esperarHasta reintenta cond hasta 2 s
+func esperarHasta(t *testing.T, cond func() bool) {
+	t.Helper()
+	limite := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(limite) {
+			t.Fatal("timeout esperando condición")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recibir lee n eventos de la cola
+func recibir(t *testing.T, q *eventQueue[int], n int) []int {
+	t.Helper()
+	eventos := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case evento := <-q.out:
+			eventos = append(eventos, evento)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout esperando evento %d", i)
+		}
+	}
+	return eventos
+}
+
+func TestEventQueueDropOldest(t *testing.T) {
+	q := newTestQueue(t, 2, QueuePolicyDropOldest)
+	for i := 1; i <= 4; i++ {
+		if !q.push(i) {
+			t.Fatalf("push(%d) = false, drop_oldest siempre encola", i)
+		}
+	}
+
+	if eventos := recibir(t, q, 3); !reflect.DeepEqual(eventos, []int{0, 3, 4}) {
+		t.Errorf("eventos = %v, esperado [0 3 4]", eventos)
+	}
+	stats := q.stats()
+	if stats.Descartados != 2 || stats.Encolados != 5 || stats.ProfundidadMax != 2 {
+		t.Errorf("stats = %+v, esperado 2 descartados, 5 encolados, profundidad máx 2", stats)
+	}
+}
+
+func TestEventQueueDivertToReject(t *testing.T) {
+	q := newTestQueue(t, 2, QueuePolicyDivertToReject)
+	var desviados []int
+	q.divert = func(evento int) { desviados = append(desviados, evento) }
+
+	for i := 1; i <= 3; i++ {
+		encolado := q.push(i)
+		if encolado != (i <= 2) {
+			t.Errorf("push(%d) = %t", i, encolado)
+		}
+	}
+
+	if !reflect.DeepEqual(desviados, []int{3}) {
+		t.Errorf("desviados = %v, esperado [3]", desviados)
+	}
+	if eventos := recibir(t, q, 3); !reflect.DeepEqual(eventos, []int{0, 1, 2}) {
+		t.Errorf("eventos = %v, esperado [0 1 2]", eventos)
+	}
+	if stats := q.stats(); stats.Desviados != 1 || stats.Descartados != 0 {
+		t.Errorf("stats = %+v, esperado 1 desviado", stats)
+	}
+}
+
+func TestEventQueueBlock(t *testing.T) {
+	q := newTestQueue(t, 1, QueuePolicyBlock)
+	q.push(1)
+
+	encolado := make(chan bool, 1)
+	go func() { encolado <- q.push(2) }()
+	esperarHasta(t, func() bool { return q.stats().LectoresBloqueados == 1 })
+
+	if eventos := recibir(t, q, 3); !reflect.DeepEqual(eventos, []int{0, 1, 2}) {
+		t.Errorf("eventos = %v, esperado [0 1 2]", eventos)
+	}
+	if !<-encolado {
+		t.Error("push bloqueado retornó false")
+	}
+	if stats := q.stats(); stats.Bloqueos != 1 || stats.LectoresBloqueados != 0 || stats.Descartados != 0 {
+		t.Errorf("stats = %+v, esperado 1 bloqueo sin lectores esperando", stats)
+	}
+}
+
+func TestEventQueueWaitMetrics(t *testing.T) {
+	q := newTestQueue(t, 4, QueuePolicyBlock)
+	q.push(1)
+	time.Sleep(50 * time.Millisecond)
+	recibir(t, q, 2)
+
+	esperarHasta(t, func() bool { return q.stats().Entregados == 2 })
+	stats := q.stats()
+	if stats.EsperaMaxMs < 50 {
+		t.Errorf("EsperaMaxMs = %.1f, esperado >= 50", stats.EsperaMaxMs)
+	}
+	if stats.EsperaPromedioMs < 25 || stats.EsperaPromedioMs > stats.EsperaMaxMs {
+		t.Errorf("EsperaPromedioMs = %.1f, esperado entre 25 y %.1f", stats.EsperaPromedioMs, stats.EsperaMaxMs)
+	}
+	if stats.Profundidad != 0 {
+		t.Errorf("Profundidad = %d, esperado 0", stats.Profundidad)
+	}
+}
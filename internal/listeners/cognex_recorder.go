@@ -0,0 +1,177 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Límites por defecto del archivo de grabación de tráfico
+const (
+	defaultRecordMaxSizeMB = 50
+	defaultRecordMaxFiles  = 5
+)
+
+// TrafficRecorder graba las tramas crudas de las cámaras en un archivo JSON lines con rotación
+// por tamaño (archivo, archivo.1 ... archivo.N). Puede compartirse entre varias cámaras.
+type TrafficRecorder struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	tramas  int64
+	errores int64
+}
+
+// NewTrafficRecorder abre (o crea) el archivo de grabación. maxSizeMB y maxFiles <= 0 usan el default.
+func NewTrafficRecorder(path string, maxSizeMB, maxFiles int) (*TrafficRecorder, error) {
+	if path == "" {
+		return nil, fmt.Errorf("ruta de grabación vacía")
+	}
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultRecordMaxSizeMB
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultRecordMaxFiles
+	}
+
+	r := &TrafficRecorder{
+		path:     path,
+		maxBytes: int64(maxSizeMB) * 1024 * 1024,
+		maxFiles: maxFiles,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error al crear directorio de grabación: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Path retorna la ruta del archivo de grabación activo
+func (r *TrafficRecorder) Path() string {
+	return r.path
+}
+
+// Record graba una trama. Los errores de escritura se registran en el log sin afectar la lectura.
+func (r *TrafficRecorder) Record(cognexID int, remote string, frame string) {
+	line, err := json.Marshal(models.CognexTrafficRecord{
+		Timestamp: time.Now(),
+		CognexID:  cognexID,
+		Remote:    remote,
+		Frame:     frame,
+	})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	if r.size+int64(len(line)) > r.maxBytes && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			r.fallo(err)
+			return
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		r.fallo(err)
+		return
+	}
+	r.tramas++
+}
+
+// Close cierra el archivo de grabación
+func (r *TrafficRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// open abre el archivo activo en modo append. Requiere r.mu (o uso exclusivo).
+func (r *TrafficRecorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error al abrir archivo de grabación: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error al leer archivo de grabación: %w", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate desplaza archivo → archivo.1 → ... → archivo.N (el más antiguo se descarta). Requiere r.mu.
+func (r *TrafficRecorder) rotate() error {
+	if err := r.file.Close(); err != nil {
+		log.Printf("⚠️  [Grabación] Error al cerrar %s: %v", r.path, err)
+	}
+	r.file = nil
+
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		origen := fmt.Sprintf("%s.%d", r.path, i)
+		if _, err := os.Stat(origen); err == nil {
+			os.Rename(origen, fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		log.Printf("⚠️  [Grabación] Error al rotar %s: %v", r.path, err)
+	}
+
+	return r.open()
+}
+
+// fallo registra un error de escritura (solo el primero y luego cada 1000 para no inundar el log). Requiere r.mu.
+func (r *TrafficRecorder) fallo(err error) {
+	r.errores++
+	if r.errores == 1 || r.errores%1000 == 0 {
+		log.Printf("❌ [Grabación] Error al grabar tráfico en %s (%d errores): %v", r.path, r.errores, err)
+	}
+}
+
+// SetRecorder activa la grabación de las tramas crudas recibidas por la cámara. Debe llamarse antes de Start.
+func (c *CognexListener) SetRecorder(recorder *TrafficRecorder) {
+	c.recorder = recorder
+}
+
+// record graba la trama si la grabación está activa
+func (c *CognexListener) record(trama string, conn net.Conn) {
+	if c.recorder == nil {
+		return
+	}
+	c.recorder.Record(c.id, conn.RemoteAddr().String(), trama)
+}
+
+// recordPath retorna el archivo de grabación de la cámara (vacío si no graba)
+func (c *CognexListener) recordPath() string {
+	if c.recorder == nil {
+		return ""
+	}
+	return c.recorder.Path()
+}
@@ -0,0 +1,129 @@
+package listeners
+
+import (
+	"API-GREENEX/internal/models"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// leerGrabacion retorna las tramas grabadas en un archivo
+func leerGrabacion(t *testing.T, path string) []models.CognexTrafficRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("abrir %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var registros []models.CognexTrafficRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var registro models.CognexTrafficRecord
+		if err := json.Unmarshal(scanner.Bytes(), &registro); err != nil {
+			t.Fatalf("línea inválida en %s: %v", path, err)
+		}
+		registros = append(registros, registro)
+	}
+	return registros
+}
+
+func TestTrafficRecorderGraba(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "trafico.jsonl")
+	r, err := NewTrafficRecorder(path, 0, 0)
+	if err != nil {
+		t.Fatalf("NewTrafficRecorder: %v", err)
+	}
+
+	tramas := []string{"E003;4J;0;CEMDCRBP44;V020", "NO_READ", "con \"comillas\"\r y control\x02"}
+	for _, trama := range tramas {
+		r.Record(3, "10.0.0.5:3000", trama)
+	}
+	r.Close()
+	r.Record(3, "10.0.0.5:3000", "tras cerrar")
+
+	registros := leerGrabacion(t, path)
+	if len(registros) != len(tramas) {
+		t.Fatalf("%d tramas grabadas, esperado %d", len(registros), len(tramas))
+	}
+	for i, registro := range registros {
+		if registro.Frame != tramas[i] || registro.CognexID != 3 || registro.Remote != "10.0.0.5:3000" || registro.Timestamp.IsZero() {
+			t.Errorf("trama %d = %+v, esperado %q", i, registro, tramas[i])
+		}
+	}
+
+	if _, err := NewTrafficRecorder("", 0, 0); err == nil {
+		t.Error("ruta vacía aceptada")
+	}
+}
+
+func TestTrafficRecorderRota(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trafico.jsonl")
+	r, err := NewTrafficRecorder(path, 1, 2)
+	if err != nil {
+		t.Fatalf("NewTrafficRecorder: %v", err)
+	}
+	r.maxBytes = 300 // unas 3 tramas por archivo
+
+	const total = 20
+	for i := 0; i < total; i++ {
+		r.Record(1, "10.0.0.5:3000", fmt.Sprintf("E003;4J;0;CEMDCRBP44;V%03d", i))
+	}
+	r.Close()
+
+	// Solo quedan el archivo activo y maxFiles rotados, sin superar el tamaño máximo
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 existe con maxFiles=2", path)
+	}
+	var frames []string
+	for _, archivo := range []string{path + ".2", path + ".1", path} {
+		info, err := os.Stat(archivo)
+		if err != nil {
+			t.Fatalf("%s: %v", archivo, err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%s tiene %d bytes, máximo 300", archivo, info.Size())
+		}
+		for _, registro := range leerGrabacion(t, archivo) {
+			frames = append(frames, registro.Frame)
+		}
+	}
+
+	// Las tramas conservadas son las más recientes, en orden
+	for i, frame := range frames {
+		esperado := fmt.Sprintf("E003;4J;0;CEMDCRBP44;V%03d", total-len(frames)+i)
+		if frame != esperado {
+			t.Fatalf("trama %d = %s, esperado %s", i, frame, esperado)
+		}
+	}
+	if len(frames) == 0 || len(frames) == total {
+		t.Errorf("%d tramas conservadas de %d", len(frames), total)
+	}
+}
+
+func TestTrafficRecorderContinuaArchivoExistente(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trafico.jsonl")
+	r, err := NewTrafficRecorder(path, 1, 2)
+	if err != nil {
+		t.Fatalf("NewTrafficRecorder: %v", err)
+	}
+	r.Record(1, "10.0.0.5:3000", "primera")
+	r.Close()
+
+	// Al reabrir se agrega al final y el tamaño previo cuenta para la rotación
+	r, err = NewTrafficRecorder(path, 1, 2)
+	if err != nil {
+		t.Fatalf("NewTrafficRecorder: %v", err)
+	}
+	r.maxBytes = r.size + 1
+	r.Record(1, "10.0.0.5:3000", "segunda")
+	r.Close()
+
+	anterior, actual := leerGrabacion(t, path+".1"), leerGrabacion(t, path)
+	if len(anterior) != 1 || anterior[0].Frame != "primera" || len(actual) != 1 || actual[0].Frame != "segunda" {
+		t.Errorf("rotado = %+v, activo = %+v", anterior, actual)
+	}
+}
@@ -28,6 +28,8 @@ type HTTPFrontend struct {
 	sorters       map[string]shared.SorterInterface // Mapa de sorters por ID
 	wsHub         *WebSocketHub                     // Hub de WebSocket
 	deviceMonitor interface{}                       // Para monitoreo de dispositivos
+	cognexDevices map[int]*CognexListener           // Cámaras Cognex por ID
+	boxJournal    BoxJournalReconciler              // Registro local de cajas sin BD (nil = deshabilitado)
 }
 
 func NewHTTPFrontend(addr string) *HTTPFrontend {
@@ -66,6 +68,47 @@ func NewHTTPFrontend(addr string) *HTTPFrontend {
 						"POST /assignment",
 						"DELETE /assignment/:sealer_id/:sku_id",
 						"DELETE /assignment/:sealer_id",
+						"GET /assignment/plans/:sorter_id",
+						"POST /assignment/plans",
+						"PUT /assignment/plans/:plan_id",
+						"DELETE /assignment/plans/:plan_id",
+						"POST /assignment/plans/:plan_id/apply",
+					},
+					"routing_rules": []string{
+						"GET /routing/rules/:sorter_id",
+						"POST /routing/rules",
+						"PUT /routing/rules/:rule_id",
+						"DELETE /routing/rules/:rule_id",
+						"GET /routing/batch/:sorter_id",
+						"DELETE /routing/batch/:sorter_id",
+						"DELETE /routing/batch/:sorter_id/:sku",
+						"GET /routing/capacity/:sorter_id",
+						"GET /routing/shadow/:sorter_id",
+						"PUT /routing/shadow/:sorter_id",
+						"DELETE /routing/shadow/:sorter_id",
+						"GET /routing/shadow/:sorter_id/divergences",
+						"GET /routing/decisions/:sorter_id",
+						"GET /routing/decisions/correlativo/:correlativo",
+					},
+					"cognex": []string{
+						"GET /cognex/stats",
+						"GET /cognex/:cognex_id/stats",
+						"GET /cognex/queues",
+						"GET /cognex/quality",
+						"GET /cognex/:cognex_id/quality/history",
+						"GET /cognex/:cognex_id/connections",
+						"POST /cognex/:cognex_id/commands",
+					},
+					"sorter": []string{
+						"GET /sorter/:sorter_id/state",
+						"POST /sorter/:sorter_id/pause",
+						"POST /sorter/:sorter_id/resume",
+						"GET /sorter/:sorter_id/diverts",
+						"GET /sorter/:sorter_id/plc/queue",
+					},
+					"journal": []string{
+						"GET /journal/status",
+						"POST /journal/reconcile",
 					},
 					"websocket": []string{
 						"GET /ws/:room",
@@ -86,10 +129,11 @@ func NewHTTPFrontend(addr string) *HTTPFrontend {
 	go wsHub.Run()
 
 	return &HTTPFrontend{
-		router:  router,
-		addr:    addr,
-		sorters: make(map[string]shared.SorterInterface),
-		wsHub:   wsHub,
+		router:        router,
+		addr:          addr,
+		sorters:       make(map[string]shared.SorterInterface),
+		wsHub:         wsHub,
+		cognexDevices: make(map[int]*CognexListener),
 	}
 }
 
@@ -140,6 +184,11 @@ func (h *HTTPFrontend) RegisterSorter(sorter shared.SorterInterface) {
 	h.sorters[sorterID] = sorter
 }
 
+// RegisterCognex registra una cámara Cognex para consultar sus estadísticas desde HTTP
+func (h *HTTPFrontend) RegisterCognex(cognex *CognexListener) {
+	h.cognexDevices[cognex.GetID()] = cognex
+}
+
 // GetWebSocketHub retorna el hub de WebSocket
 func (h *HTTPFrontend) GetWebSocketHub() *WebSocketHub {
 	return h.wsHub
@@ -662,6 +711,17 @@ func (h *HTTPFrontend) setupRoutes() {
 		c.JSON(http.StatusOK, historial)
 	})
 
+	// Endpoints de reglas de ruteo por atributos y estado del balance
+	h.setupRoutingRuleRoutes()
+	h.setupBatchStateRoutes()
+	h.setupCapacityRoutes()
+	h.setupShadowRoutingRoutes()
+	h.setupRoutingDecisionRoutes()
+	h.setupAssignmentPlanRoutes()
+	h.setupCognexRoutes()
+	h.setupSorterStateRoutes()
+	h.setupJournalRoutes()
+
 	// ========================================
 	// 📡 Endpoints de Monitoreo de Dispositivos
 	// ========================================
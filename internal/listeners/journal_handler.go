@@ -0,0 +1,59 @@
+package listeners
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"API-GREENEX/internal/models"
+)
+
+// BoxJournalReconciler es el registro local de cajas con su reconciliador (evita import cycle con journal)
+type BoxJournalReconciler interface {
+	Stats() models.BoxJournalStats
+	ReconcileNow(ctx context.Context) (int, error)
+}
+
+// SetBoxJournal vincula el registro local de cajas al frontend HTTP
+func (h *HTTPFrontend) SetBoxJournal(reconciler BoxJournalReconciler) {
+	h.boxJournal = reconciler
+}
+
+// setupJournalRoutes registra los endpoints del registro local de cajas sin BD
+func (h *HTTPFrontend) setupJournalRoutes() {
+	// Endpoint GET /journal/status
+	// Cajas y salidas pendientes de escribir en PostgreSQL
+	h.router.GET("/journal/status", func(c *gin.Context) {
+		if h.boxJournal == nil {
+			RespondWithError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavail, "Registro de cajas sin BD deshabilitado", nil, "Configure database.postgres.journal")
+			return
+		}
+
+		Success(c, h.boxJournal.Stats(), "Estado del registro de cajas")
+	})
+
+	// Endpoint POST /journal/reconcile
+	// Fuerza una pasada del reconciliador sin esperar el intervalo
+	h.router.POST("/journal/reconcile", func(c *gin.Context) {
+		if h.boxJournal == nil {
+			RespondWithError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavail, "Registro de cajas sin BD deshabilitado", nil, "Configure database.postgres.journal")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		escritas, err := h.boxJournal.ReconcileNow(ctx)
+		result := models.BoxJournalReconcileResult{Reconciliadas: escritas, Estado: h.boxJournal.Stats()}
+		if err != nil {
+			result.Error = err.Error()
+			RespondWithError(c, http.StatusServiceUnavailable, ErrCodeServiceUnavail, "Reconciliación incompleta", result, "")
+			return
+		}
+
+		Success(c, result, fmt.Sprintf("%d entrada(s) reconciliada(s)", escritas))
+	})
+}
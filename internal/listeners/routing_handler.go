@@ -0,0 +1,494 @@
+package listeners
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+)
+
+// RoutingRuleStore es la interfaz de persistencia de reglas de ruteo (evita import cycle con db)
+type RoutingRuleStore interface {
+	GetRoutingRules(ctx context.Context, sorterID int) ([]models.RoutingRule, error)
+	GetRoutingRule(ctx context.Context, id int) (*models.RoutingRule, error)
+	InsertRoutingRule(ctx context.Context, rule models.RoutingRule) (int, error)
+	UpdateRoutingRule(ctx context.Context, rule models.RoutingRule) error
+	DeleteRoutingRule(ctx context.Context, id int) error
+}
+
+// routingRuleReloader es implementado por los sorters que soportan reglas por atributos
+type routingRuleReloader interface {
+	ReloadRoutingRules(ctx context.Context) error
+}
+
+// batchStateManager es implementado por los sorters con balance por batch persistente
+type batchStateManager interface {
+	GetBatchStates() []models.BatchState
+	ResetBatchDistributor(ctx context.Context, sku string) error
+}
+
+// capacityReporter es implementado por los sorters con ruteo por capacidad de mesas
+type capacityReporter interface {
+	GetMesaFills() []models.MesaFill
+}
+
+// shadowRoutingManager es implementado por los sorters con ruteo en sombra
+type shadowRoutingManager interface {
+	EnableShadowRouting(cfg models.ShadowRoutingConfig) error
+	DisableShadowRouting()
+	GetShadowRoutingStatus() models.ShadowRoutingStatus
+	GetShadowDivergences(limit int) []models.ShadowDivergence
+}
+
+// RoutingDecisionStore es la interfaz de consulta de la auditoría de ruteo (evita import cycle con db)
+type RoutingDecisionStore interface {
+	GetRoutingDecisionsByCorrelativo(ctx context.Context, correlativo string) ([]models.RoutingDecision, error)
+	GetRoutingDecisions(ctx context.Context, sorterID int, desde, hasta time.Time, razon string, limit int) ([]models.RoutingDecision, error)
+}
+
+// setupRoutingRuleRoutes registra los endpoints CRUD de reglas de ruteo por atributos
+func (h *HTTPFrontend) setupRoutingRuleRoutes() {
+	// Endpoint GET /routing/rules/:sorter_id
+	// Lista las reglas de ruteo de un sorter (ordenadas por prioridad)
+	h.router.GET("/routing/rules/:sorter_id", func(c *gin.Context) {
+		sorterIDStr := c.Param("sorter_id")
+		sorterID, err := strconv.Atoi(sorterIDStr)
+		if err != nil {
+			BadRequest(c, "sorter_id debe ser un número entero válido", gin.H{"sorter_id": sorterIDStr})
+			return
+		}
+		if _, exists := h.sorters[sorterIDStr]; !exists {
+			SorterNotFound(c, sorterIDStr)
+			return
+		}
+
+		store, ok := h.postgresMgr.(RoutingRuleStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", gin.H{"sorter_id": sorterID})
+			return
+		}
+
+		rules, err := store.GetRoutingRules(c.Request.Context(), sorterID)
+		if err != nil {
+			InternalServerError(c, "Error al consultar reglas de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+
+		Success(c, rules, fmt.Sprintf("%d regla(s) de ruteo", len(rules)))
+	})
+
+	// Endpoint POST /routing/rules
+	// Crea una regla de ruteo. Body: models.RoutingRule (sin id)
+	h.router.POST("/routing/rules", func(c *gin.Context) {
+		var rule models.RoutingRule
+		rule.Activa = true // Default si no viene en el body
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+			return
+		}
+
+		sorter, ok := h.validateRoutingRule(c, &rule)
+		if !ok {
+			return
+		}
+
+		store, ok := h.postgresMgr.(RoutingRuleStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", nil)
+			return
+		}
+
+		id, err := store.InsertRoutingRule(c.Request.Context(), rule)
+		if err != nil {
+			InternalServerError(c, "Error al crear regla de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+		rule.ID = id
+
+		h.reloadSorterRoutingRules(c.Request.Context(), sorter)
+		Created(c, rule, fmt.Sprintf("Regla de ruteo #%d creada", id))
+	})
+
+	// Endpoint PUT /routing/rules/:rule_id
+	// Reemplaza una regla de ruteo existente
+	h.router.PUT("/routing/rules/:rule_id", func(c *gin.Context) {
+		ruleIDStr := c.Param("rule_id")
+		ruleID, err := strconv.Atoi(ruleIDStr)
+		if err != nil {
+			BadRequest(c, "rule_id debe ser un número entero válido", gin.H{"rule_id": ruleIDStr})
+			return
+		}
+
+		store, ok := h.postgresMgr.(RoutingRuleStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", nil)
+			return
+		}
+
+		existing, err := store.GetRoutingRule(c.Request.Context(), ruleID)
+		if err != nil {
+			InternalServerError(c, "Error al consultar regla de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+		if existing == nil {
+			NotFound(c, "Regla de ruteo no encontrada", gin.H{"rule_id": ruleID})
+			return
+		}
+
+		rule := *existing
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+			return
+		}
+		rule.ID = ruleID
+
+		sorter, ok := h.validateRoutingRule(c, &rule)
+		if !ok {
+			return
+		}
+
+		if err := store.UpdateRoutingRule(c.Request.Context(), rule); err != nil {
+			InternalServerError(c, "Error al actualizar regla de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+
+		// Si la regla cambió de sorter, recargar también el sorter anterior
+		if existing.SorterID != rule.SorterID {
+			if previous, exists := h.sorters[strconv.Itoa(existing.SorterID)]; exists {
+				h.reloadSorterRoutingRules(c.Request.Context(), previous)
+			}
+		}
+		h.reloadSorterRoutingRules(c.Request.Context(), sorter)
+		Success(c, rule, fmt.Sprintf("Regla de ruteo #%d actualizada", ruleID))
+	})
+
+	// Endpoint DELETE /routing/rules/:rule_id
+	h.router.DELETE("/routing/rules/:rule_id", func(c *gin.Context) {
+		ruleIDStr := c.Param("rule_id")
+		ruleID, err := strconv.Atoi(ruleIDStr)
+		if err != nil {
+			BadRequest(c, "rule_id debe ser un número entero válido", gin.H{"rule_id": ruleIDStr})
+			return
+		}
+
+		store, ok := h.postgresMgr.(RoutingRuleStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", nil)
+			return
+		}
+
+		existing, err := store.GetRoutingRule(c.Request.Context(), ruleID)
+		if err != nil {
+			InternalServerError(c, "Error al consultar regla de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+		if existing == nil {
+			NotFound(c, "Regla de ruteo no encontrada", gin.H{"rule_id": ruleID})
+			return
+		}
+
+		if err := store.DeleteRoutingRule(c.Request.Context(), ruleID); err != nil {
+			InternalServerError(c, "Error al eliminar regla de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+
+		if sorter, exists := h.sorters[strconv.Itoa(existing.SorterID)]; exists {
+			h.reloadSorterRoutingRules(c.Request.Context(), sorter)
+		}
+		Success(c, gin.H{"rule_id": ruleID}, fmt.Sprintf("Regla de ruteo #%d eliminada", ruleID))
+	})
+}
+
+// setupBatchStateRoutes registra los endpoints para consultar y reiniciar el balance por batch
+func (h *HTTPFrontend) setupBatchStateRoutes() {
+	// Endpoint GET /routing/batch/:sorter_id
+	// Retorna el estado actual del balance round-robin por SKU
+	h.router.GET("/routing/batch/:sorter_id", func(c *gin.Context) {
+		manager, ok := h.batchStateManagerFor(c)
+		if !ok {
+			return
+		}
+
+		states := manager.GetBatchStates()
+		Success(c, states, fmt.Sprintf("%d SKU(s) con balance activo", len(states)))
+	})
+
+	// Endpoint DELETE /routing/batch/:sorter_id
+	// Reinicia el balance de todos los SKUs del sorter
+	h.router.DELETE("/routing/batch/:sorter_id", func(c *gin.Context) {
+		manager, ok := h.batchStateManagerFor(c)
+		if !ok {
+			return
+		}
+
+		if err := manager.ResetBatchDistributor(c.Request.Context(), ""); err != nil {
+			InternalServerError(c, "Error al reiniciar balance", gin.H{"error": err.Error()})
+			return
+		}
+		Success(c, gin.H{"sorter_id": c.Param("sorter_id")}, "Balance reiniciado para todos los SKUs")
+	})
+
+	// Endpoint DELETE /routing/batch/:sorter_id/:sku
+	// Reinicia el balance de un SKU específico (vuelve a la primera salida)
+	h.router.DELETE("/routing/batch/:sorter_id/:sku", func(c *gin.Context) {
+		manager, ok := h.batchStateManagerFor(c)
+		if !ok {
+			return
+		}
+
+		sku := c.Param("sku")
+		if err := manager.ResetBatchDistributor(c.Request.Context(), sku); err != nil {
+			NotFound(c, err.Error(), gin.H{"sorter_id": c.Param("sorter_id"), "sku": sku})
+			return
+		}
+		Success(c, gin.H{"sorter_id": c.Param("sorter_id"), "sku": sku}, fmt.Sprintf("Balance reiniciado para SKU '%s'", sku))
+	})
+}
+
+// setupCapacityRoutes registra el endpoint de consulta del llenado de mesas usado en el ruteo
+func (h *HTTPFrontend) setupCapacityRoutes() {
+	// Endpoint GET /routing/capacity/:sorter_id
+	// Retorna el último llenado conocido de pallet por salida (y si está retenida)
+	h.router.GET("/routing/capacity/:sorter_id", func(c *gin.Context) {
+		sorterID := c.Param("sorter_id")
+		sorter, exists := h.sorters[sorterID]
+		if !exists {
+			SorterNotFound(c, sorterID)
+			return
+		}
+
+		reporter, ok := sorter.(capacityReporter)
+		if !ok {
+			InternalServerError(c, "El sorter no soporta ruteo por capacidad", gin.H{"sorter_id": sorterID})
+			return
+		}
+
+		fills := reporter.GetMesaFills()
+		Success(c, fills, fmt.Sprintf("%d salida(s) con llenado de mesa", len(fills)))
+	})
+}
+
+// setupShadowRoutingRoutes registra los endpoints del ruteo en sombra (dry-run)
+func (h *HTTPFrontend) setupShadowRoutingRoutes() {
+	// Endpoint GET /routing/shadow/:sorter_id
+	// Retorna la configuración candidata y los contadores de divergencias
+	h.router.GET("/routing/shadow/:sorter_id", func(c *gin.Context) {
+		manager, ok := h.shadowRoutingManagerFor(c)
+		if !ok {
+			return
+		}
+
+		Success(c, manager.GetShadowRoutingStatus(), "Estado del ruteo en sombra")
+	})
+
+	// Endpoint PUT /routing/shadow/:sorter_id
+	// Activa (o reemplaza) el ruteo en sombra. Body: models.ShadowRoutingConfig
+	h.router.PUT("/routing/shadow/:sorter_id", func(c *gin.Context) {
+		manager, ok := h.shadowRoutingManagerFor(c)
+		if !ok {
+			return
+		}
+
+		var cfg models.ShadowRoutingConfig
+		if err := c.ShouldBindJSON(&cfg); err != nil {
+			BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := manager.EnableShadowRouting(cfg); err != nil {
+			UnprocessableEntity(c, err.Error(), gin.H{"sorter_id": c.Param("sorter_id")})
+			return
+		}
+
+		Success(c, manager.GetShadowRoutingStatus(), "Ruteo en sombra activado")
+	})
+
+	// Endpoint DELETE /routing/shadow/:sorter_id
+	// Desactiva el ruteo en sombra
+	h.router.DELETE("/routing/shadow/:sorter_id", func(c *gin.Context) {
+		manager, ok := h.shadowRoutingManagerFor(c)
+		if !ok {
+			return
+		}
+
+		manager.DisableShadowRouting()
+		Success(c, gin.H{"sorter_id": c.Param("sorter_id")}, "Ruteo en sombra desactivado")
+	})
+
+	// Endpoint GET /routing/shadow/:sorter_id/divergences?limit=100
+	// Lista las divergencias más recientes entre la decisión real y la de sombra
+	h.router.GET("/routing/shadow/:sorter_id/divergences", func(c *gin.Context) {
+		manager, ok := h.shadowRoutingManagerFor(c)
+		if !ok {
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 {
+			BadRequest(c, "limit debe ser un número entero positivo", gin.H{"limit": c.Query("limit")})
+			return
+		}
+
+		divergencias := manager.GetShadowDivergences(limit)
+		Success(c, divergencias, fmt.Sprintf("%d divergencia(s)", len(divergencias)))
+	})
+}
+
+// setupRoutingDecisionRoutes registra los endpoints de consulta de la auditoría de decisiones de ruteo
+func (h *HTTPFrontend) setupRoutingDecisionRoutes() {
+	// Endpoint GET /routing/decisions/correlativo/:correlativo
+	// Explica por qué una caja fue a una salida (candidatas, razón, reintentos PLC)
+	h.router.GET("/routing/decisions/correlativo/:correlativo", func(c *gin.Context) {
+		store, ok := h.postgresMgr.(RoutingDecisionStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", nil)
+			return
+		}
+
+		correlativo := c.Param("correlativo")
+		decisions, err := store.GetRoutingDecisionsByCorrelativo(c.Request.Context(), correlativo)
+		if err != nil {
+			InternalServerError(c, "Error al consultar decisiones de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+		if len(decisions) == 0 {
+			NotFound(c, "Sin decisiones de ruteo para la caja", gin.H{"correlativo": correlativo})
+			return
+		}
+
+		Success(c, decisions, fmt.Sprintf("%d decisión(es) para caja %s", len(decisions), correlativo))
+	})
+
+	// Endpoint GET /routing/decisions/:sorter_id?desde=RFC3339&hasta=RFC3339&razon=sin_asignacion&limit=200
+	// Lista las decisiones de un sorter en un rango de tiempo (default: última hora)
+	h.router.GET("/routing/decisions/:sorter_id", func(c *gin.Context) {
+		sorterIDStr := c.Param("sorter_id")
+		sorterID, err := strconv.Atoi(sorterIDStr)
+		if err != nil {
+			BadRequest(c, "sorter_id debe ser un número entero válido", gin.H{"sorter_id": sorterIDStr})
+			return
+		}
+		if _, exists := h.sorters[sorterIDStr]; !exists {
+			SorterNotFound(c, sorterIDStr)
+			return
+		}
+
+		hasta := time.Now()
+		if v := c.Query("hasta"); v != "" {
+			if hasta, err = time.Parse(time.RFC3339, v); err != nil {
+				BadRequest(c, "hasta debe tener formato RFC3339", gin.H{"hasta": v})
+				return
+			}
+		}
+		desde := hasta.Add(-time.Hour)
+		if v := c.Query("desde"); v != "" {
+			if desde, err = time.Parse(time.RFC3339, v); err != nil {
+				BadRequest(c, "desde debe tener formato RFC3339", gin.H{"desde": v})
+				return
+			}
+		}
+		if !desde.Before(hasta) {
+			BadRequest(c, "desde debe ser anterior a hasta", gin.H{"desde": desde, "hasta": hasta})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "200"))
+		if err != nil || limit <= 0 || limit > 5000 {
+			BadRequest(c, "limit debe ser un número entre 1 y 5000", gin.H{"limit": c.Query("limit")})
+			return
+		}
+
+		store, ok := h.postgresMgr.(RoutingDecisionStore)
+		if !ok || h.postgresMgr == nil {
+			InternalServerError(c, "Base de datos no disponible", gin.H{"sorter_id": sorterID})
+			return
+		}
+
+		decisions, err := store.GetRoutingDecisions(c.Request.Context(), sorterID, desde, hasta, c.Query("razon"), limit)
+		if err != nil {
+			InternalServerError(c, "Error al consultar decisiones de ruteo", gin.H{"error": err.Error()})
+			return
+		}
+
+		Success(c, decisions, fmt.Sprintf("%d decisión(es) entre %s y %s", len(decisions),
+			desde.Format(time.RFC3339), hasta.Format(time.RFC3339)))
+	})
+}
+
+// shadowRoutingManagerFor obtiene el sorter de la ruta con soporte de ruteo en sombra
+func (h *HTTPFrontend) shadowRoutingManagerFor(c *gin.Context) (shadowRoutingManager, bool) {
+	sorterID := c.Param("sorter_id")
+	sorter, exists := h.sorters[sorterID]
+	if !exists {
+		SorterNotFound(c, sorterID)
+		return nil, false
+	}
+
+	manager, ok := sorter.(shadowRoutingManager)
+	if !ok {
+		InternalServerError(c, "El sorter no soporta ruteo en sombra", gin.H{"sorter_id": sorterID})
+		return nil, false
+	}
+	return manager, true
+}
+
+// batchStateManagerFor obtiene el sorter de la ruta con soporte de balance persistente
+func (h *HTTPFrontend) batchStateManagerFor(c *gin.Context) (batchStateManager, bool) {
+	sorterID := c.Param("sorter_id")
+	sorter, exists := h.sorters[sorterID]
+	if !exists {
+		SorterNotFound(c, sorterID)
+		return nil, false
+	}
+
+	manager, ok := sorter.(batchStateManager)
+	if !ok {
+		InternalServerError(c, "El sorter no soporta balance persistente", gin.H{"sorter_id": sorterID})
+		return nil, false
+	}
+	return manager, true
+}
+
+// validateRoutingRule valida la regla y que la salida pertenezca al sorter indicado.
+// Responde el error al cliente y retorna ok=false si la regla no es válida.
+func (h *HTTPFrontend) validateRoutingRule(c *gin.Context, rule *models.RoutingRule) (shared.SorterInterface, bool) {
+	if err := rule.Validate(); err != nil {
+		ValidationError(c, "rule", err.Error())
+		return nil, false
+	}
+
+	sorterIDStr := strconv.Itoa(rule.SorterID)
+	sorter, exists := h.sorters[sorterIDStr]
+	if !exists {
+		SorterNotFound(c, sorterIDStr)
+		return nil, false
+	}
+
+	salidas := sorter.GetSalidas()
+	for i := range salidas {
+		if salidas[i].ID == rule.SalidaID {
+			return sorter, true
+		}
+	}
+
+	UnprocessableEntity(c, fmt.Sprintf("La salida %d no pertenece al sorter #%d", rule.SalidaID, rule.SorterID),
+		gin.H{"sorter_id": rule.SorterID, "salida_id": rule.SalidaID})
+	return nil, false
+}
+
+// reloadSorterRoutingRules refresca en memoria las reglas del sorter tras un cambio en BD
+func (h *HTTPFrontend) reloadSorterRoutingRules(ctx context.Context, sorter shared.SorterInterface) {
+	reloader, ok := sorter.(routingRuleReloader)
+	if !ok {
+		return
+	}
+	if err := reloader.ReloadRoutingRules(ctx); err != nil {
+		log.Printf("⚠️  Sorter #%d: Error al recargar reglas de ruteo: %v", sorter.GetID(), err)
+	}
+}
@@ -0,0 +1,147 @@
+package listeners
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"API-GREENEX/internal/models"
+)
+
+// sorterPauser es implementado por los sorters que se pueden pausar
+type sorterPauser interface {
+	Pause(motivo string) (models.SorterState, error)
+	Resume() (models.SorterState, error)
+	GetSorterState() models.SorterState
+}
+
+// divertConfirmationReporter es implementado por los sorters con confirmación física de desvíos
+type divertConfirmationReporter interface {
+	GetDivertConfirmationStatus(limit int) models.DivertConfirmationStatus
+}
+
+// plcQueueReporter es implementado por los sorters con cola de comandos al PLC
+type plcQueueReporter interface {
+	GetPLCQueueStats() models.PLCQueueStats
+}
+
+// setupSorterStateRoutes registra los endpoints de pausa, reanudación, confirmación de desvíos y cola PLC de sorters
+func (h *HTTPFrontend) setupSorterStateRoutes() {
+	// Endpoint GET /sorter/:sorter_id/state
+	h.router.GET("/sorter/:sorter_id/state", func(c *gin.Context) {
+		pauser, ok := h.sorterPauserFor(c)
+		if !ok {
+			return
+		}
+
+		Success(c, pauser.GetSorterState(), "Estado del sorter")
+	})
+
+	// Endpoint POST /sorter/:sorter_id/pause
+	// Pausa el sorter: no rutea ni envía asignaciones al PLC y las cámaras QR con offline_on_pause se ponen offline.
+	// Body opcional: models.SorterPauseRequest
+	h.router.POST("/sorter/:sorter_id/pause", func(c *gin.Context) {
+		pauser, ok := h.sorterPauserFor(c)
+		if !ok {
+			return
+		}
+
+		var req models.SorterPauseRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				BadRequest(c, "Formato de body inválido", gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		state, err := pauser.Pause(req.Motivo)
+		if err != nil {
+			RespondWithError(c, http.StatusConflict, ErrCodeConflict, err.Error(), state, "")
+			return
+		}
+
+		Success(c, state, fmt.Sprintf("Sorter #%d en pausa", state.SorterID))
+	})
+
+	// Endpoint POST /sorter/:sorter_id/resume
+	// Reanuda el sorter y vuelve a poner online las cámaras QR
+	h.router.POST("/sorter/:sorter_id/resume", func(c *gin.Context) {
+		pauser, ok := h.sorterPauserFor(c)
+		if !ok {
+			return
+		}
+
+		state, err := pauser.Resume()
+		if err != nil {
+			RespondWithError(c, http.StatusConflict, ErrCodeConflict, err.Error(), state, "")
+			return
+		}
+
+		Success(c, state, fmt.Sprintf("Sorter #%d reanudado", state.SorterID))
+	})
+
+	// Endpoint GET /sorter/:sorter_id/diverts?limit=50
+	// Confirmación física de desvíos: contadores y alertas recientes (cajas mal desviadas o perdidas)
+	h.router.GET("/sorter/:sorter_id/diverts", func(c *gin.Context) {
+		sorterID := c.Param("sorter_id")
+		sorter, exists := h.sorters[sorterID]
+		if !exists {
+			SorterNotFound(c, sorterID)
+			return
+		}
+
+		reporter, ok := sorter.(divertConfirmationReporter)
+		if !ok {
+			InternalServerError(c, "El sorter no soporta confirmación de desvíos", gin.H{"sorter_id": sorterID})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit <= 0 {
+			BadRequest(c, "limit debe ser un número entero positivo", gin.H{"limit": c.Query("limit")})
+			return
+		}
+
+		status := reporter.GetDivertConfirmationStatus(limit)
+		Success(c, status, fmt.Sprintf("%d alerta(s) de desvío", len(status.Alertas)))
+	})
+
+	// Endpoint GET /sorter/:sorter_id/plc/queue
+	// Cola serializada de comandos al PLC: profundidad, descartes por plazo y percentiles de latencia
+	h.router.GET("/sorter/:sorter_id/plc/queue", func(c *gin.Context) {
+		sorterID := c.Param("sorter_id")
+		sorter, exists := h.sorters[sorterID]
+		if !exists {
+			SorterNotFound(c, sorterID)
+			return
+		}
+
+		reporter, ok := sorter.(plcQueueReporter)
+		if !ok {
+			InternalServerError(c, "El sorter no soporta cola de comandos PLC", gin.H{"sorter_id": sorterID})
+			return
+		}
+
+		stats := reporter.GetPLCQueueStats()
+		Success(c, stats, fmt.Sprintf("%d comando(s) en cola", stats.Profundidad))
+	})
+}
+
+// sorterPauserFor obtiene el sorter de la ruta con soporte de pausa
+func (h *HTTPFrontend) sorterPauserFor(c *gin.Context) (sorterPauser, bool) {
+	sorterID := c.Param("sorter_id")
+	sorter, exists := h.sorters[sorterID]
+	if !exists {
+		SorterNotFound(c, sorterID)
+		return nil, false
+	}
+
+	pauser, ok := sorter.(sorterPauser)
+	if !ok {
+		InternalServerError(c, "El sorter no soporta pausa", gin.H{"sorter_id": sorterID})
+		return nil, false
+	}
+	return pauser, true
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AssignmentPlan representa un plan de asignación SKU→salida que se aplica automáticamente.
+// El plan se dispara una sola vez en EjecutarEn, o al inicio de cada turno indicado en Turno.
+type AssignmentPlan struct {
+	ID              int                  `json:"id"`
+	SorterID        int                  `json:"sorter_id"`
+	Nombre          string               `json:"nombre"`
+	Descripcion     string               `json:"descripcion"`
+	EjecutarEn      *time.Time           `json:"ejecutar_en"` // Ejecución única (nil si es por turno)
+	Turno           string               `json:"turno"`       // Nombre del turno (vacío si es por fecha)
+	Items           []AssignmentPlanItem `json:"items"`
+	Activo          bool                 `json:"activo"`
+	UltimaEjecucion *time.Time           `json:"ultima_ejecucion"`
+	UltimoResultado string               `json:"ultimo_resultado"`
+	FechaCreacion   time.Time            `json:"fecha_creacion"`
+}
+
+// AssignmentPlanItem define las SKUs que debe quedar recibiendo una salida
+type AssignmentPlanItem struct {
+	SalidaID int      `json:"salida_id"`
+	SKUIDs   []uint32 `json:"sku_ids"`
+	Limpiar  bool     `json:"limpiar"` // Quitar todas las SKUs actuales antes de asignar
+}
+
+// AssignmentPlanChange es el resultado de una operación individual al aplicar un plan
+type AssignmentPlanChange struct {
+	SalidaID int    `json:"salida_id"`
+	Accion   string `json:"accion"` // "limpiar" o "asignar"
+	SKUID    uint32 `json:"sku_id,omitempty"`
+	SKU      string `json:"sku,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AssignmentPlanResult resume la aplicación de un plan
+type AssignmentPlanResult struct {
+	PlanID     int                    `json:"plan_id"`
+	SorterID   int                    `json:"sorter_id"`
+	Nombre     string                 `json:"nombre"`
+	Disparo    string                 `json:"disparo"` // "fecha", "turno" o "manual"
+	AplicadoEn time.Time              `json:"aplicado_en"`
+	Cambios    []AssignmentPlanChange `json:"cambios"`
+	Errores    int                    `json:"errores"`
+}
+
+// Summary retorna un resumen legible del resultado (se guarda en ultimo_resultado)
+func (r *AssignmentPlanResult) Summary() string {
+	if r.Errores == 0 {
+		return fmt.Sprintf("OK: %d cambio(s) aplicados", len(r.Cambios))
+	}
+	errores := make([]string, 0, r.Errores)
+	for _, cambio := range r.Cambios {
+		if cambio.Error != "" {
+			errores = append(errores, fmt.Sprintf("salida %d: %s", cambio.SalidaID, cambio.Error))
+		}
+	}
+	return fmt.Sprintf("%d/%d cambio(s) con error: %s", r.Errores, len(r.Cambios), strings.Join(errores, "; "))
+}
+
+// Validate verifica la estructura del plan (el turno y las salidas se validan contra el sorter)
+func (p *AssignmentPlan) Validate() error {
+	if p.SorterID <= 0 {
+		return fmt.Errorf("sorter_id inválido: %d", p.SorterID)
+	}
+	if strings.TrimSpace(p.Nombre) == "" {
+		return fmt.Errorf("nombre es requerido")
+	}
+	if (p.EjecutarEn == nil) == (p.Turno == "") {
+		return fmt.Errorf("se debe indicar exactamente uno de 'ejecutar_en' o 'turno'")
+	}
+	if len(p.Items) == 0 {
+		return fmt.Errorf("el plan no tiene items")
+	}
+	vistas := make(map[int]bool, len(p.Items))
+	for _, item := range p.Items {
+		if item.SalidaID <= 0 {
+			return fmt.Errorf("salida_id inválido: %d", item.SalidaID)
+		}
+		if vistas[item.SalidaID] {
+			return fmt.Errorf("salida %d repetida en el plan", item.SalidaID)
+		}
+		vistas[item.SalidaID] = true
+		if !item.Limpiar && len(item.SKUIDs) == 0 {
+			return fmt.Errorf("salida %d sin cambios (sin sku_ids ni limpiar)", item.SalidaID)
+		}
+	}
+	return nil
+}
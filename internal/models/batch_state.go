@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// BatchState representa el estado persistido del balance round-robin de un SKU en un sorter
+type BatchState struct {
+	SorterID           int       `json:"sorter_id"`
+	SKU                string    `json:"sku"`
+	Salidas            []int     `json:"salidas"`       // IDs de salidas candidatas en el orden usado por el balance
+	CurrentIndex       int       `json:"current_index"` // Índice de la salida actual dentro de Salidas
+	CurrentCount       int       `json:"current_count"` // Cajas enviadas a la salida actual en el batch en curso
+	FechaActualizacion time.Time `json:"fecha_actualizacion"`
+}
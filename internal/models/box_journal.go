@@ -0,0 +1,21 @@
+package models
+
+// BoxJournalStats es el estado del registro local de cajas usado cuando PostgreSQL no está disponible
+type BoxJournalStats struct {
+	Archivo              string `json:"archivo"`
+	Pendientes           int    `json:"pendientes"`                      // Entradas aún no escritas en la BD
+	CajasPendientes      int    `json:"cajas_pendientes"`                // Cajas con correlativo provisional
+	SalidasPendientes    int    `json:"salidas_pendientes"`              // Registros de salida_caja pendientes
+	PendienteDesde       string `json:"pendiente_desde,omitempty"`       // Fecha de la entrada pendiente más antigua
+	Reconciliadas        int64  `json:"reconciliadas"`                   // Entradas escritas en la BD desde el inicio
+	EnCuarentena         int    `json:"en_cuarentena"`                   // Entradas rechazadas por la BD que ya no se reintentan
+	UltimaReconciliacion string `json:"ultima_reconciliacion,omitempty"` // Última pasada del reconciliador
+	UltimoError          string `json:"ultimo_error,omitempty"`          // Error de la última pasada (vacío = OK)
+}
+
+// BoxJournalReconcileResult es el resultado de POST /journal/reconcile
+type BoxJournalReconcileResult struct {
+	Reconciliadas int             `json:"reconciliadas"`
+	Error         string          `json:"error,omitempty"`
+	Estado        BoxJournalStats `json:"estado"`
+}
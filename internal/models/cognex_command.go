@@ -0,0 +1,29 @@
+package models
+
+// Comandos de control aceptados por POST /cognex/:cognex_id/commands
+const (
+	CognexCommandOnline  = "online"   // Cámara online (procesa triggers)
+	CognexCommandOffline = "offline"  // Cámara offline (no lee)
+	CognexCommandTrigger = "trigger"  // Trigger por software
+	CognexCommandLoadJob = "load_job" // Cargar un job (requiere Job)
+	CognexCommandStatus  = "status"   // Estado online y job cargado
+)
+
+// CognexCommand es un comando de control para una cámara
+type CognexCommand struct {
+	Command string `json:"command" binding:"required"`
+	Job     string `json:"job,omitempty"` // Nombre del job para load_job (ej: "qr_linea1.job")
+}
+
+// CognexCameraStatus es el estado de la cámara leído por el canal de control
+type CognexCameraStatus struct {
+	Online bool   `json:"online"`
+	Job    string `json:"job"`
+}
+
+// CognexCommandResult es la respuesta a un comando de control
+type CognexCommandResult struct {
+	CognexID int                 `json:"cognex_id"`
+	Command  string              `json:"command"`
+	Status   *CognexCameraStatus `json:"status,omitempty"` // Solo para el comando status
+}
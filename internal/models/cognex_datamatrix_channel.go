@@ -12,6 +12,8 @@ type DataMatrixEvent struct {
 	CognexID    int       `json:"cognex_id"`   // ID del Cognex que leyó el código
 	Timestamp   time.Time `json:"timestamp"`   // Momento de la lectura
 	RawMessage  string    `json:"raw_message"` // Mensaje crudo recibido
+
+	Calidad *ReadQuality `json:"calidad,omitempty"` // Simbología, tiempo de decodificación y grado (si la cámara los agrega)
 }
 
 // NewDataMatrixEvent crea un nuevo evento de DataMatrix
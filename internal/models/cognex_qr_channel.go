@@ -14,11 +14,24 @@ type LecturaEvent struct {
 	Calibre     string    `json:"calibre"`
 	Variedad    string    `json:"variedad"`
 	Embalaje    string    `json:"embalaje"`
+	Dark        int       `json:"dark"`
 	Correlativo string    `json:"correlativo"` // ID de la caja insertada en DB (para QR) o código DataMatrix
 	Mensaje     string    `json:"mensaje"`     // Mensaje original o código DataMatrix
 	Error       error     `json:"error"`       // Error si hubo fallo
 	Dispositivo string    `json:"dispositivo"` // Identificador del dispositivo (ej: "Cognex-01")
 	CognexID    int       `json:"cognex_id"`   // ID numérico del dispositivo Cognex
+
+	Calidad *ReadQuality `json:"calidad,omitempty"` // Simbología, tiempo de decodificación y grado (si la cámara los agrega)
+
+	Recibida time.Time `json:"-"` // Llegada de la trama desde la cámara (antes de la inserción en BD)
+}
+
+// InstanteLectura retorna cuándo llegó la trama de la cámara (Timestamp si no se registró)
+func (e LecturaEvent) InstanteLectura() time.Time {
+	if !e.Recibida.IsZero() {
+		return e.Recibida
+	}
+	return e.Timestamp
 }
 
 // TipoLectura representa el tipo de lectura
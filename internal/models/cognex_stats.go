@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// CognexStats resume la actividad de una cámara Cognex desde que inició la API
+type CognexStats struct {
+	CognexID             int    `json:"cognex_id"`
+	Dispositivo          string `json:"dispositivo"`
+	ScanMethod           string `json:"scan_method"`
+	Mensajes             int64  `json:"mensajes"`              // Mensajes recibidos (incluye NO_READ y duplicados)
+	DuplicadosSuprimidos int64  `json:"duplicados_suprimidos"` // Lecturas repetidas descartadas (sin correlativo ni desvío)
+	VentanaDuplicadosMs  int    `json:"ventana_duplicados_ms"` // 0 = supresión deshabilitada
+	DuplicadosConPLC     bool   `json:"duplicados_con_plc"`    // Duplicados confirmados con el tracking de cajas del PLC
+	TramasExcedidas      int64  `json:"tramas_excedidas"`      // Tramas descartadas por superar la longitud máxima
+	TramasIncompletas    int64  `json:"tramas_incompletas"`    // Tramas sin delimitador al vencer el timeout de trama parcial
+	Modo                 string `json:"modo"`                  // "server" (escucha) o "client" (se conecta a la cámara)
+	Conectada            bool   `json:"conectada"`             // Hay al menos una conexión abierta con la cámara
+	Conexiones           int64  `json:"conexiones"`            // Conexiones establecidas desde el inicio
+	ConexionesRechazadas int64  `json:"conexiones_rechazadas"` // Conexiones rechazadas por allowed_sources o max_connections
+
+	Fusion    *ReadFusionStats `json:"fusion,omitempty"`    // Solo si la cámara forma parte de un lector con varias cámaras
+	Grabacion string           `json:"grabacion,omitempty"` // Archivo donde se graban las tramas crudas
+	Cola      CognexQueueStats `json:"cola"`                // Cola de eventos hacia el sorter
+
+	Calidad *CognexQualityStats `json:"calidad,omitempty"` // Solo si la cámara agrega datos de decodificación (read_trailer)
+}
+
+// CognexQueueStats resume la cola acotada de eventos entre una cámara y el sorter
+type CognexQueueStats struct {
+	Politica           string  `json:"politica"`        // block | drop_oldest | divert_to_reject
+	Capacidad          int     `json:"capacidad"`       // Eventos máximos pendientes
+	Profundidad        int     `json:"profundidad"`     // Eventos pendientes en este momento
+	ProfundidadMax     int     `json:"profundidad_max"` // Máximo de eventos pendientes desde el inicio
+	Encolados          int64   `json:"encolados"`
+	Entregados         int64   `json:"entregados"`          // Eventos tomados por el sorter
+	Descartados        int64   `json:"descartados"`         // Eventos perdidos por drop_oldest (o al detener la API)
+	Desviados          int64   `json:"desviados"`           // Lecturas enviadas al handler de rechazo por divert_to_reject
+	Bloqueos           int64   `json:"bloqueos"`            // Lecturas que esperaron espacio en la cola (block)
+	LectoresBloqueados int     `json:"lectores_bloqueados"` // Lecturas esperando espacio en este momento
+	EsperaPromedioMs   float64 `json:"espera_promedio_ms"`  // Tiempo promedio en cola hasta que el sorter toma el evento
+	EsperaMaxMs        float64 `json:"espera_max_ms"`
+}
+
+// ReadFusionStats resume la fusión de lecturas de un lector lógico con varias cámaras QR
+type ReadFusionStats struct {
+	Camaras             []int         `json:"camaras"`              // IDs de las cámaras del lector (la primera es la principal)
+	VentanaMs           int           `json:"ventana_ms"`           // Ventana de fusión por caja
+	Cajas               int64         `json:"cajas"`                // Ventanas cerradas (una por caja)
+	GanadasPorCamara    map[int]int64 `json:"ganadas_por_camara"`   // Lecturas exitosas que ganaron la ventana, por cámara
+	LecturasDescartadas int64         `json:"lecturas_descartadas"` // Lecturas exitosas de otra cámara cuando la caja ya estaba leída
+	FallosAbsorbidos    int64         `json:"fallos_absorbidos"`    // Fallos ignorados porque otra cámara leyó la caja
+	NoReads             int64         `json:"no_reads"`             // Cajas sin lectura exitosa en ninguna cámara
+}
+
+// CognexConnection es una conexión TCP abierta con una cámara
+type CognexConnection struct {
+	Remote string    `json:"remote"`
+	Desde  time.Time `json:"desde"`
+}
+
+// CognexConnectionReject es una conexión entrante rechazada por la política del puerto
+type CognexConnectionReject struct {
+	Remote string    `json:"remote"`
+	Motivo string    `json:"motivo"` // origen_no_permitido | max_conexiones
+	Fecha  time.Time `json:"fecha"`
+}
+
+// CognexConnections resume las conexiones de una cámara y la política de su puerto
+type CognexConnections struct {
+	CognexID           int                      `json:"cognex_id"`
+	Modo               string                   `json:"modo"`
+	OrigenesPermitidos []string                 `json:"origenes_permitidos"` // Vacío = cualquier origen
+	MaxConexiones      int                      `json:"max_conexiones"`      // 0 = sin límite
+	ReemplazoActivo    bool                     `json:"reemplazo_activo"`
+	Activas            []CognexConnection       `json:"activas"`
+	Rechazadas         int64                    `json:"rechazadas"`
+	Reemplazadas       int64                    `json:"reemplazadas"`
+	RechazosRecientes  []CognexConnectionReject `json:"rechazos_recientes"` // El más reciente primero
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// CognexTrafficRecord es una trama cruda recibida de una cámara Cognex, tal como se graba
+// en el archivo de tráfico (una línea JSON por trama) y como la reproduce cmd/cognex-replay
+type CognexTrafficRecord struct {
+	Timestamp time.Time `json:"ts"`
+	CognexID  int       `json:"cognex_id"`
+	Remote    string    `json:"remote"` // Dirección de la cámara (ip:puerto)
+	Frame     string    `json:"frame"`  // Trama sin delimitador, sin normalizar
+}
@@ -22,6 +22,8 @@ type DeviceStatus struct {
 	LastCheck         time.Time  `json:"last_check"`
 	SectionID         int        `json:"section_id"`
 	ResponseTimeMs    int64      `json:"response_time_ms"`
+	Reported          bool       `json:"reported"`             // Estado informado por la conexión del servicio (sin heartbeat TCP)
+	LastError         string     `json:"last_error,omitempty"` // Último error de conexión informado
 }
 
 // SectionStatus representa el estado de una sección (sorter)
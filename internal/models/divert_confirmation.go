@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Estados de la confirmación física del desvío de una caja (columna estado_desvio de salida_caja)
+const (
+	DesvioConfirmado  = "confirmado"   // El PLC confirmó la caja en la salida asignada
+	DesvioMalDesviado = "mal_desviado" // El PLC confirmó la caja en otra salida
+	DesvioPerdido     = "perdido"      // El PLC no confirmó la caja dentro del timeout
+	DesvioNoComandado = "no_comandado" // Caja registrada en REJECT sin señal al PLC (cola de lecturas llena)
+)
+
+// DivertAlert es una caja que el PLC desvió a otra salida o que nunca confirmó
+type DivertAlert struct {
+	SorterID         int       `json:"sorter_id"`
+	Tipo             string    `json:"tipo"` // mal_desviado | perdido
+	Correlativo      string    `json:"correlativo"`
+	SKU              string    `json:"sku"`
+	Tracking         uint16    `json:"tracking_plc"`
+	SalidaEsperadaID int       `json:"salida_esperada_id"`
+	LaneEsperada     int16     `json:"lane_esperada"`            // Salida física enviada al PLC (0 = descarte)
+	SalidaRealID     int       `json:"salida_real_id,omitempty"` // Salida donde el PLC confirmó la caja (0 = desconocida)
+	LaneReal         *int16    `json:"lane_real,omitempty"`      // Salida física confirmada (nil = sin confirmación)
+	Enviada          time.Time `json:"enviada"`                  // Asignación de la salida al PLC
+	Timestamp        time.Time `json:"timestamp"`                // Confirmación o vencimiento del timeout
+	DemoraMs         float64   `json:"demora_ms"`                // Tiempo entre la asignación y la alerta
+	Nota             string    `json:"nota,omitempty"`           // Detalle adicional (ej: tracking reutilizado)
+}
+
+// String implementa fmt.Stringer
+func (a DivertAlert) String() string {
+	if a.Tipo == DesvioMalDesviado && a.LaneReal != nil {
+		return fmt.Sprintf("Caja %s (tracking %d): asignada a lane %d, confirmada en lane %d",
+			a.Correlativo, a.Tracking, a.LaneEsperada, *a.LaneReal)
+	}
+	return fmt.Sprintf("Caja %s (tracking %d): asignada a lane %d, sin confirmación del PLC tras %.0fms",
+		a.Correlativo, a.Tracking, a.LaneEsperada, a.DemoraMs)
+}
+
+// DivertConfirmationStatus resume la confirmación física de desvíos de un sorter
+type DivertConfirmationStatus struct {
+	SorterID     int           `json:"sorter_id"`
+	Enabled      bool          `json:"enabled"`
+	TimeoutMs    int64         `json:"timeout_ms"`
+	Pendientes   int           `json:"pendientes"`        // Cajas asignadas esperando confirmación
+	Confirmadas  int64         `json:"confirmadas"`       // Confirmadas en la salida asignada
+	MalDesviadas int64         `json:"mal_desviadas"`     // Confirmadas en otra salida
+	Perdidas     int64         `json:"perdidas"`          // Sin confirmación dentro del timeout
+	Desconocidas int64         `json:"desconocidas"`      // Confirmaciones sin caja pendiente con ese tracking
+	Alertas      []DivertAlert `json:"alertas_recientes"` // Más recientes primero
+}
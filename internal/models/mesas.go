@@ -1 +1,16 @@
 package models
+
+import "time"
+
+// MesaFill representa el nivel de llenado del pallet actual en una mesa de paletizado
+type MesaFill struct {
+	SalidaID     int       `json:"salida_id"`
+	MesaID       int       `json:"mesa_id"`
+	CajasEnPale  int       `json:"cajas_en_pale"`  // DatosProduccion.NumeroCajasEnPale
+	CajasPorPale int       `json:"cajas_por_pale"` // DatosPaletizado.CajasPorPale
+	Restantes    int       `json:"restantes"`      // Cajas que faltan para completar el pallet
+	Ratio        float64   `json:"ratio"`          // Porcentaje de llenado (0..1)
+	HoldBack     bool      `json:"hold_back"`      // true si la salida se retiene por cambio de pallet inminente
+	UpdatedAt    time.Time `json:"updated_at"`
+	Error        string    `json:"error,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// PLCLatencyPercentiles resume una ventana de latencias en milisegundos
+type PLCLatencyPercentiles struct {
+	Muestras int     `json:"muestras"`
+	P50      float64 `json:"p50"`
+	P90      float64 `json:"p90"`
+	P99      float64 `json:"p99"`
+	Max      float64 `json:"max"`
+}
+
+// PLCCommandStats son los contadores y latencias de una prioridad de la cola de comandos al PLC
+type PLCCommandStats struct {
+	Prioridad   string                `json:"prioridad"` // desvio | mantenimiento
+	Profundidad int                   `json:"profundidad"`
+	Encolados   int64                 `json:"encolados"`
+	Ejecutados  int64                 `json:"ejecutados"`   // Enviados al PLC sin error
+	Fallidos    int64                 `json:"fallidos"`     // Enviados al PLC con error
+	Vencidos    int64                 `json:"vencidos"`     // Descartados sin enviar: venció su plazo esperando turno
+	Cancelados  int64                 `json:"cancelados"`   // Descartados sin enviar: el llamador dejó de esperar
+	EsperaMs    PLCLatencyPercentiles `json:"espera_ms"`    // Tiempo en cola hasta llegar al PLC
+	EjecucionMs PLCLatencyPercentiles `json:"ejecucion_ms"` // Tiempo de la llamada o escritura en el PLC
+}
+
+// PLCQueueStats resume la cola serializada de comandos al PLC de un sorter
+type PLCQueueStats struct {
+	SorterID       int               `json:"sorter_id"`
+	Profundidad    int               `json:"profundidad"`        // Comandos esperando turno
+	ProfundidadMax int               `json:"profundidad_max"`    // Mayor profundidad observada
+	EnCurso        string            `json:"en_curso,omitempty"` // Comando que se está enviando al PLC
+	Prioridades    []PLCCommandStats `json:"prioridades"`        // De mayor a menor prioridad
+}
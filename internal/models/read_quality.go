@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// ReadQuality son los datos de decodificación que la cámara agrega al final de la lectura
+type ReadQuality struct {
+	Simbologia string  `json:"simbologia,omitempty"` // QR, DATAMATRIX, CODE128... (vacío = no informada)
+	DecodeMs   int     `json:"decode_ms"`            // Tiempo de decodificación informado por la cámara (-1 = no informado)
+	Grado      string  `json:"grado,omitempty"`      // Grado de calidad ISO 15415: A, B, C, D o F (vacío = no informado)
+	Puntaje    float64 `json:"puntaje"`              // Grado como número: A=4 ... F=0
+}
+
+// CognexQualityStats resume la calidad de lectura de una cámara desde que inició la API
+type CognexQualityStats struct {
+	Lecturas            int64            `json:"lecturas"`             // Lecturas con datos de calidad
+	SinDatos            int64            `json:"sin_datos"`            // Lecturas sin datos de calidad al final
+	NoReads             int64            `json:"no_reads"`             // NO_READ recibidos
+	PorGrado            map[string]int64 `json:"por_grado"`            // Lecturas por grado (A..F)
+	PorSimbologia       map[string]int64 `json:"por_simbologia"`       // Lecturas por simbología
+	SimbologiaRechazada int64            `json:"simbologia_rechazada"` // Lecturas rechazadas por simbología no permitida
+	PuntajePromedio     float64          `json:"puntaje_promedio"`     // Promedio desde el inicio (A=4 ... F=0)
+	PuntajeReciente     float64          `json:"puntaje_reciente"`     // Promedio de las últimas lecturas
+	GradoReciente       string           `json:"grado_reciente"`       // PuntajeReciente como grado
+	DecodePromedioMs    float64          `json:"decode_promedio_ms"`
+	DecodeMaxMs         int              `json:"decode_max_ms"`
+	Degradada           bool             `json:"degradada"` // El puntaje reciente cayó bajo el mínimo configurado
+}
+
+// ReadQualityBucket agrupa la calidad de lectura persistida de una cámara en un intervalo
+type ReadQualityBucket struct {
+	Desde            time.Time        `json:"desde"`
+	Cajas            int64            `json:"cajas"`
+	PorGrado         map[string]int64 `json:"por_grado"`
+	PuntajePromedio  float64          `json:"puntaje_promedio"`
+	DecodePromedioMs float64          `json:"decode_promedio_ms"`
+}
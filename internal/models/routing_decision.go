@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Razones de la decisión de ruteo de una caja (columna razon de routing_decision)
+const (
+	RazonSKUAsignado          = "sku_asignado"           // Salida con el SKU asignado explícitamente
+	RazonRegla                = "regla"                  // Salida elegida por regla de atributos
+	RazonDesborde             = "desborde"               // Salidas del SKU no disponibles o saturadas por ritmo, caja enviada por su cadena de desborde
+	RazonSinAsignacion        = "sin_asignacion"         // SKU sin salida ni regla → REJECT
+	RazonSalidasNoDisponibles = "salidas_no_disponibles" // SKU con salidas (asignadas o por regla), pero todas bloqueadas/llenas → REJECT
+	RazonRitmoExcedido        = "ritmo_excedido"         // Salidas del SKU y sus desbordes saturadas por ritmo: caja enviada igual a la menos excedida
+	RazonRejectNoDisponible   = "reject_no_disponible"   // Ni siquiera REJECT disponible (caja perdida)
+	RazonNoRead               = "no_read"
+	RazonFormatoInvalido      = "formato_invalido"
+	RazonErrorDB              = "error_db"
+	RazonColaLlena            = "cola_llena"      // Cola de lecturas llena (divert_to_reject): caja a REJECT sin señal al PLC
+	RazonSorterEnPausa        = "sorter_en_pausa" // Lectura recibida con el sorter en pausa: no se rutea ni se envía al PLC
+)
+
+// RoutingCandidate es el estado de una salida candidata al momento de decidir
+type RoutingCandidate struct {
+	SalidaID   int   `json:"salida_id"`
+	Estado     int16 `json:"estado"`
+	Bloqueo    bool  `json:"bloqueo"`
+	Disponible bool  `json:"disponible"`
+}
+
+// PLCAttempt registra un envío de salida al PLC (el inicial o un reintento con salida alternativa)
+type PLCAttempt struct {
+	SalidaID   int     `json:"salida_id"`
+	LatenciaMs float64 `json:"latencia_ms"`
+	Tracking   *uint16 `json:"tracking,omitempty"` // Número de seguimiento retornado por el PLC
+	Error      string  `json:"error,omitempty"`
+}
+
+// RoutingDecision es el registro de auditoría de la decisión de ruteo de una caja
+type RoutingDecision struct {
+	ID            int64              `json:"id"`
+	SorterID      int                `json:"sorter_id"`
+	Correlativo   string             `json:"correlativo"`
+	SKU           string             `json:"sku"`
+	Exitosa       bool               `json:"exitosa"` // Lectura exitosa (false = NO_READ / formato / BD)
+	Razon         string             `json:"razon"`
+	Estrategia    string             `json:"estrategia,omitempty"`
+	Candidatas    []RoutingCandidate `json:"candidatas"`
+	BatchIndex    *int               `json:"batch_index"` // Índice del BatchDistributor antes de decidir (nil si no aplica)
+	Reglas        []int              `json:"reglas"`      // Reglas de atributos que coincidieron
+	SalidaID      int                `json:"salida_id"`   // Salida decidida (0 = ninguna)
+	SalidaFinalID int                `json:"salida_final_id"`
+	Desborde      []int              `json:"-"` // Salidas no disponibles recorridas por la cadena de desborde (se persisten en salida_caja)
+	PLCIntentos   []PLCAttempt       `json:"plc_intentos"`
+	TrackingPLC   *uint16            `json:"tracking_plc,omitempty"` // Número de seguimiento de la caja en el PLC (intento confirmado)
+	PLCError      string             `json:"plc_error,omitempty"`
+	Fecha         time.Time          `json:"fecha"`
+}
+
+// RecordCandidates agrega el estado actual de las salidas candidatas
+func (d *RoutingDecision) RecordCandidates(candidatas []RoutingCandidate) {
+	if d == nil {
+		return
+	}
+	d.Candidatas = append(d.Candidatas, candidatas...)
+}
+
+// RecordPLCAttempt agrega un intento de envío al PLC (tracking = número de seguimiento retornado, si lo hubo)
+func (d *RoutingDecision) RecordPLCAttempt(salidaID int, latencia time.Duration, tracking *uint16, err error) {
+	if d == nil {
+		return
+	}
+	attempt := PLCAttempt{SalidaID: salidaID, LatenciaMs: float64(latencia.Microseconds()) / 1000, Tracking: tracking}
+	if err != nil {
+		attempt.Error = err.Error()
+	} else {
+		d.SalidaFinalID = salidaID
+		d.TrackingPLC = tracking
+	}
+	d.PLCIntentos = append(d.PLCIntentos, attempt)
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RoutingRule representa una regla de ruteo por atributos del SKU.
+// Cada lista vacía (o con "*") acepta cualquier valor; los valores admiten comodines
+// estilo glob (ej: "CEMD*"). La variedad se compara contra el código y el nombre.
+type RoutingRule struct {
+	ID          int      `json:"id"`
+	SorterID    int      `json:"sorter_id"`
+	SalidaID    int      `json:"salida_id"`
+	Prioridad   int      `json:"prioridad"`  // Mayor prioridad se evalúa primero
+	Variedades  []string `json:"variedades"` // Códigos o nombres de variedad (ej: "V018", "LAPINS")
+	Calibres    []string `json:"calibres"`
+	Embalajes   []string `json:"embalajes"`
+	Dark        *int     `json:"dark"` // nil = cualquiera
+	Activa      bool     `json:"activa"`
+	Descripcion string   `json:"descripcion"`
+}
+
+// Validate verifica que la regla tenga los campos mínimos y patrones válidos
+func (r *RoutingRule) Validate() error {
+	if r.SorterID <= 0 {
+		return fmt.Errorf("sorter_id inválido: %d", r.SorterID)
+	}
+	if r.SalidaID <= 0 {
+		return fmt.Errorf("salida_id inválido: %d", r.SalidaID)
+	}
+	if r.Dark != nil && *r.Dark != 0 && *r.Dark != 1 {
+		return fmt.Errorf("dark debe ser 0 o 1 (recibido %d)", *r.Dark)
+	}
+	for _, patrones := range [][]string{r.Variedades, r.Calibres, r.Embalajes} {
+		for _, patron := range patrones {
+			if _, err := path.Match(strings.ToUpper(patron), ""); err != nil {
+				return fmt.Errorf("patrón inválido '%s': %w", patron, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches indica si la regla aplica a los atributos de una caja
+func (r *RoutingRule) Matches(calibre, variedad, nombreVariedad, embalaje string, dark int) bool {
+	if !r.Activa {
+		return false
+	}
+	if r.Dark != nil && *r.Dark != dark {
+		return false
+	}
+	if !matchAny(r.Calibres, calibre) || !matchAny(r.Embalajes, embalaje) {
+		return false
+	}
+	return matchAny(r.Variedades, variedad) || (nombreVariedad != "" && matchAny(r.Variedades, nombreVariedad))
+}
+
+// String implementa fmt.Stringer
+func (r *RoutingRule) String() string {
+	dark := "*"
+	if r.Dark != nil {
+		dark = fmt.Sprintf("%d", *r.Dark)
+	}
+	return fmt.Sprintf("Regla #%d [prio=%d] variedad=%s calibre=%s embalaje=%s dark=%s → salida %d",
+		r.ID, r.Prioridad, patternList(r.Variedades), patternList(r.Calibres), patternList(r.Embalajes), dark, r.SalidaID)
+}
+
+// matchAny retorna true si el valor coincide con alguno de los patrones (lista vacía = cualquiera)
+func matchAny(patrones []string, valor string) bool {
+	if len(patrones) == 0 {
+		return true
+	}
+	valor = strings.ToUpper(strings.TrimSpace(valor))
+	for _, patron := range patrones {
+		patron = strings.ToUpper(strings.TrimSpace(patron))
+		if patron == "*" || patron == valor {
+			return true
+		}
+		if ok, err := path.Match(patron, valor); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func patternList(patrones []string) string {
+	if len(patrones) == 0 {
+		return "*"
+	}
+	return "{" + strings.Join(patrones, ",") + "}"
+}
@@ -0,0 +1,12 @@
+package models
+
+// SalidaRate es el ritmo actual de una salida frente a su límite configurado
+type SalidaRate struct {
+	SalidaID   int     `json:"salida_id"`
+	MaxRate    int     `json:"max_rate"`   // Cajas por minuto (0 = sin límite)
+	Burst      int     `json:"burst"`      // Cajas que pueden llegar seguidas por sobre el ritmo
+	Rate       float64 `json:"rate"`       // Cajas enviadas en el último minuto
+	Tokens     float64 `json:"tokens"`     // Cajas que puede recibir ahora sin exceder el ritmo
+	Saturacion float64 `json:"saturacion"` // Rate / MaxRate (0 si no hay límite)
+	Saturada   bool    `json:"saturada"`   // true si la salida no puede recibir más cajas por ritmo
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ShadowRoutingConfig define la configuración candidata que se evalúa en sombra (sin enviar al PLC).
+// Los campos vacíos usan la configuración real del sorter.
+type ShadowRoutingConfig struct {
+	Strategy      string            `json:"strategy"`       // Estrategia candidata (vacío = batch_round_robin)
+	SKUStrategies map[string]string `json:"sku_strategies"` // Overrides por SKU
+	Weights       map[int]int       `json:"weights"`        // Pesos por salida para "weighted" (nil = pesos reales)
+	Assignments   map[int][]string  `json:"assignments"`    // Asignaciones candidatas salidaID → SKUs (nil = asignaciones reales)
+}
+
+// ShadowDivergence registra una caja donde la decisión en sombra difiere de la real
+type ShadowDivergence struct {
+	SorterID       int       `json:"sorter_id"`
+	Correlativo    string    `json:"correlativo"`
+	SKU            string    `json:"sku"`
+	LiveSalidaID   int       `json:"live_salida_id"`
+	LiveSalida     string    `json:"live_salida"`
+	ShadowSalidaID int       `json:"shadow_salida_id"` // 0 = sin salida disponible en sombra
+	ShadowSalida   string    `json:"shadow_salida"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// String implementa fmt.Stringer
+func (d ShadowDivergence) String() string {
+	return fmt.Sprintf("Caja %s (SKU %s): real → salida %d, sombra → salida %d",
+		d.Correlativo, d.SKU, d.LiveSalidaID, d.ShadowSalidaID)
+}
+
+// ShadowRoutingStatus resume el estado del ruteo en sombra de un sorter
+type ShadowRoutingStatus struct {
+	SorterID     int                  `json:"sorter_id"`
+	Enabled      bool                 `json:"enabled"`
+	Config       *ShadowRoutingConfig `json:"config,omitempty"`
+	Desde        *time.Time           `json:"desde,omitempty"`
+	Evaluadas    int64                `json:"evaluadas"`
+	Divergencias int64                `json:"divergencias"`
+	Porcentaje   float64              `json:"porcentaje_divergencia"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// SorterState es el estado de pausa de un sorter
+type SorterState struct {
+	SorterID       int    `json:"sorter_id"`
+	Pausado        bool   `json:"pausado"`
+	Motivo         string `json:"motivo,omitempty"`
+	Desde          string `json:"desde,omitempty"`
+	CamarasOffline bool   `json:"camaras_offline"`         // Cámaras QR puestas offline por la pausa
+	ErrorCamaras   string `json:"error_camaras,omitempty"` // Último error al cambiar el estado de las cámaras
+}
+
+// SorterPauseRequest es el body de POST /sorter/:sorter_id/pause
+type SorterPauseRequest struct {
+	Motivo string `json:"motivo"` // Motivo de la pausa (ej: "cambio de turno")
+}
@@ -40,7 +40,8 @@ func (m *DeviceMonitor) RegisterDevice(device *models.DeviceStatus) {
 	defer m.devicesMu.Unlock()
 
 	device.LastCheck = time.Now()
-	device.IsDisconnected = false
+	// Los dispositivos con estado informado quedan desconectados hasta su primer reporte
+	device.IsDisconnected = device.Reported
 	m.devices[device.ID] = device
 
 	log.Printf("📡 Dispositivo registrado para monitoreo: %s (%s:%d) en sección %d",
@@ -95,8 +96,47 @@ func (m *DeviceMonitor) checkAllDevices() {
 	wg.Wait()
 }
 
+// ReportConnection actualiza el estado de un dispositivo cuya conexión mantiene el propio servicio
+// (ej: cámara Cognex en modo cliente). Estos dispositivos no se chequean con heartbeat TCP.
+func (m *DeviceMonitor) ReportConnection(deviceID int, connected bool, err error) {
+	m.devicesMu.Lock()
+	defer m.devicesMu.Unlock()
+
+	device, exists := m.devices[deviceID]
+	if !exists {
+		return
+	}
+
+	now := time.Now()
+	device.LastCheck = now
+	device.LastError = ""
+	if err != nil {
+		device.LastError = err.Error()
+	}
+
+	if connected {
+		if device.IsDisconnected {
+			log.Printf("✅ Dispositivo reconectado: %s (%s:%d)", device.DeviceName, device.IP, device.Port)
+		}
+		device.IsDisconnected = false
+		return
+	}
+
+	if !device.IsDisconnected {
+		device.LastDisconnection = &now
+		device.IsDisconnected = true
+		log.Printf("❌ Dispositivo desconectado: %s (%s:%d) - Error: %v",
+			device.DeviceName, device.IP, device.Port, err)
+	}
+}
+
 // checkDevice verifica el estado de un dispositivo usando TCP dial
 func (m *DeviceMonitor) checkDevice(device *models.DeviceStatus) {
+	if device.Reported {
+		// Estado informado por ReportConnection: un dial extra podría ocupar la única conexión del equipo
+		return
+	}
+
 	address := net.JoinHostPort(device.IP, fmt.Sprintf("%d", device.Port))
 	start := time.Now()
 
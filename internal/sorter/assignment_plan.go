@@ -0,0 +1,233 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/db"
+	"API-GREENEX/internal/listeners"
+	"API-GREENEX/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Ventana máxima tras el inicio de un turno para aplicar un plan (ej: si la API estuvo caída)
+const assignmentPlanShiftGrace = 15 * time.Minute
+
+// SetShifts configura los turnos de planta (nombre → hora de inicio desde medianoche)
+func (s *Sorter) SetShifts(turnos map[string]time.Duration) {
+	s.planMutex.Lock()
+	defer s.planMutex.Unlock()
+	s.turnos = turnos
+}
+
+// ValidateAssignmentPlan verifica que el turno exista y que las salidas pertenezcan al sorter
+func (s *Sorter) ValidateAssignmentPlan(plan models.AssignmentPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	if plan.SorterID != s.ID {
+		return fmt.Errorf("el plan pertenece al sorter #%d, no al #%d", plan.SorterID, s.ID)
+	}
+	if plan.Turno != "" {
+		s.planMutex.Lock()
+		_, exists := s.turnos[plan.Turno]
+		s.planMutex.Unlock()
+		if !exists {
+			return fmt.Errorf("turno '%s' no configurado", plan.Turno)
+		}
+	}
+	for _, item := range plan.Items {
+		if s.findSalidaByID(item.SalidaID) == nil {
+			return fmt.Errorf("la salida %d no pertenece al sorter #%d", item.SalidaID, s.ID)
+		}
+	}
+	return nil
+}
+
+// startAssignmentPlanScheduler revisa periódicamente los planes activos y aplica los que vencen
+func (s *Sorter) startAssignmentPlanScheduler(interval time.Duration) {
+	log.Printf("🗓️  Sorter #%d: Programador de planes de asignación iniciado (cada %v)", s.ID, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Printf("⏸️  Sorter #%d: Programador de planes de asignación detenido", s.ID)
+			return
+		case now := <-ticker.C:
+			s.checkAssignmentPlans(now)
+		}
+	}
+}
+
+// checkAssignmentPlans aplica los planes cuyo disparo (fecha o inicio de turno) ya ocurrió
+func (s *Sorter) checkAssignmentPlans(now time.Time) {
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok || pgManager == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	plans, err := pgManager.GetActiveAssignmentPlans(ctx, s.ID)
+	cancel()
+	if err != nil {
+		log.Printf("⚠️  Sorter #%d: Error al consultar planes de asignación: %v", s.ID, err)
+		return
+	}
+
+	for _, plan := range plans {
+		disparo, due := s.assignmentPlanDue(plan, now)
+		if !due {
+			continue
+		}
+
+		log.Printf("🗓️  Sorter #%d: Aplicando plan de asignación #%d '%s' (disparo: %s)", s.ID, plan.ID, plan.Nombre, disparo)
+		if _, err := s.ApplyAssignmentPlan(s.ctx, plan, disparo); err != nil {
+			log.Printf("❌ Sorter #%d: Error al aplicar plan #%d: %v", s.ID, plan.ID, err)
+		}
+	}
+}
+
+// assignmentPlanDue indica si el plan debe aplicarse ahora y qué lo disparó
+func (s *Sorter) assignmentPlanDue(plan models.AssignmentPlan, now time.Time) (string, bool) {
+	if plan.EjecutarEn != nil {
+		return "fecha", plan.UltimaEjecucion == nil && !now.Before(*plan.EjecutarEn)
+	}
+
+	s.planMutex.Lock()
+	offset, exists := s.turnos[plan.Turno]
+	s.planMutex.Unlock()
+	if !exists {
+		return "turno", false
+	}
+
+	// Inicio de turno más reciente (hoy o ayer)
+	local := now.Local()
+	inicio := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()).Add(offset)
+	if inicio.After(local) {
+		inicio = inicio.AddDate(0, 0, -1)
+	}
+
+	if local.Sub(inicio) > assignmentPlanShiftGrace {
+		return "turno", false
+	}
+
+	// No aplicar dos veces el mismo turno ni turnos anteriores a la creación del plan
+	referencia := plan.FechaCreacion
+	if plan.UltimaEjecucion != nil {
+		referencia = *plan.UltimaEjecucion
+	}
+	return "turno", inicio.After(referencia)
+}
+
+// ApplyAssignmentPlan aplica un plan de asignación usando las mismas operaciones que la API manual,
+// persiste las asignaciones en salida_sku y publica el resultado en el WebSocket assignment_N
+func (s *Sorter) ApplyAssignmentPlan(ctx context.Context, plan models.AssignmentPlan, disparo string) (*models.AssignmentPlanResult, error) {
+	if err := s.ValidateAssignmentPlan(plan); err != nil {
+		return nil, err
+	}
+
+	// Un plan a la vez por sorter
+	s.planApplyMutex.Lock()
+	defer s.planApplyMutex.Unlock()
+
+	pgManager, _ := s.dbManager.(*db.PostgresManager)
+
+	result := &models.AssignmentPlanResult{
+		PlanID:     plan.ID,
+		SorterID:   s.ID,
+		Nombre:     plan.Nombre,
+		Disparo:    disparo,
+		AplicadoEn: time.Now(),
+		Cambios:    make([]models.AssignmentPlanChange, 0),
+	}
+
+	for _, item := range plan.Items {
+		if item.Limpiar {
+			cambio := models.AssignmentPlanChange{SalidaID: item.SalidaID, Accion: "limpiar"}
+			if _, err := s.RemoveAllSKUsFromSalida(item.SalidaID); err != nil {
+				cambio.Error = err.Error()
+			} else if pgManager != nil {
+				if _, err := pgManager.DeleteAllSalidaSKUs(ctx, item.SalidaID); err != nil {
+					cambio.Error = err.Error()
+				} else if err := pgManager.InsertSalidaSKU(ctx, item.SalidaID, "REJECT", "REJECT", "REJECT", 0, "1"); err != nil {
+					log.Printf("⚠️  Sorter #%d: Error al re-insertar REJECT en salida %d: %v", s.ID, item.SalidaID, err)
+				}
+			}
+			result.Cambios = append(result.Cambios, cambio)
+		}
+
+		for _, skuID := range item.SKUIDs {
+			cambio := models.AssignmentPlanChange{SalidaID: item.SalidaID, Accion: "asignar", SKUID: skuID}
+			if targetSKU := s.findSKUByID(skuID); targetSKU != nil {
+				cambio.SKU = targetSKU.SKU
+			}
+
+			calibre, variedad, embalaje, dark, linea, err := s.AssignSKUToSalida(skuID, item.SalidaID)
+			if err != nil {
+				cambio.Error = err.Error()
+			} else if skuID != 0 && pgManager != nil {
+				// REJECT (ID=0) solo existe en memoria, no en BD
+				if err := pgManager.InsertSalidaSKU(ctx, item.SalidaID, calibre, variedad, embalaje, dark, linea); err != nil {
+					cambio.Error = err.Error()
+				}
+			}
+			result.Cambios = append(result.Cambios, cambio)
+		}
+	}
+
+	for _, cambio := range result.Cambios {
+		if cambio.Error != "" {
+			result.Errores++
+		}
+	}
+
+	if result.Errores > 0 {
+		log.Printf("⚠️  Sorter #%d: Plan #%d '%s' aplicado con %d error(es) de %d cambio(s)",
+			s.ID, plan.ID, plan.Nombre, result.Errores, len(result.Cambios))
+	} else {
+		log.Printf("✅ Sorter #%d: Plan #%d '%s' aplicado (%d cambio(s))", s.ID, plan.ID, plan.Nombre, len(result.Cambios))
+	}
+
+	if pgManager != nil && plan.ID > 0 {
+		if err := pgManager.MarkAssignmentPlanApplied(ctx, plan.ID, result.AplicadoEn, result.Summary()); err != nil {
+			log.Printf("⚠️  Sorter #%d: %v", s.ID, err)
+		}
+	}
+
+	s.PublishAssignmentPlanEvent(result)
+	return result, nil
+}
+
+// PublishAssignmentPlanEvent publica al WebSocket los cambios aplicados por un plan
+func (s *Sorter) PublishAssignmentPlanEvent(result *models.AssignmentPlanResult) {
+	if s.wsHub == nil {
+		return
+	}
+
+	message := map[string]interface{}{
+		"type":        "assignment_plan_applied",
+		"sorter_id":   s.ID,
+		"plan_id":     result.PlanID,
+		"nombre":      result.Nombre,
+		"disparo":     result.Disparo,
+		"aplicado_en": result.AplicadoEn.Format(time.RFC3339),
+		"cambios":     result.Cambios,
+		"errores":     result.Errores,
+	}
+
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Error al serializar assignment_plan_applied: %v", err)
+		return
+	}
+
+	roomName := fmt.Sprintf("assignment_%d", s.ID)
+	s.wsHub.Broadcast <- &listeners.BroadcastMessage{
+		RoomName: roomName,
+		Message:  jsonBytes,
+	}
+}
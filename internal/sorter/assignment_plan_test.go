@@ -0,0 +1,140 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"testing"
+	"time"
+)
+
+func TestAssignmentPlanDue(t *testing.T) {
+	hora := func(dia, h, m int) time.Time { return time.Date(2026, 3, dia, h, m, 0, 0, time.Local) }
+	ptr := func(t time.Time) *time.Time { return &t }
+	creado := hora(1, 12, 0)
+
+	casos := []struct {
+		nombre  string
+		plan    models.AssignmentPlan
+		now     time.Time
+		disparo string
+		due     bool
+	}{
+		{
+			nombre:  "fecha vencida sin ejecutar",
+			plan:    models.AssignmentPlan{EjecutarEn: ptr(hora(10, 6, 0))},
+			now:     hora(10, 6, 0),
+			disparo: "fecha",
+			due:     true,
+		},
+		{
+			nombre:  "fecha futura",
+			plan:    models.AssignmentPlan{EjecutarEn: ptr(hora(10, 6, 0))},
+			now:     hora(10, 5, 59),
+			disparo: "fecha",
+		},
+		{
+			nombre:  "fecha ya ejecutada",
+			plan:    models.AssignmentPlan{EjecutarEn: ptr(hora(10, 6, 0)), UltimaEjecucion: ptr(hora(10, 6, 1))},
+			now:     hora(10, 7, 0),
+			disparo: "fecha",
+		},
+		{
+			nombre:  "inicio de turno",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: creado},
+			now:     hora(10, 6, 0).Add(time.Second),
+			disparo: "turno",
+			due:     true,
+		},
+		{
+			nombre:  "dentro de la ventana de gracia",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: creado},
+			now:     hora(10, 6, 15),
+			disparo: "turno",
+			due:     true,
+		},
+		{
+			nombre:  "fuera de la ventana de gracia",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: creado},
+			now:     hora(10, 6, 16),
+			disparo: "turno",
+		},
+		{
+			nombre:  "antes del turno de hoy no repite el de ayer",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: creado},
+			now:     hora(10, 5, 59),
+			disparo: "turno",
+		},
+		{
+			nombre:  "turno ya aplicado",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: creado, UltimaEjecucion: ptr(hora(10, 6, 1))},
+			now:     hora(10, 6, 5),
+			disparo: "turno",
+		},
+		{
+			nombre:  "aplicado en el turno anterior",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: creado, UltimaEjecucion: ptr(hora(9, 6, 1))},
+			now:     hora(10, 6, 5),
+			disparo: "turno",
+			due:     true,
+		},
+		{
+			nombre:  "plan creado después del inicio del turno",
+			plan:    models.AssignmentPlan{Turno: "mañana", FechaCreacion: hora(10, 6, 2)},
+			now:     hora(10, 6, 5),
+			disparo: "turno",
+		},
+		{
+			nombre:  "turno que empezó ayer antes de medianoche",
+			plan:    models.AssignmentPlan{Turno: "noche", FechaCreacion: creado},
+			now:     hora(10, 0, 5),
+			disparo: "turno",
+			due:     true,
+		},
+		{
+			nombre:  "turno no configurado",
+			plan:    models.AssignmentPlan{Turno: "tarde", FechaCreacion: creado},
+			now:     hora(10, 14, 0),
+			disparo: "turno",
+		},
+	}
+
+	s := newTestSorter(t)
+	s.SetShifts(map[string]time.Duration{
+		"mañana": 6 * time.Hour,
+		"noche":  23*time.Hour + 55*time.Minute,
+	})
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			disparo, due := s.assignmentPlanDue(caso.plan, caso.now)
+			if disparo != caso.disparo || due != caso.due {
+				t.Errorf("assignmentPlanDue = (%s, %v), esperado (%s, %v)", disparo, due, caso.disparo, caso.due)
+			}
+		})
+	}
+}
+
+func TestValidateAssignmentPlan(t *testing.T) {
+	s := newTestSorter(t, salidaFixture{id: 1})
+	s.SetShifts(map[string]time.Duration{"mañana": 6 * time.Hour})
+	item := []models.AssignmentPlanItem{{SalidaID: 1, Limpiar: true}}
+
+	casos := []struct {
+		nombre string
+		plan   models.AssignmentPlan
+		valido bool
+	}{
+		{"plan por turno", models.AssignmentPlan{SorterID: s.ID, Nombre: "p", Turno: "mañana", Items: item}, true},
+		{"turno no configurado", models.AssignmentPlan{SorterID: s.ID, Nombre: "p", Turno: "tarde", Items: item}, false},
+		{"otro sorter", models.AssignmentPlan{SorterID: s.ID + 1, Nombre: "p", Turno: "mañana", Items: item}, false},
+		{"salida de otro sorter", models.AssignmentPlan{SorterID: s.ID, Nombre: "p", Turno: "mañana",
+			Items: []models.AssignmentPlanItem{{SalidaID: 2, Limpiar: true}}}, false},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if err := s.ValidateAssignmentPlan(caso.plan); (err == nil) != caso.valido {
+				t.Errorf("ValidateAssignmentPlan = %v, esperado válido=%v", err, caso.valido)
+			}
+		})
+	}
+}
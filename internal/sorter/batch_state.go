@@ -0,0 +1,243 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/db"
+	"API-GREENEX/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// markBatchDirty marca el estado de balance de un SKU como pendiente de persistir.
+// Debe llamarse con batchMutex tomado.
+func (s *Sorter) markBatchDirty(sku string) {
+	s.batchDirty[sku] = true
+	delete(s.batchDeleted, sku)
+}
+
+// markBatchDeleted marca el estado de balance de un SKU como pendiente de eliminar.
+// Debe llamarse con batchMutex tomado.
+func (s *Sorter) markBatchDeleted(sku string) {
+	s.batchDeleted[sku] = true
+	delete(s.batchDirty, sku)
+}
+
+// RestoreBatchStates restaura desde PostgreSQL el estado del balance por batch del sorter
+func (s *Sorter) RestoreBatchStates(ctx context.Context) error {
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok || pgManager == nil {
+		return fmt.Errorf("dbManager no es un PostgresManager válido")
+	}
+
+	states, err := pgManager.LoadBatchStates(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+
+	s.batchMutex.Lock()
+	defer s.batchMutex.Unlock()
+
+	for _, state := range states {
+		s.batchCounters[state.SKU] = &BatchDistributor{
+			Salidas:      state.Salidas,
+			CurrentIndex: state.CurrentIndex,
+			CurrentCount: state.CurrentCount,
+		}
+	}
+
+	log.Printf("⚖️  Sorter #%d: %d estado(s) de balance restaurado(s) desde BD", s.ID, len(states))
+	return nil
+}
+
+// startBatchStatePersister guarda periódicamente en PostgreSQL los balances modificados
+func (s *Sorter) startBatchStatePersister(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := s.flushBatchStates(ctx); err != nil {
+				log.Printf("⚠️  Sorter #%d: Error al persistir estado de balance: %v", s.ID, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// flushBatchStates persiste los cambios pendientes del balance por batch
+func (s *Sorter) flushBatchStates(ctx context.Context) error {
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok || pgManager == nil {
+		return nil
+	}
+
+	s.batchMutex.Lock()
+	if len(s.batchDirty) == 0 && len(s.batchDeleted) == 0 {
+		s.batchMutex.Unlock()
+		return nil
+	}
+
+	states := make([]models.BatchState, 0, len(s.batchDirty))
+	for sku := range s.batchDirty {
+		if bd, exists := s.batchCounters[sku]; exists {
+			states = append(states, models.BatchState{
+				SorterID:     s.ID,
+				SKU:          sku,
+				Salidas:      append([]int(nil), bd.Salidas...),
+				CurrentIndex: bd.CurrentIndex,
+				CurrentCount: bd.CurrentCount,
+			})
+		}
+	}
+	deleted := make([]string, 0, len(s.batchDeleted))
+	for sku := range s.batchDeleted {
+		deleted = append(deleted, sku)
+	}
+	pendingDirty, pendingDeleted := s.batchDirty, s.batchDeleted
+	s.batchDirty = make(map[string]bool)
+	s.batchDeleted = make(map[string]bool)
+	s.batchMutex.Unlock()
+
+	if err := pgManager.SaveBatchStates(ctx, s.ID, states, deleted); err != nil {
+		// Reencolar los cambios para el próximo intento (sin pisar cambios más recientes)
+		s.batchMutex.Lock()
+		for sku := range pendingDirty {
+			if !s.batchDeleted[sku] {
+				s.batchDirty[sku] = true
+			}
+		}
+		for sku := range pendingDeleted {
+			if !s.batchDirty[sku] {
+				s.batchDeleted[sku] = true
+			}
+		}
+		s.batchMutex.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// GetBatchStates retorna una foto del estado actual del balance por batch
+func (s *Sorter) GetBatchStates() []models.BatchState {
+	s.batchMutex.RLock()
+	defer s.batchMutex.RUnlock()
+
+	states := make([]models.BatchState, 0, len(s.batchCounters))
+	for sku, bd := range s.batchCounters {
+		states = append(states, models.BatchState{
+			SorterID:     s.ID,
+			SKU:          sku,
+			Salidas:      append([]int(nil), bd.Salidas...),
+			CurrentIndex: bd.CurrentIndex,
+			CurrentCount: bd.CurrentCount,
+		})
+	}
+	return states
+}
+
+// batchIndex retorna el índice actual del balance de un SKU (nil si no tiene balance activo)
+func (s *Sorter) batchIndex(sku string) *int {
+	s.batchMutex.RLock()
+	defer s.batchMutex.RUnlock()
+
+	bd, exists := s.batchCounters[sku]
+	if !exists {
+		return nil
+	}
+	idx := bd.CurrentIndex
+	return &idx
+}
+
+// ResetBatchDistributor reinicia el balance de un SKU (o de todos si sku == "")
+// en memoria y en PostgreSQL
+func (s *Sorter) ResetBatchDistributor(ctx context.Context, sku string) error {
+	s.batchMutex.Lock()
+	if sku == "" {
+		for key := range s.batchCounters {
+			s.markBatchDeleted(key)
+		}
+		s.batchCounters = make(map[string]*BatchDistributor)
+	} else {
+		if _, exists := s.batchCounters[sku]; !exists {
+			s.batchMutex.Unlock()
+			return fmt.Errorf("SKU '%s' sin estado de balance en sorter #%d", sku, s.ID)
+		}
+		delete(s.batchCounters, sku)
+		s.markBatchDeleted(sku)
+	}
+	s.batchMutex.Unlock()
+
+	if sku == "" {
+		log.Printf("⚖️  Sorter #%d: Balance reiniciado para todos los SKUs", s.ID)
+	} else {
+		log.Printf("⚖️  Sorter #%d: Balance reiniciado para SKU '%s'", s.ID, sku)
+	}
+
+	// Si falla la escritura, el persistidor periódico reintenta con los cambios reencolados
+	if err := s.flushBatchStates(ctx); err != nil {
+		log.Printf("⚠️  Sorter #%d: Error al persistir reinicio de balance (se reintentará): %v", s.ID, err)
+	}
+	return nil
+}
+
+// pruneBatchCounters elimina el balance de SKUs que ya no están activos
+func (s *Sorter) pruneBatchCounters(skus []models.SKUAssignable) {
+	activos := make(map[string]bool, len(skus))
+	for _, sku := range skus {
+		activos[sku.SKU] = true
+	}
+
+	s.batchMutex.Lock()
+	defer s.batchMutex.Unlock()
+
+	for sku := range s.batchCounters {
+		if sku == "REJECT" || activos[sku] {
+			continue
+		}
+		delete(s.batchCounters, sku)
+		s.markBatchDeleted(sku)
+	}
+}
+
+// syncBatchSalidas alinea el distribuidor con las salidas candidatas actuales.
+// Si cambió el conjunto de salidas, mantiene el batch en curso cuando la salida actual sigue presente.
+// Debe llamarse con batchMutex tomado.
+func (bd *BatchDistributor) syncBatchSalidas(ids []int) bool {
+	if equalInts(bd.Salidas, ids) {
+		return false
+	}
+
+	newIndex, newCount := 0, 0
+	if bd.CurrentIndex >= 0 && bd.CurrentIndex < len(bd.Salidas) {
+		actual := bd.Salidas[bd.CurrentIndex]
+		for i, id := range ids {
+			if id == actual {
+				newIndex, newCount = i, bd.CurrentCount
+				break
+			}
+		}
+	}
+
+	bd.Salidas = ids
+	bd.CurrentIndex = newIndex
+	bd.CurrentCount = newCount
+	return true
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/db"
+	"context"
+	"testing"
+)
+
+func TestSyncBatchSalidas(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		salidas   []int
+		index     int
+		count     int
+		nuevas    []int
+		cambio    bool
+		esperadoI int
+		esperadoC int
+	}{
+		{"mismas salidas", []int{1, 2, 3}, 1, 2, []int{1, 2, 3}, false, 1, 2},
+		{"salida actual sigue presente", []int{1, 2, 3}, 1, 2, []int{2, 3}, true, 0, 2},
+		{"salida agregada", []int{1, 2}, 1, 1, []int{1, 2, 3}, true, 1, 1},
+		{"salida actual quitada", []int{1, 2, 3}, 1, 2, []int{1, 3}, true, 0, 0},
+		{"índice fuera de rango", []int{1, 2}, 5, 1, []int{1, 3}, true, 0, 0},
+		{"distribuidor nuevo", nil, 0, 0, []int{4, 5}, true, 0, 0},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			bd := &BatchDistributor{Salidas: caso.salidas, CurrentIndex: caso.index, CurrentCount: caso.count}
+			if cambio := bd.syncBatchSalidas(caso.nuevas); cambio != caso.cambio {
+				t.Errorf("cambio = %v, esperado %v", cambio, caso.cambio)
+			}
+			if !equalInts(bd.Salidas, caso.nuevas) || bd.CurrentIndex != caso.esperadoI || bd.CurrentCount != caso.esperadoC {
+				t.Errorf("distribuidor = %+v, esperado salidas %v, índice %d, cuenta %d",
+					bd, caso.nuevas, caso.esperadoI, caso.esperadoC)
+			}
+		})
+	}
+}
+
+// TestFlushBatchStatesReencolaAlFallar verifica que un error de BD deje los cambios pendientes
+// para el próximo intento del persistidor
+func TestFlushBatchStatesReencolaAlFallar(t *testing.T) {
+	s := newTestSorter(t)
+	s.dbManager = &db.PostgresManager{} // sin pool: SaveBatchStates siempre falla
+
+	s.batchMutex.Lock()
+	s.batchCounters["A"] = &BatchDistributor{Salidas: []int{1, 2}}
+	s.markBatchDirty("A")
+	s.markBatchDeleted("B")
+	s.batchMutex.Unlock()
+
+	if err := s.flushBatchStates(context.Background()); err == nil {
+		t.Fatal("flushBatchStates sin error con la BD caída")
+	}
+
+	s.batchMutex.RLock()
+	defer s.batchMutex.RUnlock()
+	if !s.batchDirty["A"] || len(s.batchDirty) != 1 {
+		t.Errorf("pendientes de guardar = %v, esperado [A]", s.batchDirty)
+	}
+	if !s.batchDeleted["B"] || len(s.batchDeleted) != 1 {
+		t.Errorf("pendientes de eliminar = %v, esperado [B]", s.batchDeleted)
+	}
+}
+
+func TestResetBatchDistributorSinBD(t *testing.T) {
+	s := newTestSorter(t)
+	s.dbManager = &db.PostgresManager{}
+
+	s.batchMutex.Lock()
+	s.batchCounters["A"] = &BatchDistributor{Salidas: []int{1, 2}, CurrentIndex: 1}
+	s.batchCounters["B"] = &BatchDistributor{Salidas: []int{3}}
+	s.batchMutex.Unlock()
+
+	if err := s.ResetBatchDistributor(context.Background(), "C"); err == nil {
+		t.Error("reinicio de SKU sin balance sin error")
+	}
+	if err := s.ResetBatchDistributor(context.Background(), "A"); err != nil {
+		t.Fatalf("ResetBatchDistributor: %v", err)
+	}
+	if s.batchIndex("A") != nil || s.batchIndex("B") == nil {
+		t.Errorf("balance tras reinicio = %+v, esperado solo B", s.GetBatchStates())
+	}
+	// La BD caída no pierde el reinicio: queda pendiente para el persistidor
+	s.batchMutex.RLock()
+	defer s.batchMutex.RUnlock()
+	if !s.batchDeleted["A"] {
+		t.Errorf("reinicio de A no quedó pendiente de eliminar: %v", s.batchDeleted)
+	}
+}
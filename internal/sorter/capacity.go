@@ -0,0 +1,198 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/communication/pallet"
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"context"
+	"log"
+	"time"
+)
+
+// ConfigureCapacity habilita el ruteo por capacidad usando el llenado de mesas de Serfruit
+func (s *Sorter) ConfigureCapacity(enabled bool, pollInterval, staleAfter time.Duration, holdBackRemaining int) {
+	s.capacityMutex.Lock()
+	defer s.capacityMutex.Unlock()
+
+	s.capacityEnabled = enabled
+	s.capacityPollInterval = pollInterval
+	s.capacityStaleAfter = staleAfter
+	s.holdBackRemaining = holdBackRemaining
+
+	if enabled {
+		log.Printf("📦 Sorter #%d: Ruteo por capacidad habilitado (poll=%v, retener con <= %d cajas restantes)",
+			s.ID, pollInterval, holdBackRemaining)
+	}
+}
+
+// needsMesaFill indica si hay que consultar el llenado de mesas (capacidad o estrategia least_filled)
+func (s *Sorter) needsMesaFill() bool {
+	s.capacityMutex.RLock()
+	enabled := s.capacityEnabled
+	s.capacityMutex.RUnlock()
+	if enabled {
+		return true
+	}
+
+	s.routingMutex.RLock()
+	defer s.routingMutex.RUnlock()
+	if s.routingStrategy != nil && s.routingStrategy.Name() == StrategyLeastFilled {
+		return true
+	}
+	for _, strategy := range s.skuStrategies {
+		if strategy.Name() == StrategyLeastFilled {
+			return true
+		}
+	}
+	return false
+}
+
+// startMesaFillPoller consulta periódicamente el llenado del pallet de cada salida automática
+func (s *Sorter) startMesaFillPoller() {
+	if s.mesaClient == nil {
+		log.Printf("⚠️  Sorter #%d: Sin servidor de paletizado configurado, llenado de mesas deshabilitado", s.ID)
+		return
+	}
+
+	s.capacityMutex.RLock()
+	interval := s.capacityPollInterval
+	s.capacityMutex.RUnlock()
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	log.Printf("📦 Sorter #%d: Monitor de llenado de mesas iniciado (cada %v)", s.ID, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.pollMesaFills()
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Printf("⏸️  Sorter #%d: Monitor de llenado de mesas detenido", s.ID)
+			return
+		case <-ticker.C:
+			s.pollMesaFills()
+		}
+	}
+}
+
+// pollMesaFills actualiza el caché de llenado para todas las salidas automáticas con mesa
+func (s *Sorter) pollMesaFills() {
+	s.capacityMutex.RLock()
+	holdBackRemaining := s.holdBackRemaining
+	s.capacityMutex.RUnlock()
+
+	for i := range s.Salidas {
+		salida := &s.Salidas[i]
+		if salida.Tipo != "automatico" || salida.MesaID <= 0 {
+			continue
+		}
+
+		fill := models.MesaFill{
+			SalidaID:  salida.ID,
+			MesaID:    salida.MesaID,
+			UpdatedAt: time.Now(),
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, time.Second)
+		estados, err := s.mesaClient.GetEstadoMesa(ctx, salida.MesaID)
+		cancel()
+
+		switch {
+		case err == pallet.ErrMesaNoActiva:
+			fill.Error = "mesa sin orden de fabricación activa"
+		case err != nil:
+			fill.Error = err.Error()
+		case len(estados) == 0 || estados[0].DatosPaletizado.CajasPorPale <= 0:
+			fill.Error = "sin datos de paletizado"
+		default:
+			estado := estados[0]
+			fill.CajasEnPale = estado.DatosProduccion.NumeroCajasEnPale
+			fill.CajasPorPale = estado.DatosPaletizado.CajasPorPale
+			fill.Restantes = fill.CajasPorPale - fill.CajasEnPale
+			if fill.Restantes < 0 {
+				fill.Restantes = 0
+			}
+			fill.Ratio = float64(fill.CajasEnPale) / float64(fill.CajasPorPale)
+			fill.HoldBack = fill.Restantes <= holdBackRemaining
+		}
+
+		s.capacityMutex.Lock()
+		previo, existe := s.mesaFills[salida.ID]
+		s.mesaFills[salida.ID] = fill
+		s.capacityMutex.Unlock()
+
+		if fill.HoldBack && (!existe || !previo.HoldBack) {
+			log.Printf("⏳ Sorter #%d: Salida %d retenida (mesa %d con %d/%d cajas, cambio de pallet inminente)",
+				s.ID, salida.ID, salida.MesaID, fill.CajasEnPale, fill.CajasPorPale)
+		} else if !fill.HoldBack && existe && previo.HoldBack {
+			log.Printf("✅ Sorter #%d: Salida %d liberada (mesa %d con %d/%d cajas)",
+				s.ID, salida.ID, salida.MesaID, fill.CajasEnPale, fill.CajasPorPale)
+		}
+	}
+}
+
+// mesaFill retorna el llenado cacheado de la mesa de una salida (ok=false si no hay dato vigente)
+func (s *Sorter) mesaFill(salida *shared.Salida) (models.MesaFill, bool) {
+	s.capacityMutex.RLock()
+	defer s.capacityMutex.RUnlock()
+
+	fill, exists := s.mesaFills[salida.ID]
+	if !exists || fill.Error != "" {
+		return fill, false
+	}
+
+	staleAfter := s.capacityStaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 10 * time.Second
+	}
+	if time.Since(fill.UpdatedAt) > staleAfter {
+		return fill, false
+	}
+	return fill, true
+}
+
+// GetMesaFills retorna el caché de llenado de mesas del sorter
+func (s *Sorter) GetMesaFills() []models.MesaFill {
+	s.capacityMutex.RLock()
+	defer s.capacityMutex.RUnlock()
+
+	fills := make([]models.MesaFill, 0, len(s.mesaFills))
+	for i := range s.Salidas {
+		if fill, exists := s.mesaFills[s.Salidas[i].ID]; exists {
+			fills = append(fills, fill)
+		}
+	}
+	return fills
+}
+
+// filtrarPorCapacidad descarta las salidas retenidas por cambio de pallet inminente.
+// Si todas las salidas disponibles están retenidas, se mantienen las candidatas originales
+// para no forzar el envío a REJECT.
+func (s *Sorter) filtrarPorCapacidad(candidatas []*shared.Salida) []*shared.Salida {
+	s.capacityMutex.RLock()
+	enabled := s.capacityEnabled
+	s.capacityMutex.RUnlock()
+	if !enabled || len(candidatas) < 2 {
+		return candidatas
+	}
+
+	filtradas := make([]*shared.Salida, 0, len(candidatas))
+	hayDisponible := false
+	for _, salida := range candidatas {
+		if fill, ok := s.mesaFill(salida); ok && fill.HoldBack {
+			continue
+		}
+		filtradas = append(filtradas, salida)
+		if salida.IsAvailable() {
+			hayDisponible = true
+		}
+	}
+
+	if !hayDisponible {
+		return candidatas
+	}
+	return filtradas
+}
@@ -0,0 +1,86 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFiltrarPorCapacidad(t *testing.T) {
+	casos := []struct {
+		nombre      string
+		deshabilita bool
+		salidas     []salidaFixture
+		fills       map[int]models.MesaFill // key=salidaID (UpdatedAt vacío = dato vigente)
+		esperado    []int
+	}{
+		{
+			nombre:      "capacidad deshabilitada",
+			deshabilita: true,
+			salidas:     []salidaFixture{{id: 1}, {id: 2}},
+			fills:       map[int]models.MesaFill{1: {HoldBack: true}},
+			esperado:    []int{1, 2},
+		},
+		{
+			nombre:   "candidata única",
+			salidas:  []salidaFixture{{id: 1}},
+			fills:    map[int]models.MesaFill{1: {HoldBack: true}},
+			esperado: []int{1},
+		},
+		{
+			nombre:   "salida retenida se descarta",
+			salidas:  []salidaFixture{{id: 1}, {id: 2}, {id: 3}},
+			fills:    map[int]models.MesaFill{1: {HoldBack: true}, 2: {HoldBack: false}},
+			esperado: []int{2, 3},
+		},
+		{
+			nombre:   "todas retenidas mantiene las originales",
+			salidas:  []salidaFixture{{id: 1}, {id: 2}},
+			fills:    map[int]models.MesaFill{1: {HoldBack: true}, 2: {HoldBack: true}},
+			esperado: []int{1, 2},
+		},
+		{
+			nombre:   "única no retenida bloqueada mantiene las originales",
+			salidas:  []salidaFixture{{id: 1}, {id: 2, bloqueo: true}},
+			fills:    map[int]models.MesaFill{1: {HoldBack: true}},
+			esperado: []int{1, 2},
+		},
+		{
+			nombre:   "dato vencido no retiene",
+			salidas:  []salidaFixture{{id: 1}, {id: 2}},
+			fills:    map[int]models.MesaFill{1: {HoldBack: true, UpdatedAt: time.Now().Add(-time.Hour)}},
+			esperado: []int{1, 2},
+		},
+		{
+			nombre:   "dato con error no retiene",
+			salidas:  []salidaFixture{{id: 1}, {id: 2}},
+			fills:    map[int]models.MesaFill{1: {HoldBack: true, Error: "sin datos de paletizado"}},
+			esperado: []int{1, 2},
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t, caso.salidas...)
+			s.ConfigureCapacity(!caso.deshabilita, time.Second, time.Minute, 5)
+			for salidaID, fill := range caso.fills {
+				fill.SalidaID = salidaID
+				if fill.UpdatedAt.IsZero() {
+					fill.UpdatedAt = time.Now()
+				}
+				s.mesaFills[salidaID] = fill
+			}
+
+			candidatas := make([]*shared.Salida, 0, len(caso.salidas))
+			for _, f := range caso.salidas {
+				candidatas = append(candidatas, s.findSalidaByID(f.id))
+			}
+			got := idsDe(s.filtrarPorCapacidad(candidatas))
+			if !reflect.DeepEqual(got, caso.esperado) {
+				t.Errorf("filtrarPorCapacidad = %v, esperado %v", got, caso.esperado)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package sorter
 
 import (
 	"API-GREENEX/internal/db"
+	"API-GREENEX/internal/journal"
 	"API-GREENEX/internal/listeners"
 	"API-GREENEX/internal/models"
 	"API-GREENEX/internal/shared"
@@ -13,7 +14,8 @@ import (
 )
 
 // PublishLecturaEvent publica un evento de lectura individual procesada al WebSocket
-func (s *Sorter) PublishLecturaEvent(evento models.LecturaEvent, salida *shared.Salida, exitoso bool) {
+// (tracking = número de seguimiento asignado por el PLC, nil si no se obtuvo)
+func (s *Sorter) PublishLecturaEvent(evento models.LecturaEvent, salida *shared.Salida, exitoso bool, tracking *uint16) {
 	if s.wsHub == nil {
 		return
 	}
@@ -32,6 +34,9 @@ func (s *Sorter) PublishLecturaEvent(evento models.LecturaEvent, salida *shared.
 		"variedad":    evento.Variedad,
 		"embalaje":    evento.Embalaje,
 	}
+	if tracking != nil {
+		message["tracking_plc"] = *tracking
+	}
 
 	jsonBytes, err := json.Marshal(message)
 	if err != nil {
@@ -46,8 +51,10 @@ func (s *Sorter) PublishLecturaEvent(evento models.LecturaEvent, salida *shared.
 	}
 }
 
-// RegistrarSalidaCaja registra en la base de datos que una caja fue enviada a una salida física
-func (s *Sorter) RegistrarSalidaCaja(correlativo string, salida *shared.Salida, sku, calibre string) error {
+// RegistrarSalidaCaja registra en la base de datos que una caja fue enviada a una salida física.
+// saltos son las salidas no disponibles recorridas por la cadena de desborde (nil = sin desborde).
+// tracking es el número de seguimiento que el PLC asignó a la caja; se guarda en el registro de la salida final.
+func (s *Sorter) RegistrarSalidaCaja(correlativo string, salida *shared.Salida, sku, calibre string, saltos []int, tracking *uint16) error {
 	if s.dbManager == nil {
 		return fmt.Errorf("dbManager no inicializado")
 	}
@@ -59,6 +66,10 @@ func (s *Sorter) RegistrarSalidaCaja(correlativo string, salida *shared.Salida,
 
 	ctx := context.Background()
 
+	if len(saltos) > 0 {
+		return s.registrarSaltosDesborde(ctx, pgManager, correlativo, salida, sku, calibre, saltos, tracking)
+	}
+
 	// Determinar si la salida final estaba realmente disponible. Si la salida destino
 	// (salida) no está disponible porque las otras asignadas estaban llenas, debemos
 	// marcar la salida "intended" como llena y registrar la caja apuntando a la salida
@@ -102,14 +113,14 @@ func (s *Sorter) RegistrarSalidaCaja(correlativo string, salida *shared.Salida,
 			if sealerPhysical == 0 {
 				log.Printf("⚠️  No se encontró SealerPhysicalID para intendedSalida %d (caja %s)", intendedSalidaID, correlativo)
 			}
-			if err := pgManager.InsertSalidaCaja(ctx, correlativo, intendedSalidaID, sealerPhysical, true); err != nil {
+			if err := s.insertSalidaCaja(ctx, pgManager, correlativo, journal.SalidaRecord{SalidaID: intendedSalidaID, SealerPhysicalID: sealerPhysical, Llena: true}); err != nil {
 				log.Printf("⚠️  Error al marcar intended salida como llena para caja %s: %v", correlativo, err)
 			}
 		}
 	}
 
 	// Finalmente insertar el registro real donde la caja fue enviada
-	err := pgManager.InsertSalidaCaja(ctx, correlativo, salida.ID, salida.SealerPhysicalID, llena)
+	err := s.insertSalidaCaja(ctx, pgManager, correlativo, journal.SalidaRecord{SalidaID: salida.ID, SealerPhysicalID: salida.SealerPhysicalID, Llena: llena, TrackingPLC: tracking})
 	if err != nil {
 		return fmt.Errorf("error al registrar salida de caja %s: %w", correlativo, err)
 	}
@@ -120,6 +131,120 @@ func (s *Sorter) RegistrarSalidaCaja(correlativo string, salida *shared.Salida,
 	return nil
 }
 
+// RegistrarSalidaNoComandada registra en salida_caja una caja enviada a REJECT sin señal al PLC
+// (cola de lecturas llena), marcada como no comandada para que no cuente como un REJECT del PLC
+func (s *Sorter) RegistrarSalidaNoComandada(correlativo string, salida *shared.Salida, sku, calibre string) error {
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok || pgManager == nil {
+		return fmt.Errorf("dbManager no es un PostgresManager válido")
+	}
+
+	registro := journal.SalidaRecord{SalidaID: salida.ID, SealerPhysicalID: salida.SealerPhysicalID, EstadoDesvio: models.DesvioNoComandado}
+	if err := s.insertSalidaCaja(context.Background(), pgManager, correlativo, registro); err != nil {
+		return fmt.Errorf("error al registrar salida de caja %s: %w", correlativo, err)
+	}
+
+	s.PublishHistorialEvent(correlativo, sku, calibre, salida, false)
+	return nil
+}
+
+// registrarSaltosDesborde registra en salida_caja cada salto de la cadena de desborde (marcado como lleno)
+// y la salida donde terminó la caja, todos con la salida prevista y la real
+func (s *Sorter) registrarSaltosDesborde(ctx context.Context, pgManager *db.PostgresManager, correlativo string, salida *shared.Salida, sku, calibre string, saltos []int, tracking *uint16) error {
+	originalID := saltos[0]
+	for i, salidaID := range saltos {
+		sealerPhysical := 0
+		if so := s.findSalidaByID(salidaID); so != nil {
+			sealerPhysical = so.SealerPhysicalID
+		}
+		salto := journal.SalidaRecord{SalidaID: salidaID, SealerPhysicalID: sealerPhysical, Llena: true, Desborde: true,
+			SalidaOriginalID: originalID, SalidaDestinoID: salida.ID, Salto: i}
+		if err := s.insertSalidaCaja(ctx, pgManager, correlativo, salto); err != nil {
+			log.Printf("⚠️  Error al registrar salto de desborde %d (salida %d) para caja %s: %v", i, salidaID, correlativo, err)
+		}
+	}
+
+	if salida.ID == 0 {
+		// Cadena agotada y sin REJECT disponible: la caja no tiene salida real
+		return nil
+	}
+	final := journal.SalidaRecord{SalidaID: salida.ID, SealerPhysicalID: salida.SealerPhysicalID, Desborde: true,
+		SalidaOriginalID: originalID, SalidaDestinoID: salida.ID, Salto: len(saltos), TrackingPLC: tracking}
+	if err := s.insertSalidaCaja(ctx, pgManager, correlativo, final); err != nil {
+		return fmt.Errorf("error al registrar salida de caja %s: %w", correlativo, err)
+	}
+
+	// 📡 Broadcast a WebSocket de historial (la salida prevista estaba llena)
+	s.PublishHistorialEvent(correlativo, sku, calibre, salida, true)
+
+	return nil
+}
+
+// SetBoxJournal habilita el registro local de salidas de cajas cuando PostgreSQL no está disponible
+func (s *Sorter) SetBoxJournal(j *journal.BoxJournal) {
+	s.boxJournal = j
+}
+
+// insertSalidaCaja escribe un registro de salida_caja. Las cajas con correlativo provisional
+// (aún no reconciliadas) y las salidas que fallan porque la BD no responde quedan en el registro local.
+func (s *Sorter) insertSalidaCaja(ctx context.Context, pgManager *db.PostgresManager, correlativo string, salida journal.SalidaRecord) error {
+	if s.boxJournal != nil && journal.IsProvisional(correlativo) {
+		real, ok := s.boxJournal.RealCorrelativo(correlativo)
+		if !ok {
+			return s.boxJournal.RecordSalida(correlativo, salida)
+		}
+		correlativo = real
+	}
+
+	var err error
+	if salida.Desborde {
+		err = pgManager.InsertSalidaCajaOverflow(ctx, correlativo, salida.SalidaID, salida.SealerPhysicalID, salida.Llena,
+			salida.SalidaOriginalID, salida.SalidaDestinoID, salida.Salto)
+	} else {
+		err = pgManager.InsertSalidaCaja(ctx, correlativo, salida.SalidaID, salida.SealerPhysicalID, salida.Llena)
+	}
+	if err == nil {
+		if salida.TrackingPLC != nil {
+			if err := pgManager.SetSalidaCajaTracking(ctx, correlativo, salida.SalidaID, *salida.TrackingPLC); err != nil {
+				log.Printf("⚠️  Sorter #%d: %v", s.ID, err)
+			}
+		}
+		if salida.EstadoDesvio != "" {
+			if err := pgManager.SetSalidaCajaDesvio(ctx, correlativo, salida.SalidaID, salida.EstadoDesvio, nil); err != nil {
+				log.Printf("⚠️  Sorter #%d: %v", s.ID, err)
+			}
+		}
+		return nil
+	}
+	if s.boxJournal == nil {
+		return err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if pgManager.Ping(pingCtx) == nil {
+		return err
+	}
+	log.Printf("⚠️  Sorter #%d: PostgreSQL no disponible (%v), salida de caja %s registrada localmente", s.ID, err, correlativo)
+	return s.boxJournal.RecordSalida(correlativo, salida)
+}
+
+// registrarDecision guarda en segundo plano la auditoría de la decisión de ruteo de una caja
+func (s *Sorter) registrarDecision(decision *models.RoutingDecision) {
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok || pgManager == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pgManager.InsertRoutingDecision(ctx, decision); err != nil {
+			log.Printf("⚠️  Sorter #%d: Error al registrar decisión de ruteo de caja %s: %v", s.ID, decision.Correlativo, err)
+		}
+	}()
+}
+
 // PublishHistorialEvent publica un evento de historial al WebSocket
 func (s *Sorter) PublishHistorialEvent(correlativo, sku, calibre string, salida *shared.Salida, isFull bool) {
 	if s.wsHub == nil {
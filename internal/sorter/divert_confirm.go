@@ -0,0 +1,434 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/communication/plc"
+	"API-GREENEX/internal/db"
+	"API-GREENEX/internal/journal"
+	"API-GREENEX/internal/listeners"
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Cantidad de alertas de desvío recientes que se mantienen en memoria por sorter
+const divertAlertBuffer = 200
+
+// pendingDivert es una caja asignada al PLC que aún no confirma su desvío físico
+type pendingDivert struct {
+	correlativo string
+	sku         string
+	tracking    uint16
+	salidaID    int
+	lane        int16 // Salida física enviada al PLC (0 = descarte)
+	enviada     time.Time
+}
+
+// divertConfirmation relaciona las confirmaciones físicas del PLC con las cajas asignadas por tracking.
+// Las confirmaciones llegan por un nodo FIFO del sorter (tracking + lane) y/o por un nodo por salida (tracking).
+type divertConfirmation struct {
+	fifoNode    string
+	salidaNodes map[string]int // nodeID → salidaID
+	timeout     time.Duration
+
+	pendientes   map[uint16]*pendingDivert // key=tracking
+	vistos       map[string]bool           // Nodos que ya entregaron su valor inicial
+	confirmadas  int64
+	malDesviadas int64
+	perdidas     int64
+	desconocidas int64
+	alertas      []models.DivertAlert // buffer circular
+	next         int
+	mu           sync.Mutex
+}
+
+// ConfigureDivertConfirmation habilita la confirmación física de desvíos. fifoNode y salidaNodes
+// (key=salidaID) son opcionales, pero debe haber al menos uno. Debe llamarse antes de Start.
+func (s *Sorter) ConfigureDivertConfirmation(fifoNode string, salidaNodes map[int]string, timeout time.Duration) error {
+	dc := &divertConfirmation{
+		fifoNode:    fifoNode,
+		salidaNodes: make(map[string]int, len(salidaNodes)),
+		timeout:     timeout,
+		pendientes:  make(map[uint16]*pendingDivert),
+		vistos:      make(map[string]bool),
+		alertas:     make([]models.DivertAlert, 0, divertAlertBuffer),
+	}
+	for salidaID, nodeID := range salidaNodes {
+		if nodeID == "" {
+			continue
+		}
+		if s.findSalidaByID(salidaID) == nil {
+			return fmt.Errorf("la salida %d no pertenece al sorter #%d", salidaID, s.ID)
+		}
+		dc.salidaNodes[nodeID] = salidaID
+	}
+	if dc.fifoNode == "" && len(dc.salidaNodes) == 0 {
+		return fmt.Errorf("no hay nodos de confirmación de desvío configurados")
+	}
+
+	s.divertConfirm = dc
+	log.Printf("📍 Sorter #%d: Confirmación física de desvíos (FIFO: %t, %d nodo(s) por salida, timeout %v)",
+		s.ID, dc.fifoNode != "", len(dc.salidaNodes), timeout)
+	return nil
+}
+
+// laneDe retorna la salida física que se envía al PLC para una salida (0 = descarte)
+func laneDe(salida *shared.Salida) int16 {
+	if salida.Tipo == "descarte" {
+		return 0
+	}
+	return int16(salida.SealerPhysicalID)
+}
+
+// salidaPorLane busca la salida correspondiente a una salida física reportada por el PLC
+func (s *Sorter) salidaPorLane(lane int16) *shared.Salida {
+	for i := range s.Salidas {
+		if laneDe(&s.Salidas[i]) == lane {
+			return &s.Salidas[i]
+		}
+	}
+	return nil
+}
+
+// registrarDesvioPendiente agrega la caja a las pendientes de confirmación física (requiere tracking del PLC)
+func (s *Sorter) registrarDesvioPendiente(decision *models.RoutingDecision, salidaID int, asignacion plc.LaneAssignment) {
+	dc := s.divertConfirm
+	if dc == nil || asignacion.Tracking == nil || decision == nil {
+		return
+	}
+
+	pendiente := &pendingDivert{
+		correlativo: decision.Correlativo,
+		sku:         decision.SKU,
+		tracking:    *asignacion.Tracking,
+		salidaID:    salidaID,
+		lane:        asignacion.Lane,
+		enviada:     time.Now(),
+	}
+
+	dc.mu.Lock()
+	anterior := dc.pendientes[pendiente.tracking]
+	dc.pendientes[pendiente.tracking] = pendiente
+	if anterior != nil {
+		dc.perdidas++
+	}
+	dc.mu.Unlock()
+
+	// El contador del PLC dio la vuelta sin que la caja anterior se confirmara
+	if anterior != nil {
+		s.alertarDesvio(anterior, models.DesvioPerdido, nil, "tracking reutilizado por el PLC antes de confirmar")
+	}
+}
+
+// divertConfirmNodes retorna los nodos de confirmación a monitorear (nodeID → tipo)
+func (s *Sorter) divertConfirmNodes() map[string]string {
+	dc := s.divertConfirm
+	if dc == nil {
+		return nil
+	}
+	nodos := make(map[string]string, len(dc.salidaNodes)+1)
+	if dc.fifoNode != "" {
+		nodos[dc.fifoNode] = "confirmacion_fifo"
+	}
+	for nodeID := range dc.salidaNodes {
+		nodos[nodeID] = "confirmacion"
+	}
+	return nodos
+}
+
+// processDivertConfirmChange procesa un cambio en un nodo de confirmación de desvío
+func (s *Sorter) processDivertConfirmChange(nodeID, tipo string, value interface{}) {
+	dc := s.divertConfirm
+	if dc == nil {
+		return
+	}
+
+	// El primer valor de la suscripción es el último desvío previo al arranque
+	dc.mu.Lock()
+	inicial := !dc.vistos[nodeID]
+	dc.vistos[nodeID] = true
+	dc.mu.Unlock()
+	if inicial {
+		return
+	}
+
+	var tracking uint16
+	var lane int16
+	switch tipo {
+	case "confirmacion_fifo":
+		t, l, ok := parseDivertFIFO(value)
+		if !ok {
+			log.Printf("⚠️ Sorter #%d: Valor inesperado en FIFO de confirmación %s: %T (%v)", s.ID, nodeID, value, value)
+			return
+		}
+		tracking, lane = t, l
+	case "confirmacion":
+		t, ok := plc.ToUint16(value)
+		if !ok {
+			log.Printf("⚠️ Sorter #%d: Valor inesperado en nodo de confirmación %s: %T (%v)", s.ID, nodeID, value, value)
+			return
+		}
+		salida := s.findSalidaByID(dc.salidaNodes[nodeID])
+		if salida == nil {
+			return
+		}
+		tracking, lane = t, laneDe(salida)
+	default:
+		return
+	}
+
+	s.confirmarDesvio(tracking, lane)
+}
+
+// confirmarDesvio relaciona una confirmación del PLC con la caja pendiente del mismo tracking
+func (s *Sorter) confirmarDesvio(tracking uint16, lane int16) {
+	dc := s.divertConfirm
+
+	dc.mu.Lock()
+	pendiente, ok := dc.pendientes[tracking]
+	if !ok {
+		dc.desconocidas++
+		dc.mu.Unlock()
+		log.Printf("❔ Sorter #%d: Confirmación de desvío sin caja pendiente (tracking %d, lane %d)", s.ID, tracking, lane)
+		return
+	}
+	delete(dc.pendientes, tracking)
+	correcto := pendiente.lane == lane
+	if correcto {
+		dc.confirmadas++
+	} else {
+		dc.malDesviadas++
+	}
+	dc.mu.Unlock()
+
+	if correcto {
+		s.marcarDesvio(pendiente, models.DesvioConfirmado, &lane)
+		return
+	}
+	s.alertarDesvio(pendiente, models.DesvioMalDesviado, &lane, "")
+}
+
+// startDivertTimeoutChecker marca como perdidas las cajas sin confirmación dentro del timeout
+func (s *Sorter) startDivertTimeoutChecker() {
+	dc := s.divertConfirm
+	intervalo := dc.timeout / 4
+	if intervalo < 100*time.Millisecond {
+		intervalo = 100 * time.Millisecond
+	} else if intervalo > time.Second {
+		intervalo = time.Second
+	}
+
+	ticker := time.NewTicker(intervalo)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case ahora := <-ticker.C:
+			var vencidas []*pendingDivert
+			dc.mu.Lock()
+			for tracking, p := range dc.pendientes {
+				if ahora.Sub(p.enviada) > dc.timeout {
+					vencidas = append(vencidas, p)
+					delete(dc.pendientes, tracking)
+				}
+			}
+			dc.perdidas += int64(len(vencidas))
+			dc.mu.Unlock()
+
+			for _, p := range vencidas {
+				s.alertarDesvio(p, models.DesvioPerdido, nil, "")
+			}
+		}
+	}
+}
+
+// alertarDesvio registra y publica una caja mal desviada o perdida
+func (s *Sorter) alertarDesvio(p *pendingDivert, tipo string, laneReal *int16, nota string) {
+	ahora := time.Now()
+	alerta := models.DivertAlert{
+		SorterID:         s.ID,
+		Tipo:             tipo,
+		Correlativo:      p.correlativo,
+		SKU:              p.sku,
+		Tracking:         p.tracking,
+		SalidaEsperadaID: p.salidaID,
+		LaneEsperada:     p.lane,
+		LaneReal:         laneReal,
+		Enviada:          p.enviada,
+		Timestamp:        ahora,
+		DemoraMs:         float64(ahora.Sub(p.enviada).Microseconds()) / 1000,
+		Nota:             nota,
+	}
+	if laneReal != nil {
+		if salida := s.salidaPorLane(*laneReal); salida != nil {
+			alerta.SalidaRealID = salida.ID
+		}
+	}
+
+	dc := s.divertConfirm
+	dc.mu.Lock()
+	if len(dc.alertas) < divertAlertBuffer {
+		dc.alertas = append(dc.alertas, alerta)
+		dc.next = len(dc.alertas) % divertAlertBuffer
+	} else {
+		dc.alertas[dc.next] = alerta
+		dc.next = (dc.next + 1) % divertAlertBuffer
+	}
+	dc.mu.Unlock()
+
+	log.Printf("🚨 Sorter #%d: Desvío %s | %s", s.ID, tipo, alerta.String())
+	s.marcarDesvio(p, tipo, laneReal)
+	s.PublishDivertAlert(alerta)
+}
+
+// marcarDesvio guarda en salida_caja el resultado de la confirmación física del desvío
+func (s *Sorter) marcarDesvio(p *pendingDivert, estado string, laneReal *int16) {
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok || pgManager == nil || p.correlativo == "" {
+		return
+	}
+
+	go func() {
+		correlativo := p.correlativo
+		if journal.IsProvisional(correlativo) {
+			real, ok := s.realCorrelativo(correlativo)
+			if !ok {
+				log.Printf("⚠️  Sorter #%d: Caja %s aún sin reconciliar, desvío %s no registrado en BD", s.ID, correlativo, estado)
+				return
+			}
+			correlativo = real
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pgManager.SetSalidaCajaDesvio(ctx, correlativo, p.salidaID, estado, laneReal); err != nil {
+			log.Printf("⚠️  Sorter #%d: %v", s.ID, err)
+		}
+	}()
+}
+
+// realCorrelativo retorna el correlativo asignado por la BD a una caja registrada localmente
+func (s *Sorter) realCorrelativo(provisional string) (string, bool) {
+	if s.boxJournal == nil {
+		return "", false
+	}
+	return s.boxJournal.RealCorrelativo(provisional)
+}
+
+// GetDivertConfirmationStatus retorna los contadores de confirmación física y las alertas más recientes
+func (s *Sorter) GetDivertConfirmationStatus(limit int) models.DivertConfirmationStatus {
+	dc := s.divertConfirm
+	if dc == nil {
+		return models.DivertConfirmationStatus{SorterID: s.ID, Alertas: []models.DivertAlert{}}
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	total := len(dc.alertas)
+	if limit <= 0 || limit > total {
+		limit = total
+	}
+	alertas := make([]models.DivertAlert, 0, limit)
+	for i := 0; i < limit; i++ {
+		// Recorrer hacia atrás desde el último elemento escrito
+		idx := (dc.next - 1 - i + total) % total
+		alertas = append(alertas, dc.alertas[idx])
+	}
+
+	return models.DivertConfirmationStatus{
+		SorterID:     s.ID,
+		Enabled:      true,
+		TimeoutMs:    dc.timeout.Milliseconds(),
+		Pendientes:   len(dc.pendientes),
+		Confirmadas:  dc.confirmadas,
+		MalDesviadas: dc.malDesviadas,
+		Perdidas:     dc.perdidas,
+		Desconocidas: dc.desconocidas,
+		Alertas:      alertas,
+	}
+}
+
+// PublishDivertAlert publica una alerta de desvío (mal desviado o perdido) al WebSocket
+func (s *Sorter) PublishDivertAlert(alerta models.DivertAlert) {
+	if s.wsHub == nil {
+		return
+	}
+
+	message := map[string]interface{}{
+		"type":               "divert_alert",
+		"sorter_id":          s.ID,
+		"tipo":               alerta.Tipo,
+		"correlativo":        alerta.Correlativo,
+		"sku":                alerta.SKU,
+		"tracking_plc":       alerta.Tracking,
+		"salida_esperada_id": alerta.SalidaEsperadaID,
+		"lane_esperada":      alerta.LaneEsperada,
+		"salida_real_id":     alerta.SalidaRealID,
+		"lane_real":          alerta.LaneReal,
+		"demora_ms":          alerta.DemoraMs,
+		"timestamp":          alerta.Timestamp.Format(time.RFC3339),
+	}
+
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Error al serializar divert_alert: %v", err)
+		return
+	}
+
+	roomName := fmt.Sprintf("assignment_%d", s.ID)
+	s.wsHub.Broadcast <- &listeners.BroadcastMessage{
+		RoomName: roomName,
+		Message:  jsonBytes,
+	}
+}
+
+// parseDivertFIFO interpreta el valor del FIFO de confirmación: [tracking, lane] o UInt32 tracking<<16|lane
+func parseDivertFIFO(value interface{}) (uint16, int16, bool) {
+	var par []interface{}
+	switch v := value.(type) {
+	case []uint16:
+		for _, x := range v {
+			par = append(par, x)
+		}
+	case []int16:
+		for _, x := range v {
+			par = append(par, x)
+		}
+	case []uint32:
+		for _, x := range v {
+			par = append(par, x)
+		}
+	case []int32:
+		for _, x := range v {
+			par = append(par, x)
+		}
+	case []interface{}:
+		par = v
+	case uint32:
+		return uint16(v >> 16), int16(v & 0xFFFF), true
+	case int32:
+		return uint16(uint32(v) >> 16), int16(uint32(v) & 0xFFFF), true
+	default:
+		return 0, 0, false
+	}
+
+	if len(par) < 2 {
+		return 0, 0, false
+	}
+	tracking, ok := plc.ToUint16(par[0])
+	if !ok {
+		return 0, 0, false
+	}
+	lane, ok := plc.ToUint16(par[1])
+	if !ok || lane > 0x7FFF {
+		return 0, 0, false
+	}
+	return tracking, int16(lane), true
+}
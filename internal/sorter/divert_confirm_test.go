@@ -0,0 +1,160 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/communication/plc"
+	"API-GREENEX/internal/models"
+	"testing"
+	"time"
+)
+
+func TestParseDivertFIFO(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		valor    interface{}
+		tracking uint16
+		lane     int16
+		ok       bool
+	}{
+		{"par uint16", []uint16{1234, 3}, 1234, 3, true},
+		{"par int16 descarte", []int16{7, 0}, 7, 0, true},
+		{"par uint32", []uint32{65535, 12}, 65535, 12, true},
+		{"par variant", []interface{}{uint16(42), int32(5)}, 42, 5, true},
+		{"uint32 empaquetado", uint32(1234)<<16 | 3, 1234, 3, true},
+		{"int32 empaquetado", int32(7<<16 | 2), 7, 2, true},
+		{"arreglo incompleto", []uint16{1234}, 0, 0, false},
+		{"tracking negativo", []int32{-1, 3}, 0, 0, false},
+		{"lane fuera de rango", []uint16{1, 0x8000}, 0, 0, false},
+		{"tipo no soportado", "1234,3", 0, 0, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			tracking, lane, ok := parseDivertFIFO(c.valor)
+			if ok != c.ok || tracking != c.tracking || lane != c.lane {
+				t.Fatalf("parseDivertFIFO(%v) = (%d, %d, %t), se esperaba (%d, %d, %t)",
+					c.valor, tracking, lane, ok, c.tracking, c.lane, c.ok)
+			}
+		})
+	}
+}
+
+// newDivertSorter crea un sorter con dos salidas (lanes 1 y 2) y confirmación física por FIFO
+func newDivertSorter(t *testing.T, timeout time.Duration) *Sorter {
+	t.Helper()
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 2, skus: []string{"B"}},
+	)
+	s.Salidas[0].SealerPhysicalID = 1
+	s.Salidas[1].SealerPhysicalID = 2
+	if err := s.ConfigureDivertConfirmation("ns=4;s=FIFO_Desvio", nil, timeout); err != nil {
+		t.Fatalf("ConfigureDivertConfirmation: %v", err)
+	}
+	return s
+}
+
+// asignar registra una caja pendiente de confirmación como si el PLC hubiera aceptado la salida
+func asignar(s *Sorter, correlativo string, tracking uint16, salidaID int, lane int16) {
+	decision := &models.RoutingDecision{Correlativo: correlativo, SKU: "A"}
+	s.registrarDesvioPendiente(decision, salidaID, plc.LaneAssignment{Lane: lane, Tracking: &tracking})
+}
+
+func TestConfirmarDesvio(t *testing.T) {
+	casos := []struct {
+		nombre       string
+		tracking     uint16
+		lane         int16
+		confirmadas  int64
+		malDesviadas int64
+		desconocidas int64
+		salidaReal   int
+	}{
+		{"lane correcta", 10, 1, 1, 0, 0, 0},
+		{"lane equivocada", 10, 2, 0, 1, 0, 2},
+		{"tracking desconocido", 11, 1, 0, 0, 1, 0},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			s := newDivertSorter(t, time.Minute)
+			asignar(s, "500", 10, 1, 1)
+
+			s.confirmarDesvio(c.tracking, c.lane)
+
+			st := s.GetDivertConfirmationStatus(0)
+			if st.Confirmadas != c.confirmadas || st.MalDesviadas != c.malDesviadas || st.Desconocidas != c.desconocidas {
+				t.Fatalf("status = %+v", st)
+			}
+			if c.malDesviadas == 0 {
+				if len(st.Alertas) != 0 {
+					t.Fatalf("alertas inesperadas: %+v", st.Alertas)
+				}
+				return
+			}
+			alerta := st.Alertas[0]
+			if alerta.Tipo != models.DesvioMalDesviado || alerta.Correlativo != "500" || alerta.SalidaEsperadaID != 1 || alerta.SalidaRealID != c.salidaReal {
+				t.Fatalf("alerta = %+v", alerta)
+			}
+		})
+	}
+}
+
+func TestProcessDivertConfirmChangeIgnoraValorInicial(t *testing.T) {
+	s := newDivertSorter(t, time.Minute)
+	asignar(s, "500", 10, 1, 1)
+	fifo := s.divertConfirm.fifoNode
+
+	// El valor inicial de la suscripción corresponde a un desvío anterior al arranque
+	s.processDivertConfirmChange(fifo, "confirmacion_fifo", uint32(10)<<16|1)
+	if st := s.GetDivertConfirmationStatus(0); st.Confirmadas != 0 || st.Pendientes != 1 {
+		t.Fatalf("el valor inicial no debe confirmar cajas: %+v", st)
+	}
+
+	s.processDivertConfirmChange(fifo, "confirmacion_fifo", uint32(10)<<16|1)
+	if st := s.GetDivertConfirmationStatus(0); st.Confirmadas != 1 || st.Pendientes != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestDesvioPerdidoPorTimeout(t *testing.T) {
+	s := newDivertSorter(t, 10*time.Millisecond)
+	asignar(s, "500", 10, 1, 1)
+	go s.startDivertTimeoutChecker()
+
+	limite := time.Now().Add(2 * time.Second)
+	for s.GetDivertConfirmationStatus(0).Perdidas == 0 {
+		if time.Now().After(limite) {
+			t.Fatal("la caja sin confirmación no se marcó como perdida")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st := s.GetDivertConfirmationStatus(0)
+	if st.Pendientes != 0 || len(st.Alertas) != 1 || st.Alertas[0].Tipo != models.DesvioPerdido || st.Alertas[0].LaneReal != nil {
+		t.Fatalf("status = %+v", st)
+	}
+
+	// Una confirmación tardía ya no encuentra la caja
+	s.confirmarDesvio(10, 1)
+	if st := s.GetDivertConfirmationStatus(0); st.Confirmadas != 0 || st.Desconocidas != 1 {
+		t.Fatalf("status tras confirmación tardía = %+v", st)
+	}
+}
+
+func TestTrackingReutilizadoMarcaPerdida(t *testing.T) {
+	s := newDivertSorter(t, time.Minute)
+	asignar(s, "500", 10, 1, 1)
+	asignar(s, "501", 10, 2, 2)
+
+	st := s.GetDivertConfirmationStatus(0)
+	if st.Perdidas != 1 || st.Pendientes != 1 || len(st.Alertas) != 1 {
+		t.Fatalf("status = %+v", st)
+	}
+	if alerta := st.Alertas[0]; alerta.Tipo != models.DesvioPerdido || alerta.Correlativo != "500" || alerta.Nota == "" {
+		t.Fatalf("alerta = %+v", alerta)
+	}
+
+	// La confirmación del tracking corresponde a la caja más reciente
+	s.confirmarDesvio(10, 2)
+	if st := s.GetDivertConfirmationStatus(0); st.Confirmadas != 1 || st.MalDesviadas != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+}
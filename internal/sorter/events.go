@@ -1,11 +1,13 @@
 package sorter
 
 import (
+	"API-GREENEX/internal/communication/plc"
 	"API-GREENEX/internal/listeners"
 	"API-GREENEX/internal/models"
 	"API-GREENEX/internal/shared"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -27,12 +29,7 @@ func (s *Sorter) procesarEventosCognex() {
 				return
 			}
 
-			if evento.Exitoso {
-				s.processLecturaExitosa(evento)
-			} else {
-				s.processLecturaFallida(evento)
-			}
-
+			s.procesarLectura(evento)
 			s.showStatsIfNeeded()
 		}
 	}
@@ -113,24 +110,71 @@ func (s *Sorter) processDataMatrixEvent(dmEvent models.DataMatrixEvent) {
 	}
 }
 
+// procesarLectura rutea una lectura QR/SKU. Con el sorter en pausa la lectura se registra
+// pero no se rutea ni se envía al PLC.
+func (s *Sorter) procesarLectura(evento models.LecturaEvent) {
+	if s.IsPaused() {
+		s.descartarEnPausa(evento)
+		return
+	}
+
+	if evento.Exitoso {
+		s.processLecturaExitosa(evento)
+	} else {
+		s.processLecturaFallida(evento)
+	}
+}
+
+// descartarEnPausa registra una lectura recibida con el sorter en pausa, sin salida ni señal al PLC
+func (s *Sorter) descartarEnPausa(evento models.LecturaEvent) {
+	log.Printf("⏸️  Sorter #%d: En pausa, caja %s (SKU %s) no se rutea ni se envía al PLC",
+		s.ID, evento.Correlativo, evento.SKU)
+	s.registrarDecision(&models.RoutingDecision{
+		SorterID:    s.ID,
+		Correlativo: evento.Correlativo,
+		SKU:         evento.SKU,
+		Exitosa:     evento.Exitoso,
+		Razon:       models.RazonSorterEnPausa,
+		PLCError:    "no enviado: sorter en pausa",
+		Fecha:       time.Now(),
+	})
+}
+
 // processLecturaExitosa procesa una lectura exitosa QR/SKU
 func (s *Sorter) processLecturaExitosa(evento models.LecturaEvent) {
 	s.LecturasExitosas++
 	s.registrarLectura(evento.SKU)
 
-	salida := s.determinarSalida(evento.SKU, evento.Calibre)
-	log.Printf("✅ Sorter #%d: Lectura #%d | SKU: %s | Salida: %s (ID: %d) | Razón: sort por SKU",
-		s.ID, s.LecturasExitosas, evento.SKU, salida.Salida_Sorter, salida.ID)
+	decision := &models.RoutingDecision{
+		SorterID:    s.ID,
+		Correlativo: evento.Correlativo,
+		SKU:         evento.SKU,
+		Exitosa:     true,
+		Fecha:       time.Now(),
+	}
 
-	if err := s.sendPLCSignal(&salida); err != nil {
+	salida := s.determinarSalida(evento, decision)
+	decision.SalidaID = salida.ID
+	log.Printf("✅ Sorter #%d: Lectura #%d | SKU: %s | Salida: %s (ID: %d) | Razón: %s",
+		s.ID, s.LecturasExitosas, evento.SKU, salida.Salida_Sorter, salida.ID, decision.Razon)
+
+	if err := s.sendPLCSignal(&salida, decision, evento.InstanteLectura()); err != nil {
 		log.Printf("❌ [Sorter #%d] Error crítico al asignar salida para caja %s (SKU: %s): %v",
 			s.ID, evento.Correlativo, evento.SKU, err)
+		decision.PLCError = err.Error()
 		// Registrar el error pero continuar para no bloquear el flujo
 	}
+	s.registrarEnvioSalida(decision.SalidaFinalID)
+	s.registrarDecision(decision)
+
+	// Evaluar la configuración candidata en sombra (nunca se envía al PLC)
+	s.evaluarRuteoSombra(evento, &salida)
 
-	s.PublishLecturaEvent(evento, &salida, true)
+	// El tracking del PLC corresponde a la salida que aceptó la caja (alternativa si hubo reintento)
+	enviada := s.salidaEnviada(&salida, decision)
+	s.PublishLecturaEvent(evento, enviada, true, decision.TrackingPLC)
 
-	if err := s.RegistrarSalidaCaja(evento.Correlativo, &salida, evento.SKU, evento.Calibre); err != nil {
+	if err := s.RegistrarSalidaCaja(evento.Correlativo, enviada, evento.SKU, evento.Calibre, decision.Desborde, decision.TrackingPLC); err != nil {
 		log.Printf("⚠️  Sorter #%d: Error al registrar salida de caja %s: %v", s.ID, evento.Correlativo, err)
 	}
 }
@@ -142,29 +186,114 @@ func (s *Sorter) processLecturaFallida(evento models.LecturaEvent) {
 	tipoLectura := evento.GetTipo()
 	salida, razon := s.getSalidaForFallo(tipoLectura)
 
+	decision := &models.RoutingDecision{
+		SorterID:    s.ID,
+		Correlativo: evento.Correlativo,
+		SKU:         evento.SKU,
+		Exitosa:     false,
+		Razon:       razonFallo(tipoLectura),
+		Fecha:       time.Now(),
+	}
+
 	// Protección contra salida nil
 	if salida == nil {
 		log.Printf("❌ Sorter #%d: Fallo #%d | SKU: %s | Sin salida disponible | Razón: %s | %s",
 			s.ID, s.LecturasFallidas, evento.SKU, razon, evento.String())
+		s.registrarDecision(decision)
 		return
 	}
 
 	log.Printf("❌ Sorter #%d: Fallo #%d | SKU: %s | Salida: %s (ID: %d) | Razón: %s | %s",
 		s.ID, s.LecturasFallidas, evento.SKU, salida.Salida_Sorter, salida.ID, razon, evento.String())
 
-	if err := s.sendPLCSignal(salida); err != nil {
+	decision.SalidaID = salida.ID
+	decision.RecordCandidates(candidatosDeSalidas([]*shared.Salida{salida}))
+
+	if err := s.sendPLCSignal(salida, decision, evento.InstanteLectura()); err != nil {
 		log.Printf("❌ [Sorter #%d] Error crítico al asignar salida para caja fallida %s: %v",
 			s.ID, evento.Correlativo, err)
+		decision.PLCError = err.Error()
 		// Registrar el error pero continuar para no bloquear el flujo
 	}
+	s.registrarEnvioSalida(decision.SalidaFinalID)
+	s.registrarDecision(decision)
 
-	s.PublishLecturaEvent(evento, salida, false)
+	enviada := s.salidaEnviada(salida, decision)
+	s.PublishLecturaEvent(evento, enviada, false, decision.TrackingPLC)
 
-	if err := s.RegistrarSalidaCaja(evento.Correlativo, salida, evento.SKU, evento.Calibre); err != nil {
+	if err := s.RegistrarSalidaCaja(evento.Correlativo, enviada, evento.SKU, evento.Calibre, nil, decision.TrackingPLC); err != nil {
 		log.Printf("⚠️  Sorter #%d: Error al registrar salida de caja fallida %s: %v", s.ID, evento.Correlativo, err)
 	}
 }
 
+// desviarPorColaLlena registra como rechazada una lectura que no cupo en la cola de eventos
+// (política divert_to_reject). Corre en la goroutine del lector: no espera al PLC, por lo que la
+// caja sigue sin asignación hasta el final de la línea y queda registrada en la salida REJECT
+// como no comandada (sin tracking del PLC).
+func (s *Sorter) desviarPorColaLlena(evento models.LecturaEvent) {
+	salida := s.GetDiscardSalida()
+
+	decision := &models.RoutingDecision{
+		SorterID:    s.ID,
+		Correlativo: evento.Correlativo,
+		SKU:         evento.SKU,
+		Exitosa:     evento.Exitoso,
+		Razon:       models.RazonColaLlena,
+		PLCError:    "no enviado: cola de lecturas llena",
+		Fecha:       time.Now(),
+	}
+	if salida == nil {
+		log.Printf("🚧 Sorter #%d: Cola de lecturas llena, caja %s (SKU %s) descartada sin salida REJECT",
+			s.ID, evento.Correlativo, evento.SKU)
+		s.registrarDecision(decision)
+		return
+	}
+
+	log.Printf("🚧 Sorter #%d: Cola de lecturas llena, caja %s (SKU %s) desviada a %s sin señal PLC",
+		s.ID, evento.Correlativo, evento.SKU, salida.Salida_Sorter)
+	decision.SalidaID = salida.ID
+	s.registrarDecision(decision)
+	s.PublishLecturaEvent(evento, salida, false, nil)
+
+	if evento.Correlativo != "" {
+		if err := s.RegistrarSalidaNoComandada(evento.Correlativo, salida, evento.SKU, evento.Calibre); err != nil {
+			log.Printf("⚠️  Sorter #%d: Error al registrar salida de caja desviada %s: %v", s.ID, evento.Correlativo, err)
+		}
+	}
+}
+
+// salidaEnviada retorna la salida que el PLC aceptó para la caja: la alternativa si la salida
+// decidida falló y un reintento la reemplazó, o la decidida en cualquier otro caso
+func (s *Sorter) salidaEnviada(salida *shared.Salida, decision *models.RoutingDecision) *shared.Salida {
+	if decision.SalidaFinalID == 0 || decision.SalidaFinalID == salida.ID {
+		return salida
+	}
+	if final := s.findSalidaByID(decision.SalidaFinalID); final != nil {
+		return final
+	}
+	return salida
+}
+
+// razonFallo traduce el tipo de lectura fallida a la razón registrada en la auditoría
+func razonFallo(tipoLectura models.TipoLectura) string {
+	switch tipoLectura {
+	case models.LecturaNoRead:
+		return models.RazonNoRead
+	case models.LecturaDB:
+		return models.RazonErrorDB
+	default:
+		return models.RazonFormatoInvalido
+	}
+}
+
+// describeTracking formatea el número de seguimiento del PLC para los logs (vacío si no hay)
+func describeTracking(tracking *uint16) string {
+	if tracking == nil {
+		return ""
+	}
+	return fmt.Sprintf(" | Tracking PLC: %d", *tracking)
+}
+
 // getSalidaForFallo obtiene la salida y razón para un fallo
 func (s *Sorter) getSalidaForFallo(tipoLectura models.TipoLectura) (salida *shared.Salida, razon string) {
 	var salidaPtr *shared.Salida
@@ -187,8 +316,10 @@ func (s *Sorter) getSalidaForFallo(tipoLectura models.TipoLectura) (salida *shar
 	return salida, razon
 }
 
-// sendPLCSignal envía señal al PLC para activar una salida con reintentos automáticos
-func (s *Sorter) sendPLCSignal(salida *shared.Salida) error {
+// sendPLCSignal envía señal al PLC para activar una salida con reintentos automáticos.
+// Cada intento (latencia y error) queda registrado en decision. leida es el momento de la lectura
+// de la caja: define el plazo de la asignación en la cola del PLC (plc.box_travel_time).
+func (s *Sorter) sendPLCSignal(salida *shared.Salida, decision *models.RoutingDecision, leida time.Time) error {
 	if s.plcManager == nil {
 		log.Printf("⚠️  [Sorter #%d] sendPLCSignal: plcManager es nil, no se puede enviar señal", s.ID)
 		return fmt.Errorf("plcManager no inicializado")
@@ -212,26 +343,35 @@ func (s *Sorter) sendPLCSignal(salida *shared.Salida) error {
 	}
 
 	// Intento inicial
-	err := s.plcManager.AssignLaneToBox(ctx, s.ID, int16(destino))
+	asignacion, err := s.plcManager.AssignLaneToBox(ctx, s.ID, int16(destino), leida)
 	elapsed := time.Since(startTime)
+	decision.RecordPLCAttempt(salida.ID, elapsed, asignacion.Tracking, err)
 
 	if err == nil {
-		log.Printf("✅ [Sorter #%d] Señal PLC confirmada → Salida %d (PhysicalID=%d) en %v",
-			s.ID, salida.ID, salida.SealerPhysicalID, elapsed)
+		s.registrarDesvioPendiente(decision, salida.ID, asignacion)
+		log.Printf("✅ [Sorter #%d] Señal PLC confirmada → Salida %d (PhysicalID=%d) en %v%s",
+			s.ID, salida.ID, salida.SealerPhysicalID, elapsed, describeTracking(asignacion.Tracking))
 		return nil
 	}
 
+	// ⏰ La caja ya pasó: otra salida tampoco alcanzaría
+	if errors.Is(err, plc.ErrCommandExpired) {
+		log.Printf("⏰ [Sorter #%d] Señal PLC para salida %d (PhysicalID=%d) descartada por llegar tarde: %v",
+			s.ID, salida.ID, salida.SealerPhysicalID, err)
+		return err
+	}
+
 	// ❌ Falló el primer intento
 	log.Printf("❌ [Sorter #%d] Error al enviar señal PLC para salida %d (PhysicalID=%d) después de %v: %v",
 		s.ID, salida.ID, salida.SealerPhysicalID, elapsed, err)
 
 	// 🔄 SISTEMA DE REINTENTOS CON SALIDAS ALTERNATIVAS
 	// Solo reintentar si hay múltiples salidas con el mismo SKU
-	return s.retryWithAlternativeSalida(salida, err)
+	return s.retryWithAlternativeSalida(salida, err, decision, leida)
 }
 
 // retryWithAlternativeSalida intenta asignar la caja a una salida alternativa
-func (s *Sorter) retryWithAlternativeSalida(salidaOriginal *shared.Salida, originalError error) error {
+func (s *Sorter) retryWithAlternativeSalida(salidaOriginal *shared.Salida, originalError error, decision *models.RoutingDecision, leida time.Time) error {
 	// Obtener el SKU de la salida original
 	if len(salidaOriginal.SKUs_Actuales) == 0 {
 		log.Printf("⚠️  [Sorter #%d] Salida %d no tiene SKUs asignados, no se puede buscar alternativa",
@@ -268,13 +408,20 @@ func (s *Sorter) retryWithAlternativeSalida(salidaOriginal *shared.Salida, origi
 			destino = 0
 		}
 
-		err := s.plcManager.AssignLaneToBox(ctx, s.ID, int16(destino))
+		asignacion, err := s.plcManager.AssignLaneToBox(ctx, s.ID, int16(destino), leida)
 		elapsed := time.Since(startTime)
 		cancel()
+		decision.RecordPLCAttempt(salidaAlternativa.ID, elapsed, asignacion.Tracking, err)
+
+		if errors.Is(err, plc.ErrCommandExpired) {
+			log.Printf("⏰ [Sorter #%d] Salida alternativa %d descartada por llegar tarde: %v", s.ID, salidaAlternativa.ID, err)
+			return fmt.Errorf("fallo asignando caja para SKU '%s': %w", sku, err)
+		}
 
 		if err == nil {
-			log.Printf("✅ [Sorter #%d] Señal PLC confirmada con salida alternativa %d (PhysicalID=%d) en %v (intento %d/%d)",
-				s.ID, salidaAlternativa.ID, salidaAlternativa.SealerPhysicalID, elapsed, attempt, maxRetries)
+			s.registrarDesvioPendiente(decision, salidaAlternativa.ID, asignacion)
+			log.Printf("✅ [Sorter #%d] Señal PLC confirmada con salida alternativa %d (PhysicalID=%d) en %v (intento %d/%d)%s",
+				s.ID, salidaAlternativa.ID, salidaAlternativa.SealerPhysicalID, elapsed, attempt, maxRetries, describeTracking(asignacion.Tracking))
 			return nil
 		}
 
@@ -303,8 +450,12 @@ func (s *Sorter) showStatsIfNeeded() {
 	total := s.LecturasExitosas + s.LecturasFallidas
 	if total%10 == 0 && total > 0 {
 		tasaExito := float64(s.LecturasExitosas) / float64(total) * 100
-		log.Printf("📊 Sorter #%d: Stats: Total=%d | Exitosas=%d | Fallidas=%d | Tasa=%.1f%%",
-			s.ID, total, s.LecturasExitosas, s.LecturasFallidas, tasaExito)
+		duplicados := int64(0)
+		if s.Cognex != nil {
+			duplicados = s.Cognex.GetStats().DuplicadosSuprimidos
+		}
+		log.Printf("📊 Sorter #%d: Stats: Total=%d | Exitosas=%d | Fallidas=%d | Duplicadas=%d | Tasa=%.1f%%",
+			s.ID, total, s.LecturasExitosas, s.LecturasFallidas, duplicados, tasaExito)
 	}
 }
 
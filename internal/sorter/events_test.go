@@ -0,0 +1,53 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSalidaEnviada(t *testing.T) {
+	tracking := uint16(3512)
+	casos := []struct {
+		nombre   string
+		intentos func(d *models.RoutingDecision)
+		esperado int
+	}{
+		{
+			nombre:   "salida decidida aceptada",
+			intentos: func(d *models.RoutingDecision) { d.RecordPLCAttempt(1, time.Millisecond, &tracking, nil) },
+			esperado: 1,
+		},
+		{
+			nombre: "salida alternativa tras fallo",
+			intentos: func(d *models.RoutingDecision) {
+				d.RecordPLCAttempt(1, time.Millisecond, nil, errors.New("BadTimeout"))
+				d.RecordPLCAttempt(2, time.Millisecond, &tracking, nil)
+			},
+			esperado: 2,
+		},
+		{
+			nombre: "sin salida aceptada",
+			intentos: func(d *models.RoutingDecision) {
+				d.RecordPLCAttempt(1, time.Millisecond, nil, errors.New("BadTimeout"))
+			},
+			esperado: 1,
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t,
+				salidaFixture{id: 1, skus: []string{"A"}},
+				salidaFixture{id: 2, skus: []string{"A"}},
+			)
+			decision := &models.RoutingDecision{SalidaID: 1}
+			caso.intentos(decision)
+
+			if enviada := s.salidaEnviada(s.findSalidaByID(1), decision); enviada.ID != caso.esperado {
+				t.Errorf("salida enviada %d, esperado %d", enviada.ID, caso.esperado)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/shared"
+	"log"
+)
+
+// ConfigureOverflow configura las cadenas de desborde de las salidas (key=salidaID, salidas en orden)
+func (s *Sorter) ConfigureOverflow(chains map[int][]int) {
+	s.routingMutex.Lock()
+	s.overflowChains = chains
+	s.routingMutex.Unlock()
+
+	for salidaID, chain := range chains {
+		log.Printf("🔀 Sorter #%d: Salida %d desborda hacia %v → REJECT", s.ID, salidaID, chain)
+	}
+}
+
+// overflowChain retorna la cadena de desborde de una salida (nil = sin cadena)
+func (s *Sorter) overflowChain(salidaID int) []int {
+	s.routingMutex.RLock()
+	defer s.routingMutex.RUnlock()
+	return s.overflowChains[salidaID]
+}
+
+// getSalidaPorDesborde recorre en orden las cadenas de desborde de las candidatas (todas no disponibles
+// o saturadas por ritmo) y retorna la primera salida disponible y dentro de su ritmo. La salida prevista
+// es la primera candidata. saltos contiene las salidas descartadas recorridas, empezando por la prevista;
+// es vacío si ninguna candidata tiene cadena de desborde.
+func (s *Sorter) getSalidaPorDesborde(candidatas []*shared.Salida) (salida *shared.Salida, saltos []int) {
+	visitadas := make(map[int]bool)
+	for _, candidata := range candidatas {
+		visitadas[candidata.ID] = true
+	}
+
+	for _, candidata := range candidatas {
+		chain := s.overflowChain(candidata.ID)
+		if len(chain) == 0 {
+			continue
+		}
+		if len(saltos) == 0 {
+			saltos = append(saltos, candidatas[0].ID)
+		}
+
+		for _, destinoID := range chain {
+			if visitadas[destinoID] {
+				continue
+			}
+			visitadas[destinoID] = true
+
+			destino := s.findSalidaByID(destinoID)
+			if destino == nil {
+				continue
+			}
+			if destino.IsAvailable() && !s.ritmoExcedido(destino.ID) {
+				return destino, saltos
+			}
+			saltos = append(saltos, destinoID)
+		}
+	}
+	return nil, saltos
+}
@@ -0,0 +1,81 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"reflect"
+	"testing"
+)
+
+func TestGetSalidaPorDesborde(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		candidatas []int
+		cadenas    map[int][]int
+		salidaID   int // 0 = ninguna
+		saltos     []int
+	}{
+		{"sin cadena", []int{1}, nil, 0, nil},
+		{"primer destino disponible", []int{1}, map[int][]int{1: {2}}, 2, []int{1}},
+		{"salta destinos no disponibles en orden", []int{1}, map[int][]int{1: {3, 4, 2}}, 2, []int{1, 3, 4}},
+		{"destino inexistente se ignora", []int{1}, map[int][]int{1: {99, 2}}, 2, []int{1}},
+		{"cadena agotada", []int{1}, map[int][]int{1: {3, 4}}, 0, []int{1, 3, 4}},
+		{"ciclo hacia la salida prevista", []int{1}, map[int][]int{1: {3, 1}, 3: {1}}, 0, []int{1, 3}},
+		{"cadena de un destino no se sigue", []int{1}, map[int][]int{1: {3}, 3: {2}}, 0, []int{1, 3}},
+		{"cadena de la segunda candidata", []int{1, 3}, map[int][]int{3: {2}}, 2, []int{1}},
+		{"destino compartido se visita una vez", []int{1, 3}, map[int][]int{1: {4}, 3: {4, 2}}, 2, []int{1, 4}},
+		{"candidata como destino no se repite", []int{1, 3}, map[int][]int{1: {3, 2}}, 2, []int{1}},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t,
+				salidaFixture{id: 1, bloqueo: true},
+				salidaFixture{id: 2},
+				salidaFixture{id: 3, bloqueo: true},
+				salidaFixture{id: 4, bloqueo: true},
+			)
+			s.ConfigureOverflow(caso.cadenas)
+			candidatas := make([]*shared.Salida, len(caso.candidatas))
+			for i, id := range caso.candidatas {
+				candidatas[i] = s.findSalidaByID(id)
+			}
+
+			salida, saltos := s.getSalidaPorDesborde(candidatas)
+			salidaID := 0
+			if salida != nil {
+				salidaID = salida.ID
+			}
+			if salidaID != caso.salidaID || !reflect.DeepEqual(saltos, caso.saltos) {
+				t.Errorf("desborde = salida %d, saltos %v; esperado salida %d, saltos %v",
+					salidaID, saltos, caso.salidaID, caso.saltos)
+			}
+		})
+	}
+}
+
+func TestDeterminarSalidaPorDesborde(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}, bloqueo: true},
+		salidaFixture{id: 2, bloqueo: true},
+		salidaFixture{id: 3},
+		salidaFixture{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+	)
+	s.ConfigureOverflow(map[int][]int{1: {2, 3}})
+
+	decision := &models.RoutingDecision{}
+	salida := s.determinarSalida(models.LecturaEvent{SKU: "A"}, decision)
+	if salida.ID != 3 || decision.Razon != models.RazonDesborde || !reflect.DeepEqual(decision.Desborde, []int{1, 2}) {
+		t.Fatalf("salida %d (%s, saltos %v), esperado 3 (%s, saltos [1 2])",
+			salida.ID, decision.Razon, decision.Desborde, models.RazonDesborde)
+	}
+
+	// Cadena agotada: REJECT, conservando los saltos recorridos para la auditoría
+	s.findSalidaByID(3).SetBloqueo(true)
+	decision = &models.RoutingDecision{}
+	salida = s.determinarSalida(models.LecturaEvent{SKU: "A"}, decision)
+	if salida.ID != 9 || decision.Razon != models.RazonSalidasNoDisponibles || !reflect.DeepEqual(decision.Desborde, []int{1, 2, 3}) {
+		t.Errorf("salida %d (%s, saltos %v), esperado REJECT 9 (%s, saltos [1 2 3])",
+			salida.ID, decision.Razon, decision.Desborde, models.RazonSalidasNoDisponibles)
+	}
+}
@@ -0,0 +1,100 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Pause marca el sorter como pausado: las lecturas dejan de rutearse y de enviarse al PLC, y las
+// cámaras QR configuradas con offline_on_pause se ponen offline. Un error de las cámaras no impide
+// la pausa: queda registrado en el estado.
+func (s *Sorter) Pause(motivo string) (models.SorterState, error) {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+
+	if s.pausado {
+		return s.stateLocked(), fmt.Errorf("el sorter #%d ya está en pausa", s.ID)
+	}
+
+	s.pausado = true
+	s.pausaMotivo = motivo
+	s.pausaDesde = time.Now()
+	log.Printf("⏸️  Sorter #%d: En pausa (motivo: %s)", s.ID, motivo)
+
+	s.setCamarasPaused(true)
+	return s.stateLocked(), nil
+}
+
+// Resume reanuda el sorter y vuelve a poner online las cámaras que se pusieron offline al pausar
+func (s *Sorter) Resume() (models.SorterState, error) {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+
+	if !s.pausado {
+		return s.stateLocked(), fmt.Errorf("el sorter #%d no está en pausa", s.ID)
+	}
+
+	s.pausado = false
+	s.pausaMotivo = ""
+	s.pausaDesde = time.Time{}
+	log.Printf("▶️  Sorter #%d: Reanudado", s.ID)
+
+	s.setCamarasPaused(false)
+	return s.stateLocked(), nil
+}
+
+// GetSorterState retorna el estado de pausa del sorter
+func (s *Sorter) GetSorterState() models.SorterState {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	return s.stateLocked()
+}
+
+// IsPaused indica si el sorter está en pausa
+func (s *Sorter) IsPaused() bool {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	return s.pausado
+}
+
+// setCamarasPaused cambia el estado online de las cámaras QR del sorter. Requiere pauseMutex.
+func (s *Sorter) setCamarasPaused(paused bool) {
+	if s.Cognex == nil {
+		return
+	}
+
+	cambiadas, err := s.Cognex.SetPaused(paused)
+	if cambiadas {
+		s.camarasOffline = paused
+	}
+	s.errorCamaras = ""
+	if err != nil {
+		s.errorCamaras = err.Error()
+		log.Printf("⚠️  Sorter #%d: Error al cambiar el estado de las cámaras QR: %v", s.ID, err)
+		return
+	}
+	if cambiadas {
+		if paused {
+			log.Printf("📷 Sorter #%d: Cámaras QR offline durante la pausa", s.ID)
+		} else {
+			log.Printf("📷 Sorter #%d: Cámaras QR online", s.ID)
+		}
+	}
+}
+
+// stateLocked arma el estado de pausa. Requiere pauseMutex.
+func (s *Sorter) stateLocked() models.SorterState {
+	state := models.SorterState{
+		SorterID:       s.ID,
+		Pausado:        s.pausado,
+		Motivo:         s.pausaMotivo,
+		CamarasOffline: s.camarasOffline,
+		ErrorCamaras:   s.errorCamaras,
+	}
+	if s.pausado {
+		state.Desde = s.pausaDesde.Format(time.RFC3339)
+	}
+	return state
+}
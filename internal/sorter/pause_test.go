@@ -0,0 +1,51 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/communication/plc"
+	"API-GREENEX/internal/config"
+	"API-GREENEX/internal/models"
+	"errors"
+	"testing"
+)
+
+// encoladosDesvio retorna cuántas asignaciones de salida recibió la cola del PLC del sorter
+func encoladosDesvio(s *Sorter) int64 {
+	for _, prioridad := range s.GetPLCQueueStats().Prioridades {
+		if prioridad.Prioridad == plc.PriorityDivert.String() {
+			return prioridad.Encolados
+		}
+	}
+	return 0
+}
+
+func TestPausedSorterDoesNotCallPLC(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+	)
+	s.Salidas[0].SealerPhysicalID = 1
+	s.Salidas[1].SealerPhysicalID = 9
+	s.plcManager = plc.NewManager(&config.Config{Sorters: []config.Sorter{{ID: s.ID}}})
+
+	if _, err := s.Pause("cambio de turno"); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	s.procesarLectura(models.LecturaEvent{Exitoso: true, SKU: "A", Correlativo: "100"})
+	s.procesarLectura(models.LecturaEvent{Exitoso: false, Correlativo: "101", Error: errors.New("NO_READ")})
+
+	if n := encoladosDesvio(s); n != 0 {
+		t.Fatalf("sorter en pausa envió %d asignación(es) al PLC", n)
+	}
+	if s.LecturasExitosas != 0 || s.LecturasFallidas != 0 {
+		t.Errorf("lecturas ruteadas en pausa: %d exitosas, %d fallidas", s.LecturasExitosas, s.LecturasFallidas)
+	}
+
+	// Al reanudar vuelve a rutear y a llamar al PLC
+	if _, err := s.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	s.procesarLectura(models.LecturaEvent{Exitoso: true, SKU: "A", Correlativo: "102"})
+	if n := encoladosDesvio(s); n == 0 {
+		t.Error("sorter reanudado no envió la asignación al PLC")
+	}
+}
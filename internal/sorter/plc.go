@@ -1,12 +1,15 @@
 package sorter
 
 import (
+	"API-GREENEX/internal/models"
 	"API-GREENEX/internal/shared"
+	"fmt"
 	"log"
 	"time"
 )
 
-// startPLCSubscriptions inicia UNA suscripción OPC UA para monitorear TODOS los nodos (ESTADO y BLOQUEO)
+// startPLCSubscriptions inicia UNA suscripción OPC UA para monitorear TODOS los nodos
+// (ESTADO, BLOQUEO, contador de cajas y confirmación de desvíos)
 func (s *Sorter) startPLCSubscriptions() {
 	log.Printf("🔔 Sorter #%d: Iniciando suscripción OPC UA compartida para Estado y Bloqueo...", s.ID)
 
@@ -30,6 +33,16 @@ func (s *Sorter) startPLCSubscriptions() {
 		}
 	}
 
+	if s.boxCounterNode != "" {
+		nodeIDs = append(nodeIDs, s.boxCounterNode)
+		nodeToTypeMap[s.boxCounterNode] = "contador"
+	}
+
+	for nodeID, tipo := range s.divertConfirmNodes() {
+		nodeIDs = append(nodeIDs, nodeID)
+		nodeToTypeMap[nodeID] = tipo
+	}
+
 	if len(nodeIDs) == 0 {
 		log.Printf("⚠️  Sorter #%d: No hay nodos OPC UA configurados para monitorear", s.ID)
 		return
@@ -61,13 +74,21 @@ func (s *Sorter) startPLCSubscriptions() {
 					return
 				}
 
+				nodeType := nodeToTypeMap[nodeInfo.NodeID]
+				if nodeType == "contador" {
+					s.processBoxCounterChange(nodeInfo.Value)
+					continue
+				}
+				if nodeType == "confirmacion" || nodeType == "confirmacion_fifo" {
+					s.processDivertConfirmChange(nodeInfo.NodeID, nodeType, nodeInfo.Value)
+					continue
+				}
+
 				salida, exists := nodeToSalidaMap[nodeInfo.NodeID]
 				if !exists {
 					continue
 				}
 
-				nodeType := nodeToTypeMap[nodeInfo.NodeID]
-
 				if nodeType == "estado" {
 					s.processEstadoChange(salida, nodeInfo.Value)
 				} else if nodeType == "bloqueo" {
@@ -80,6 +101,31 @@ func (s *Sorter) startPLCSubscriptions() {
 	log.Printf("✅ Sorter #%d: Suscripción compartida iniciada para %d nodos", s.ID, len(nodeIDs))
 }
 
+// ConfigureBoxTracking configura el nodo contador de cajas del PLC y lo vincula a la
+// supresión de duplicados del Cognex QR. Debe llamarse antes de Start.
+func (s *Sorter) ConfigureBoxTracking(nodeID string) {
+	s.boxCounterNode = nodeID
+	if s.Cognex != nil {
+		s.Cognex.SetBoxTracker(s.BoxTrackingValue)
+	}
+	log.Printf("📦 Sorter #%d: Tracking de cajas desde nodo %s", s.ID, nodeID)
+}
+
+// processBoxCounterChange guarda el último valor del contador de cajas del PLC
+func (s *Sorter) processBoxCounterChange(value interface{}) {
+	s.boxTrackingMutex.Lock()
+	defer s.boxTrackingMutex.Unlock()
+	s.boxTracking = fmt.Sprint(value)
+	s.boxTrackingOK = value != nil
+}
+
+// BoxTrackingValue retorna el último valor conocido del contador de cajas del PLC
+func (s *Sorter) BoxTrackingValue() (string, bool) {
+	s.boxTrackingMutex.RLock()
+	defer s.boxTrackingMutex.RUnlock()
+	return s.boxTracking, s.boxTrackingOK
+}
+
 // processEstadoChange procesa cambios en el estado de una salida
 func (s *Sorter) processEstadoChange(salida *shared.Salida, value interface{}) {
 	var estadoValor int16
@@ -162,3 +208,11 @@ func (s *Sorter) stopPLCSubscriptions() {
 
 	s.cancelSubscriptions = nil
 }
+
+// GetPLCQueueStats retorna la profundidad y las latencias de la cola de comandos al PLC del sorter
+func (s *Sorter) GetPLCQueueStats() models.PLCQueueStats {
+	if s.plcManager == nil {
+		return models.PLCQueueStats{SorterID: s.ID, Prioridades: []models.PLCCommandStats{}}
+	}
+	return s.plcManager.GetQueueStats(s.ID)
+}
@@ -0,0 +1,244 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/listeners"
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// laneRate controla el ritmo máximo de una salida (token bucket) y mide su tasa real
+type laneRate struct {
+	maxRate  int // Cajas por minuto (0 = sin límite)
+	burst    int
+	tokens   float64
+	recarga  time.Time   // Última recarga de tokens
+	envios   []time.Time // Envíos del último minuto
+	saturada bool
+}
+
+// recargar suma los tokens acumulados desde la última recarga (hasta burst)
+func (l *laneRate) recargar(now time.Time) {
+	if l.maxRate <= 0 {
+		return
+	}
+	l.tokens += now.Sub(l.recarga).Minutes() * float64(l.maxRate)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.recarga = now
+}
+
+// podar descarta los envíos de hace más de un minuto
+func (l *laneRate) podar(now time.Time) {
+	limite := now.Add(-time.Minute)
+	i := 0
+	for i < len(l.envios) && l.envios[i].Before(limite) {
+		i++
+	}
+	l.envios = l.envios[i:]
+}
+
+// ConfigureRateLimit configura el ritmo máximo de una salida en cajas/minuto (0 = sin límite)
+// y cuántas cajas puede recibir seguidas por sobre ese ritmo (mínimo 1)
+func (s *Sorter) ConfigureRateLimit(salidaID, maxRate, burst int) {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	s.rateMutex.Lock()
+	defer s.rateMutex.Unlock()
+
+	l := s.laneRateLocked(salidaID)
+	l.maxRate = maxRate
+	l.burst = burst
+	l.tokens = float64(burst)
+	l.recarga = time.Now()
+
+	if maxRate > 0 {
+		log.Printf("⏱️  Sorter #%d: Salida %d limitada a %d cajas/min (ráfaga %d)", s.ID, salidaID, maxRate, burst)
+	}
+}
+
+// laneRateLocked retorna (creando si no existe) el control de ritmo de una salida. Requiere rateMutex.
+func (s *Sorter) laneRateLocked(salidaID int) *laneRate {
+	l, exists := s.laneRates[salidaID]
+	if !exists {
+		l = &laneRate{recarga: time.Now()}
+		s.laneRates[salidaID] = l
+	}
+	return l
+}
+
+// hasRateLimits indica si alguna salida tiene ritmo máximo configurado
+func (s *Sorter) hasRateLimits() bool {
+	s.rateMutex.Lock()
+	defer s.rateMutex.Unlock()
+	for _, l := range s.laneRates {
+		if l.maxRate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ritmoExcedido indica si la salida superó su ritmo máximo (sin tokens disponibles)
+func (s *Sorter) ritmoExcedido(salidaID int) bool {
+	s.rateMutex.Lock()
+	defer s.rateMutex.Unlock()
+	l, exists := s.laneRates[salidaID]
+	if !exists || l.maxRate <= 0 {
+		return false
+	}
+	l.recargar(time.Now())
+	return l.tokens < 1
+}
+
+// filtrarPorRitmo descarta las salidas que superaron su ritmo máximo, aunque sean la única
+// candidata, para que la caja se desborde a su cadena de desborde o a la siguiente salida elegible.
+// Si no queda ninguna, determinarSalida decide explícitamente con getSalidaSaturada.
+func (s *Sorter) filtrarPorRitmo(candidatas []*shared.Salida) []*shared.Salida {
+	filtradas := make([]*shared.Salida, 0, len(candidatas))
+	for _, salida := range candidatas {
+		if s.ritmoExcedido(salida.ID) {
+			continue
+		}
+		filtradas = append(filtradas, salida)
+	}
+	return filtradas
+}
+
+// getSalidaSaturada elige, entre las candidatas disponibles saturadas por ritmo, la que tiene más
+// tokens (la menos excedida). Se usa cuando el SKU no tiene ninguna otra salida elegible, para
+// enviar la caja por sobre el ritmo en vez de a REJECT. Retorna nil si ninguna está disponible.
+func (s *Sorter) getSalidaSaturada(candidatas []*shared.Salida) *shared.Salida {
+	var elegida *shared.Salida
+	mejor := 0.0
+
+	now := time.Now()
+	s.rateMutex.Lock()
+	for _, salida := range candidatas {
+		if !salida.IsAvailable() {
+			continue
+		}
+		l, exists := s.laneRates[salida.ID]
+		if !exists || l.maxRate <= 0 {
+			continue
+		}
+		l.recargar(now)
+		if elegida == nil || l.tokens > mejor {
+			elegida = salida
+			mejor = l.tokens
+		}
+	}
+	s.rateMutex.Unlock()
+	return elegida
+}
+
+// filtrarCandidatas aplica los filtros de capacidad de mesa y de ritmo por salida
+func (s *Sorter) filtrarCandidatas(candidatas []*shared.Salida) []*shared.Salida {
+	return s.filtrarPorRitmo(s.filtrarPorCapacidad(candidatas))
+}
+
+// registrarEnvioSalida descuenta una caja del ritmo de la salida a la que fue enviada
+func (s *Sorter) registrarEnvioSalida(salidaID int) {
+	if salidaID <= 0 {
+		return
+	}
+
+	now := time.Now()
+	s.rateMutex.Lock()
+	l := s.laneRateLocked(salidaID)
+	l.podar(now)
+	l.envios = append(l.envios, now)
+
+	cambio := false
+	if l.maxRate > 0 {
+		l.recargar(now)
+		l.tokens--
+		saturada := l.tokens < 1
+		cambio = saturada != l.saturada
+		l.saturada = saturada
+	}
+	saturada := l.saturada
+	s.rateMutex.Unlock()
+
+	if cambio && saturada {
+		log.Printf("⏱️  Sorter #%d: Salida %d saturada por ritmo, desbordando a otras salidas", s.ID, salidaID)
+	}
+}
+
+// GetSalidaRates retorna el ritmo actual de cada salida con envíos o límite configurado
+func (s *Sorter) GetSalidaRates() []models.SalidaRate {
+	now := time.Now()
+
+	s.rateMutex.Lock()
+	rates := make([]models.SalidaRate, 0, len(s.laneRates))
+	for salidaID, l := range s.laneRates {
+		l.podar(now)
+		l.recargar(now)
+
+		rate := models.SalidaRate{
+			SalidaID: salidaID,
+			MaxRate:  l.maxRate,
+			Rate:     float64(len(l.envios)),
+		}
+		if l.maxRate > 0 {
+			rate.Burst = l.burst
+			rate.Tokens = l.tokens
+			rate.Saturacion = rate.Rate / float64(l.maxRate)
+			l.saturada = l.tokens < 1
+			rate.Saturada = l.saturada
+		}
+		rates = append(rates, rate)
+	}
+	s.rateMutex.Unlock()
+
+	sort.Slice(rates, func(i, j int) bool { return rates[i].SalidaID < rates[j].SalidaID })
+	return rates
+}
+
+// startRatePublisher publica periódicamente el ritmo de las salidas al WebSocket
+func (s *Sorter) startRatePublisher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.PublishSalidaRates(s.GetSalidaRates())
+		}
+	}
+}
+
+// PublishSalidaRates publica el ritmo y la saturación de las salidas al WebSocket
+func (s *Sorter) PublishSalidaRates(rates []models.SalidaRate) {
+	if s.wsHub == nil {
+		return
+	}
+
+	message := map[string]interface{}{
+		"type":      "salida_rates",
+		"sorter_id": s.ID,
+		"salidas":   rates,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Error al serializar salida_rates: %v", err)
+		return
+	}
+
+	roomName := fmt.Sprintf("assignment_%d", s.ID)
+	s.wsHub.Broadcast <- &listeners.BroadcastMessage{
+		RoomName: roomName,
+		Message:  jsonBytes,
+	}
+}
@@ -0,0 +1,79 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestFiltrarPorRitmo(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		limites  map[int]int // salidaID → burst (1 caja/min para que no recargue durante el test)
+		envios   []int
+		esperado []int
+	}{
+		{nombre: "sin límites", envios: []int{1, 1, 2}, esperado: []int{1, 2, 3}},
+		{nombre: "ráfaga no agotada", limites: map[int]int{1: 2}, envios: []int{1}, esperado: []int{1, 2, 3}},
+		{nombre: "salida saturada se descarta", limites: map[int]int{1: 1}, envios: []int{1}, esperado: []int{2, 3}},
+		{nombre: "todas saturadas", limites: map[int]int{1: 1, 2: 1, 3: 1}, envios: []int{1, 2, 3}, esperado: []int{}},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t,
+				salidaFixture{id: 1, skus: []string{"A"}},
+				salidaFixture{id: 2, skus: []string{"A"}},
+				salidaFixture{id: 3, skus: []string{"A"}},
+			)
+			for salidaID, burst := range caso.limites {
+				s.ConfigureRateLimit(salidaID, 1, burst)
+			}
+			for _, salidaID := range caso.envios {
+				s.registrarEnvioSalida(salidaID)
+			}
+
+			if got := idsDe(s.filtrarPorRitmo(s.salidasConSKU("A"))); !reflect.DeepEqual(got, caso.esperado) {
+				t.Errorf("filtrarPorRitmo = %v, esperado %v", got, caso.esperado)
+			}
+		})
+	}
+}
+
+// TestRitmoSalidaUnica verifica que una salida que es la única del SKU también se limita:
+// la caja se desborda por su cadena y, sin alternativa, se envía igual con razón explícita
+func TestRitmoSalidaUnica(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, tipo: "manual", skus: []string{"A"}},
+		salidaFixture{id: 2, tipo: "manual"},
+		salidaFixture{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+	)
+	s.ConfigureRateLimit(1, 1, 1)
+	s.ConfigureOverflow(map[int][]int{1: {2}})
+
+	decidir := func() (int, string) {
+		decision := &models.RoutingDecision{}
+		salida := s.determinarSalida(models.LecturaEvent{SKU: "A"}, decision)
+		s.registrarEnvioSalida(salida.ID)
+		return salida.ID, decision.Razon
+	}
+
+	if id, razon := decidir(); id != 1 || razon != models.RazonSKUAsignado {
+		t.Fatalf("primera caja → salida %d (%s), esperado 1 (%s)", id, razon, models.RazonSKUAsignado)
+	}
+	if id, razon := decidir(); id != 2 || razon != models.RazonDesborde {
+		t.Fatalf("segunda caja → salida %d (%s), esperado desborde a 2", id, razon)
+	}
+
+	// Sin cadena de desborde: la salida saturada recibe la caja igual, con la razón registrada
+	s.ConfigureOverflow(nil)
+	if id, razon := decidir(); id != 1 || razon != models.RazonRitmoExcedido {
+		t.Fatalf("tercera caja → salida %d (%s), esperado 1 (%s)", id, razon, models.RazonRitmoExcedido)
+	}
+
+	// Salida saturada y además bloqueada: REJECT
+	s.findSalidaByID(1).SetBloqueo(true)
+	if id, razon := decidir(); id != 9 || razon != models.RazonSalidasNoDisponibles {
+		t.Fatalf("cuarta caja → salida %d (%s), esperado REJECT 9 (%s)", id, razon, models.RazonSalidasNoDisponibles)
+	}
+}
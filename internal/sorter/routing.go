@@ -1,38 +1,76 @@
 package sorter
 
 import (
+	"API-GREENEX/internal/models"
 	"API-GREENEX/internal/shared"
 	"log"
 )
 
-// determinarSalida determina a qué salida debe ir la caja según el SKU/Calibre
-func (s *Sorter) determinarSalida(sku, calibre string) shared.Salida {
-	// Buscar salida con balance
-	if salida := s.getSalidaConBatchDistribution(sku); salida != nil {
+// determinarSalida determina a qué salida debe ir la caja según el SKU y sus atributos.
+// Registra en decision las candidatas evaluadas y la razón de la elección.
+func (s *Sorter) determinarSalida(evento models.LecturaEvent, decision *models.RoutingDecision) shared.Salida {
+	sku := evento.SKU
+
+	// Buscar salida con balance entre asignaciones explícitas
+	if salida := s.getSalidaConBatchDistribution(sku, decision); salida != nil {
+		decision.Razon = models.RazonSKUAsignado
 		return *salida
 	}
 
-	// Si no encuentra el SKU específico, buscar REJECT
-	if salida := s.getSalidaConBatchDistribution("REJECT"); salida != nil {
+	// Salidas del SKU no disponibles: recorrer sus cadenas de desborde
+	if candidatas := s.salidasConSKU(sku); len(candidatas) > 0 {
+		salida, saltos := s.getSalidaPorDesborde(candidatas)
+		decision.Desborde = saltos
+		if salida != nil {
+			log.Printf("🔀 Sorter #%d: SKU '%s' desbordado de salida %d a salida %d (saltos: %v)",
+				s.ID, sku, saltos[0], salida.ID, saltos)
+			decision.Razon = models.RazonDesborde
+			return *salida
+		}
+	}
+
+	// Buscar por reglas de atributos (variedad/calibre/embalaje/dark)
+	if salida, reglas := s.getSalidaPorReglas(evento, decision); salida != nil {
+		decision.Razon = models.RazonRegla
+		decision.Reglas = reglas
+		decision.Desborde = nil
 		return *salida
 	}
 
-	return s.getSalidaDescarte(sku)
-}
+	// Todas las salidas elegibles del SKU saturadas por ritmo: enviar igual a la menos excedida antes que a REJECT
+	if salida := s.getSalidaSaturada(s.salidasConSKU(sku)); salida != nil {
+		log.Printf("⏱️  Sorter #%d: SKU '%s' sin salida dentro de su ritmo, enviando igual a salida %d (saturada)",
+			s.ID, sku, salida.ID)
+		decision.Razon = models.RazonRitmoExcedido
+		decision.Desborde = nil
+		return *salida
+	}
 
-// getSalidaConBatchDistribution obtiene salida usando round-robin con validación de disponibilidad
-func (s *Sorter) getSalidaConBatchDistribution(sku string) *shared.Salida {
-	// Buscar TODAS las salidas que tienen este SKU en SKUs_Actuales
-	var todasLasSalidas []*shared.Salida
+	// Sin salida propia: distinguir SKU sin asignación de salidas asignadas no disponibles
+	decision.Razon = models.RazonSinAsignacion
+	if len(decision.Candidatas) > 0 {
+		decision.Razon = models.RazonSalidasNoDisponibles
+	}
 
-	for i := range s.Salidas {
-		for _, skuConfig := range s.Salidas[i].SKUs_Actuales {
-			if skuConfig.SKU == sku {
-				todasLasSalidas = append(todasLasSalidas, &s.Salidas[i])
-				break
-			}
-		}
+	// Si no encuentra el SKU específico, buscar REJECT (su estado queda en la auditoría)
+	decision.RecordCandidates(candidatosDeSalidas(s.salidasConSKU("REJECT")))
+	if salida := s.getSalidaConBatchDistribution("REJECT", nil); salida != nil {
+		return *salida
+	}
+
+	salida := s.getSalidaDescarte(sku)
+	if salida.ID == 0 {
+		decision.Razon = models.RazonRejectNoDisponible
 	}
+	return salida
+}
+
+// getSalidaConBatchDistribution obtiene salida delegando en la estrategia de ruteo configurada
+// (por defecto round-robin por batch_size) con validación de disponibilidad.
+// Si decision != nil registra las candidatas, la estrategia y el índice del balance.
+func (s *Sorter) getSalidaConBatchDistribution(sku string, decision *models.RoutingDecision) *shared.Salida {
+	// Buscar TODAS las salidas que tienen este SKU en SKUs_Actuales
+	todasLasSalidas := s.salidasConSKU(sku)
 
 	// DEBUG: Ver qué encontró
 	if len(todasLasSalidas) == 0 {
@@ -47,67 +85,53 @@ func (s *Sorter) getSalidaConBatchDistribution(sku string) *shared.Salida {
 	}
 	log.Printf("[Sorter %d] ✓ SKU '%s' found in %d salida(s): %v", s.ID, sku, len(todasLasSalidas), salidaIDs)
 
-	// Si solo hay una salida, retornarla si está disponible
-	if len(todasLasSalidas) == 1 {
-		if todasLasSalidas[0].IsAvailable() {
-			return todasLasSalidas[0]
+	strategy := s.strategyForSKU(sku)
+	if decision != nil {
+		decision.Estrategia = strategy.Name()
+		decision.RecordCandidates(candidatosDeSalidas(todasLasSalidas))
+		if strategy.Name() == StrategyBatchRoundRobin {
+			decision.BatchIndex = s.batchIndex(sku)
 		}
-		// 🚨 LOG CRÍTICO: Por qué la salida NO está disponible
-		log.Printf("🚨 [Sorter %d] Salida ID=%d NO disponible para SKU '%s' (Estado=%d, Bloqueo=%t)",
-			s.ID, todasLasSalidas[0].ID, sku,
-			todasLasSalidas[0].GetEstado(), todasLasSalidas[0].GetBloqueo())
-		return nil
+	}
+	if salida := strategy.Select(sku, todasLasSalidas, s.filtrarCandidatas(todasLasSalidas)); salida != nil {
+		return salida
 	}
 
-	// Múltiples salidas: usar round-robin con batch_size
-	s.batchMutex.Lock()
-	defer s.batchMutex.Unlock()
+	// Ninguna salida disponible
+	log.Printf("🚨 [Sorter %d] SKU '%s': Ninguna de las %d salidas está disponible (bloqueadas/llenas/saturadas por ritmo, estrategia=%s)",
+		s.ID, sku, len(todasLasSalidas), strategy.Name())
+	return nil
+}
 
-	// Obtener o crear distribuidor para este SKU
-	bd, exists := s.batchCounters[sku]
-	if !exists {
-		// Primera vez: crear distribuidor en índice 0
-		s.batchCounters[sku] = &BatchDistributor{
-			CurrentIndex: 0,
-			CurrentCount: 0,
-		}
-		bd = s.batchCounters[sku]
-		log.Printf("[Sorter %d] ⚖️ Balance activated for SKU '%s' with %d lanes", s.ID, sku, len(todasLasSalidas))
-	}
-
-	// Buscar salida disponible empezando desde índice actual
-	startIdx := bd.CurrentIndex
-	for attempts := 0; attempts < len(todasLasSalidas); attempts++ {
-		idx := (startIdx + attempts) % len(todasLasSalidas)
-		salida := todasLasSalidas[idx]
-
-		if salida.IsAvailable() {
-			// ✅ Incrementar contador de cajas enviadas a esta salida
-			bd.CurrentCount++
-
-			// ✅ Si alcanzamos el batch_size, rotar a la siguiente salida
-			if bd.CurrentCount >= salida.BatchSize {
-				bd.CurrentIndex = (idx + 1) % len(todasLasSalidas)
-				bd.CurrentCount = 0
-				log.Printf("[Sorter %d] 🔄 SKU '%s': Batch completado en salida %d (%d cajas), rotando a siguiente",
-					s.ID, sku, salida.ID, salida.BatchSize)
-			} else {
-				// Mantener en la misma salida (batch no completado)
-				bd.CurrentIndex = idx
+// salidasConSKU retorna las salidas que tienen el SKU en SKUs_Actuales (en orden de configuración)
+func (s *Sorter) salidasConSKU(sku string) []*shared.Salida {
+	var salidas []*shared.Salida
+	for i := range s.Salidas {
+		for _, skuConfig := range s.Salidas[i].SKUs_Actuales {
+			if skuConfig.SKU == sku {
+				salidas = append(salidas, &s.Salidas[i])
+				break
 			}
+		}
+	}
+	return salidas
+}
 
-			return salida
+// candidatosDeSalidas toma una foto del estado de las salidas candidatas para la auditoría
+func candidatosDeSalidas(salidas []*shared.Salida) []models.RoutingCandidate {
+	candidatos := make([]models.RoutingCandidate, len(salidas))
+	for i, salida := range salidas {
+		candidatos[i] = models.RoutingCandidate{
+			SalidaID:   salida.ID,
+			Estado:     salida.GetEstado(),
+			Bloqueo:    salida.GetBloqueo(),
+			Disponible: salida.IsAvailable(),
 		}
-		// 🚨 LOG: Por qué esta salida no está disponible
-		log.Printf("⚠️  [Sorter %d] Salida ID=%d NO disponible (intento %d/%d) para SKU '%s' (Estado=%d, Bloqueo=%t)",
-			s.ID, salida.ID, attempts+1, len(todasLasSalidas), sku,
-			salida.GetEstado(), salida.GetBloqueo())
 	}
+	return candidatos
+}
 
-	// Ninguna salida disponible
-	log.Printf("🚨 [Sorter %d] SKU '%s': Ninguna de las %d salidas está disponible (todas bloqueadas/llenas)", s.ID, sku, len(todasLasSalidas))
-	return nil
-} // getSalidaDescarte obtiene salida de descarte como último recurso
+// getSalidaDescarte obtiene salida de descarte como último recurso
 // SOLO usa la salida con SKU "REJECT" asignado, no cualquier salida manual
 func (s *Sorter) getSalidaDescarte(sku string) shared.Salida {
 	// Buscar SOLO la salida que tiene "REJECT" asignado
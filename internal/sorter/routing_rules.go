@@ -0,0 +1,137 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/db"
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// SetRoutingRules reemplaza las reglas de ruteo por atributos del sorter
+func (s *Sorter) SetRoutingRules(rules []models.RoutingRule) {
+	ordenadas := make([]models.RoutingRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.SorterID == s.ID {
+			ordenadas = append(ordenadas, rule)
+		}
+	}
+	sort.SliceStable(ordenadas, func(i, j int) bool {
+		return ordenadas[i].Prioridad > ordenadas[j].Prioridad
+	})
+
+	s.rulesMutex.Lock()
+	s.routingRules = ordenadas
+	s.rulesMutex.Unlock()
+}
+
+// GetRoutingRules retorna una copia de las reglas de ruteo activas en memoria
+func (s *Sorter) GetRoutingRules() []models.RoutingRule {
+	s.rulesMutex.RLock()
+	defer s.rulesMutex.RUnlock()
+
+	rules := make([]models.RoutingRule, len(s.routingRules))
+	copy(rules, s.routingRules)
+	return rules
+}
+
+// ReloadRoutingRules recarga las reglas de ruteo del sorter desde PostgreSQL
+func (s *Sorter) ReloadRoutingRules(ctx context.Context) error {
+	if s.dbManager == nil {
+		return fmt.Errorf("dbManager no inicializado")
+	}
+
+	pgManager, ok := s.dbManager.(*db.PostgresManager)
+	if !ok {
+		return fmt.Errorf("dbManager no es un PostgresManager válido")
+	}
+
+	rules, err := pgManager.GetRoutingRules(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+
+	s.SetRoutingRules(rules)
+	log.Printf("🧭 Sorter #%d: %d regla(s) de ruteo cargada(s) desde BD", s.ID, len(rules))
+	return nil
+}
+
+// getSalidaPorReglas busca una salida usando las reglas por atributos y la estrategia de ruteo del SKU.
+// Retorna también los IDs de las reglas que coincidieron en el nivel elegido.
+func (s *Sorter) getSalidaPorReglas(evento models.LecturaEvent, decision *models.RoutingDecision) (*shared.Salida, []int) {
+	salida, reglasIDs, prioridad := s.seleccionarPorReglas(evento, s.strategyForSKU(evento.SKU), decision)
+	if salida != nil {
+		log.Printf("[Sorter %d] 🧭 SKU '%s' ruteado por regla(s) %v (prioridad %d) → salida %d",
+			s.ID, evento.SKU, reglasIDs, prioridad, salida.ID)
+	}
+	return salida, reglasIDs
+}
+
+// seleccionarPorReglas evalúa las reglas por nivel de prioridad: todas las salidas de las reglas
+// que coinciden en el nivel más alto se reparten con la estrategia indicada; si ninguna está
+// disponible se pasa al siguiente nivel. Retorna la salida elegida, las reglas y la prioridad usadas.
+// Si decision != nil registra las salidas de cada nivel evaluado.
+func (s *Sorter) seleccionarPorReglas(evento models.LecturaEvent, strategy RoutingStrategy, decision *models.RoutingDecision) (*shared.Salida, []int, int) {
+	s.rulesMutex.RLock()
+	rules := s.routingRules
+	s.rulesMutex.RUnlock()
+
+	if len(rules) == 0 {
+		return nil, nil, 0
+	}
+
+	nombreVariedad := nombreVariedadFromSKU(evento.SKU, evento.Calibre, evento.Embalaje, evento.Dark)
+
+	for i := 0; i < len(rules); {
+		prioridad := rules[i].Prioridad
+		var candidatas []*shared.Salida
+		var reglasIDs []int
+		for ; i < len(rules) && rules[i].Prioridad == prioridad; i++ {
+			rule := &rules[i]
+			if !rule.Matches(evento.Calibre, evento.Variedad, nombreVariedad, evento.Embalaje, evento.Dark) {
+				continue
+			}
+			salida := s.findSalidaByID(rule.SalidaID)
+			if salida == nil || containsSalida(candidatas, salida.ID) {
+				continue
+			}
+			candidatas = append(candidatas, salida)
+			reglasIDs = append(reglasIDs, rule.ID)
+		}
+
+		if len(candidatas) == 0 {
+			continue
+		}
+		if decision != nil {
+			decision.RecordCandidates(candidatosDeSalidas(candidatas))
+		}
+
+		if salida := strategy.Select(evento.SKU, candidatas, s.filtrarCandidatas(candidatas)); salida != nil {
+			return salida, reglasIDs, prioridad
+		}
+	}
+
+	return nil, nil, 0
+}
+
+// nombreVariedadFromSKU extrae el nombre de variedad del SKU "calibre-NOMBRE-embalaje-dark"
+func nombreVariedadFromSKU(sku, calibre, embalaje string, dark int) string {
+	nombre := strings.TrimPrefix(sku, calibre+"-")
+	nombre = strings.TrimSuffix(nombre, fmt.Sprintf("-%s-%d", embalaje, dark))
+	if nombre == sku {
+		return ""
+	}
+	return nombre
+}
+
+func containsSalida(salidas []*shared.Salida, salidaID int) bool {
+	for _, salida := range salidas {
+		if salida.ID == salidaID {
+			return true
+		}
+	}
+	return false
+}
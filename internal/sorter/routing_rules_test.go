@@ -0,0 +1,188 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestRoutingRuleMatches(t *testing.T) {
+	cero, uno := 0, 1
+	casos := []struct {
+		nombre string
+		regla  models.RoutingRule
+		dark   int
+		espera bool
+	}{
+		{"listas vacías aceptan todo", models.RoutingRule{}, 0, true},
+		{"asterisco acepta todo", models.RoutingRule{Variedades: []string{"*"}, Calibres: []string{"*"}}, 1, true},
+		{"comodín de prefijo", models.RoutingRule{Embalajes: []string{"CEMD*"}}, 0, true},
+		{"comodín de un carácter", models.RoutingRule{Calibres: []string{"X?"}}, 0, true},
+		{"comodín que no coincide", models.RoutingRule{Embalajes: []string{"CEMX*"}}, 0, false},
+		{"mayúsculas y espacios ignorados", models.RoutingRule{Variedades: []string{" v018 "}}, 0, true},
+		{"variedad por nombre", models.RoutingRule{Variedades: []string{"LAP*"}}, 0, true},
+		{"variedad distinta", models.RoutingRule{Variedades: []string{"V099", "SANTINA"}}, 0, false},
+		{"alguno de varios patrones", models.RoutingRule{Calibres: []string{"J", "XL"}}, 0, true},
+		{"calibre distinto", models.RoutingRule{Calibres: []string{"J"}}, 0, false},
+		{"dark nil acepta cualquiera", models.RoutingRule{}, 1, true},
+		{"dark coincide", models.RoutingRule{Dark: &uno}, 1, true},
+		{"dark distinto", models.RoutingRule{Dark: &cero}, 1, false},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			caso.regla.Activa = true
+			if got := caso.regla.Matches("XL", "V018", "LAPINS", "CEMDL5", caso.dark); got != caso.espera {
+				t.Errorf("Matches = %v, esperado %v", got, caso.espera)
+			}
+		})
+	}
+
+	inactiva := models.RoutingRule{}
+	if inactiva.Matches("XL", "V018", "LAPINS", "CEMDL5", 0) {
+		t.Error("regla inactiva coincide")
+	}
+}
+
+func TestSeleccionarPorReglas(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		reglas    []models.RoutingRule
+		salidas   []int // salida elegida en lecturas sucesivas (0 = ninguna)
+		reglasIDs []int
+		prioridad int
+	}{
+		{
+			nombre: "mayor prioridad primero",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 4, Prioridad: 5, Variedades: []string{"V018"}, Activa: true},
+				{ID: 2, SalidaID: 5, Prioridad: 10, Variedades: []string{"V0*"}, Activa: true},
+			},
+			salidas:   []int{5, 5},
+			reglasIDs: []int{2},
+			prioridad: 10,
+		},
+		{
+			nombre: "empate de prioridad se reparte con la estrategia",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 4, Prioridad: 10, Variedades: []string{"V018"}, Activa: true},
+				{ID: 2, SalidaID: 5, Prioridad: 10, Calibres: []string{"1"}, Activa: true},
+				{ID: 3, SalidaID: 6, Prioridad: 1, Activa: true},
+			},
+			salidas:   []int{4, 5, 4},
+			reglasIDs: []int{1, 2},
+			prioridad: 10,
+		},
+		{
+			nombre: "empate con la misma salida no la duplica",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 4, Prioridad: 10, Activa: true},
+				{ID: 2, SalidaID: 4, Prioridad: 10, Activa: true},
+			},
+			salidas:   []int{4, 4},
+			reglasIDs: []int{1},
+			prioridad: 10,
+		},
+		{
+			nombre: "nivel sin salida disponible pasa al siguiente",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 3, Prioridad: 10, Activa: true},
+				{ID: 2, SalidaID: 6, Prioridad: 5, Activa: true},
+			},
+			salidas:   []int{6},
+			reglasIDs: []int{2},
+			prioridad: 5,
+		},
+		{
+			nombre: "regla que no coincide se ignora en su nivel",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 4, Prioridad: 10, Embalajes: []string{"CEM*"}, Activa: true},
+				{ID: 2, SalidaID: 5, Prioridad: 10, Embalajes: []string{"X"}, Activa: true},
+			},
+			salidas:   []int{5, 5},
+			reglasIDs: []int{2},
+			prioridad: 10,
+		},
+		{
+			nombre: "sin coincidencias",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 4, Variedades: []string{"V099"}, Activa: true},
+				{ID: 2, SalidaID: 5, Activa: false},
+			},
+			salidas: []int{0},
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t,
+				salidaFixture{id: 3, bloqueo: true},
+				salidaFixture{id: 4},
+				salidaFixture{id: 5},
+				salidaFixture{id: 6},
+			)
+			for i := range caso.reglas {
+				caso.reglas[i].SorterID = s.ID
+			}
+			s.SetRoutingRules(caso.reglas)
+			strategy := &batchRoundRobinStrategy{sorter: s}
+			evento := models.LecturaEvent{SKU: "1-LAPINS-X-0", Calibre: "1", Variedad: "V018", Embalaje: "X"}
+
+			for i, esperada := range caso.salidas {
+				salida, reglasIDs, prioridad := s.seleccionarPorReglas(evento, strategy, nil)
+				if esperada == 0 {
+					if salida != nil {
+						t.Fatalf("lectura %d: salida %d, esperado ninguna", i, salida.ID)
+					}
+					continue
+				}
+				if salida == nil || salida.ID != esperada {
+					t.Fatalf("lectura %d: salida %v, esperado %d", i, salida, esperada)
+				}
+				if !reflect.DeepEqual(reglasIDs, caso.reglasIDs) || prioridad != caso.prioridad {
+					t.Errorf("lectura %d: reglas %v (prioridad %d), esperado %v (prioridad %d)",
+						i, reglasIDs, prioridad, caso.reglasIDs, caso.prioridad)
+				}
+			}
+		})
+	}
+}
+
+// TestDeterminarSalidaSinReglaRepartePorBatch verifica que una caja sin regla que coincida
+// siga el reparto por batch de su SKU o, sin asignación, el de las salidas REJECT
+func TestDeterminarSalidaSinReglaRepartePorBatch(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		sku     string
+		salidas []int
+		razon   string
+	}{
+		{"SKU asignado", "1-LAPINS-X-0", []int{4, 5, 4}, models.RazonSKUAsignado},
+		{"SKU sin asignación", "2-LAPINS-X-0", []int{8, 9, 8}, models.RazonSinAsignacion},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t,
+				salidaFixture{id: 4, skus: []string{"1-LAPINS-X-0"}},
+				salidaFixture{id: 5, skus: []string{"1-LAPINS-X-0"}},
+				salidaFixture{id: 6},
+				salidaFixture{id: 8, tipo: "manual", skus: []string{"REJECT"}},
+				salidaFixture{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			)
+			s.SetRoutingRules([]models.RoutingRule{
+				{ID: 1, SorterID: s.ID, SalidaID: 6, Variedades: []string{"V099"}, Activa: true},
+			})
+			evento := models.LecturaEvent{SKU: caso.sku, Calibre: "1", Variedad: "V018", Embalaje: "X"}
+
+			for i, esperada := range caso.salidas {
+				decision := &models.RoutingDecision{}
+				salida := s.determinarSalida(evento, decision)
+				if salida.ID != esperada || decision.Razon != caso.razon || decision.Reglas != nil {
+					t.Fatalf("lectura %d: salida %d (%s, reglas %v), esperado %d (%s)",
+						i, salida.ID, decision.Razon, decision.Reglas, esperada, caso.razon)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Nombres de las estrategias de ruteo disponibles (valores válidos en config.yaml)
+const (
+	StrategyBatchRoundRobin   = "batch_round_robin"
+	StrategyWeighted          = "weighted"
+	StrategyLeastRecentlyUsed = "least_recently_used"
+	StrategyLeastFilled       = "least_filled"
+)
+
+// RoutingStrategy decide cuál de las salidas candidatas recibe la próxima caja de un SKU.
+// Las candidatas son todas las salidas que tienen el SKU asignado (definen el estado de la
+// estrategia) y elegibles el subconjunto que pasó los filtros de capacidad y ritmo. La estrategia
+// solo elige entre las elegibles y es responsable de descartar las no disponibles (IsAvailable).
+type RoutingStrategy interface {
+	Name() string
+	Select(sku string, candidatas, elegibles []*shared.Salida) *shared.Salida
+	Reset()
+}
+
+// NewRoutingStrategy crea una estrategia de ruteo por nombre para el sorter indicado.
+// weights solo se usa en la estrategia "weighted" (key=salidaID).
+func NewRoutingStrategy(name string, s *Sorter, weights map[int]int) (RoutingStrategy, error) {
+	switch name {
+	case "", StrategyBatchRoundRobin:
+		return &batchRoundRobinStrategy{sorter: s}, nil
+	case StrategyWeighted:
+		return newWeightedStrategy(weights), nil
+	case StrategyLeastRecentlyUsed:
+		return newLeastRecentlyUsedStrategy(), nil
+	case StrategyLeastFilled:
+		return newLeastFilledStrategy(s.mesaFill), nil
+	default:
+		return nil, fmt.Errorf("estrategia de ruteo desconocida: '%s'", name)
+	}
+}
+
+// ConfigureRouting define la estrategia por defecto del sorter y, opcionalmente, estrategias por SKU
+func (s *Sorter) ConfigureRouting(defaultStrategy string, skuStrategies map[string]string, weights map[int]int) error {
+	def, err := NewRoutingStrategy(defaultStrategy, s, weights)
+	if err != nil {
+		return err
+	}
+
+	// Reutilizar una instancia por nombre para compartir estado entre SKUs
+	instancias := map[string]RoutingStrategy{def.Name(): def}
+	porSKU := make(map[string]RoutingStrategy, len(skuStrategies))
+	for sku, name := range skuStrategies {
+		if name == "" {
+			name = StrategyBatchRoundRobin
+		}
+		strategy, ok := instancias[name]
+		if !ok {
+			strategy, err = NewRoutingStrategy(name, s, weights)
+			if err != nil {
+				return fmt.Errorf("SKU '%s': %w", sku, err)
+			}
+			instancias[name] = strategy
+		}
+		porSKU[sku] = strategy
+	}
+
+	s.routingMutex.Lock()
+	s.routingStrategy = def
+	s.skuStrategies = porSKU
+	s.routingWeights = weights
+	s.routingMutex.Unlock()
+
+	log.Printf("🧭 Sorter #%d: Estrategia de ruteo '%s' (%d override(s) por SKU)", s.ID, def.Name(), len(porSKU))
+	return nil
+}
+
+// strategyForSKU retorna la estrategia aplicable al SKU (override por SKU o la del sorter)
+func (s *Sorter) strategyForSKU(sku string) RoutingStrategy {
+	s.routingMutex.RLock()
+	defer s.routingMutex.RUnlock()
+
+	if strategy, ok := s.skuStrategies[sku]; ok {
+		return strategy
+	}
+	return s.routingStrategy
+}
+
+// resetRoutingStrategies reinicia el estado interno de todas las estrategias configuradas
+func (s *Sorter) resetRoutingStrategies() {
+	s.routingMutex.RLock()
+	defer s.routingMutex.RUnlock()
+
+	s.routingStrategy.Reset()
+	for _, strategy := range s.skuStrategies {
+		strategy.Reset()
+	}
+}
+
+// ============================================================================
+// Batch round-robin (comportamiento histórico)
+// ============================================================================
+
+// batchRoundRobinStrategy envía BatchSize cajas seguidas a cada salida y luego rota.
+// Por defecto usa (y persiste) el estado de balance del sorter; si counters != nil
+// mantiene su propio estado en memoria (usado por el ruteo en sombra).
+type batchRoundRobinStrategy struct {
+	sorter   *Sorter
+	counters map[string]*BatchDistributor
+	mu       sync.Mutex
+}
+
+// newShadowBatchRoundRobinStrategy crea un batch round-robin con estado propio que no toca el balance real
+func newShadowBatchRoundRobinStrategy(s *Sorter) *batchRoundRobinStrategy {
+	return &batchRoundRobinStrategy{sorter: s, counters: make(map[string]*BatchDistributor)}
+}
+
+func (b *batchRoundRobinStrategy) Name() string { return StrategyBatchRoundRobin }
+
+// Reset no hace nada para el estado del sorter: el estado de batch se persiste en BD, se poda
+// en UpdateSKUs y se reinicia explícitamente con ResetBatchDistributor
+func (b *batchRoundRobinStrategy) Reset() {
+	if b.counters != nil {
+		b.mu.Lock()
+		b.counters = make(map[string]*BatchDistributor)
+		b.mu.Unlock()
+	}
+}
+
+func (b *batchRoundRobinStrategy) Select(sku string, candidatas, elegibles []*shared.Salida) *shared.Salida {
+	s := b.sorter
+	persistente := b.counters == nil
+
+	// Si solo hay una salida, retornarla si está disponible
+	if len(candidatas) == 1 {
+		if candidatas[0].IsAvailable() && containsSalida(elegibles, candidatas[0].ID) {
+			return candidatas[0]
+		}
+		if persistente {
+			// 🚨 LOG CRÍTICO: Por qué la salida NO está disponible
+			log.Printf("🚨 [Sorter %d] Salida ID=%d NO disponible para SKU '%s' (Estado=%d, Bloqueo=%t, elegible=%t)",
+				s.ID, candidatas[0].ID, sku,
+				candidatas[0].GetEstado(), candidatas[0].GetBloqueo(), containsSalida(elegibles, candidatas[0].ID))
+		}
+		return nil
+	}
+
+	// Múltiples salidas: usar round-robin con batch_size
+	counters := b.counters
+	if persistente {
+		s.batchMutex.Lock()
+		defer s.batchMutex.Unlock()
+		counters = s.batchCounters
+	} else {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+	}
+
+	// El balance se identifica por todas las salidas del SKU: que una salida quede retenida
+	// o saturada por ritmo no cambia su conjunto ni reinicia el batch en curso
+	ids := make([]int, len(candidatas))
+	for i, salida := range candidatas {
+		ids[i] = salida.ID
+	}
+
+	// Obtener o crear distribuidor para este SKU
+	bd, exists := counters[sku]
+	if !exists {
+		// Primera vez: crear distribuidor en índice 0
+		bd = &BatchDistributor{
+			Salidas:      ids,
+			CurrentIndex: 0,
+			CurrentCount: 0,
+		}
+		counters[sku] = bd
+		if persistente {
+			log.Printf("[Sorter %d] ⚖️ Balance activated for SKU '%s' with %d lanes", s.ID, sku, len(candidatas))
+		}
+	} else if bd.syncBatchSalidas(ids) && persistente {
+		s.markBatchDirty(sku)
+		log.Printf("[Sorter %d] ⚖️ SKU '%s': salidas del balance cambiaron → %v (índice %d)", s.ID, sku, ids, bd.CurrentIndex)
+	}
+
+	// Salida del batch en curso: si está disponible y elegible, recibe la caja y avanza el balance
+	idx := bd.CurrentIndex % len(candidatas)
+	if salida := candidatas[idx]; salida.IsAvailable() && containsSalida(elegibles, salida.ID) {
+		// ✅ Incrementar contador de cajas enviadas a esta salida
+		bd.CurrentCount++
+
+		// ✅ Si alcanzamos el batch_size, rotar a la siguiente salida
+		if bd.CurrentCount >= salida.BatchSize {
+			bd.CurrentIndex = (idx + 1) % len(candidatas)
+			bd.CurrentCount = 0
+			if persistente {
+				log.Printf("[Sorter %d] 🔄 SKU '%s': Batch completado en salida %d (%d cajas), rotando a siguiente",
+					s.ID, sku, salida.ID, salida.BatchSize)
+			}
+		} else {
+			// Mantener en la misma salida (batch no completado)
+			bd.CurrentIndex = idx
+		}
+		if persistente {
+			s.markBatchDirty(sku)
+		}
+		return salida
+	}
+
+	// Salida en curso no disponible, retenida o saturada: la caja va a la siguiente elegible
+	// sin mover el balance, y el batch se retoma cuando la salida vuelva
+	for attempts := 1; attempts < len(candidatas); attempts++ {
+		salida := candidatas[(idx+attempts)%len(candidatas)]
+		if salida.IsAvailable() && containsSalida(elegibles, salida.ID) {
+			return salida
+		}
+		if persistente {
+			// 🚨 LOG: Por qué esta salida no está disponible
+			log.Printf("⚠️  [Sorter %d] Salida ID=%d NO disponible (intento %d/%d) para SKU '%s' (Estado=%d, Bloqueo=%t)",
+				s.ID, salida.ID, attempts+1, len(candidatas), sku,
+				salida.GetEstado(), salida.GetBloqueo())
+		}
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Weighted split (smooth weighted round-robin)
+// ============================================================================
+
+// weightedStrategy reparte las cajas proporcionalmente al peso configurado de cada salida
+type weightedStrategy struct {
+	weights map[int]int            // salidaID -> peso configurado
+	current map[string]map[int]int // sku -> salidaID -> peso acumulado
+	mu      sync.Mutex
+}
+
+func newWeightedStrategy(weights map[int]int) *weightedStrategy {
+	return &weightedStrategy{
+		weights: weights,
+		current: make(map[string]map[int]int),
+	}
+}
+
+func (w *weightedStrategy) Name() string { return StrategyWeighted }
+
+func (w *weightedStrategy) Reset() {
+	w.mu.Lock()
+	w.current = make(map[string]map[int]int)
+	w.mu.Unlock()
+}
+
+// weightOf retorna el peso de la salida (default 1)
+func (w *weightedStrategy) weightOf(salidaID int) int {
+	if weight, ok := w.weights[salidaID]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+func (w *weightedStrategy) Select(sku string, _, elegibles []*shared.Salida) *shared.Salida {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	acumulado, ok := w.current[sku]
+	if !ok {
+		acumulado = make(map[int]int)
+		w.current[sku] = acumulado
+	}
+
+	var elegida *shared.Salida
+	total := 0
+	for _, salida := range elegibles {
+		if !salida.IsAvailable() {
+			continue
+		}
+		weight := w.weightOf(salida.ID)
+		acumulado[salida.ID] += weight
+		total += weight
+		if elegida == nil || acumulado[salida.ID] > acumulado[elegida.ID] {
+			elegida = salida
+		}
+	}
+
+	if elegida != nil {
+		acumulado[elegida.ID] -= total
+	}
+	return elegida
+}
+
+// ============================================================================
+// Least-recently-used lane
+// ============================================================================
+
+// leastRecentlyUsedStrategy envía la caja a la salida disponible que lleva más tiempo sin recibir una
+type leastRecentlyUsedStrategy struct {
+	lastUsed map[int]time.Time // salidaID -> última caja enviada
+	mu       sync.Mutex
+}
+
+func newLeastRecentlyUsedStrategy() *leastRecentlyUsedStrategy {
+	return &leastRecentlyUsedStrategy{lastUsed: make(map[int]time.Time)}
+}
+
+func (l *leastRecentlyUsedStrategy) Name() string { return StrategyLeastRecentlyUsed }
+
+func (l *leastRecentlyUsedStrategy) Reset() {
+	l.mu.Lock()
+	l.lastUsed = make(map[int]time.Time)
+	l.mu.Unlock()
+}
+
+func (l *leastRecentlyUsedStrategy) Select(sku string, _, elegibles []*shared.Salida) *shared.Salida {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var elegida *shared.Salida
+	for _, salida := range elegibles {
+		if !salida.IsAvailable() {
+			continue
+		}
+		if elegida == nil || l.lastUsed[salida.ID].Before(l.lastUsed[elegida.ID]) {
+			elegida = salida
+		}
+	}
+
+	if elegida != nil {
+		l.lastUsed[elegida.ID] = time.Now()
+	}
+	return elegida
+}
+
+// ============================================================================
+// Least-filled mesa
+// ============================================================================
+
+// MesaFillFunc retorna el llenado del pallet en la mesa de una salida.
+// ok=false si la salida no tiene mesa o no hay dato vigente.
+type MesaFillFunc func(salida *shared.Salida) (fill models.MesaFill, ok bool)
+
+// leastFilledStrategy envía la caja a la salida cuya mesa tiene más espacio libre en el pallet actual.
+// Las salidas sin información de llenado se consideran sin espacio (solo se usan si no hay otra).
+type leastFilledStrategy struct {
+	fill MesaFillFunc
+	lru  *leastRecentlyUsedStrategy // desempate entre salidas con el mismo espacio
+}
+
+func newLeastFilledStrategy(fill MesaFillFunc) *leastFilledStrategy {
+	return &leastFilledStrategy{fill: fill, lru: newLeastRecentlyUsedStrategy()}
+}
+
+func (f *leastFilledStrategy) Name() string { return StrategyLeastFilled }
+
+func (f *leastFilledStrategy) Reset() { f.lru.Reset() }
+
+func (f *leastFilledStrategy) Select(sku string, _, elegibles []*shared.Salida) *shared.Salida {
+	var mejores []*shared.Salida
+	mejorEspacio := -2
+	for _, salida := range elegibles {
+		if !salida.IsAvailable() {
+			continue
+		}
+		espacio := -1
+		if fill, ok := f.fill(salida); ok {
+			espacio = fill.Restantes
+		}
+		switch {
+		case espacio > mejorEspacio:
+			mejorEspacio = espacio
+			mejores = []*shared.Salida{salida}
+		case espacio == mejorEspacio:
+			mejores = append(mejores, salida)
+		}
+	}
+
+	return f.lru.Select(sku, mejores, mejores)
+}
@@ -0,0 +1,61 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/shared"
+	"testing"
+)
+
+// TestBatchRoundRobinSaltaSalidaFiltrada verifica que una salida retenida o saturada por ritmo
+// se salte sin reescribir el balance ni reiniciar el batch en curso
+func TestBatchRoundRobinSaltaSalidaFiltrada(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 2, skus: []string{"A"}},
+		salidaFixture{id: 3, skus: []string{"A"}},
+	)
+	for i := range s.Salidas {
+		s.Salidas[i].BatchSize = 2
+	}
+	strategy := &batchRoundRobinStrategy{sorter: s}
+	todas := s.salidasConSKU("A")
+	sinPrimera := []*shared.Salida{todas[1], todas[2]}
+
+	pasos := []struct {
+		elegibles []*shared.Salida
+		salidaID  int
+		index     int
+		count     int
+	}{
+		{todas, 1, 0, 1},
+		{sinPrimera, 2, 0, 1}, // salida 1 saturada: la caja va a la 2 y el batch de la 1 queda intacto
+		{sinPrimera, 2, 0, 1},
+		{todas, 1, 1, 0}, // la salida 1 vuelve y completa su batch
+		{todas, 2, 1, 1},
+	}
+	for i, paso := range pasos {
+		salida := strategy.Select("A", todas, paso.elegibles)
+		if salida == nil || salida.ID != paso.salidaID {
+			t.Fatalf("paso %d: salida %v, esperado %d", i, salida, paso.salidaID)
+		}
+		bd := s.batchCounters["A"]
+		if !equalInts(bd.Salidas, []int{1, 2, 3}) || bd.CurrentIndex != paso.index || bd.CurrentCount != paso.count {
+			t.Fatalf("paso %d: balance = %+v, esperado índice %d, cuenta %d", i, bd, paso.index, paso.count)
+		}
+	}
+}
+
+func TestBatchRoundRobinSinElegibles(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 2, skus: []string{"A"}, bloqueo: true},
+	)
+	strategy := &batchRoundRobinStrategy{sorter: s}
+	todas := s.salidasConSKU("A")
+
+	if salida := strategy.Select("A", todas, []*shared.Salida{todas[1]}); salida != nil {
+		t.Fatalf("salida %d elegida, ninguna elegible está disponible", salida.ID)
+	}
+	if salida := strategy.Select("A", todas[:1], nil); salida != nil {
+		t.Fatalf("salida única no elegible %d elegida", salida.ID)
+	}
+}
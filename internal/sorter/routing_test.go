@@ -0,0 +1,174 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestDeterminarSalidaAuditaReglasYReject(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		reglas     []models.RoutingRule
+		salidaID   int
+		razon      string
+		candidatas []models.RoutingCandidate
+	}{
+		{
+			nombre: "regla de menor prioridad tras salida bloqueada",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 3, Prioridad: 10, Variedades: []string{"V018"}, Activa: true},
+				{ID: 2, SalidaID: 4, Prioridad: 5, Variedades: []string{"V018"}, Activa: true},
+			},
+			salidaID: 4,
+			razon:    models.RazonRegla,
+			candidatas: []models.RoutingCandidate{
+				{SalidaID: 3, Bloqueo: true},
+				{SalidaID: 4, Disponible: true},
+			},
+		},
+		{
+			nombre: "regla sin salida disponible envía a REJECT",
+			reglas: []models.RoutingRule{
+				{ID: 1, SalidaID: 3, Prioridad: 10, Variedades: []string{"V018"}, Activa: true},
+			},
+			salidaID: 9,
+			razon:    models.RazonSalidasNoDisponibles,
+			candidatas: []models.RoutingCandidate{
+				{SalidaID: 3, Bloqueo: true},
+				{SalidaID: 9, Disponible: true},
+			},
+		},
+		{
+			nombre:     "sin regla que coincida envía a REJECT",
+			reglas:     []models.RoutingRule{{ID: 1, SalidaID: 4, Variedades: []string{"V099"}, Activa: true}},
+			salidaID:   9,
+			razon:      models.RazonSinAsignacion,
+			candidatas: []models.RoutingCandidate{{SalidaID: 9, Disponible: true}},
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t,
+				salidaFixture{id: 3, bloqueo: true},
+				salidaFixture{id: 4},
+				salidaFixture{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			)
+			for i := range caso.reglas {
+				caso.reglas[i].SorterID = s.ID
+			}
+			s.SetRoutingRules(caso.reglas)
+
+			decision := &models.RoutingDecision{}
+			evento := models.LecturaEvent{SKU: "1-LAPINS-X-0", Calibre: "1", Variedad: "V018", Embalaje: "X"}
+			salida := s.determinarSalida(evento, decision)
+
+			if salida.ID != caso.salidaID || decision.Razon != caso.razon {
+				t.Errorf("salida %d (%s), esperado %d (%s)", salida.ID, decision.Razon, caso.salidaID, caso.razon)
+			}
+			if !reflect.DeepEqual(decision.Candidatas, caso.candidatas) {
+				t.Errorf("candidatas = %+v, esperado %+v", decision.Candidatas, caso.candidatas)
+			}
+		})
+	}
+}
+
+func TestDeterminarSalida(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		sku      string
+		salidas  []salidaFixture
+		desborde map[int][]int
+		salidaID int
+		razon    string
+		saltos   []int
+	}{
+		{
+			nombre: "SKU asignado",
+			sku:    "A",
+			salidas: []salidaFixture{
+				{id: 1, skus: []string{"A"}},
+				{id: 2, skus: []string{"A"}},
+				{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			},
+			salidaID: 1,
+			razon:    models.RazonSKUAsignado,
+		},
+		{
+			nombre: "SKU asignado con una salida bloqueada",
+			sku:    "A",
+			salidas: []salidaFixture{
+				{id: 1, skus: []string{"A"}, bloqueo: true},
+				{id: 2, skus: []string{"A"}},
+				{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			},
+			salidaID: 2,
+			razon:    models.RazonSKUAsignado,
+		},
+		{
+			nombre: "desborde por cadena",
+			sku:    "A",
+			salidas: []salidaFixture{
+				{id: 1, skus: []string{"A"}, estado: 2},
+				{id: 2},
+				{id: 3, bloqueo: true},
+				{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			},
+			desborde: map[int][]int{1: {3, 2}},
+			salidaID: 2,
+			razon:    models.RazonDesborde,
+			saltos:   []int{1, 3},
+		},
+		{
+			nombre: "SKU sin asignación",
+			sku:    "B",
+			salidas: []salidaFixture{
+				{id: 1, skus: []string{"A"}},
+				{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			},
+			salidaID: 9,
+			razon:    models.RazonSinAsignacion,
+		},
+		{
+			nombre: "salidas del SKU no disponibles",
+			sku:    "A",
+			salidas: []salidaFixture{
+				{id: 1, skus: []string{"A"}, estado: 2},
+				{id: 2, skus: []string{"A"}, bloqueo: true},
+				{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+			},
+			salidaID: 9,
+			razon:    models.RazonSalidasNoDisponibles,
+		},
+		{
+			nombre: "REJECT no disponible",
+			sku:    "B",
+			salidas: []salidaFixture{
+				{id: 1, skus: []string{"A"}},
+				{id: 9, tipo: "manual", skus: []string{"REJECT"}, bloqueo: true},
+			},
+			salidaID: 0,
+			razon:    models.RazonRejectNoDisponible,
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			s := newTestSorter(t, caso.salidas...)
+			if caso.desborde != nil {
+				s.ConfigureOverflow(caso.desborde)
+			}
+
+			decision := &models.RoutingDecision{}
+			salida := s.determinarSalida(models.LecturaEvent{SKU: caso.sku}, decision)
+
+			if salida.ID != caso.salidaID || decision.Razon != caso.razon {
+				t.Errorf("salida %d (%s), esperado %d (%s)", salida.ID, decision.Razon, caso.salidaID, caso.razon)
+			}
+			if !reflect.DeepEqual(decision.Desborde, caso.saltos) {
+				t.Errorf("desborde = %v, esperado %v", decision.Desborde, caso.saltos)
+			}
+		})
+	}
+}
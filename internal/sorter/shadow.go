@@ -0,0 +1,310 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/listeners"
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Cantidad de divergencias recientes que se mantienen en memoria por sorter
+const shadowDivergenceBuffer = 500
+
+// shadowRouting evalúa una configuración de ruteo candidata en paralelo a la real.
+// Tiene su propio estado de estrategias: nunca modifica el balance real ni envía señales al PLC.
+// Las reglas por atributos y la disponibilidad de salidas son las reales.
+type shadowRouting struct {
+	config        models.ShadowRoutingConfig
+	strategy      RoutingStrategy
+	skuStrategies map[string]RoutingStrategy
+	assignments   map[int]map[string]bool // salidaID → SKUs (nil = asignaciones reales)
+	desde         time.Time
+
+	evaluadas    int64
+	divergencias int64
+	recientes    []models.ShadowDivergence // buffer circular
+	next         int
+	mu           sync.Mutex
+}
+
+// newShadowRoutingStrategy crea una estrategia con estado independiente del ruteo real
+func newShadowRoutingStrategy(name string, s *Sorter, weights map[int]int) (RoutingStrategy, error) {
+	if name == "" || name == StrategyBatchRoundRobin {
+		return newShadowBatchRoundRobinStrategy(s), nil
+	}
+	return NewRoutingStrategy(name, s, weights)
+}
+
+// EnableShadowRouting activa (o reemplaza) el ruteo en sombra con la configuración candidata
+func (s *Sorter) EnableShadowRouting(cfg models.ShadowRoutingConfig) error {
+	weights := cfg.Weights
+	if weights == nil {
+		s.routingMutex.RLock()
+		weights = s.routingWeights
+		s.routingMutex.RUnlock()
+	}
+
+	def, err := newShadowRoutingStrategy(cfg.Strategy, s, weights)
+	if err != nil {
+		return err
+	}
+
+	// Una instancia por nombre, igual que en ConfigureRouting
+	instancias := map[string]RoutingStrategy{def.Name(): def}
+	porSKU := make(map[string]RoutingStrategy, len(cfg.SKUStrategies))
+	for sku, name := range cfg.SKUStrategies {
+		if name == "" {
+			name = StrategyBatchRoundRobin
+		}
+		strategy, ok := instancias[name]
+		if !ok {
+			strategy, err = newShadowRoutingStrategy(name, s, weights)
+			if err != nil {
+				return fmt.Errorf("SKU '%s': %w", sku, err)
+			}
+			instancias[name] = strategy
+		}
+		porSKU[sku] = strategy
+	}
+
+	var assignments map[int]map[string]bool
+	if cfg.Assignments != nil {
+		assignments = make(map[int]map[string]bool, len(cfg.Assignments))
+		for salidaID, skus := range cfg.Assignments {
+			if s.findSalidaByID(salidaID) == nil {
+				return fmt.Errorf("la salida %d no pertenece al sorter #%d", salidaID, s.ID)
+			}
+			assignments[salidaID] = make(map[string]bool, len(skus))
+			for _, sku := range skus {
+				assignments[salidaID][sku] = true
+			}
+		}
+	}
+
+	sh := &shadowRouting{
+		config:        cfg,
+		strategy:      def,
+		skuStrategies: porSKU,
+		assignments:   assignments,
+		desde:         time.Now(),
+		recientes:     make([]models.ShadowDivergence, 0, shadowDivergenceBuffer),
+	}
+
+	s.shadowMutex.Lock()
+	s.shadow = sh
+	s.shadowMutex.Unlock()
+
+	origen := "reales"
+	if assignments != nil {
+		origen = "candidatas"
+	}
+	log.Printf("👥 Sorter #%d: Ruteo en sombra activado (estrategia '%s', %d override(s) por SKU, asignaciones %s)",
+		s.ID, def.Name(), len(porSKU), origen)
+	return nil
+}
+
+// DisableShadowRouting desactiva el ruteo en sombra y descarta sus estadísticas
+func (s *Sorter) DisableShadowRouting() {
+	s.shadowMutex.Lock()
+	activo := s.shadow != nil
+	s.shadow = nil
+	s.shadowMutex.Unlock()
+
+	if activo {
+		log.Printf("👥 Sorter #%d: Ruteo en sombra desactivado", s.ID)
+	}
+}
+
+// GetShadowRoutingStatus retorna la configuración y contadores del ruteo en sombra
+func (s *Sorter) GetShadowRoutingStatus() models.ShadowRoutingStatus {
+	status := models.ShadowRoutingStatus{SorterID: s.ID}
+
+	s.shadowMutex.RLock()
+	sh := s.shadow
+	s.shadowMutex.RUnlock()
+	if sh == nil {
+		return status
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	cfg := sh.config
+	desde := sh.desde
+	status.Enabled = true
+	status.Config = &cfg
+	status.Desde = &desde
+	status.Evaluadas = sh.evaluadas
+	status.Divergencias = sh.divergencias
+	if sh.evaluadas > 0 {
+		status.Porcentaje = float64(sh.divergencias) / float64(sh.evaluadas) * 100
+	}
+	return status
+}
+
+// GetShadowDivergences retorna las divergencias más recientes (la más nueva primero)
+func (s *Sorter) GetShadowDivergences(limit int) []models.ShadowDivergence {
+	s.shadowMutex.RLock()
+	sh := s.shadow
+	s.shadowMutex.RUnlock()
+	if sh == nil {
+		return []models.ShadowDivergence{}
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	total := len(sh.recientes)
+	if limit <= 0 || limit > total {
+		limit = total
+	}
+
+	result := make([]models.ShadowDivergence, 0, limit)
+	for i := 0; i < limit; i++ {
+		// Recorrer hacia atrás desde el último elemento escrito
+		idx := (sh.next - 1 - i + total) % total
+		result = append(result, sh.recientes[idx])
+	}
+	return result
+}
+
+// evaluarRuteoSombra calcula la decisión candidata para la caja y registra si difiere de la real
+func (s *Sorter) evaluarRuteoSombra(evento models.LecturaEvent, live *shared.Salida) {
+	s.shadowMutex.RLock()
+	sh := s.shadow
+	s.shadowMutex.RUnlock()
+	if sh == nil {
+		return
+	}
+
+	shadowSalida := s.decidirSalidaSombra(sh, evento)
+
+	shadowID, shadowNombre := 0, ""
+	if shadowSalida != nil {
+		shadowID, shadowNombre = shadowSalida.ID, shadowSalida.Salida_Sorter
+	}
+
+	sh.mu.Lock()
+	sh.evaluadas++
+	if shadowID == live.ID {
+		sh.mu.Unlock()
+		return
+	}
+
+	divergencia := models.ShadowDivergence{
+		SorterID:       s.ID,
+		Correlativo:    evento.Correlativo,
+		SKU:            evento.SKU,
+		LiveSalidaID:   live.ID,
+		LiveSalida:     live.Salida_Sorter,
+		ShadowSalidaID: shadowID,
+		ShadowSalida:   shadowNombre,
+		Timestamp:      time.Now(),
+	}
+	sh.divergencias++
+	if len(sh.recientes) < shadowDivergenceBuffer {
+		sh.recientes = append(sh.recientes, divergencia)
+		sh.next = len(sh.recientes) % shadowDivergenceBuffer
+	} else {
+		sh.recientes[sh.next] = divergencia
+		sh.next = (sh.next + 1) % shadowDivergenceBuffer
+	}
+	sh.mu.Unlock()
+
+	log.Printf("👥 Sorter #%d: Divergencia en sombra | %s", s.ID, divergencia.String())
+	s.PublishShadowDivergence(divergencia)
+}
+
+// decidirSalidaSombra replica determinarSalida con la estrategia y asignaciones candidatas
+func (s *Sorter) decidirSalidaSombra(sh *shadowRouting, evento models.LecturaEvent) *shared.Salida {
+	sku := evento.SKU
+
+	if candidatas := s.candidatasSombra(sh, sku); len(candidatas) > 0 {
+		if salida := sh.strategyFor(sku).Select(sku, candidatas, s.filtrarCandidatas(candidatas)); salida != nil {
+			return salida
+		}
+		if salida, _ := s.getSalidaPorDesborde(candidatas); salida != nil {
+			return salida
+		}
+	}
+
+	if salida, _, _ := s.seleccionarPorReglas(evento, sh.strategyFor(sku), nil); salida != nil {
+		return salida
+	}
+
+	if salida := s.getSalidaSaturada(s.candidatasSombra(sh, sku)); salida != nil {
+		return salida
+	}
+
+	if candidatas := s.candidatasSombra(sh, "REJECT"); len(candidatas) > 0 {
+		if salida := sh.strategyFor("REJECT").Select("REJECT", candidatas, candidatas); salida != nil {
+			return salida
+		}
+	}
+
+	return nil
+}
+
+// candidatasSombra retorna las salidas que tienen el SKU según las asignaciones en sombra (o reales)
+func (s *Sorter) candidatasSombra(sh *shadowRouting, sku string) []*shared.Salida {
+	var candidatas []*shared.Salida
+	for i := range s.Salidas {
+		salida := &s.Salidas[i]
+		if sh.assignments != nil {
+			if sh.assignments[salida.ID][sku] {
+				candidatas = append(candidatas, salida)
+			}
+			continue
+		}
+		for _, skuConfig := range salida.SKUs_Actuales {
+			if skuConfig.SKU == sku {
+				candidatas = append(candidatas, salida)
+				break
+			}
+		}
+	}
+	return candidatas
+}
+
+// strategyFor retorna la estrategia en sombra aplicable al SKU
+func (sh *shadowRouting) strategyFor(sku string) RoutingStrategy {
+	if strategy, ok := sh.skuStrategies[sku]; ok {
+		return strategy
+	}
+	return sh.strategy
+}
+
+// PublishShadowDivergence publica una divergencia del ruteo en sombra al WebSocket
+func (s *Sorter) PublishShadowDivergence(divergencia models.ShadowDivergence) {
+	if s.wsHub == nil {
+		return
+	}
+
+	message := map[string]interface{}{
+		"type":             "shadow_divergence",
+		"sorter_id":        s.ID,
+		"correlativo":      divergencia.Correlativo,
+		"sku":              divergencia.SKU,
+		"live_salida_id":   divergencia.LiveSalidaID,
+		"live_salida":      divergencia.LiveSalida,
+		"shadow_salida_id": divergencia.ShadowSalidaID,
+		"shadow_salida":    divergencia.ShadowSalida,
+		"timestamp":        divergencia.Timestamp.Format(time.RFC3339),
+	}
+
+	jsonBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("❌ Error al serializar shadow_divergence: %v", err)
+		return
+	}
+
+	roomName := fmt.Sprintf("assignment_%d", s.ID)
+	s.wsHub.Broadcast <- &listeners.BroadcastMessage{
+		RoomName: roomName,
+		Message:  jsonBytes,
+	}
+}
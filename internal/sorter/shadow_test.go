@@ -0,0 +1,139 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"fmt"
+	"testing"
+)
+
+func TestRuteoSombraNoModificaBalanceReal(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 2, skus: []string{"A"}},
+	)
+	if err := s.EnableShadowRouting(models.ShadowRoutingConfig{}); err != nil {
+		t.Fatalf("EnableShadowRouting: %v", err)
+	}
+
+	// Solo la sombra evalúa: el balance real no debe existir ni quedar pendiente de persistir
+	live := s.findSalidaByID(1)
+	for i := 0; i < 3; i++ {
+		s.evaluarRuteoSombra(models.LecturaEvent{SKU: "A"}, live)
+	}
+	s.batchMutex.RLock()
+	pendientes := len(s.batchDirty)
+	s.batchMutex.RUnlock()
+	if len(s.GetBatchStates()) != 0 || pendientes != 0 {
+		t.Fatalf("la sombra modificó el balance real: %+v", s.GetBatchStates())
+	}
+
+	// Ruteo real y en sombra con la misma configuración avanzan igual y no divergen
+	if err := s.EnableShadowRouting(models.ShadowRoutingConfig{}); err != nil {
+		t.Fatalf("EnableShadowRouting: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		evento := models.LecturaEvent{SKU: "A", Correlativo: fmt.Sprintf("c%d", i)}
+		salida := s.determinarSalida(evento, &models.RoutingDecision{})
+		s.evaluarRuteoSombra(evento, &salida)
+	}
+	if status := s.GetShadowRoutingStatus(); status.Evaluadas != 4 || status.Divergencias != 0 {
+		t.Errorf("estado = %d evaluadas, %d divergencias; esperado 4 y 0", status.Evaluadas, status.Divergencias)
+	}
+}
+
+func TestRuteoSombraAsignacionesCandidatas(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 2, skus: []string{"A"}},
+		salidaFixture{id: 9, tipo: "manual", skus: []string{"REJECT"}},
+	)
+	cfg := models.ShadowRoutingConfig{Assignments: map[int][]string{2: {"A"}, 9: {"REJECT"}}}
+	if err := s.EnableShadowRouting(cfg); err != nil {
+		t.Fatalf("EnableShadowRouting: %v", err)
+	}
+
+	// Real: 1, 2, 1; sombra: siempre 2
+	for i := 1; i <= 3; i++ {
+		evento := models.LecturaEvent{SKU: "A", Correlativo: fmt.Sprintf("c%d", i)}
+		salida := s.determinarSalida(evento, &models.RoutingDecision{})
+		s.evaluarRuteoSombra(evento, &salida)
+	}
+	// SKU sin asignación candidata: la sombra lo envía a su REJECT
+	s.evaluarRuteoSombra(models.LecturaEvent{SKU: "B", Correlativo: "c4"}, s.findSalidaByID(1))
+
+	status := s.GetShadowRoutingStatus()
+	if !status.Enabled || status.Evaluadas != 4 || status.Divergencias != 3 || status.Porcentaje != 75 {
+		t.Fatalf("estado = %+v, esperado 4 evaluadas y 3 divergencias", status)
+	}
+
+	divergencias := s.GetShadowDivergences(0)
+	esperadas := []struct {
+		correlativo  string
+		live, shadow int
+	}{{"c4", 1, 9}, {"c3", 1, 2}, {"c1", 1, 2}}
+	if len(divergencias) != len(esperadas) {
+		t.Fatalf("%d divergencias, esperado %d", len(divergencias), len(esperadas))
+	}
+	for i, e := range esperadas {
+		d := divergencias[i]
+		if d.Correlativo != e.correlativo || d.LiveSalidaID != e.live || d.ShadowSalidaID != e.shadow {
+			t.Errorf("divergencia %d = %s (%d → %d), esperado %s (%d → %d)",
+				i, d.Correlativo, d.LiveSalidaID, d.ShadowSalidaID, e.correlativo, e.live, e.shadow)
+		}
+	}
+
+	s.DisableShadowRouting()
+	if status := s.GetShadowRoutingStatus(); status.Enabled || len(s.GetShadowDivergences(0)) != 0 {
+		t.Errorf("sombra sigue activa tras desactivarla: %+v", status)
+	}
+}
+
+func TestRuteoSombraBufferCircular(t *testing.T) {
+	s := newTestSorter(t,
+		salidaFixture{id: 1, skus: []string{"A"}},
+		salidaFixture{id: 2},
+	)
+	if err := s.EnableShadowRouting(models.ShadowRoutingConfig{Assignments: map[int][]string{2: {"A"}}}); err != nil {
+		t.Fatalf("EnableShadowRouting: %v", err)
+	}
+
+	total := shadowDivergenceBuffer + 2
+	for i := 0; i < total; i++ {
+		s.evaluarRuteoSombra(models.LecturaEvent{SKU: "A", Correlativo: fmt.Sprintf("c%d", i)}, s.findSalidaByID(1))
+	}
+
+	divergencias := s.GetShadowDivergences(0)
+	if len(divergencias) != shadowDivergenceBuffer {
+		t.Fatalf("%d divergencias en memoria, esperado %d", len(divergencias), shadowDivergenceBuffer)
+	}
+	primera, ultima := divergencias[0].Correlativo, divergencias[len(divergencias)-1].Correlativo
+	if primera != fmt.Sprintf("c%d", total-1) || ultima != "c2" {
+		t.Errorf("divergencias de %s a %s, esperado de c%d a c2", primera, ultima, total-1)
+	}
+	if limitadas := s.GetShadowDivergences(3); len(limitadas) != 3 || limitadas[0].Correlativo != primera {
+		t.Errorf("GetShadowDivergences(3) = %d divergencias", len(limitadas))
+	}
+}
+
+func TestEnableShadowRoutingInvalida(t *testing.T) {
+	s := newTestSorter(t, salidaFixture{id: 1, skus: []string{"A"}})
+
+	casos := []struct {
+		nombre string
+		cfg    models.ShadowRoutingConfig
+	}{
+		{"estrategia desconocida", models.ShadowRoutingConfig{Strategy: "aleatoria"}},
+		{"estrategia por SKU desconocida", models.ShadowRoutingConfig{SKUStrategies: map[string]string{"A": "aleatoria"}}},
+		{"salida de otro sorter", models.ShadowRoutingConfig{Assignments: map[int][]string{7: {"A"}}}},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if err := s.EnableShadowRouting(caso.cfg); err == nil {
+				t.Error("configuración aceptada")
+			}
+			if s.GetShadowRoutingStatus().Enabled {
+				t.Error("sombra activada con configuración inválida")
+			}
+		})
+	}
+}
@@ -26,12 +26,14 @@ func (s *Sorter) UpdateSKUs(skus []models.SKUAssignable) {
 
 	s.assignedSKUs = skus
 
-	// SOLO limpiar BatchDistributors si los SKUs realmente cambiaron
+	// SOLO reiniciar el estado de ruteo si los SKUs realmente cambiaron.
+	// El balance por batch se conserva (persistido) para SKUs que siguen activos.
 	if skusChanged {
-		s.batchMutex.Lock()
-		s.batchCounters = make(map[string]*BatchDistributor)
-		s.batchMutex.Unlock()
-		log.Printf("📦 Sorter #%d: SKUs actualizados (%d SKUs) - Balance reiniciado", s.ID, len(skus))
+		if len(skus) > 0 {
+			s.pruneBatchCounters(skus)
+		}
+		s.resetRoutingStrategies()
+		log.Printf("📦 Sorter #%d: SKUs actualizados (%d SKUs) - Estado de ruteo actualizado", s.ID, len(skus))
 	}
 
 	// SIEMPRE publicar al canal para WebSocket (aunque no cambien)
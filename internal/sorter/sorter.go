@@ -1,7 +1,9 @@
 package sorter
 
 import (
+	"API-GREENEX/internal/communication/pallet"
 	"API-GREENEX/internal/communication/plc"
+	"API-GREENEX/internal/journal"
 	"API-GREENEX/internal/listeners"
 	"API-GREENEX/internal/models"
 	"API-GREENEX/internal/shared"
@@ -9,6 +11,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 )
 
 // Sorter representa un sistema sorter con sus salidas y configuración
@@ -41,10 +44,59 @@ type Sorter struct {
 	flowMutex      sync.RWMutex
 
 	batchCounters map[string]*BatchDistributor
+	batchDirty    map[string]bool // SKUs con balance pendiente de persistir
+	batchDeleted  map[string]bool // SKUs con balance pendiente de eliminar en BD
 	batchMutex    sync.RWMutex
 
-	wsHub     *listeners.WebSocketHub
-	dbManager interface{}
+	routingStrategy RoutingStrategy            // Estrategia de ruteo por defecto del sorter
+	skuStrategies   map[string]RoutingStrategy // Estrategias específicas por SKU (opcional)
+	routingWeights  map[int]int                // Pesos por salida de la estrategia "weighted"
+	overflowChains  map[int][]int              // Cadenas de desborde por salida (key=salidaID, en orden)
+	routingMutex    sync.RWMutex
+	mesaClient      *pallet.Client // Cliente Serfruit para consultar llenado de mesas (nil = sin paletizado)
+
+	// Ruteo por capacidad (llenado de pallets en mesas automáticas)
+	capacityEnabled      bool
+	capacityPollInterval time.Duration
+	capacityStaleAfter   time.Duration
+	holdBackRemaining    int
+	mesaFills            map[int]models.MesaFill // key=salidaID
+	capacityMutex        sync.RWMutex
+
+	// Ritmo máximo por salida (cajas/minuto)
+	laneRates map[int]*laneRate // key=salidaID
+	rateMutex sync.Mutex
+
+	routingRules []models.RoutingRule // Reglas de ruteo por atributos (ordenadas por prioridad)
+	rulesMutex   sync.RWMutex
+
+	// Tracking de cajas del PLC (confirmación de lecturas duplicadas)
+	boxCounterNode   string
+	boxTracking      string
+	boxTrackingOK    bool
+	boxTrackingMutex sync.RWMutex
+
+	divertConfirm *divertConfirmation // Confirmación física de desvíos por tracking del PLC (nil = desactivada)
+
+	shadow      *shadowRouting // Ruteo en sombra (nil = desactivado)
+	shadowMutex sync.RWMutex
+
+	// Pausa del sorter (las cámaras QR con offline_on_pause se ponen offline)
+	pausado        bool
+	pausaMotivo    string
+	pausaDesde     time.Time
+	camarasOffline bool
+	errorCamaras   string
+	pauseMutex     sync.Mutex
+
+	// Planes de asignación programados
+	turnos         map[string]time.Duration // Inicio de cada turno desde medianoche (key=nombre)
+	planMutex      sync.Mutex
+	planApplyMutex sync.Mutex
+
+	wsHub      *listeners.WebSocketHub
+	dbManager  interface{}
+	boxJournal *journal.BoxJournal // Registro local de salidas sin BD (nil = deshabilitado)
 
 	LecturasExitosas int
 	LecturasFallidas int
@@ -98,7 +150,7 @@ func GetNewSorter(ID int, ubicacion string, plcInputNode string, plcOutputNode s
 	skuChannel := channelMgr.RegisterSorterSKUChannel(sorterID, 10)
 	flowStatsChannel := channelMgr.RegisterSorterFlowStatsChannel(sorterID, 5)
 
-	return &Sorter{
+	s := &Sorter{
 		ID:                  ID,
 		Ubicacion:           ubicacion,
 		PLCInputNode:        plcInputNode,
@@ -119,9 +171,23 @@ func GetNewSorter(ID int, ubicacion string, plcInputNode string, plcOutputNode s
 		lecturaRecords:      make([]models.LecturaRecord, 0, 1000),
 		lastFlowStats:       make(map[string]float64),
 		batchCounters:       make(map[string]*BatchDistributor),
+		batchDirty:          make(map[string]bool),
+		batchDeleted:        make(map[string]bool),
+		skuStrategies:       make(map[string]RoutingStrategy),
+		mesaFills:           make(map[int]models.MesaFill),
+		laneRates:           make(map[int]*laneRate),
 		wsHub:               wsHub,
 		dbManager:           dbManager,
 	}
+
+	if paletHost != "" && paletPort > 0 {
+		s.mesaClient = pallet.NewClient(paletHost, paletPort, time.Second)
+	}
+
+	// Estrategia por defecto: batch round-robin (ConfigureRouting puede reemplazarla)
+	s.routingStrategy = &batchRoundRobinStrategy{sorter: s}
+
+	return s
 }
 
 // Start inicia el sorter
@@ -142,12 +208,34 @@ func (s *Sorter) Start() error {
 	}
 
 	if s.Cognex != nil {
+		s.Cognex.SetDivertHandler(s.desviarPorColaLlena)
 		err := s.Cognex.Start()
 		if err != nil {
 			return err
 		}
 	}
 
+	// Restaurar balance por batch persistido antes de procesar lecturas
+	if s.dbManager != nil {
+		ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+		if err := s.RestoreBatchStates(ctx); err != nil {
+			log.Printf("⚠️  Sorter #%d: No se pudo restaurar el balance desde BD: %v", s.ID, err)
+		}
+		cancel()
+		go s.startBatchStatePersister(2 * time.Second)
+		go s.startAssignmentPlanScheduler(30 * time.Second)
+	}
+
+	// Iniciar monitor de llenado de mesas (ruteo por capacidad / least_filled)
+	if s.needsMesaFill() {
+		go s.startMesaFillPoller()
+	}
+
+	// Publicar ritmo y saturación de salidas con límite configurado
+	if s.hasRateLimits() {
+		go s.startRatePublisher(2 * time.Second)
+	}
+
 	// Iniciar procesamiento de eventos QR/SKU (canal original)
 	go s.procesarEventosCognex()
 
@@ -166,6 +254,11 @@ func (s *Sorter) Start() error {
 		s.startPLCSubscriptions()
 	}
 
+	// Vencer las cajas asignadas que el PLC no confirma físicamente
+	if s.divertConfirm != nil {
+		go s.startDivertTimeoutChecker()
+	}
+
 	log.Printf("✅ Sorter #%d: Iniciado y escuchando eventos (QR/SKU + %d cámaras DataMatrix)", s.ID, len(s.CognexDevices))
 
 	return nil
@@ -178,6 +271,13 @@ func (s *Sorter) Stop() error {
 	s.stopPLCSubscriptions()
 	s.cancel()
 
+	// Guardar el balance pendiente antes de salir
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := s.flushBatchStates(ctx); err != nil {
+		log.Printf("⚠️  Sorter #%d: Error al persistir balance al detener: %v", s.ID, err)
+	}
+	cancel()
+
 	if s.Cognex != nil {
 		return s.Cognex.Stop()
 	}
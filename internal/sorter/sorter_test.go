@@ -0,0 +1,53 @@
+package sorter
+
+import (
+	"API-GREENEX/internal/models"
+	"API-GREENEX/internal/shared"
+	"testing"
+)
+
+// salidaFixture describe una salida en memoria para los tests de ruteo
+type salidaFixture struct {
+	id      int
+	tipo    string // "automatico" (default) o "manual"
+	skus    []string
+	estado  int16
+	bloqueo bool
+}
+
+// testSorterIDs evita compartir los canales globales del ChannelManager entre tests
+var testSorterIDs = 900
+
+// newTestSorter crea un sorter sin PLC, BD ni cámaras con las salidas indicadas (en ese orden)
+func newTestSorter(t *testing.T, fixtures ...salidaFixture) *Sorter {
+	t.Helper()
+	salidas := make([]shared.Salida, len(fixtures))
+	for i, f := range fixtures {
+		salidas[i].ID = f.id
+		salidas[i].Salida_Sorter = f.tipo
+		salidas[i].Tipo = f.tipo
+		if salidas[i].Tipo == "" {
+			salidas[i].Tipo = "automatico"
+		}
+		salidas[i].BatchSize = 1
+		salidas[i].Estado = f.estado
+		salidas[i].Bloqueo = f.bloqueo
+		for _, sku := range f.skus {
+			salidas[i].SKUs_Actuales = append(salidas[i].SKUs_Actuales, models.SKU{SKU: sku})
+		}
+	}
+
+	testSorterIDs++
+	s := GetNewSorter(testSorterIDs, "test", "", "", "", 0, salidas, nil, nil, nil, nil, nil, nil)
+	t.Cleanup(s.cancel)
+	return s
+}
+
+// idsDe retorna los IDs de las salidas en orden
+func idsDe(salidas []*shared.Salida) []int {
+	ids := make([]int, len(salidas))
+	for i, salida := range salidas {
+		ids[i] = salida.ID
+	}
+	return ids
+}